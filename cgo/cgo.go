@@ -144,6 +144,19 @@ typedef long long           _Cgo_longlong;
 typedef unsigned long long  _Cgo_ulonglong;
 `
 
+// RemoveDirectives replaces #cgo directives in the given preamble with empty
+// lines, as they are not valid C. The directives themselves are read by
+// ParseFlags.
+func RemoveDirectives(preamble string) string {
+	lines := strings.Split(preamble, "\n")
+	for i, line := range lines {
+		if isDirective(line) {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // Process extracts `import "C"` statements from the AST, parses the comment
 // with libclang, and modifies the AST to use this information. It returns a
 // newly created *ast.File that should be added to the list of to-be-parsed
@@ -225,7 +238,7 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 			if path != "C" {
 				continue
 			}
-			cgoComment := genDecl.Doc.Text()
+			cgoComment := RemoveDirectives(genDecl.Doc.Text())
 
 			pos := genDecl.Pos()
 			if genDecl.Doc != nil {
@@ -0,0 +1,285 @@
+package cgo
+
+// This file parses #cgo directives in the preamble of `import "C"`
+// declarations, following the grammar documented by cmd/cgo:
+//
+//     #cgo [qualifiers...] VERB: arguments...
+//
+// Qualifiers are build constraints like `linux,arm` or `!windows`. The
+// directive only applies when one of the qualifiers matches the target.
+
+import (
+	"go/ast"
+	"go/build"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Flags holds the flags of all #cgo directives of a package that apply to the
+// target, in the order in which they appear: files are read in the given
+// order, and directives in a file from top to bottom.
+type Flags struct {
+	CFLAGS    []string
+	CPPFLAGS  []string
+	CXXFLAGS  []string
+	FFLAGS    []string
+	LDFLAGS   []string
+	PkgConfig []string // package names from #cgo pkg-config directives
+}
+
+// CompileFlags returns the flags to pass to the C compiler for this package,
+// with the C flags from pkg-config (if any) between the preprocessor flags and
+// the C flags like the go tool does.
+func (f *Flags) CompileFlags(pkgConfigFlags []string) []string {
+	flags := append([]string{}, f.CPPFLAGS...)
+	flags = append(flags, pkgConfigFlags...)
+	return append(flags, f.CFLAGS...)
+}
+
+// LinkFlags returns the flags to pass to the linker for this package, followed
+// by the linker flags from pkg-config (if any).
+func (f *Flags) LinkFlags(pkgConfigFlags []string) []string {
+	flags := append([]string{}, f.LDFLAGS...)
+	return append(flags, pkgConfigFlags...)
+}
+
+// ParseFlags reads the #cgo directives of the given files that apply to the
+// target described by ctx. The string ${SRCDIR} in arguments is replaced with
+// srcDir, the directory of the package, which is also used to make relative
+// -I and -L paths absolute. Flags that are not allowed (see checkFlags) are
+// reported as errors.
+func ParseFlags(fset *token.FileSet, files []*ast.File, srcDir string, ctx *build.Context) (*Flags, []error) {
+	flags := &Flags{}
+	var errs []error
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.IMPORT || genDecl.Doc == nil || len(genDecl.Specs) != 1 {
+				continue
+			}
+			spec, ok := genDecl.Specs[0].(*ast.ImportSpec)
+			if !ok {
+				continue
+			}
+			if path, err := strconv.Unquote(spec.Path.Value); err != nil || path != "C" {
+				continue
+			}
+			for _, comment := range genDecl.Doc.List {
+				pos := fset.Position(comment.Slash)
+				var lines []string
+				if strings.HasPrefix(comment.Text, "//") {
+					lines = []string{comment.Text[2:]}
+				} else {
+					lines = strings.Split(strings.TrimSuffix(comment.Text[2:], "*/"), "\n")
+				}
+				for i, line := range lines {
+					linePos := pos
+					linePos.Line += i
+					if i != 0 {
+						linePos.Column = 1
+					}
+					if err := flags.parseDirective(line, srcDir, ctx); err != nil {
+						errs = append(errs, scanner.Error{
+							Pos: linePos,
+							Msg: err.Error(),
+						})
+					}
+				}
+			}
+		}
+	}
+	return flags, errs
+}
+
+// isDirective returns whether the given line of a preamble is a #cgo
+// directive, which may be separated from the rest of the line by a space or a
+// tab.
+func isDirective(line string) bool {
+	line = strings.TrimSpace(line)
+	return len(line) > 4 && line[:4] == "#cgo" && (line[4] == ' ' || line[4] == '\t')
+}
+
+// parseDirective parses a single line of a preamble and adds the flags to f if
+// it is a #cgo directive that applies to the target.
+func (f *Flags) parseDirective(line, srcDir string, ctx *build.Context) error {
+	if !isDirective(line) {
+		return nil
+	}
+	line = strings.TrimSpace(line)
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return &flagError{"invalid #cgo line: " + line}
+	}
+	fields := strings.Fields(line[4:colon])
+	if len(fields) == 0 {
+		return &flagError{"invalid #cgo line: " + line}
+	}
+	qualifiers, verb := fields[:len(fields)-1], fields[len(fields)-1]
+	if len(qualifiers) != 0 {
+		match := false
+		for _, qualifier := range qualifiers {
+			if matchQualifier(ctx, qualifier) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return nil
+		}
+	}
+
+	args, err := splitFlags(line[colon+1:])
+	if err != nil {
+		return &flagError{"invalid #cgo line: " + line + ": " + err.Error()}
+	}
+	for i, arg := range args {
+		// The argument has already been split, so a directory with spaces or
+		// quotes in it stays a single flag.
+		args[i] = strings.Replace(arg, "${SRCDIR}", srcDir, -1)
+	}
+
+	switch verb {
+	case "CFLAGS", "CPPFLAGS", "CXXFLAGS", "FFLAGS":
+		makePathsAbsolute(args, srcDir)
+		if err := checkCompilerFlags(verb, "#cgo "+verb, args); err != nil {
+			return err
+		}
+	case "LDFLAGS":
+		makePathsAbsolute(args, srcDir)
+		if err := checkLinkerFlags(verb, "#cgo "+verb, args); err != nil {
+			return err
+		}
+	case "pkg-config":
+		for _, arg := range args {
+			if arg == "" || strings.HasPrefix(arg, "-") || strings.ContainsAny(arg, "@ \t") {
+				return &flagError{"invalid pkg-config package name: " + arg}
+			}
+		}
+	default:
+		return &flagError{"invalid #cgo verb: " + line}
+	}
+
+	switch verb {
+	case "CFLAGS":
+		f.CFLAGS = append(f.CFLAGS, args...)
+	case "CPPFLAGS":
+		f.CPPFLAGS = append(f.CPPFLAGS, args...)
+	case "CXXFLAGS":
+		f.CXXFLAGS = append(f.CXXFLAGS, args...)
+	case "FFLAGS":
+		f.FFLAGS = append(f.FFLAGS, args...)
+	case "LDFLAGS":
+		f.LDFLAGS = append(f.LDFLAGS, args...)
+	case "pkg-config":
+		f.PkgConfig = append(f.PkgConfig, args...)
+	}
+	return nil
+}
+
+// flagError is an error in a #cgo directive.
+type flagError struct {
+	msg string
+}
+
+func (e *flagError) Error() string {
+	return e.msg
+}
+
+// matchQualifier returns whether a qualifier of a #cgo directive matches the
+// target. A qualifier is a list of terms separated by commas that must all
+// match, where each term may be negated with a "!".
+func matchQualifier(ctx *build.Context, qualifier string) bool {
+	for _, term := range strings.Split(qualifier, ",") {
+		if !matchTerm(ctx, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTerm returns whether a single (possibly negated) build tag matches the
+// target, the same way as for build constraints.
+func matchTerm(ctx *build.Context, term string) bool {
+	if strings.HasPrefix(term, "!") {
+		term = term[1:]
+		return isValidTag(term) && !matchTag(ctx, term)
+	}
+	return isValidTag(term) && matchTag(ctx, term)
+}
+
+// isValidTag returns whether name is a valid build tag: letters, digits,
+// underscores and dots only.
+func isValidTag(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// unixOS lists the values of GOOS that match the "unix" build tag.
+var unixOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"linux":     true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"solaris":   true,
+}
+
+// matchTag returns whether the build tag is set for the target.
+func matchTag(ctx *build.Context, name string) bool {
+	switch {
+	case name == "cgo":
+		return ctx.CgoEnabled
+	case name == ctx.GOOS || name == ctx.GOARCH || name == ctx.Compiler:
+		return true
+	case name == "linux" && ctx.GOOS == "android",
+		name == "solaris" && ctx.GOOS == "illumos",
+		name == "darwin" && ctx.GOOS == "ios":
+		return true
+	case name == "unix":
+		return unixOS[ctx.GOOS]
+	}
+	for _, tags := range [][]string{ctx.BuildTags, ctx.ReleaseTags} {
+		for _, tag := range tags {
+			if tag == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// makePathsAbsolute makes relative paths of -I and -L flags absolute, relative
+// to srcDir, as the compiler and linker are not run in the package directory.
+func makePathsAbsolute(args []string, srcDir string) {
+	nextPath := false
+	for i, arg := range args {
+		if nextPath {
+			if !filepath.IsAbs(arg) {
+				args[i] = filepath.Join(srcDir, arg)
+			}
+			nextPath = false
+		} else if strings.HasPrefix(arg, "-I") || strings.HasPrefix(arg, "-L") {
+			if len(arg) == 2 {
+				nextPath = true
+			} else if !filepath.IsAbs(arg[2:]) {
+				args[i] = arg[:2] + filepath.Join(srcDir, arg[2:])
+			}
+		}
+	}
+}
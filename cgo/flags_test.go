@@ -0,0 +1,180 @@
+package cgo
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+)
+
+// parseFlags parses the given sources as files of a package in srcDir and
+// returns the flags of their #cgo directives for the given target.
+func parseFlags(t *testing.T, srcDir string, ctx *build.Context, sources ...string) (*Flags, []error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for i, src := range sources {
+		f, err := parser.ParseFile(fset, "file"+string(rune('a'+i))+".go", src, parser.ParseComments)
+		if err != nil {
+			t.Fatal("could not parse:", err)
+		}
+		files = append(files, f)
+	}
+	return ParseFlags(fset, files, srcDir, ctx)
+}
+
+func TestParseFlagsQualifiers(t *testing.T) {
+	const src = `package main
+
+// #cgo CFLAGS: -DALL
+// #cgo linux CFLAGS: -DLINUX
+// #cgo linux,arm CFLAGS: -DLINUX_ARM
+// #cgo !linux CFLAGS: -DNOT_LINUX
+// #cgo darwin windows CFLAGS: -DDARWIN_OR_WINDOWS
+// #cgo unix,!cgo CFLAGS: -DUNIX_NOCGO
+// #cgo tinygo,baremetal LDFLAGS: -lbaremetal
+// #cgo !!linux CFLAGS: -DINVALID
+import "C"
+`
+	for _, tc := range []struct {
+		goos, goarch string
+		cgo          bool
+		tags         []string
+		cflags       string
+		ldflags      string
+	}{
+		{"linux", "amd64", true, nil, "-DALL -DLINUX", ""},
+		{"linux", "arm", true, nil, "-DALL -DLINUX -DLINUX_ARM", ""},
+		{"android", "arm", true, nil, "-DALL -DLINUX -DLINUX_ARM", ""},
+		{"linux", "arm", false, nil, "-DALL -DLINUX -DLINUX_ARM -DUNIX_NOCGO", ""},
+		{"darwin", "amd64", true, nil, "-DALL -DNOT_LINUX -DDARWIN_OR_WINDOWS", ""},
+		{"windows", "386", false, nil, "-DALL -DNOT_LINUX -DDARWIN_OR_WINDOWS", ""},
+		{"js", "wasm", true, []string{"tinygo"}, "-DALL -DNOT_LINUX", ""},
+		{"linux", "arm", true, []string{"tinygo", "baremetal"}, "-DALL -DLINUX -DLINUX_ARM", "-lbaremetal"},
+	} {
+		ctx := &build.Context{
+			GOOS:       tc.goos,
+			GOARCH:     tc.goarch,
+			CgoEnabled: tc.cgo,
+			Compiler:   "gc",
+			BuildTags:  tc.tags,
+		}
+		flags, errs := parseFlags(t, "/src", ctx, src)
+		if errs != nil {
+			t.Errorf("%s/%s: unexpected errors: %v", tc.goos, tc.goarch, errs)
+			continue
+		}
+		if s := strings.Join(flags.CFLAGS, " "); s != tc.cflags {
+			t.Errorf("%s/%s cgo=%v tags=%v: expected CFLAGS %q, got %q", tc.goos, tc.goarch, tc.cgo, tc.tags, tc.cflags, s)
+		}
+		if s := strings.Join(flags.LDFLAGS, " "); s != tc.ldflags {
+			t.Errorf("%s/%s cgo=%v tags=%v: expected LDFLAGS %q, got %q", tc.goos, tc.goarch, tc.cgo, tc.tags, tc.ldflags, s)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	ctx := &build.Context{GOOS: "linux", GOARCH: "arm", CgoEnabled: true, Compiler: "gc"}
+
+	// Directives of multiple files, in both comment styles, with ${SRCDIR}
+	// expanded after splitting so that a directory with a space stays a
+	// single flag.
+	flags, errs := parseFlags(t, "/src/my dir", ctx, `package main
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/include "-DNAME=\"a b\""
+#cgo LDFLAGS: -L lib -lfoo
+#cgo pkg-config: foo bar
+#include <foo.h>
+*/
+import "C"
+`, `package main
+
+// #cgo CPPFLAGS: -Iinclude2 -DSECOND
+// #cgo	LDFLAGS: ${SRCDIR}/libbar.a
+// #cgo pkg-config: baz
+import "C"
+`)
+	if errs != nil {
+		t.Fatal("unexpected errors:", errs)
+	}
+	for _, tc := range []struct {
+		name     string
+		flags    []string
+		expected string
+	}{
+		{"CFLAGS", flags.CFLAGS, `-I/src/my dir/include|-DNAME="a b"`},
+		{"CPPFLAGS", flags.CPPFLAGS, `-I/src/my dir/include2|-DSECOND`},
+		{"LDFLAGS", flags.LDFLAGS, `-L|/src/my dir/lib|-lfoo|/src/my dir/libbar.a`},
+		{"pkg-config", flags.PkgConfig, `foo|bar|baz`},
+		{"compile", flags.CompileFlags([]string{"-DPKGCONFIG"}), `-I/src/my dir/include2|-DSECOND|-DPKGCONFIG|-I/src/my dir/include|-DNAME="a b"`},
+		{"link", flags.LinkFlags([]string{"-lpkgconfig"}), `-L|/src/my dir/lib|-lfoo|/src/my dir/libbar.a|-lpkgconfig`},
+	} {
+		if s := strings.Join(tc.flags, "|"); s != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, s)
+		}
+	}
+}
+
+// TestRemoveDirectives checks that exactly the lines that are parsed as #cgo
+// directives are removed from a preamble, including ones that use a tab.
+func TestRemoveDirectives(t *testing.T) {
+	preamble := "#cgo CFLAGS: -DA\n #cgo\tLDFLAGS: -lb\n#cgoCFLAGS: -DC\n#include <stdio.h>\n"
+	expected := "\n\n#cgoCFLAGS: -DC\n#include <stdio.h>\n"
+	if s := RemoveDirectives(preamble); s != expected {
+		t.Errorf("expected preamble %q, got %q", expected, s)
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	ctx := &build.Context{GOOS: "linux", GOARCH: "arm", CgoEnabled: true, Compiler: "gc"}
+	_, errs := parseFlags(t, "/src", ctx, `package main
+
+// #cgo CFLAGS: -fplugin=evil.so
+// #cgo LDFLAGS: -Wl,--wrap=main
+// #cgo LDFLAGS: -L
+// #cgo CFLAGS: "-DFOO
+// #cgo FOOFLAGS: -DFOO
+// #cgo CFLAGS -DFOO
+// #cgo pkg-config: --static
+// #cgo windows CFLAGS: -fplugin=ignored.so
+import "C"
+`)
+	expected := []string{
+		"filea.go:3:1: invalid flag in #cgo CFLAGS: -fplugin=evil.so",
+		"filea.go:4:1: invalid flag in #cgo LDFLAGS: -Wl,--wrap=main",
+		"filea.go:5:1: invalid flag in #cgo LDFLAGS: -L without argument",
+		`filea.go:6:1: invalid #cgo line: #cgo CFLAGS: "-DFOO: unterminated quoted string`,
+		"filea.go:7:1: invalid #cgo verb: #cgo FOOFLAGS: -DFOO",
+		"filea.go:8:1: invalid #cgo line: #cgo CFLAGS -DFOO",
+		"filea.go:9:1: invalid pkg-config package name: --static",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error:\n%s\ngot:\n%s", expected[i], err)
+		}
+	}
+
+	// Flags can be allowed and rejected with environment variables.
+	defer os.Setenv("CGO_CFLAGS_ALLOW", os.Getenv("CGO_CFLAGS_ALLOW"))
+	defer os.Setenv("CGO_CFLAGS_DISALLOW", os.Getenv("CGO_CFLAGS_DISALLOW"))
+	os.Setenv("CGO_CFLAGS_ALLOW", "-fplugin=.*")
+	os.Setenv("CGO_CFLAGS_DISALLOW", "-O3")
+	flags, errs := parseFlags(t, "/src", ctx, `package main
+
+// #cgo CFLAGS: -fplugin=allowed.so -O2
+// #cgo CFLAGS: -O3
+import "C"
+`)
+	if len(errs) != 1 || errs[0].Error() != "filea.go:4:1: invalid flag in #cgo CFLAGS: -O3" {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if s := strings.Join(flags.CFLAGS, " "); s != "-fplugin=allowed.so -O2" {
+		t.Errorf("unexpected CFLAGS: %s", s)
+	}
+}
@@ -0,0 +1,156 @@
+package cgo
+
+// This file implements the #cgo pkg-config directive, by running pkg-config
+// for the C compiler and linker flags of a list of packages.
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// PkgConfigError is returned by PkgConfig when pkg-config can't find a
+// package, which means there is no .pc file for it in the search path.
+type PkgConfigError struct {
+	Package string
+	Output  string // output of pkg-config, may be empty
+}
+
+func (e *PkgConfigError) Error() string {
+	msg := "pkg-config: package " + e.Package + " not found: no " + e.Package + ".pc file in the pkg-config search path (PKG_CONFIG_PATH=" + os.Getenv("PKG_CONFIG_PATH") + ")"
+	if e.Output != "" {
+		msg += "\n" + e.Output
+	}
+	return msg
+}
+
+// pkgConfigCommand returns the pkg-config command to run, which can be
+// overridden with the PKG_CONFIG environment variable like with the go tool.
+func pkgConfigCommand() string {
+	if cmd := os.Getenv("PKG_CONFIG"); cmd != "" {
+		return cmd
+	}
+	return "pkg-config"
+}
+
+// PkgConfig runs pkg-config for the given packages (as listed in #cgo
+// pkg-config directives) and returns the flags for the C compiler and for the
+// linker, without duplicates. Packages are searched for in PKG_CONFIG_PATH and
+// the default search path of pkg-config.
+func PkgConfig(pkgs []string) (cflags, ldflags []string, err error) {
+	pkgs = appendFlags(nil, pkgs...)
+	if len(pkgs) == 0 {
+		return nil, nil, nil
+	}
+	for _, pkg := range pkgs {
+		if strings.HasPrefix(pkg, "-") {
+			// Don't pass options to pkg-config, like the go tool.
+			return nil, nil, errors.New("pkg-config: invalid package name: " + pkg)
+		}
+	}
+	cflagsOut, err := runPkgConfig("--cflags", pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	ldflagsOut, err := runPkgConfig("--libs", pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	cflags, err = splitFlags(cflagsOut)
+	if err != nil {
+		return nil, nil, errors.New("pkg-config --cflags: " + err.Error() + ": " + strings.TrimSpace(cflagsOut))
+	}
+	ldflags, err = splitFlags(ldflagsOut)
+	if err != nil {
+		return nil, nil, errors.New("pkg-config --libs: " + err.Error() + ": " + strings.TrimSpace(ldflagsOut))
+	}
+	// Flags from pkg-config are checked like flags in #cgo directives, as
+	// .pc files may come with the package that uses them.
+	if err := checkCompilerFlags("CFLAGS", "pkg-config --cflags", cflags); err != nil {
+		return nil, nil, err
+	}
+	if err := checkLinkerFlags("LDFLAGS", "pkg-config --libs", ldflags); err != nil {
+		return nil, nil, err
+	}
+	return appendFlags(nil, cflags...), appendFlags(nil, ldflags...), nil
+}
+
+// runPkgConfig runs pkg-config with the given option for the given packages
+// and returns its output. When pkg-config fails, it finds out which package
+// is missing to return a more helpful error.
+func runPkgConfig(option string, pkgs []string) (string, error) {
+	cmd := exec.Command(pkgConfigCommand(), append([]string{option, "--"}, pkgs...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stderr.String())
+		for _, pkg := range pkgs {
+			if exec.Command(pkgConfigCommand(), "--exists", "--", pkg).Run() != nil {
+				return "", &PkgConfigError{Package: pkg, Output: output}
+			}
+		}
+		if output == "" {
+			output = err.Error()
+		}
+		return "", errors.New("pkg-config " + option + " " + strings.Join(pkgs, " ") + ": " + output)
+	}
+	return stdout.String(), nil
+}
+
+// splitFlags splits the output of pkg-config or the arguments of a #cgo
+// directive in separate flags. Flags may be quoted or contain spaces escaped
+// with a backslash.
+func splitFlags(s string) ([]string, error) {
+	var flags []string
+	var flag strings.Builder
+	inFlag := false
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+			inFlag = true
+		case c == '\\' && quote != '\'' && i+1 < len(s):
+			i++
+			flag.WriteByte(s[i])
+			inFlag = true
+		case quote == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			if inFlag {
+				flags = append(flags, flag.String())
+				flag.Reset()
+				inFlag = false
+			}
+		default:
+			flag.WriteByte(c)
+			inFlag = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if inFlag {
+		flags = append(flags, flag.String())
+	}
+	return flags, nil
+}
+
+// appendFlags appends the given flags to the list of flags, skipping flags
+// that are already in the list.
+func appendFlags(list []string, flags ...string) []string {
+outer:
+	for _, flag := range flags {
+		for _, existing := range list {
+			if existing == flag {
+				continue outer
+			}
+		}
+		list = append(list, flag)
+	}
+	return list
+}
@@ -0,0 +1,75 @@
+package cgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakePkgConfig is a pkg-config replacement that knows about the packages foo
+// and bar.
+const fakePkgConfig = `#!/bin/sh
+option=$1
+shift
+[ "$1" = "--" ] && shift
+for pkg in "$@"; do
+	case $pkg in
+	foo|bar) ;;
+	*)
+		[ "$option" = "--exists" ] || echo "Package $pkg was not found in the pkg-config search path." >&2
+		exit 1;;
+	esac
+done
+for pkg in "$@"; do
+	case $option in
+	--cflags) printf '%s ' "-I/opt/$pkg/include" "-I/opt/with\\ space" -DCOMMON;;
+	--libs) printf '%s ' -L/opt/lib "-l$pkg";;
+	esac
+done
+echo
+`
+
+// TestPkgConfig checks that the flags of all packages are returned without
+// duplicates, and that a missing package is reported by name.
+func TestPkgConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pkg-config is a shell script")
+	}
+	tmpdir, err := ioutil.TempDir("", "tinygo-cgo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	script := filepath.Join(tmpdir, "pkg-config")
+	if err := ioutil.WriteFile(script, []byte(fakePkgConfig), 0777); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PKG_CONFIG", os.Getenv("PKG_CONFIG"))
+	os.Setenv("PKG_CONFIG", script)
+
+	cflags, ldflags, err := PkgConfig([]string{"foo", "bar", "foo"})
+	if err != nil {
+		t.Fatal("pkg-config failed:", err)
+	}
+	if s := strings.Join(cflags, "|"); s != "-I/opt/foo/include|-I/opt/with space|-DCOMMON|-I/opt/bar/include" {
+		t.Errorf("unexpected cflags: %s", s)
+	}
+	if s := strings.Join(ldflags, "|"); s != "-L/opt/lib|-lfoo|-lbar" {
+		t.Errorf("unexpected ldflags: %s", s)
+	}
+
+	_, _, err = PkgConfig([]string{"foo", "baz"})
+	if pkgErr, ok := err.(*PkgConfigError); !ok || pkgErr.Package != "baz" {
+		t.Fatalf("expected a *PkgConfigError for baz, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "no baz.pc file") || !strings.Contains(err.Error(), "Package baz was not found") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	if _, _, err := PkgConfig([]string{"--static"}); err == nil {
+		t.Error("expected an error for an option passed as package name")
+	}
+}
@@ -58,6 +58,8 @@ type Config struct {
 	CFlags        []string // cflags to pass to cgo
 	LDFlags       []string // ldflags to pass to cgo
 	ClangHeaders  string   // Clang built-in header include path
+	CgoEnabled    bool     // whether cgo is supported (sets the cgo build tag)
+	CgoDir        string   // directory to write generated cgo files to, if set
 	DumpSSA       bool     // dump Go SSA, for compiler debugging
 	VerifyIR      bool     // run extra checks on the IR
 	Debug         bool     // add debug symbols for gdb
@@ -66,6 +68,9 @@ type Config struct {
 	GOPATH        string   // GOPATH, like `go env GOPATH`
 	BuildTags     []string // build tags for TinyGo (empty means {Config.GOOS/Config.GOARCH})
 	TestConfig    TestConfig
+
+	// Packages loaded by previous builds, may be nil.
+	PackageCache *loader.Cache
 }
 
 type TestConfig struct {
@@ -224,7 +229,7 @@ func (c *Compiler) Compile(mainPath string) []error {
 			GOOS:        c.GOOS,
 			GOROOT:      c.GOROOT,
 			GOPATH:      c.GOPATH,
-			CgoEnabled:  true,
+			CgoEnabled:  c.CgoEnabled,
 			UseAllFiles: false,
 			Compiler:    "gc", // must be one of the recognized compilers
 			BuildTags:   buildTags,
@@ -234,7 +239,7 @@ func (c *Compiler) Compile(mainPath string) []error {
 			GOOS:        c.GOOS,
 			GOROOT:      c.TINYGOROOT,
 			GOPATH:      overlayGopath,
-			CgoEnabled:  true,
+			CgoEnabled:  c.CgoEnabled,
 			UseAllFiles: false,
 			Compiler:    "gc", // must be one of the recognized compilers
 			BuildTags:   buildTags,
@@ -274,6 +279,8 @@ func (c *Compiler) Compile(mainPath string) []error {
 		TINYGOROOT:   c.TINYGOROOT,
 		CFlags:       c.CFlags,
 		ClangHeaders: c.ClangHeaders,
+		CgoDir:       c.CgoDir,
+		Cache:        c.PackageCache,
 	}
 
 	if strings.HasSuffix(mainPath, ".go") {
@@ -303,6 +310,23 @@ func (c *Compiler) Compile(mainPath string) []error {
 	// Run a simple dead code elimination pass.
 	c.ir.SimpleDCE()
 
+	// The reflect package implements comparing interface values, because
+	// that needs to interpret type codes. Only load it when the program
+	// compares interface values and doesn't import reflect already, so that
+	// other programs don't need to compile it.
+	if c.ir.Program.ImportedPackage("reflect") == nil && c.ir.ComparesInterfaces() {
+		_, err = lprogram.Import("reflect", "")
+		if err != nil {
+			return []error{err}
+		}
+		err = lprogram.Parse(c.TestConfig.CompileTestBinary)
+		if err != nil {
+			return []error{err}
+		}
+		c.ir = ir.NewProgram(lprogram, mainPath)
+		c.ir.SimpleDCE()
+	}
+
 	// Initialize debug information.
 	if c.Debug {
 		c.cu = c.dibuilder.CreateCompileUnit(llvm.DICompileUnit{
@@ -332,11 +356,28 @@ func (c *Compiler) Compile(mainPath string) []error {
 			continue
 		}
 		if frame.fn.Blocks == nil {
-			continue // external function
+			// External function. It may be implemented in Go assembly, which
+			// would otherwise only be noticed as an undefined symbol at link
+			// time.
+			if fn, ok := frame.fn.Object().(*types.Func); ok {
+				if err := lprogram.AssemblyError(fn); err != nil {
+					c.diagnostics = append(c.diagnostics, err)
+				}
+			}
+			continue
 		}
 		c.parseFunc(frame)
 	}
 
+	// The reflect package can put values in an interface that the program
+	// never puts in an interface itself. Make sure the interface lowering pass
+	// knows about the methods of these types, so that type asserts on them
+	// work as expected.
+	for _, typ := range c.ir.ReflectTypes() {
+		global := c.getTypeInInterface(typ)
+		global.SetLinkage(llvm.ExternalLinkage) // keep alive until interface lowering
+	}
+
 	// Define the already declared functions that wrap methods for use in
 	// interfaces.
 	for _, state := range c.interfaceInvokeWrappers {
@@ -871,6 +912,18 @@ func (c *Compiler) parseFunc(frame *Frame) {
 		frame.fn.LLVMFn.AddFunctionAttr(noinline)
 	}
 
+	// Mark functions with a //go:compiletime pragma, so that calls to them
+	// can be evaluated by the interp package (see interp.CompileTimeAttribute).
+	if frame.fn.IsCompileTime() {
+		frame.fn.LLVMFn.AddFunctionAttr(c.ctx.CreateStringAttribute("tinygo-compiletime", ""))
+	}
+
+	// Mark package initializers that must be run at runtime, so that the
+	// interp package leaves them alone (see interp.RuntimeInitAttribute).
+	if frame.fn.IsRuntimeInit() {
+		frame.fn.LLVMFn.AddFunctionAttr(c.ctx.CreateStringAttribute("tinygo-runtimeinit", ""))
+	}
+
 	// Add debug info, if needed.
 	if c.Debug {
 		if frame.fn.Synthetic == "package initializer" {
@@ -2163,7 +2216,16 @@ func (c *Compiler) parseBinOp(op token.Token, typ types.Type, x, y llvm.Value, p
 	case *types.Interface:
 		switch op {
 		case token.EQL, token.NEQ: // ==, !=
-			result := c.createRuntimeCall("interfaceEqual", []llvm.Value{x, y}, "")
+			var result llvm.Value
+			if x.IsNull() || y.IsNull() {
+				// Comparing against nil only needs to check whether there is
+				// a dynamic type, which doesn't need the reflect package.
+				xTypeCode := c.builder.CreateExtractValue(x, 0, "")
+				yTypeCode := c.builder.CreateExtractValue(y, 0, "")
+				result = c.builder.CreateICmp(llvm.IntEQ, xTypeCode, yTypeCode, "")
+			} else {
+				result = c.createRuntimeCall("interfaceEqual", []llvm.Value{x, y}, "")
+			}
 			if op == token.NEQ {
 				result = c.builder.CreateNot(result, "")
 			}
@@ -18,8 +18,9 @@ package compiler
 //     switch. This is very easy to optimize for LLVM: it will often translate a
 //     type switch into a regular switch statement.
 //     When this type assert is not possible (the type is never used in an
-//     interface), this call is replaced with a constant false to optimize the
-//     type assert away completely.
+//     interface and the reflect package cannot create it either), this call
+//     is replaced with a constant false to optimize the type assert away
+//     completely.
 //
 // interfaceImplements:
 //     This call is translated into a call that checks whether the underlying
@@ -166,6 +167,7 @@ func (p *lowerInterfacesPass) run() {
 	typecodeIDPtr := llvm.PointerType(p.getLLVMRuntimeType("typecodeID"), 0)
 	typeInInterfacePtr := llvm.PointerType(p.getLLVMRuntimeType("typeInInterface"), 0)
 	var typesInInterfaces []llvm.Value
+	var ptrMethodSets []ptrMethodSetInfo
 	for global := p.mod.FirstGlobal(); !global.IsNil(); global = llvm.NextGlobal(global) {
 		switch global.Type() {
 		case typecodeIDPtr:
@@ -187,6 +189,9 @@ func (p *lowerInterfacesPass) run() {
 			methodSet := llvm.ConstExtractValue(initializer, []uint32{1})
 			t := p.types[typecode.Name()]
 			p.addTypeMethods(t, methodSet)
+			if ptrMethodSet := llvm.ConstExtractValue(initializer, []uint32{2}); !ptrMethodSet.IsNull() {
+				ptrMethodSets = append(ptrMethodSets, ptrMethodSetInfo{t, ptrMethodSet})
+			}
 
 			// Count the number of MakeInterface instructions, for sorting the
 			// typecodes later.
@@ -194,6 +199,17 @@ func (p *lowerInterfacesPass) run() {
 		}
 	}
 
+	// The reflect package can take the address of a named value stored in an
+	// interface, so the pointer to this named type may need to implement
+	// interfaces as well. This is only possible when type codes are assigned
+	// the way the reflect package expects them.
+	if p.needsReflectTypeCodes() {
+		for _, info := range ptrMethodSets {
+			t := p.getPointerType(info.elem)
+			p.addTypeMethods(t, info.methodSet)
+		}
+	}
+
 	// Count per type how often it is type asserted on (e.g. in a switch
 	// statement).
 	typeAssert := p.mod.NamedFunction("runtime.typeAssert")
@@ -408,12 +424,17 @@ func (p *lowerInterfacesPass) run() {
 
 	// Replace each type assert with an actual type comparison or (if the type
 	// assert is impossible) the constant false.
+	// A type that is never put in an interface by the compiler may still end
+	// up in one when the reflect package constructs its type code (for
+	// example, reflect.New(t).Interface() results in a pointer to t), so type
+	// asserts can only be removed if type codes are not structural.
+	reflectTypeCodes := p.needsReflectTypeCodes()
 	for _, use := range typeAssertUses {
 		actualType := use.Operand(0)
 		assertedTypeGlobal := use.Operand(1)
 		t := p.types[assertedTypeGlobal.Name()]
 		var commaOk llvm.Value
-		if t.countMakeInterfaces == 0 {
+		if t.countMakeInterfaces == 0 && !reflectTypeCodes {
 			// impossible type assert: optimize accordingly
 			commaOk = llvm.ConstInt(p.ctx.Int1Type(), 0, false)
 		} else {
@@ -489,6 +510,33 @@ func (p *lowerInterfacesPass) addTypeMethods(t *typeInfo, methodSet llvm.Value)
 	}
 }
 
+// ptrMethodSetInfo is the method set of a pointer to a named type that was
+// stored in an interface.
+type ptrMethodSetInfo struct {
+	elem      *typeInfo
+	methodSet llvm.Value
+}
+
+// getPointerType returns the type info of a pointer to the given type,
+// creating a new type code if the compiler never emitted one.
+func (p *lowerInterfacesPass) getPointerType(elem *typeInfo) *typeInfo {
+	name := "reflect/types.type:pointer:" + strings.TrimPrefix(elem.name, "reflect/types.type:")
+	if t, ok := p.types[name]; ok {
+		return t
+	}
+	typecodeID := p.getLLVMRuntimeType("typecodeID")
+	global := llvm.AddGlobal(p.mod, typecodeID, name)
+	global.SetInitializer(llvm.ConstInsertValue(llvm.ConstNull(typecodeID), elem.typecode, []uint32{0}))
+	global.SetGlobalConstant(true)
+	global.SetLinkage(llvm.PrivateLinkage)
+	t := &typeInfo{
+		name:     name,
+		typecode: global,
+	}
+	p.types[name] = t
+	return t
+}
+
 // addInterface reads information about an interface, which is the
 // fully-qualified name and the signatures of all methods it has.
 func (p *lowerInterfacesPass) addInterface(methodSet llvm.Value) {
@@ -24,21 +24,36 @@ import (
 // An interface value is a {typecode, value} tuple, or {i16, i8*} to be exact.
 func (c *Compiler) parseMakeInterface(val llvm.Value, typ types.Type, pos token.Pos) llvm.Value {
 	itfValue := c.emitPointerPack([]llvm.Value{val})
+	itfConcreteTypeGlobal := c.getTypeInInterface(typ)
+	itfTypeCode := c.builder.CreatePtrToInt(itfConcreteTypeGlobal, c.uintptrType, "")
+	itf := llvm.Undef(c.getLLVMRuntimeType("_interface"))
+	itf = c.builder.CreateInsertValue(itf, itfTypeCode, 0, "")
+	itf = c.builder.CreateInsertValue(itf, itfValue, 1, "")
+	return itf
+}
+
+// getTypeInInterface returns the runtime.typeInInterface global of the given
+// type, which is used as a type code placeholder in interface values until the
+// interface lowering pass. It also tells the interface lowering pass which
+// methods the type has.
+func (c *Compiler) getTypeInInterface(typ types.Type) llvm.Value {
 	itfTypeCodeGlobal := c.getTypeCode(typ)
-	itfMethodSetGlobal := c.getTypeMethodSet(typ)
 	itfConcreteTypeGlobal := c.mod.NamedGlobal("typeInInterface:" + itfTypeCodeGlobal.Name())
 	if itfConcreteTypeGlobal.IsNil() {
+		itfMethodSetGlobal := c.getTypeMethodSet(typ)
+		// The reflect package may turn a named value into a pointer, so also
+		// include the method set of the pointer type when it is used.
+		itfPtrMethodSetGlobal := llvm.ConstPointerNull(llvm.PointerType(c.getLLVMRuntimeType("interfaceMethodInfo"), 0))
+		if _, ok := typ.(*types.Named); ok && !types.IsInterface(typ) && c.ir.UsesReflect() {
+			itfPtrMethodSetGlobal = c.getTypeMethodSet(types.NewPointer(typ))
+		}
 		typeInInterface := c.getLLVMRuntimeType("typeInInterface")
 		itfConcreteTypeGlobal = llvm.AddGlobal(c.mod, typeInInterface, "typeInInterface:"+itfTypeCodeGlobal.Name())
-		itfConcreteTypeGlobal.SetInitializer(llvm.ConstNamedStruct(typeInInterface, []llvm.Value{itfTypeCodeGlobal, itfMethodSetGlobal}))
+		itfConcreteTypeGlobal.SetInitializer(llvm.ConstNamedStruct(typeInInterface, []llvm.Value{itfTypeCodeGlobal, itfMethodSetGlobal, itfPtrMethodSetGlobal}))
 		itfConcreteTypeGlobal.SetGlobalConstant(true)
 		itfConcreteTypeGlobal.SetLinkage(llvm.PrivateLinkage)
 	}
-	itfTypeCode := c.builder.CreatePtrToInt(itfConcreteTypeGlobal, c.uintptrType, "")
-	itf := llvm.Undef(c.getLLVMRuntimeType("_interface"))
-	itf = c.builder.CreateInsertValue(itf, itfTypeCode, 0, "")
-	itf = c.builder.CreateInsertValue(itf, itfValue, 1, "")
-	return itf
+	return itfConcreteTypeGlobal
 }
 
 // getTypeCode returns a reference to a type code.
@@ -55,9 +70,16 @@ func (c *Compiler) getTypeCode(typ types.Type) llvm.Value {
 		// reflect lowering simpler.
 		var references llvm.Value
 		var length int64
+		var methodSet, ptrMethodSet llvm.Value
 		switch typ := typ.(type) {
 		case *types.Named:
 			references = c.getTypeCode(typ.Underlying())
+			if !types.IsInterface(typ) {
+				// Store the methods of this type and of the pointer to this
+				// type, for Type.Implements in the reflect package.
+				methodSet = c.makeTypeMethods(typ)
+				ptrMethodSet = c.makeTypeMethods(types.NewPointer(typ))
+			}
 		case *types.Chan:
 			references = c.getTypeCode(typ.Elem())
 		case *types.Pointer:
@@ -71,6 +93,14 @@ func (c *Compiler) getTypeCode(typ types.Type) llvm.Value {
 			// Take a pointer to the typecodeID of the first field (if it exists).
 			structGlobal := c.makeStructTypeFields(typ)
 			references = llvm.ConstBitCast(structGlobal, global.Type())
+		case *types.Interface:
+			// Take a pointer to the list of methods of this interface.
+			methodsGlobal := c.makeInterfaceTypeMethods(typ)
+			references = llvm.ConstBitCast(methodsGlobal, global.Type())
+		case *types.Map:
+			// Take a pointer to a {key, elem} pair of typecodeIDs.
+			mapGlobal := c.makeMapTypeFields(typ)
+			references = llvm.ConstBitCast(mapGlobal, global.Type())
 		}
 		if !references.IsNil() {
 			// Set the 'references' field of the runtime.typecodeID struct.
@@ -80,6 +110,12 @@ func (c *Compiler) getTypeCode(typ types.Type) llvm.Value {
 				lengthValue := llvm.ConstInt(c.uintptrType, uint64(length), false)
 				globalValue = llvm.ConstInsertValue(globalValue, lengthValue, []uint32{1})
 			}
+			if !methodSet.IsNil() {
+				globalValue = llvm.ConstInsertValue(globalValue, llvm.ConstBitCast(methodSet, global.Type()), []uint32{2})
+			}
+			if !ptrMethodSet.IsNil() {
+				globalValue = llvm.ConstInsertValue(globalValue, llvm.ConstBitCast(ptrMethodSet, global.Type()), []uint32{3})
+			}
 			global.SetInitializer(globalValue)
 			global.SetLinkage(llvm.PrivateLinkage)
 		}
@@ -97,6 +133,7 @@ func (c *Compiler) makeStructTypeFields(typ *types.Struct) llvm.Value {
 	structGlobalType := llvm.ArrayType(runtimeStructField, typ.NumFields())
 	structGlobal := llvm.AddGlobal(c.mod, structGlobalType, "reflect/types.structFields")
 	structGlobalValue := llvm.ConstNull(structGlobalType)
+	llvmStructType := c.getLLVMType(typ)
 	for i := 0; i < typ.NumFields(); i++ {
 		fieldGlobalValue := llvm.ConstNull(runtimeStructField)
 		fieldGlobalValue = llvm.ConstInsertValue(fieldGlobalValue, c.getTypeCode(typ.Field(i).Type()), []uint32{0})
@@ -122,6 +159,18 @@ func (c *Compiler) makeStructTypeFields(typ *types.Struct) llvm.Value {
 			fieldEmbedded := llvm.ConstInt(c.ctx.Int1Type(), 1, false)
 			fieldGlobalValue = llvm.ConstInsertValue(fieldGlobalValue, fieldEmbedded, []uint32{3})
 		}
+		if !typ.Field(i).Exported() {
+			fieldPkgPath := c.makeGlobalArray([]byte(typ.Field(i).Pkg().Path()), "reflect/types.structFieldPkgPath", c.ctx.Int8Type())
+			fieldPkgPath.SetLinkage(llvm.PrivateLinkage)
+			fieldPkgPath.SetUnnamedAddr(true)
+			fieldPkgPath = llvm.ConstGEP(fieldPkgPath, []llvm.Value{
+				llvm.ConstInt(llvm.Int32Type(), 0, false),
+				llvm.ConstInt(llvm.Int32Type(), 0, false),
+			})
+			fieldGlobalValue = llvm.ConstInsertValue(fieldGlobalValue, fieldPkgPath, []uint32{4})
+		}
+		fieldOffset := llvm.ConstInt(c.uintptrType, c.targetData.ElementOffset(llvmStructType, i), false)
+		fieldGlobalValue = llvm.ConstInsertValue(fieldGlobalValue, fieldOffset, []uint32{5})
 		structGlobalValue = llvm.ConstInsertValue(structGlobalValue, fieldGlobalValue, []uint32{uint32(i)})
 	}
 	structGlobal.SetInitializer(structGlobalValue)
@@ -130,6 +179,84 @@ func (c *Compiler) makeStructTypeFields(typ *types.Struct) llvm.Value {
 	return structGlobal
 }
 
+// makeInterfaceTypeMethods creates a new global that stores the name and
+// signature of all methods of this interface type, as an array of
+// runtime.interfaceMethod structs.
+func (c *Compiler) makeInterfaceTypeMethods(typ *types.Interface) llvm.Value {
+	methods := make([]*types.Func, typ.NumMethods())
+	for i := range methods {
+		methods[i] = typ.Method(i)
+	}
+	return c.makeMethodsGlobal(methods, "reflect/types.interfaceMethods")
+}
+
+// makeTypeMethods is like makeInterfaceTypeMethods, but for the method set of
+// a non-interface type. It returns a nil value if this type has no methods.
+func (c *Compiler) makeTypeMethods(typ types.Type) llvm.Value {
+	ms := c.ir.Program.MethodSets.MethodSet(typ)
+	if ms.Len() == 0 {
+		return llvm.Value{}
+	}
+	methods := make([]*types.Func, ms.Len())
+	for i := range methods {
+		methods[i] = ms.At(i).Obj().(*types.Func)
+	}
+	return c.makeMethodsGlobal(methods, "reflect/types.typeMethods")
+}
+
+// makeMethodsGlobal creates a new global with the given name that stores the
+// name and signature of the given methods, as an array of
+// runtime.interfaceMethod structs.
+func (c *Compiler) makeMethodsGlobal(methods []*types.Func, name string) llvm.Value {
+	runtimeInterfaceMethod := c.getLLVMRuntimeType("interfaceMethod")
+	methodsGlobalType := llvm.ArrayType(runtimeInterfaceMethod, len(methods))
+	methodsGlobal := llvm.AddGlobal(c.mod, methodsGlobalType, name)
+	methodsGlobalValue := llvm.ConstNull(methodsGlobalType)
+	for i, method := range methods {
+		methodValue := llvm.ConstNull(runtimeInterfaceMethod)
+		methodValue = llvm.ConstInsertValue(methodValue, c.getTypeCode(method.Type()), []uint32{0})
+		methodName := c.makeGlobalArray([]byte(method.Name()), "reflect/types.interfaceMethodName", c.ctx.Int8Type())
+		methodName.SetLinkage(llvm.PrivateLinkage)
+		methodName.SetUnnamedAddr(true)
+		methodName = llvm.ConstGEP(methodName, []llvm.Value{
+			llvm.ConstInt(llvm.Int32Type(), 0, false),
+			llvm.ConstInt(llvm.Int32Type(), 0, false),
+		})
+		methodValue = llvm.ConstInsertValue(methodValue, methodName, []uint32{1})
+		if !method.Exported() {
+			methodPkgPath := c.makeGlobalArray([]byte(method.Pkg().Path()), "reflect/types.interfaceMethodPkgPath", c.ctx.Int8Type())
+			methodPkgPath.SetLinkage(llvm.PrivateLinkage)
+			methodPkgPath.SetUnnamedAddr(true)
+			methodPkgPath = llvm.ConstGEP(methodPkgPath, []llvm.Value{
+				llvm.ConstInt(llvm.Int32Type(), 0, false),
+				llvm.ConstInt(llvm.Int32Type(), 0, false),
+			})
+			methodValue = llvm.ConstInsertValue(methodValue, methodPkgPath, []uint32{2})
+		}
+		methodsGlobalValue = llvm.ConstInsertValue(methodsGlobalValue, methodValue, []uint32{uint32(i)})
+	}
+	methodsGlobal.SetInitializer(methodsGlobalValue)
+	methodsGlobal.SetUnnamedAddr(true)
+	methodsGlobal.SetLinkage(llvm.PrivateLinkage)
+	return methodsGlobal
+}
+
+// makeMapTypeFields creates a new global that stores the key and element type
+// of this map type, as an array of two typecodeID pointers.
+func (c *Compiler) makeMapTypeFields(typ *types.Map) llvm.Value {
+	typecodeIDPtr := llvm.PointerType(c.getLLVMRuntimeType("typecodeID"), 0)
+	mapGlobalType := llvm.ArrayType(typecodeIDPtr, 2)
+	mapGlobal := llvm.AddGlobal(c.mod, mapGlobalType, "reflect/types.mapTypes")
+	mapGlobal.SetInitializer(llvm.ConstArray(typecodeIDPtr, []llvm.Value{
+		c.getTypeCode(typ.Key()),
+		c.getTypeCode(typ.Elem()),
+	}))
+	mapGlobal.SetGlobalConstant(true)
+	mapGlobal.SetUnnamedAddr(true)
+	mapGlobal.SetLinkage(llvm.PrivateLinkage)
+	return mapGlobal
+}
+
 // getTypeCodeName returns a name for this type that can be used in the
 // interface lowering pass to assign type codes as expected by the reflect
 // package. See getTypeCodeNum.
@@ -187,7 +314,7 @@ func getTypeCodeName(t types.Type) string {
 	case *types.Interface:
 		methods := make([]string, t.NumMethods())
 		for i := 0; i < t.NumMethods(); i++ {
-			methods[i] = getTypeCodeName(t.Method(i).Type())
+			methods[i] = getQualifiedName(t.Method(i)) + ":" + getTypeCodeName(t.Method(i).Type())
 		}
 		return "interface:" + "{" + strings.Join(methods, ",") + "}"
 	case *types.Map:
@@ -219,7 +346,7 @@ func getTypeCodeName(t types.Type) string {
 			if t.Field(i).Embedded() {
 				embedded = "#"
 			}
-			elems[i] = embedded + t.Field(i).Name() + ":" + getTypeCodeName(t.Field(i).Type())
+			elems[i] = embedded + getQualifiedName(t.Field(i)) + ":" + getTypeCodeName(t.Field(i).Type())
 			if t.Tag(i) != "" {
 				elems[i] += "`" + t.Tag(i) + "`"
 			}
@@ -230,6 +357,17 @@ func getTypeCodeName(t types.Type) string {
 	}
 }
 
+// getQualifiedName returns the name of a struct field or interface method for
+// use in a type code name. Unexported names are prefixed with their package
+// path, as the same unexported name in two different packages results in two
+// different types.
+func getQualifiedName(obj types.Object) string {
+	if obj.Exported() {
+		return obj.Name()
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
 // getTypeMethodSet returns a reference (GEP) to a global method set. This
 // method set should be unreferenced after the interface lowering pass.
 func (c *Compiler) getTypeMethodSet(typ types.Type) llvm.Value {
@@ -240,6 +378,8 @@ func (c *Compiler) getTypeMethodSet(typ types.Type) llvm.Value {
 		return llvm.ConstGEP(global, []llvm.Value{zero, zero})
 	}
 
+	// The method set includes methods promoted from embedded fields, following
+	// the depth and ambiguity rules of the Go spec.
 	ms := c.ir.Program.MethodSets.MethodSet(typ)
 	if ms.Len() == 0 {
 		// no methods, so can leave that one out
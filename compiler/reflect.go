@@ -55,20 +55,21 @@ var basicTypes = map[string]int64{
 	"float64":    14,
 	"complex64":  15,
 	"complex128": 16,
-	"string":     17,
-	"unsafeptr":  18,
+	"string":     24,
+	"unsafeptr":  26,
 }
 
-// A list of non-basic types. Adding 19 to this number will give the Kind as
-// used in src/reflect/types.go, and it must be kept in sync with that list.
+// A list of non-basic types, numbered in the order of their Kind in
+// src/reflect/type.go (which skips String as it is a basic type). It must be
+// kept in sync with that list.
 var nonBasicTypes = map[string]int64{
-	"chan":      0,
-	"interface": 1,
-	"pointer":   2,
-	"slice":     3,
-	"array":     4,
-	"func":      5,
-	"map":       6,
+	"array":     0,
+	"chan":      1,
+	"func":      2,
+	"interface": 3,
+	"map":       4,
+	"pointer":   5,
+	"slice":     6,
 	"struct":    7,
 }
 
@@ -79,6 +80,7 @@ type typeCodeAssignmentState struct {
 	// type codes that are not yet fully supported otherwise by the reflect
 	// package (or are simply unused in the compiled program).
 	fallbackIndex int
+	fallbackTypes map[string]int
 
 	// This is the length of an uintptr. Only used occasionally to know whether
 	// a given number can be encoded as a varint.
@@ -94,6 +96,26 @@ type typeCodeAssignmentState struct {
 	arrayTypesSidetable      []byte
 	needsArrayTypesSidetable bool
 
+	// Map of interface types to their type code. The interface sidetable
+	// stores lists of methods, which are shared between all types with the
+	// same methods.
+	interfaceTypes               map[string]int
+	interfaceTypesSidetable      []byte
+	needsInterfaceTypesSidetable bool
+	methodLists                  map[string]int
+
+	// The methods of named types and of pointers to named types, as a
+	// reference to a list of methods in the interface sidetable. This sidetable
+	// is only created when the reflect package needs method sets of
+	// non-interface types, for example for Type.Implements.
+	methodSetsSidetable      []byte
+	needsMethodSetsSidetable bool
+
+	// Map of map types to their type code.
+	mapTypes               map[string]int
+	mapTypesSidetable      []byte
+	needsMapTypesSidetable bool
+
 	// Map of struct types to their type code.
 	structTypes               map[string]int
 	structTypesSidetable      []byte
@@ -122,13 +144,24 @@ type typeCodeAssignmentState struct {
 	needsNamedNonBasicTypesSidetable bool
 }
 
+// needsReflectTypeCodes returns whether type codes must be assigned the way the
+// reflect package expects them. This is the case when reflect.ValueOf is used
+// or when interface values are compared by the reflect package.
+//
+// Type codes assigned this way are structural: the reflect package can
+// construct the type code of a type (for example using PtrTo) even if the
+// compiler never put a value of that type in an interface.
+func (c *Compiler) needsReflectTypeCodes() bool {
+	return !c.mod.NamedFunction("reflect.ValueOf").IsNil() || len(getUses(c.mod.NamedFunction("runtime.interfaceValueEqual"))) != 0
+}
+
 // assignTypeCodes is used to assign a type code to each type in the program
 // that is ever stored in an interface. It tries to use the smallest possible
 // numbers to make the code that works with interfaces as small as possible.
 func (c *Compiler) assignTypeCodes(typeSlice typeInfoSlice) {
-	fn := c.mod.NamedFunction("reflect.ValueOf")
-	if fn.IsNil() {
-		// reflect.ValueOf is never used, so we can use the most efficient
+	if !c.needsReflectTypeCodes() {
+		// reflect.ValueOf is never used and interface values are never
+		// compared by the reflect package, so we can use the most efficient
 		// encoding possible.
 		for i, t := range typeSlice {
 			t.num = uint64(i + 1)
@@ -139,16 +172,27 @@ func (c *Compiler) assignTypeCodes(typeSlice typeInfoSlice) {
 	// Assign typecodes the way the reflect package expects.
 	state := typeCodeAssignmentState{
 		fallbackIndex:                    1,
+		fallbackTypes:                    make(map[string]int),
 		uintptrLen:                       c.uintptrType.IntTypeWidth(),
 		namedBasicTypes:                  make(map[string]int),
 		namedNonBasicTypes:               make(map[string]int),
 		arrayTypes:                       make(map[string]int),
+		interfaceTypes:                   make(map[string]int),
+		methodLists:                      make(map[string]int),
+		mapTypes:                         make(map[string]int),
 		structTypes:                      make(map[string]int),
 		structNames:                      make(map[string]int),
 		needsNamedNonBasicTypesSidetable: len(getUses(c.mod.NamedGlobal("reflect.namedNonBasicTypesSidetable"))) != 0,
 		needsStructTypesSidetable:        len(getUses(c.mod.NamedGlobal("reflect.structTypesSidetable"))) != 0,
 		needsStructNamesSidetable:        len(getUses(c.mod.NamedGlobal("reflect.structNamesSidetable"))) != 0,
 		needsArrayTypesSidetable:         len(getUses(c.mod.NamedGlobal("reflect.arrayTypesSidetable"))) != 0,
+		needsMapTypesSidetable:           len(getUses(c.mod.NamedGlobal("reflect.mapTypesSidetable"))) != 0,
+		needsInterfaceTypesSidetable:     len(getUses(c.mod.NamedGlobal("reflect.interfaceTypesSidetable"))) != 0,
+		needsMethodSetsSidetable:         len(getUses(c.mod.NamedGlobal("reflect.methodSetsSidetable"))) != 0,
+	}
+	if state.needsMethodSetsSidetable {
+		// Method sets refer to method lists in the interface sidetable.
+		state.needsInterfaceTypesSidetable = true
 	}
 	for _, t := range typeSlice {
 		num := state.getTypeCodeNum(t.typecode)
@@ -162,18 +206,50 @@ func (c *Compiler) assignTypeCodes(typeSlice typeInfoSlice) {
 		t.num = num.Uint64()
 	}
 
+	// Store the method sets of all named types. This must happen before the
+	// other sidetables are created, as the method signatures may add entries
+	// to them.
+	if state.needsMethodSetsSidetable {
+		for _, t := range typeSlice {
+			state.addMethodSets(t)
+		}
+		// The list of method sets ends with a zero type code.
+		state.methodSetsSidetable = append(state.methodSetsSidetable, 0)
+		global := c.replaceGlobalIntWithArray("reflect.methodSetsSidetable", state.methodSetsSidetable)
+		global.SetLinkage(llvm.InternalLinkage)
+		global.SetUnnamedAddr(true)
+	}
+
 	// Only create this sidetable when it is necessary.
 	if state.needsNamedNonBasicTypesSidetable {
 		global := c.replaceGlobalIntWithArray("reflect.namedNonBasicTypesSidetable", state.namedNonBasicTypesSidetable)
 		global.SetLinkage(llvm.InternalLinkage)
 		global.SetUnnamedAddr(true)
 	}
+	// The array, map and struct sidetables are searched by reflect.ArrayOf,
+	// reflect.MapOf and reflect.StructOf for a type that is identical to the
+	// one they construct, so they end with an entry that can't be a type:
+	// type codes are never zero and a struct without fields doesn't have
+	// unexported fields.
 	if state.needsArrayTypesSidetable {
+		state.arrayTypesSidetable = append(state.arrayTypesSidetable, 0)
 		global := c.replaceGlobalIntWithArray("reflect.arrayTypesSidetable", state.arrayTypesSidetable)
 		global.SetLinkage(llvm.InternalLinkage)
 		global.SetUnnamedAddr(true)
 	}
+	if state.needsInterfaceTypesSidetable {
+		global := c.replaceGlobalIntWithArray("reflect.interfaceTypesSidetable", state.interfaceTypesSidetable)
+		global.SetLinkage(llvm.InternalLinkage)
+		global.SetUnnamedAddr(true)
+	}
+	if state.needsMapTypesSidetable {
+		state.mapTypesSidetable = append(state.mapTypesSidetable, 0)
+		global := c.replaceGlobalIntWithArray("reflect.mapTypesSidetable", state.mapTypesSidetable)
+		global.SetLinkage(llvm.InternalLinkage)
+		global.SetUnnamedAddr(true)
+	}
 	if state.needsStructTypesSidetable {
+		state.structTypesSidetable = append(state.structTypesSidetable, 1)
 		global := c.replaceGlobalIntWithArray("reflect.structTypesSidetable", state.structTypesSidetable)
 		global.SetLinkage(llvm.InternalLinkage)
 		global.SetUnnamedAddr(true)
@@ -200,7 +276,7 @@ func (state *typeCodeAssignmentState) getTypeCodeNum(typecode llvm.Value) *big.I
 	if class == "basic" {
 		// Basic types follow the following bit pattern:
 		//    ...xxxxx0
-		// where xxxxx is allocated for the 18 possible basic types and all the
+		// where xxxxx is the reflect.Kind of the basic type and all the
 		// upper bits are used to indicate the named type.
 		num, ok := basicTypes[value]
 		if !ok {
@@ -282,16 +358,30 @@ func (state *typeCodeAssignmentState) getNonBasicTypeCode(class string, typecode
 		return state.getTypeCodeNum(sub)
 	case "array":
 		// An array is basically a pair of (typecode, length) stored in a
-		// sidetable.
-		return big.NewInt(int64(state.getArrayTypeNum(typecode)))
+		// sidetable. The index is shifted left by one, as the reflect package
+		// uses the lowest bit for array, map and struct types that are
+		// constructed at runtime.
+		return big.NewInt(int64(state.getArrayTypeNum(typecode)) << 1)
+	case "interface":
+		// An interface is a list of methods stored in a sidetable.
+		return big.NewInt(int64(state.getInterfaceTypeNum(typecode)))
+	case "map":
+		// A map is a pair of (key type, element type) stored in a sidetable.
+		// See above for the shift.
+		return big.NewInt(int64(state.getMapTypeNum(typecode)) << 1)
 	case "struct":
 		// More complicated type kind. The upper bits contain the index to the
-		// struct type in the struct types sidetable.
-		return big.NewInt(int64(state.getStructTypeNum(typecode)))
+		// struct type in the struct types sidetable. See above for the shift.
+		return big.NewInt(int64(state.getStructTypeNum(typecode)) << 1)
 	default:
 		// Type has not yet been implemented, so fall back by using a unique
-		// number.
+		// number. Make sure the same type always gets the same number, as it
+		// may be referenced from multiple places (like interface methods).
+		if index, ok := state.fallbackTypes[typecode.Name()]; ok {
+			return big.NewInt(int64(index))
+		}
 		num := big.NewInt(int64(state.fallbackIndex))
+		state.fallbackTypes[typecode.Name()] = state.fallbackIndex
 		state.fallbackIndex++
 		return num
 	}
@@ -365,6 +455,145 @@ func (state *typeCodeAssignmentState) getArrayTypeNum(typecode llvm.Value) int {
 	return index
 }
 
+// getInterfaceTypeNum returns the interface type number, which is an index
+// into reflect.interfaceTypesSidetable or a unique number for every interface
+// type if this sidetable is not needed in the to-be-compiled program.
+func (state *typeCodeAssignmentState) getInterfaceTypeNum(typecode llvm.Value) int {
+	name := typecode.Name()
+	if num, ok := state.interfaceTypes[name]; ok {
+		// This interface already has an assigned type code.
+		return num
+	}
+
+	if !state.needsInterfaceTypesSidetable {
+		// We don't need interface sidetables, so we can just assign
+		// monotonically increasing numbers to each interface type.
+		num := len(state.interfaceTypes)
+		state.interfaceTypes[name] = num
+		return num
+	}
+
+	// The interface type code refers to a list of methods, see getMethodList.
+	methodsGlobal := llvm.ConstExtractValue(typecode.Initializer(), []uint32{0}).Operand(0).Initializer()
+	num := state.getMethodListNum(methodsGlobal)
+	state.interfaceTypes[name] = num
+	return num
+}
+
+// getMethodListNum returns the index of the given list of methods in the
+// interface sidetable, adding it if it isn't already there. Interface types and
+// method sets of other types with the same methods share a single list.
+func (state *typeCodeAssignmentState) getMethodListNum(methodsGlobal llvm.Value) int {
+	buf := state.getMethodList(methodsGlobal)
+	if num, ok := state.methodLists[string(buf)]; ok {
+		return num
+	}
+	num := len(state.interfaceTypesSidetable)
+	state.methodLists[string(buf)] = num
+	state.interfaceTypesSidetable = append(state.interfaceTypesSidetable, buf...)
+	return num
+}
+
+// getMethodList returns the encoded list of methods in the given array of
+// runtime.interfaceMethod structs, as used in the interface sidetable and the
+// method sets sidetable. It starts with the number of methods, followed by a
+// {signature type, name} pair for each method. Unexported methods are followed
+// by their package path. The names are stored in the struct names sidetable.
+func (state *typeCodeAssignmentState) getMethodList(methodsGlobal llvm.Value) []byte {
+	numMethods := methodsGlobal.Type().ArrayLength()
+	buf := makeVarint(uint64(numMethods))
+	for i := 0; i < numMethods; i++ {
+		method := llvm.ConstExtractValue(methodsGlobal, []uint32{uint32(i)})
+		typeNum := state.getTypeCodeNum(llvm.ConstExtractValue(method, []uint32{0}))
+		if typeNum.BitLen() > state.uintptrLen || !typeNum.IsUint64() {
+			// TODO: make this a regular error
+			panic("interface method has a type code that is too big")
+		}
+		buf = append(buf, makeVarint(typeNum.Uint64())...)
+		nameGlobal := llvm.ConstExtractValue(method, []uint32{1})
+		methodName := getGlobalBytes(nameGlobal.Operand(0))
+		nameNumber := state.getStructNameNumber(methodName)
+		buf = append(buf, makeVarint(uint64(nameNumber))...)
+		if !ast.IsExported(string(methodName)) {
+			pkgPathGlobal := llvm.ConstExtractValue(method, []uint32{2})
+			if pkgPathGlobal == llvm.ConstPointerNull(pkgPathGlobal.Type()) {
+				panic("compiler: no package path for this unexported interface method")
+			}
+			pkgPathNumber := state.getStructNameNumber(getGlobalBytes(pkgPathGlobal.Operand(0)))
+			buf = append(buf, makeVarint(uint64(pkgPathNumber))...)
+		}
+	}
+	return buf
+}
+
+// addMethodSets adds the methods of this type and of the pointer to this type
+// to the method sets sidetable, if this is a named type with methods. Each
+// entry is the type code followed by the index of the list of methods in the
+// interface sidetable. Often the pointer type has the same methods as the
+// named type, in which case they share the same list. Pointer types are stored
+// with the type code the reflect package constructs for them, so that a type
+// like *T can be found even when the compiler never assigned a type code to
+// it.
+func (state *typeCodeAssignmentState) addMethodSets(t *typeInfo) {
+	if class, _ := getClassAndValueFromTypeCode(t.typecode); class != "named" || t.typecode.Initializer().IsNil() {
+		return
+	}
+	methodSet := llvm.ConstExtractValue(t.typecode.Initializer(), []uint32{2})
+	if !methodSet.IsNull() {
+		state.methodSetsSidetable = append(state.methodSetsSidetable, makeVarint(t.num)...)
+		state.methodSetsSidetable = append(state.methodSetsSidetable, makeVarint(uint64(state.getMethodListNum(methodSet.Operand(0).Initializer())))...)
+	}
+	ptrMethodSet := llvm.ConstExtractValue(t.typecode.Initializer(), []uint32{3})
+	if !ptrMethodSet.IsNull() {
+		// See getTypeCodeNum for the bit pattern of pointer types.
+		num := new(big.Int).SetUint64(t.num)
+		num.Lsh(num, 5).Or(num, big.NewInt((nonBasicTypes["pointer"]<<1)+1))
+		if num.BitLen() > state.uintptrLen || !num.IsUint64() {
+			// TODO: make this a regular error
+			panic("pointer type has a type code that is too big")
+		}
+		state.methodSetsSidetable = append(state.methodSetsSidetable, makeVarint(num.Uint64())...)
+		state.methodSetsSidetable = append(state.methodSetsSidetable, makeVarint(uint64(state.getMethodListNum(ptrMethodSet.Operand(0).Initializer())))...)
+	}
+}
+
+// getMapTypeNum returns the map type number, which is an index into the
+// reflect.mapTypesSidetable or a unique number for this type if this table is
+// not used.
+func (state *typeCodeAssignmentState) getMapTypeNum(typecode llvm.Value) int {
+	name := typecode.Name()
+	if num, ok := state.mapTypes[name]; ok {
+		// This map type already has an entry in the sidetable. Don't store it
+		// twice.
+		return num
+	}
+
+	if !state.needsMapTypesSidetable {
+		// We don't need map sidetables, so we can just assign monotonically
+		// increasing numbers to each map type.
+		num := len(state.mapTypes)
+		state.mapTypes[name] = num
+		return num
+	}
+
+	// The map side table is a sequence of {key type, element type}.
+	mapTypeGlobal := llvm.ConstExtractValue(typecode.Initializer(), []uint32{0}).Operand(0).Initializer()
+	var buf []byte
+	for i := uint32(0); i < 2; i++ {
+		typeNum := state.getTypeCodeNum(llvm.ConstExtractValue(mapTypeGlobal, []uint32{i}))
+		if typeNum.BitLen() > state.uintptrLen || !typeNum.IsUint64() {
+			// TODO: make this a regular error
+			panic("map key or element type has a type code that is too big")
+		}
+		buf = append(buf, makeVarint(typeNum.Uint64())...)
+	}
+
+	index := len(state.mapTypesSidetable)
+	state.mapTypes[name] = index
+	state.mapTypesSidetable = append(state.mapTypesSidetable, buf...)
+	return index
+}
+
 // getStructTypeNum returns the struct type number, which is an index into
 // reflect.structTypesSidetable or an unique number for every struct if this
 // sidetable is not needed in the to-be-compiled program.
@@ -388,11 +617,36 @@ func (state *typeCodeAssignmentState) getStructTypeNum(typecode llvm.Value) int
 	structTypeGlobal := llvm.ConstExtractValue(typecode.Initializer(), []uint32{0}).Operand(0).Initializer()
 	numFields := structTypeGlobal.Type().ArrayLength()
 
+	// All unexported fields of a struct type are declared in the same package,
+	// so the package path is stored only once for the whole struct.
+	var pkgPath []byte
+	for i := 0; i < numFields; i++ {
+		field := llvm.ConstExtractValue(structTypeGlobal, []uint32{uint32(i)})
+		pkgPathGlobal := llvm.ConstExtractValue(field, []uint32{4})
+		if pkgPathGlobal == llvm.ConstPointerNull(pkgPathGlobal.Type()) {
+			continue
+		}
+		fieldPkgPath := getGlobalBytes(pkgPathGlobal.Operand(0))
+		if pkgPath != nil && string(pkgPath) != string(fieldPkgPath) {
+			panic("compiler: struct fields declared in different packages")
+		}
+		pkgPath = fieldPkgPath
+	}
+
 	// The first data that is stored in the struct sidetable is the number of
-	// fields this struct contains. This is usually just a single byte because
-	// most structs don't contain that many fields, but make it a varint just
-	// to be sure.
-	buf := makeVarint(uint64(numFields))
+	// fields this struct contains, shifted left by one. The lowest bit
+	// indicates whether the struct has unexported fields, in which case it is
+	// followed by the package path of these fields. This is usually just a
+	// single byte because most structs don't contain that many fields, but
+	// make it a varint just to be sure.
+	header := uint64(numFields) << 1
+	if pkgPath != nil {
+		header |= 1
+	}
+	buf := makeVarint(header)
+	if pkgPath != nil {
+		buf = append(buf, makeVarint(uint64(state.getStructNameNumber(pkgPath)))...)
+	}
 
 	// Iterate over every field in the struct.
 	// Every field is stored sequentially in the struct sidetable. Fields can
@@ -400,6 +654,9 @@ func (state *typeCodeAssignmentState) getStructTypeNum(typecode llvm.Value) int
 	// of them until the right field has been found.
 	// Perhaps adding some index would speed things up, but it would also make
 	// the sidetable bigger.
+	// Field offsets are stored as the difference with the previous field,
+	// which nearly always fits in a single byte.
+	previousOffset := uint64(0)
 	for i := 0; i < numFields; i++ {
 		// Collect some information about this field.
 		field := llvm.ConstExtractValue(structTypeGlobal, []uint32{uint32(i)})
@@ -425,6 +682,15 @@ func (state *typeCodeAssignmentState) getStructTypeNum(typecode llvm.Value) int
 		// The 'embedded' or 'anonymous' flag for this field.
 		embedded := llvm.ConstExtractValue(field, []uint32{3}).ZExtValue() != 0
 
+		// Unexported fields use the package path stored at the start of the
+		// struct.
+		exported := ast.IsExported(string(fieldNameBytes))
+		if !exported && pkgPath == nil {
+			panic("compiler: no package path for this unexported struct field")
+		}
+
+		offset := llvm.ConstExtractValue(field, []uint32{5}).ZExtValue()
+
 		// The first byte in the struct types sidetable is a flags byte with
 		// two bits in it.
 		flagsByte := byte(0)
@@ -434,11 +700,15 @@ func (state *typeCodeAssignmentState) getStructTypeNum(typecode llvm.Value) int
 		if hasTag {
 			flagsByte |= 2
 		}
-		if ast.IsExported(string(fieldNameBytes)) {
+		if exported {
 			flagsByte |= 4
 		}
 		buf = append(buf, flagsByte)
 
+		// Add the offset, relative to the previous field.
+		buf = append(buf, makeVarint(offset-previousOffset)...)
+		previousOffset = offset
+
 		// Get the type number and add it to the buffer.
 		// All fields have a type, so include it directly here.
 		typeNum := state.getTypeCodeNum(llvm.ConstExtractValue(field, []uint32{0}))
@@ -4,6 +4,7 @@ package compiler
 // pragmas, determines the link name, etc.
 
 import (
+	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
@@ -105,3 +106,68 @@ func (info *globalInfo) parsePragmas(doc *ast.CommentGroup) {
 		}
 	}
 }
+
+// SetStringVar sets the value of a package-level string variable, like the -X
+// flag of the Go linker. The name is of the form importpath.name, where the
+// import path may be "main" for the main package. The variable must be
+// declared without a value or be initialized to a constant string, in which
+// case the store in the package initializer is removed.
+//
+// It must be called after Compile but before package initializers are
+// interpreted, so that other globals derived from this variable can still be
+// calculated at compile time.
+func (c *Compiler) SetStringVar(name, value string) error {
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= 0 {
+		return fmt.Errorf("-X %s: expected importpath.name=value", name)
+	}
+	pkgPath, varName := name[:dot], name[dot+1:]
+	pkg := c.ir.Program.ImportedPackage(pkgPath)
+	if pkgPath == "main" {
+		pkg = c.ir.MainPkg()
+	}
+	if pkg == nil {
+		return fmt.Errorf("-X %s: package %s is not part of this program", name, pkgPath)
+	}
+	g, ok := pkg.Members[varName].(*ssa.Global)
+	if !ok {
+		return fmt.Errorf("-X %s: not a package-level variable", name)
+	}
+	typ := g.Type().(*types.Pointer).Elem()
+	if basic, ok := typ.Underlying().(*types.Basic); !ok || basic.Info()&types.IsString == 0 {
+		return fmt.Errorf("-X %s: variable has type %s, not string", name, typ)
+	}
+	info := c.getGlobalInfo(g)
+	if info.extern {
+		return fmt.Errorf("-X %s: cannot set an external variable", name)
+	}
+	global := c.mod.NamedGlobal(info.linkName)
+	if global.IsNil() {
+		// The variable is never used, so it was not included in the program.
+		return nil
+	}
+
+	// Remove the store of the initial value, which would otherwise overwrite
+	// the new value.
+	initFn := c.mod.NamedFunction(pkg.Pkg.Path() + ".init")
+	for _, use := range getUses(global) {
+		if use.IsAStoreInst().IsNil() || use.InstructionParent().Parent() != initFn || use.Operand(1) != global {
+			continue
+		}
+		if !use.Operand(0).IsConstant() {
+			return fmt.Errorf("-X %s: variable is not initialized to a constant string", name)
+		}
+		use.EraseFromParentAsInstruction()
+	}
+
+	strGlobal := llvm.AddGlobal(c.mod, llvm.ArrayType(c.ctx.Int8Type(), len(value)), info.linkName+"$string")
+	strGlobal.SetInitializer(c.ctx.ConstString(value, false))
+	strGlobal.SetLinkage(llvm.InternalLinkage)
+	strGlobal.SetGlobalConstant(true)
+	strGlobal.SetUnnamedAddr(true)
+	zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+	strPtr := llvm.ConstInBoundsGEP(strGlobal, []llvm.Value{zero, zero})
+	strLen := llvm.ConstInt(c.uintptrType, uint64(len(value)), false)
+	global.SetInitializer(llvm.ConstNamedStruct(c.getLLVMRuntimeType("_string"), []llvm.Value{strPtr, strLen}))
+	return nil
+}
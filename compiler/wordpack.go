@@ -33,8 +33,11 @@ func (c *Compiler) emitPointerPack(values []llvm.Value) llvm.Value {
 			return c.builder.CreateIntToPtr(values[0], c.i8ptrType, "pack.int")
 		}
 		// Because packedType is a struct and we have to cast it to a *i8, store
-		// it in an alloca first for bitcasting (store+bitcast+load).
-		packedAlloc, _, _ = c.createTemporaryAlloca(packedType, "")
+		// it in an alloca first for bitcasting (store+bitcast+load). The
+		// alloca is pointer-sized, so that the *i8 can be loaded from it
+		// without reading past its end.
+		packedRawAlloc, _, _ := c.createTemporaryAlloca(c.i8ptrType, "pack.raw.alloc")
+		packedAlloc = c.builder.CreateBitCast(packedRawAlloc, llvm.PointerType(packedType, 0), "pack.alloc")
 	} else {
 		// Packed data is bigger than a pointer, so allocate it on the heap.
 		sizeValue := llvm.ConstInt(c.uintptrType, size, false)
@@ -0,0 +1,109 @@
+package interp
+
+// This file implements evaluation of calls to functions that are marked to be
+// evaluated at compile time, outside of package initializers.
+
+import (
+	"fmt"
+	"go/token"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// CompileTimeAttribute is the string attribute the compiler adds to functions
+// marked with //go:compiletime. Calls to these functions are replaced with
+// their result by EvalCompileTimeCalls where possible.
+const CompileTimeAttribute = "tinygo-compiletime"
+
+// CallError is returned for calls to compile-time functions that could not be
+// evaluated at compile time. These calls are left to be done at runtime.
+type CallError struct {
+	Call llvm.Value     // the call instruction
+	Pos  token.Position // source location of the call, if it has debug info
+	Err  error          // underlying error
+}
+
+func (e *CallError) Error() string {
+	msg := "cannot evaluate call to " + e.Call.CalledValue().Name()
+	if e.Pos.IsValid() {
+		msg += " at " + e.Pos.String()
+	}
+	return msg + " at compile time: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, usually a *Diagnostic.
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+// EvalCompileTimeCalls evaluates all calls to functions marked with
+// CompileTimeAttribute and replaces each call with its result. Only calls with
+// constant parameters can be evaluated, and the function must be pure: it may
+// not read or modify any global that is not constant. Calls that cannot be
+// evaluated are left in place and are returned as a list of errors.
+func (e *Eval) EvalCompileTimeCalls() []error {
+	var errs []error
+	for fn := e.Mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		if fn.GetStringAttributeAtIndex(-1, CompileTimeAttribute).IsNil() {
+			continue
+		}
+		for _, call := range getUses(fn) {
+			if call.IsACallInst().IsNil() || call.CalledValue() != fn {
+				continue // not a direct call
+			}
+			err := e.evalCompileTimeCall(fn, call)
+			if err != nil {
+				err := &CallError{Call: call, Pos: getPosition(call), Err: err}
+				e.debugf(DebugSummary, "%v", err)
+				errs = append(errs, err)
+				continue
+			}
+			e.debugf(DebugSummary, "evaluated call to %s at compile time", fn.Name())
+		}
+	}
+	return errs
+}
+
+// evalCompileTimeCall evaluates a single call to the given compile-time
+// function and replaces the call with the result on success.
+func (e *Eval) evalCompileTimeCall(fn, call llvm.Value) error {
+	scan := e.hasSideEffects(fn)
+	if scan.severity != sideEffectNone {
+		return newDiagnostic(Unsupported, fn, "function has side effects")
+	}
+	for global := range scan.mentionsGlobals {
+		if !global.IsGlobalConstant() {
+			return newDiagnostic(Unsupported, global, "function accesses global "+global.Name())
+		}
+	}
+	var params []Value
+	for i := 0; i < call.OperandsCount()-1; i++ {
+		param := e.getValue(call.Operand(i))
+		if !param.IsConstant() {
+			return newDiagnostic(Unsupported, call.Operand(i), fmt.Sprintf("parameter %d is not a constant", i))
+		}
+		params = append(params, param)
+	}
+
+	e.begin(call)
+	e.instructions = 0
+	result, err := e.Function(fn, params, fn.Name())
+	if err == nil && llvm.PrevInstruction(call) != e.tx.start {
+		err = newDiagnostic(Unsupported, fn, "function emitted code to run at runtime")
+	}
+	if err == nil && result != nil && !result.IsConstant() {
+		err = newDiagnostic(Unsupported, result.Value(), "result is not a constant")
+	}
+	if err != nil {
+		e.rollback()
+		return err
+	}
+	if result != nil {
+		// Replace the call before committing, so that globals referenced by
+		// the result (such as heap allocations) are kept.
+		call.ReplaceAllUsesWith(result.Value())
+	}
+	e.commit()
+	call.EraseFromParentAsInstruction()
+	return nil
+}
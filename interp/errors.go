@@ -3,15 +3,235 @@ package interp
 // This file provides useful types for errors encountered during IR evaluation.
 
 import (
+	"go/token"
+
 	"tinygo.org/x/go-llvm"
 )
 
-type Unsupported struct {
-	Inst llvm.Value
+// Error is an error that occurred while interpreting a package initializer. It
+// records where exactly interpretation failed, as far as that is known.
+type Error struct {
+	PkgName string         // package being initialized
+	Fn      llvm.Value     // function being interpreted (may be nil)
+	Inst    llvm.Value     // offending instruction (may be nil)
+	Pos     token.Position // source location of Inst, if it has debug info
+	Err     error          // underlying error
+}
+
+func (e *Error) Error() string {
+	msg := "package " + e.PkgName + ": cannot interpret init"
+	if e.Kind() == Panic {
+		msg = "package " + e.PkgName + ": init panics"
+	}
+	if e.Pos.IsValid() {
+		msg += " at " + e.Pos.String()
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, usually a *Diagnostic.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Kind returns the kind of failure, as recorded in the underlying *Diagnostic.
+func (e *Error) Kind() ErrorKind {
+	if d, ok := e.Err.(*Diagnostic); ok {
+		return d.Kind
+	}
+	return Unsupported
+}
+
+// Instruction returns the offending instruction in textual form, or an empty
+// string if the error is not caused by a particular instruction.
+func (e *Error) Instruction() string {
+	if e.Inst.IsNil() {
+		return ""
+	}
+	return valueString(e.Inst)
+}
+
+// errorAt returns an *Error for an error that was encountered while
+// interpreting the given instruction. Errors that are already of type *Error
+// (for example, because they happened in a called function) are returned
+// unmodified. Errors that are not a *Diagnostic are assumed to be caused by an
+// unsupported operation.
+func (fr *frame) errorAt(inst llvm.Value, err error) *Error {
+	if err, ok := err.(*Error); ok {
+		return err
+	}
+	if _, ok := err.(*Diagnostic); !ok {
+		err = newDiagnostic(Unsupported, inst, err.Error())
+	}
+	return &Error{
+		PkgName: fr.pkgName,
+		Fn:      fr.fn,
+		Inst:    inst,
+		Pos:     getPosition(inst),
+		Err:     err,
+	}
+}
+
+// Warning describes a condition that is not an error, but that users may want
+// to know about because the program ends up larger or slower than expected: for
+// example, a package initializer that is run at runtime instead of at compile
+// time. See Eval.Warnings.
+type Warning struct {
+	PkgName string         // package being initialized
+	Kind    ErrorKind      // reason for the warning
+	Pos     token.Position // source location, if known
+	Msg     string
+}
+
+func (w *Warning) String() string {
+	msg := "package " + w.PkgName
+	if w.Pos.IsValid() {
+		msg += " at " + w.Pos.String()
+	}
+	return msg + ": " + w.Msg
+}
+
+// warnReverted records a warning for a package initializer that could not be
+// interpreted because of the given error, and is run at runtime instead. The
+// error is also recorded as the reason why it was reverted.
+func (e *Eval) warnReverted(pkgName string, err error) {
+	r := &Revert{
+		PkgName: pkgName,
+		Kind:    Unsupported,
+		Reason:  err.Error(),
+	}
+	if err, ok := err.(*Error); ok {
+		r.Kind = err.Kind()
+		r.Pos = err.Pos
+		r.Reason = err.Err.Error()
+	}
+	e.reverted = append(e.reverted, r)
+	e.warnings = append(e.warnings, &Warning{
+		PkgName: pkgName,
+		Kind:    r.Kind,
+		Pos:     r.Pos,
+		Msg:     "init run at runtime: " + r.Reason,
+	})
+}
+
+// warnUnknownSideEffects records a warning for a package initializer with
+// unknown side effects that is run at runtime, which stops all remaining
+// initializers from being interpreted.
+func (e *Eval) warnUnknownSideEffects(pkgName string) {
+	e.warnings = append(e.warnings, &Warning{
+		PkgName: pkgName,
+		Kind:    Unsupported,
+		Msg:     "init has unknown side effects, not interpreting remaining inits",
+	})
+}
+
+// Warnings returns the warnings collected by Run and RunReverted, in the order
+// in which they were found.
+func (e *Eval) Warnings() []*Warning {
+	return e.warnings
+}
+
+// Revert describes why a package initializer is run at runtime instead of being
+// interpreted at compile time. See Eval.Reverted.
+type Revert struct {
+	PkgName string         // package being initialized
+	Kind    ErrorKind      // kind of failure
+	Pos     token.Position // source location, if known
+	Reason  string
+}
+
+func (r *Revert) String() string {
+	msg := "package " + r.PkgName
+	if r.Pos.IsValid() {
+		msg += " at " + r.Pos.String()
+	}
+	return msg + ": " + r.Reason
+}
+
+// Reverted returns the reason for each package initializer that Run or
+// RunReverted left to be run at runtime, in the order in which the
+// initializers are called. There is at most one reason per package: the first
+// failure that stopped interpretation.
+func (e *Eval) Reverted() []*Revert {
+	return e.reverted
+}
+
+// UpdateReverted updates the reasons returned by Reverted of an earlier Eval
+// (usually the one that called Run) with the result of RunReverted on this
+// Eval: initializers that were interpreted this time are removed, and those
+// that failed again get their new reason.
+func (e *Eval) UpdateReverted(reverted []*Revert) []*Revert {
+	retried := make(map[string]bool)
+	for _, p := range e.profile {
+		retried[p.PkgName] = true
+	}
+	again := make(map[string]*Revert)
+	for _, r := range e.reverted {
+		again[r.PkgName] = r
+	}
+	var result []*Revert
+	for _, r := range reverted {
+		if retried[r.PkgName] {
+			r = again[r.PkgName]
+		}
+		if r != nil {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// ErrorKind describes why interpretation failed.
+type ErrorKind int
+
+const (
+	Unsupported      ErrorKind = iota // not supported by the interpreter, so it must run at runtime
+	Malformed                         // the IR is not in the form the compiler normally emits
+	Budget                            // the instruction, call depth or memory limit was exceeded
+	Nondeterministic                  // the result may be different each time the program runs
+	Unreachable                       // an unreachable instruction was executed (usually after a panic)
+	Panic                             // the init function always panics, with a known message
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case Unsupported:
+		return "unsupported"
+	case Malformed:
+		return "malformed"
+	case Budget:
+		return "budget"
+	case Nondeterministic:
+		return "nondeterministic"
+	case Unreachable:
+		return "unreachable"
+	case Panic:
+		return "panic"
+	default:
+		return "unknown"
+	}
+}
+
+// Diagnostic is the underlying error of an *Error. It describes what kind of
+// failure happened, so that callers can react differently to for example
+// malformed IR than to code that can only run at runtime.
+type Diagnostic struct {
+	Kind  ErrorKind
+	Value llvm.Value // offending value (may be nil)
+	Msg   string
+}
+
+func (d *Diagnostic) Error() string {
+	return d.Msg
+}
+
+// newDiagnostic returns a new *Diagnostic for the given value.
+func newDiagnostic(kind ErrorKind, value llvm.Value, msg string) *Diagnostic {
+	return &Diagnostic{Kind: kind, Value: value, Msg: msg}
 }
 
-func (e Unsupported) Error() string {
-	// TODO: how to return the actual instruction string?
-	// It looks like LLVM provides no function for that...
-	return "interp: unsupported instruction"
+// unsupportedInstruction returns a *Diagnostic for an instruction that is not
+// supported by the interpreter.
+func unsupportedInstruction(inst llvm.Value) *Diagnostic {
+	return newDiagnostic(Unsupported, inst, "unsupported instruction: "+valueString(inst))
 }
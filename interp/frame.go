@@ -4,7 +4,7 @@ package interp
 // functions.
 
 import (
-	"errors"
+	"fmt"
 	"strings"
 
 	"tinygo.org/x/go-llvm"
@@ -14,169 +14,310 @@ type frame struct {
 	*Eval
 	fn      llvm.Value
 	pkgName string
-	locals  map[llvm.Value]Value
+	depth   int                        // number of calls between the init function and this frame
+	locals  map[llvm.Value]llvm.Value  // evaluated instructions and parameters
+	maps    map[llvm.Value]*MapValue   // instructions that evaluated to a map
+	values  map[llvm.Value]*LocalValue // wrappers returned by getLocal, by evaluated value
+	allocas []llvm.Value               // globals created for allocas in this function
 }
 
-var ErrUnreachable = errors.New("interp: unreachable executed")
-
 // evalBasicBlock evaluates a single basic block, returning the return value (if
 // ending with a ret instruction), a list of outgoing basic blocks (if not
 // ending with a ret instruction), or an error on failure.
 // Most of it works at compile time. Some calls get translated into calls to be
 // executed at runtime: calls to functions with side effects, external calls,
 // and operations on the result of such instructions.
-func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (retval Value, outgoing []llvm.Value, err error) {
+func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock) (retval Value, outgoing []llvm.Value, err error) {
 	for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
-		if fr.Debug {
-			print(indent)
-			inst.Dump()
-			println()
+		fr.instructions++
+		if fr.MaxInstructions > 0 && fr.instructions > fr.MaxInstructions {
+			return nil, nil, fr.errorAt(inst, newDiagnostic(Budget, inst, fmt.Sprintf("exceeded the limit of %d instructions", fr.MaxInstructions)))
+		}
+		if diag := fr.checkMemory(inst); diag != nil {
+			// Checked before every instruction, so that the memory created by
+			// the previous instruction is never used.
+			return nil, nil, fr.errorAt(inst, diag)
+		}
+		if fr.Debug >= DebugInstructions {
+			fr.debugf(DebugInstructions, "%s%s", strings.Repeat("    ", fr.depth+1), valueString(inst))
 		}
 		switch {
 		case !inst.IsABinaryOperator().IsNil():
-			lhs := fr.getLocal(inst.Operand(0)).(*LocalValue).Underlying
-			rhs := fr.getLocal(inst.Operand(1)).(*LocalValue).Underlying
+			lhs := fr.getLocalValue(inst.Operand(0))
+			rhs := fr.getLocalValue(inst.Operand(1))
 
 			switch inst.InstructionOpcode() {
 			// Standard binary operators
 			case llvm.Add:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateAdd(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateAdd(lhs, rhs, "")
 			case llvm.FAdd:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFAdd(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateFAdd(lhs, rhs, "")
 			case llvm.Sub:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateSub(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateSub(lhs, rhs, "")
 			case llvm.FSub:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFSub(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateFSub(lhs, rhs, "")
 			case llvm.Mul:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateMul(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateMul(lhs, rhs, "")
 			case llvm.FMul:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFMul(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateFMul(lhs, rhs, "")
 			case llvm.UDiv:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateUDiv(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateUDiv(lhs, rhs, "")
 			case llvm.SDiv:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateSDiv(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateSDiv(lhs, rhs, "")
 			case llvm.FDiv:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFDiv(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateFDiv(lhs, rhs, "")
 			case llvm.URem:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateURem(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateURem(lhs, rhs, "")
 			case llvm.SRem:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateSRem(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateSRem(lhs, rhs, "")
 			case llvm.FRem:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFRem(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateFRem(lhs, rhs, "")
 
 			// Logical operators
 			case llvm.Shl:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateShl(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateShl(lhs, rhs, "")
 			case llvm.LShr:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateLShr(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateLShr(lhs, rhs, "")
 			case llvm.AShr:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateAShr(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateAShr(lhs, rhs, "")
 			case llvm.And:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateAnd(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateAnd(lhs, rhs, "")
 			case llvm.Or:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateOr(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateOr(lhs, rhs, "")
 			case llvm.Xor:
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateXor(lhs, rhs, "")}
+				fr.locals[inst] = fr.builder.CreateXor(lhs, rhs, "")
 
 			default:
-				return nil, nil, &Unsupported{inst}
+				return nil, nil, fr.errorAt(inst, unsupportedInstruction(inst))
 			}
 
 		// Memory operators
 		case !inst.IsAAllocaInst().IsNil():
 			allocType := inst.Type().ElementType()
-			alloca := llvm.AddGlobal(fr.Mod, allocType, fr.pkgName+"$alloca")
+			alloca := fr.addGlobal(allocType, fr.pkgName+"$alloca")
 			alloca.SetInitializer(llvm.ConstNull(allocType))
-			alloca.SetLinkage(llvm.InternalLinkage)
-			fr.locals[inst] = &LocalValue{
-				Underlying: alloca,
-				Eval:       fr.Eval,
-			}
+			fr.allocas = append(fr.allocas, alloca)
+			fr.locals[inst] = alloca
 		case !inst.IsALoadInst().IsNil():
-			operand := fr.getLocal(inst.Operand(0)).(*LocalValue)
+			// Use a temporary LocalValue on the stack to avoid a heap
+			// allocation for every load.
+			operand := LocalValue{fr.Eval, fr.getLocalValue(inst.Operand(0))}
+			if inst.IsVolatile() {
+				// Probably a hardware register, which must only be accessed
+				// at runtime.
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "volatile load"))
+			}
+			if isFixedAddress(operand.Underlying) {
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, operand.Underlying, "load from memory-mapped I/O address: "+valueString(operand.Underlying)))
+			}
 			var value llvm.Value
-			if !operand.IsConstant() || inst.IsVolatile() || (!operand.Underlying.IsAConstantExpr().IsNil() && operand.Underlying.Opcode() == llvm.BitCast) {
+			if !operand.IsConstant() {
 				value = fr.builder.CreateLoad(operand.Value(), inst.Name())
 			} else {
-				value = operand.Load()
+				value, err = operand.Load()
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
 			}
 			if value.Type() != inst.Type() {
 				panic("interp: load: type does not match")
 			}
-			fr.locals[inst] = fr.getValue(value)
+			fr.locals[inst] = value
 		case !inst.IsAStoreInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			ptr := fr.getLocal(inst.Operand(1))
+			value := fr.getLocalValue(inst.Operand(0))
+			ptr := LocalValue{fr.Eval, fr.getLocalValue(inst.Operand(1))}
 			if inst.IsVolatile() {
-				fr.builder.CreateStore(value.Value(), ptr.Value())
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "volatile store"))
+			}
+			if isFixedAddress(ptr.Value()) {
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, ptr.Value(), "store to memory-mapped I/O address: "+valueString(ptr.Value())))
+			}
+			if !ptr.IsConstant() {
+				// The pointer is only known at runtime, but may still point
+				// into a known global.
+				fr.markDirty(ptr.Value())
+				fr.builder.CreateStore(value, ptr.Value())
 			} else {
-				ptr.Store(value.Value())
+				err := ptr.Store(value)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
+			}
+		case isAtomicRMW(inst):
+			// Atomic operations are executed as plain memory operations:
+			// there is only one thread while interpreting init functions.
+			ptr := fr.getLocal(inst.Operand(0))
+			val := fr.getLocalValue(inst.Operand(1))
+			if !ptr.IsConstant() {
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, ptr.Value(), "atomic operation on a pointer only known at runtime"))
+			}
+			old, err := ptr.Load()
+			if err != nil {
+				return nil, nil, fr.errorAt(inst, err)
+			}
+			var result llvm.Value
+			switch getAtomicRMWOp(inst) {
+			case atomicRMWXchg:
+				result = val
+			case atomicRMWAdd:
+				result = fr.builder.CreateAdd(old, val, "")
+			case atomicRMWSub:
+				result = fr.builder.CreateSub(old, val, "")
+			case atomicRMWAnd:
+				result = fr.builder.CreateAnd(old, val, "")
+			case atomicRMWNand:
+				result = fr.builder.CreateNot(fr.builder.CreateAnd(old, val, ""), "")
+			case atomicRMWOr:
+				result = fr.builder.CreateOr(old, val, "")
+			case atomicRMWXor:
+				result = fr.builder.CreateXor(old, val, "")
+			case atomicRMWMax:
+				result = fr.builder.CreateSelect(fr.builder.CreateICmp(llvm.IntSGT, old, val, ""), old, val, "")
+			case atomicRMWMin:
+				result = fr.builder.CreateSelect(fr.builder.CreateICmp(llvm.IntSLT, old, val, ""), old, val, "")
+			case atomicRMWUMax:
+				result = fr.builder.CreateSelect(fr.builder.CreateICmp(llvm.IntUGT, old, val, ""), old, val, "")
+			case atomicRMWUMin:
+				result = fr.builder.CreateSelect(fr.builder.CreateICmp(llvm.IntULT, old, val, ""), old, val, "")
+			default:
+				return nil, nil, fr.errorAt(inst, unsupportedInstruction(inst))
+			}
+			err = ptr.Store(result)
+			if err != nil {
+				return nil, nil, fr.errorAt(inst, err)
+			}
+			fr.locals[inst] = old
+		case isAtomicCmpXchg(inst):
+			ptr := fr.getLocal(inst.Operand(0))
+			cmp := fr.getLocalValue(inst.Operand(1))
+			newValue := fr.getLocalValue(inst.Operand(2))
+			if !ptr.IsConstant() {
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, ptr.Value(), "atomic operation on a pointer only known at runtime"))
+			}
+			old, err := ptr.Load()
+			if err != nil {
+				return nil, nil, fr.errorAt(inst, err)
 			}
+			success := fr.builder.CreateICmp(llvm.IntEQ, old, cmp, "")
+			if success.IsAConstantInt().IsNil() {
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "cannot determine whether compare-and-swap succeeds"))
+			}
+			if success.ZExtValue() != 0 {
+				err = ptr.Store(newValue)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
+			}
+			// The result is a {old, success} pair.
+			fr.locals[inst] = llvm.ConstStruct([]llvm.Value{old, success}, false)
+		case isFence(inst):
+			// Nothing to order: init functions are interpreted sequentially.
 		case !inst.IsAGetElementPtrInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			llvmIndices := make([]llvm.Value, inst.OperandsCount()-1)
-			for i := range llvmIndices {
-				llvmIndices[i] = inst.Operand(i + 1)
-			}
-			indices := make([]uint32, len(llvmIndices))
-			for i, llvmIndex := range llvmIndices {
-				operand := fr.getLocal(llvmIndex)
-				if !operand.IsConstant() {
-					// Not a constant operation.
-					// This should be detected by the scanner, but isn't at the
-					// moment.
-					panic("todo: non-const gep")
-				}
-				indices[i] = uint32(operand.Value().ZExtValue())
-			}
-			result := value.GetElementPtr(indices)
+			value := fr.getLocalValue(inst.Operand(0))
+			isConstant := value.IsConstant()
+			indices := fr.indexBuf[:0] // reused to avoid an allocation per GEP
+			for i := 1; i < inst.OperandsCount(); i++ {
+				index := fr.getLocalValue(inst.Operand(i))
+				if !index.IsConstant() {
+					isConstant = false
+				}
+				indices = append(indices, index)
+			}
+			fr.indexBuf = indices
+			var result llvm.Value
+			if !isConstant {
+				// Pointer or index only known at runtime.
+				result = fr.builder.CreateGEP(value, indices, "")
+			} else if p, ok := fr.getPointer(value); ok {
+				// The indices may have been calculated during interpretation,
+				// for example in a loop. Calculate the location directly, so
+				// that it can't end up outside of the global.
+				offset, ok := fr.gepOffset(inst.Operand(0).Type().ElementType(), indices)
+				if !ok {
+					return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "getelementptr with unknown indices"))
+				}
+				location, ok := fr.checkPointer(pointer{p.global, p.offset + offset})
+				if !ok {
+					return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "getelementptr out of bounds of "+p.global.Name()))
+				}
+				result = fr.pointerValue(location, inst.Type())
+			} else {
+				// A constant pointer that is not based on a global, like a
+				// memory-mapped I/O address.
+				result = llvm.ConstGEP(value, indices)
+			}
 			if result.Type() != inst.Type() {
-				println(" expected:", inst.Type().String())
-				println(" actual:  ", result.Type().String())
-				panic("interp: gep: type does not match")
+				panic("interp: gep: type does not match: expected " + inst.Type().String() + ", got " + result.Type().String())
 			}
 			fr.locals[inst] = result
 
 		// Cast operators
 		case !inst.IsATruncInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateTrunc(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreateTrunc(value, inst.Type(), "")
 		case !inst.IsAZExtInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateZExt(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreateZExt(value, inst.Type(), "")
 		case !inst.IsASExtInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateSExt(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreateSExt(value, inst.Type(), "")
 		case !inst.IsAFPToUIInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFPToUI(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			if !value.IsAConstantFP().IsNil() && !floatFitsInt(constFloatValue(value), inst.Type().IntTypeWidth(), false) {
+				return nil, nil, fr.errorAt(inst, floatOutOfRange(inst, value))
+			}
+			fr.locals[inst] = fr.builder.CreateFPToUI(value, inst.Type(), "")
 		case !inst.IsAFPToSIInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFPToSI(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			if !value.IsAConstantFP().IsNil() && !floatFitsInt(constFloatValue(value), inst.Type().IntTypeWidth(), true) {
+				return nil, nil, fr.errorAt(inst, floatOutOfRange(inst, value))
+			}
+			fr.locals[inst] = fr.builder.CreateFPToSI(value, inst.Type(), "")
 		case !inst.IsAUIToFPInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateUIToFP(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreateUIToFP(value, inst.Type(), "")
 		case !inst.IsASIToFPInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateSIToFP(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreateSIToFP(value, inst.Type(), "")
 		case !inst.IsAFPTruncInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFPTrunc(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreateFPTrunc(value, inst.Type(), "")
 		case !inst.IsAFPExtInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFPExt(value.(*LocalValue).Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreateFPExt(value, inst.Type(), "")
 		case !inst.IsAPtrToIntInst().IsNil():
-			value := fr.getLocal(inst.Operand(0))
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreatePtrToInt(value.Value(), inst.Type(), "")}
+			value := fr.getLocalValue(inst.Operand(0))
+			fr.locals[inst] = fr.builder.CreatePtrToInt(value, inst.Type(), "")
+		case !inst.IsAIntToPtrInst().IsNil():
+			value := fr.getLocalValue(inst.Operand(0))
+			if p, ok := fr.getPointer(value); ok {
+				// The integer was derived from a known pointer, for example
+				// using a ptrtoint followed by some arithmetic. Convert it
+				// back into a regular pointer into the same global.
+				fr.locals[inst] = fr.pointerValue(p, inst.Type())
+			} else if fn := fr.getFunction(value); !fn.IsNil() {
+				// A function pointer that was stored as an integer, as in
+				// func values.
+				fr.locals[inst] = llvm.ConstBitCast(fn, inst.Type())
+			} else if !value.IsAConstantInt().IsNil() {
+				// A fixed address, such as nil.
+				fr.locals[inst] = fr.builder.CreateIntToPtr(value, inst.Type(), "")
+			} else {
+				// The pointer escapes analysis: stores through it can't be
+				// tracked.
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, value, "cannot convert integer to pointer: "+valueString(value)))
+			}
 		case !inst.IsABitCastInst().IsNil() && inst.Type().TypeKind() == llvm.PointerTypeKind:
 			operand := inst.Operand(0)
 			if !operand.IsACallInst().IsNil() {
 				fn := operand.CalledValue()
 				if !fn.IsAFunction().IsNil() && fn.Name() == "runtime.alloc" {
-					continue // special case: bitcast of alloc
+					if _, ok := fr.locals[inst]; ok {
+						continue // special case: bitcast of alloc
+					}
 				}
 			}
-			if _, ok := fr.getLocal(operand).(*MapValue); ok {
+			if _, ok := fr.maps[operand]; ok {
 				// Special case for runtime.trackPointer calls.
 				// Note: this might not be entirely sound in some rare cases
 				// where the map is stored in a dirty global.
@@ -190,85 +331,108 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 				// It is not possible in Go to bitcast a map value to a pointer.
 				panic("unimplemented: bitcast of map")
 			}
-			value := fr.getLocal(operand).(*LocalValue)
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateBitCast(value.Value(), inst.Type(), "")}
+			value := fr.getLocalValue(operand)
+			fr.locals[inst] = fr.builder.CreateBitCast(value, inst.Type(), "")
 
 		// Other operators
 		case !inst.IsAICmpInst().IsNil():
-			lhs := fr.getLocal(inst.Operand(0)).(*LocalValue).Underlying
-			rhs := fr.getLocal(inst.Operand(1)).(*LocalValue).Underlying
+			lhs := fr.getLocalValue(inst.Operand(0))
+			rhs := fr.getLocalValue(inst.Operand(1))
 			predicate := inst.IntPredicate()
-			if predicate == llvm.IntEQ && lhs.Type().TypeKind() == llvm.PointerTypeKind {
+			if lhs.Type().TypeKind() == llvm.PointerTypeKind {
 				// Unfortunately, the const propagation in the IR builder
-				// doesn't handle pointer compares of inttoptr values. So we
-				// implement it manually here.
-				lhsNil, ok1 := isPointerNil(lhs)
-				rhsNil, ok2 := isPointerNil(rhs)
-				if ok1 && ok2 {
-					if lhsNil && rhsNil {
-						// Both are nil, so this icmp is always evaluated to true.
-						fr.locals[inst] = &LocalValue{fr.Eval, llvm.ConstInt(fr.Mod.Context().Int1Type(), 1, false)}
-						continue
-					}
-					if lhsNil != rhsNil {
-						// Only one of them is nil, so this comparison must return false.
-						fr.locals[inst] = &LocalValue{fr.Eval, llvm.ConstInt(fr.Mod.Context().Int1Type(), 0, false)}
-						continue
-					}
+				// doesn't handle many pointer compares, such as those of
+				// inttoptr values or of pointers into the same global with
+				// differently typed indices. So we implement it manually here.
+				result, ok, err := fr.comparePointers(predicate, lhs, rhs)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
+				if ok {
+					fr.locals[inst] = result
+					continue
 				}
 			}
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateICmp(predicate, lhs, rhs, "")}
+			fr.locals[inst] = fr.builder.CreateICmp(predicate, lhs, rhs, "")
 		case !inst.IsAFCmpInst().IsNil():
-			lhs := fr.getLocal(inst.Operand(0)).(*LocalValue).Underlying
-			rhs := fr.getLocal(inst.Operand(1)).(*LocalValue).Underlying
+			lhs := fr.getLocalValue(inst.Operand(0))
+			rhs := fr.getLocalValue(inst.Operand(1))
 			predicate := inst.FloatPredicate()
-			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFCmp(predicate, lhs, rhs, "")}
+			fr.locals[inst] = fr.builder.CreateFCmp(predicate, lhs, rhs, "")
 		case !inst.IsAPHINode().IsNil():
 			for i := 0; i < inst.IncomingCount(); i++ {
 				if inst.IncomingBlock(i) == incoming {
-					fr.locals[inst] = fr.getLocal(inst.IncomingValue(i))
+					fr.setLocal(inst, inst.IncomingValue(i))
 				}
 			}
+		case !inst.IsASelectInst().IsNil():
+			// The optimizer turns simple branches into a select, for example
+			// to pick one of two globals based on the value of another global.
+			cond := fr.getLocalValue(inst.Operand(0))
+			if cond.IsAConstantInt().IsNil() {
+				trueValue := fr.getLocalValue(inst.Operand(1))
+				falseValue := fr.getLocalValue(inst.Operand(2))
+				fr.locals[inst] = fr.builder.CreateSelect(cond, trueValue, falseValue, "")
+			} else if cond.ZExtValue() != 0 {
+				fr.setLocal(inst, inst.Operand(1))
+			} else {
+				fr.setLocal(inst, inst.Operand(2))
+			}
 		case !inst.IsACallInst().IsNil():
 			callee := inst.CalledValue()
+			if callee.IsAFunction().IsNil() {
+				// An indirect call, for example through a function pointer
+				// loaded from a table. It can be interpreted like a direct
+				// call if the function pointer is known.
+				if fn := fr.getFunction(fr.getLocalValue(callee)); !fn.IsNil() && fn.Type() == callee.Type() {
+					callee = fn
+				}
+			}
 			switch {
+			case !callee.IsAInlineAsm().IsNil():
+				// Inline assembly, such as a memory barrier or a CPUID-style
+				// query. There is no way to know what it does.
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "call to inline assembly: "+valueString(inst)))
 			case callee.Name() == "runtime.alloc":
 				// heap allocation
-				users := getUses(inst)
+				// When allocating something other than i8*, the allocation is
+				// bitcast to the real type. The raw pointer may be used as
+				// well, for example when a value is packed in an interface.
 				var resultInst = inst
-				if len(users) == 1 && !users[0].IsABitCastInst().IsNil() {
-					// happens when allocating something other than i8*
-					resultInst = users[0]
+				for _, user := range getUses(inst) {
+					if !user.IsABitCastInst().IsNil() {
+						resultInst = user
+						break
+					}
 				}
-				size := fr.getLocal(inst.Operand(0)).(*LocalValue).Underlying.ZExtValue()
+				sizeValue := fr.getLocalValue(inst.Operand(0))
+				if sizeValue.IsAConstantInt().IsNil() {
+					return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "heap allocation of non-constant size"))
+				}
+				size := sizeValue.ZExtValue()
 				allocType := resultInst.Type().ElementType()
 				typeSize := fr.TargetData.TypeAllocSize(allocType)
-				elementCount := 1
-				if size != typeSize {
+				switch {
+				case size == typeSize:
+					fr.locals[resultInst] = fr.newAlloc(allocType)
+				case typeSize != 0 && size%typeSize == 0:
 					// allocate an array
-					if size%typeSize != 0 {
-						return nil, nil, &Unsupported{inst}
-					}
-					elementCount = int(size / typeSize)
-					allocType = llvm.ArrayType(allocType, elementCount)
-				}
-				alloc := llvm.AddGlobal(fr.Mod, allocType, fr.pkgName+"$alloc")
-				alloc.SetInitializer(llvm.ConstNull(allocType))
-				alloc.SetLinkage(llvm.InternalLinkage)
-				result := &LocalValue{
-					Underlying: alloc,
-					Eval:       fr.Eval,
-				}
-				if elementCount == 1 {
-					fr.locals[resultInst] = result
-				} else {
-					fr.locals[resultInst] = result.GetElementPtr([]uint32{0, 0})
+					alloc := fr.newAlloc(llvm.ArrayType(allocType, int(size/typeSize)))
+					fr.locals[resultInst] = llvm.ConstGEP(alloc, getLLVMIndices(fr.Mod.Context().Int32Type(), []uint32{0, 0}))
+				default:
+					// The size doesn't match the type, so allocate raw memory
+					// that is accessed through a bitcast.
+					alloc := fr.newAlloc(llvm.ArrayType(fr.Mod.Context().Int8Type(), int(size)))
+					fr.locals[resultInst] = llvm.ConstBitCast(alloc, resultInst.Type())
+				}
+				if resultInst != inst {
+					fr.locals[inst] = llvm.ConstBitCast(fr.locals[resultInst], inst.Type())
 				}
 			case callee.Name() == "runtime.hashmapMake":
 				// create a map
 				keySize := inst.Operand(0).ZExtValue()
 				valueSize := inst.Operand(1).ZExtValue()
-				fr.locals[inst] = &MapValue{
+				fr.maps[inst] = &MapValue{
 					Eval:      fr.Eval,
 					PkgName:   fr.pkgName,
 					KeySize:   int(keySize),
@@ -282,54 +446,63 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 				keyBuf := fr.getLocal(inst.Operand(1)).(*LocalValue)
 				keyLen := fr.getLocal(inst.Operand(2)).(*LocalValue)
 				valPtr := fr.getLocal(inst.Operand(3)).(*LocalValue)
-				m.PutString(keyBuf, keyLen, valPtr)
+				err := m.PutString(keyBuf, keyLen, valPtr)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
 			case callee.Name() == "runtime.hashmapBinarySet":
 				// set a binary (int etc.) key in the map
 				m := fr.getLocal(inst.Operand(0)).(*MapValue)
 				keyBuf := fr.getLocal(inst.Operand(1)).(*LocalValue)
 				valPtr := fr.getLocal(inst.Operand(2)).(*LocalValue)
-				m.PutBinary(keyBuf, valPtr)
+				err := m.PutBinary(keyBuf, valPtr)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
 			case callee.Name() == "runtime.stringConcat":
 				// adding two strings together
 				buf1Ptr := fr.getLocal(inst.Operand(0))
 				buf1Len := fr.getLocal(inst.Operand(1))
 				buf2Ptr := fr.getLocal(inst.Operand(2))
 				buf2Len := fr.getLocal(inst.Operand(3))
-				buf1 := getStringBytes(buf1Ptr, buf1Len.Value())
-				buf2 := getStringBytes(buf2Ptr, buf2Len.Value())
+				buf1, err := getStringBytes(buf1Ptr, buf1Len.Value())
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
+				buf2, err := getStringBytes(buf2Ptr, buf2Len.Value())
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
 				result := []byte(string(buf1) + string(buf2))
 				vals := make([]llvm.Value, len(result))
 				for i := range vals {
 					vals[i] = llvm.ConstInt(fr.Mod.Context().Int8Type(), uint64(result[i]), false)
 				}
-				globalType := llvm.ArrayType(fr.Mod.Context().Int8Type(), len(result))
 				globalValue := llvm.ConstArray(fr.Mod.Context().Int8Type(), vals)
-				global := llvm.AddGlobal(fr.Mod, globalType, fr.pkgName+"$stringconcat")
-				global.SetInitializer(globalValue)
-				global.SetLinkage(llvm.InternalLinkage)
-				global.SetGlobalConstant(true)
-				global.SetUnnamedAddr(true)
+				global := fr.addConstantGlobal(globalValue, fr.pkgName+"$stringconcat")
 				stringType := fr.Mod.GetTypeByName("runtime._string")
 				retPtr := llvm.ConstGEP(global, getLLVMIndices(fr.Mod.Context().Int32Type(), []uint32{0, 0}))
 				retLen := llvm.ConstInt(stringType.StructElementTypes()[1], uint64(len(result)), false)
 				ret := llvm.ConstNull(stringType)
 				ret = llvm.ConstInsertValue(ret, retPtr, []uint32{0})
 				ret = llvm.ConstInsertValue(ret, retLen, []uint32{1})
-				fr.locals[inst] = &LocalValue{fr.Eval, ret}
+				fr.locals[inst] = ret
 			case callee.Name() == "runtime.stringToBytes":
 				// convert a string to a []byte
 				bufPtr := fr.getLocal(inst.Operand(0))
 				bufLen := fr.getLocal(inst.Operand(1))
-				result := getStringBytes(bufPtr, bufLen.Value())
+				result, err := getStringBytes(bufPtr, bufLen.Value())
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
 				vals := make([]llvm.Value, len(result))
 				for i := range vals {
 					vals[i] = llvm.ConstInt(fr.Mod.Context().Int8Type(), uint64(result[i]), false)
 				}
 				globalType := llvm.ArrayType(fr.Mod.Context().Int8Type(), len(result))
 				globalValue := llvm.ConstArray(fr.Mod.Context().Int8Type(), vals)
-				global := llvm.AddGlobal(fr.Mod, globalType, fr.pkgName+"$bytes")
+				global := fr.addGlobal(globalType, fr.pkgName+"$bytes")
 				global.SetInitializer(globalValue)
-				global.SetLinkage(llvm.InternalLinkage)
 				global.SetGlobalConstant(true)
 				global.SetUnnamedAddr(true)
 				sliceType := inst.Type()
@@ -339,31 +512,59 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 				ret = llvm.ConstInsertValue(ret, retPtr, []uint32{0}) // ptr
 				ret = llvm.ConstInsertValue(ret, retLen, []uint32{1}) // len
 				ret = llvm.ConstInsertValue(ret, retLen, []uint32{2}) // cap
-				fr.locals[inst] = &LocalValue{fr.Eval, ret}
+				fr.locals[inst] = ret
+			case callee.Name() == "runtime.sliceAppend" && fr.isKnownAppend(inst):
+				// append(slice, elems...), with a slice and elements that are
+				// known at compile time
+				result, err := fr.sliceAppend(inst)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
+				fr.locals[inst] = result
+			case callee.Name() == "runtime.typeAssert":
+				// Type assert on a concrete type: compare the typecode of the
+				// dynamic type with the asserted typecode.
+				typeInInterface, ok := fr.dynamicType(fr.getLocalValue(inst.Operand(0)))
+				if !ok {
+					return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "type assert on unknown dynamic type"))
+				}
+				assertedType := fr.getLocalValue(inst.Operand(1))
+				var commaOk uint64 // i1 false
+				if !typeInInterface.IsNil() && llvm.ConstExtractValue(typeInInterface.Initializer(), []uint32{0}) == assertedType {
+					commaOk = 1 // i1 true
+				}
+				fr.locals[inst] = llvm.ConstInt(fr.Mod.Context().Int1Type(), commaOk, false)
 			case callee.Name() == "runtime.interfaceImplements":
-				typecode := fr.getLocal(inst.Operand(0)).(*LocalValue).Underlying
-				interfaceMethodSet := fr.getLocal(inst.Operand(1)).(*LocalValue).Underlying
-				if typecode.IsAConstantExpr().IsNil() || typecode.Opcode() != llvm.PtrToInt {
-					panic("interp: expected typecode to be a ptrtoint")
+				typeInInterface, ok := fr.dynamicType(fr.getLocalValue(inst.Operand(0)))
+				if !ok {
+					return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, inst, "type assert on unknown dynamic type"))
 				}
-				typecode = typecode.Operand(0)
+				if typeInInterface.IsNil() {
+					// A nil interface doesn't implement any interface.
+					fr.locals[inst] = llvm.ConstInt(fr.Mod.Context().Int1Type(), 0, false)
+					break
+				}
+				interfaceMethodSet := fr.getLocalValue(inst.Operand(1))
 				if interfaceMethodSet.IsAConstantExpr().IsNil() || interfaceMethodSet.Opcode() != llvm.GetElementPtr {
 					panic("interp: expected method set in runtime.interfaceImplements to be a constant gep")
 				}
 				interfaceMethodSet = interfaceMethodSet.Operand(0).Initializer()
-				methodSet := llvm.ConstExtractValue(typecode.Initializer(), []uint32{1})
-				if methodSet.IsAConstantExpr().IsNil() || methodSet.Opcode() != llvm.GetElementPtr {
-					panic("interp: expected method set to be a constant gep")
-				}
-				methodSet = methodSet.Operand(0).Initializer()
 
 				// Make a set of all the methods on the concrete type, for
-				// easier checking in the next step.
+				// easier checking in the next step. Types without methods
+				// have a nil method set.
 				definedMethods := map[string]struct{}{}
-				for i := 0; i < methodSet.Type().ArrayLength(); i++ {
-					methodInfo := llvm.ConstExtractValue(methodSet, []uint32{uint32(i)})
-					name := llvm.ConstExtractValue(methodInfo, []uint32{0}).Name()
-					definedMethods[name] = struct{}{}
+				methodSet := llvm.ConstExtractValue(typeInInterface.Initializer(), []uint32{1})
+				if !methodSet.IsNull() {
+					if methodSet.IsAConstantExpr().IsNil() || methodSet.Opcode() != llvm.GetElementPtr {
+						panic("interp: expected method set to be a constant gep")
+					}
+					methodSet = methodSet.Operand(0).Initializer()
+					for i := 0; i < methodSet.Type().ArrayLength(); i++ {
+						methodInfo := llvm.ConstExtractValue(methodSet, []uint32{uint32(i)})
+						name := llvm.ConstExtractValue(methodInfo, []uint32{0}).Name()
+						definedMethods[name] = struct{}{}
+					}
 				}
 				// Check whether all interface methods are also in the list
 				// of defined methods calculated above.
@@ -377,40 +578,104 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 						break
 					}
 				}
-				fr.locals[inst] = &LocalValue{fr.Eval, llvm.ConstInt(fr.Mod.Context().Int1Type(), implements, false)}
-			case callee.Name() == "runtime.nanotime":
-				fr.locals[inst] = &LocalValue{fr.Eval, llvm.ConstInt(fr.Mod.Context().Int64Type(), 0, false)}
-			case callee.Name() == "llvm.dbg.value":
+				fr.locals[inst] = llvm.ConstInt(fr.Mod.Context().Int1Type(), implements, false)
+			case isNondeterministic(callee):
+				// The result would differ between the build and the actual
+				// run, so this must be called at runtime.
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Nondeterministic, callee, "call to nondeterministic function "+callee.Name()))
+			case strings.HasPrefix(callee.Name(), "llvm.dbg."):
 				// do nothing
+			case callee.Name() == "llvm.lifetime.start.p0i8" || callee.Name() == "llvm.lifetime.end.p0i8":
+				// Allocas are turned into globals, which live forever.
 			case callee.Name() == "runtime.trackPointer":
 				// do nothing
-			case strings.HasPrefix(callee.Name(), "runtime.print") || callee.Name() == "runtime._panic":
+			case callee.Name() == "runtime.isnil" && fr.isNonNil(fr.getLocalValue(inst.Operand(0))):
+				// A nil check inserted by the front-end before dereferencing a
+				// pointer that is known to be valid, such as the result of
+				// new(T). Folding it avoids branching on a runtime value.
+				fr.locals[inst] = llvm.ConstInt(fr.Mod.Context().Int1Type(), 0, false)
+			case callee.Name() == "runtime.lookupPanic" || callee.Name() == "runtime.slicePanic":
+				// A bounds check failed, for example when indexing or slicing
+				// a string with a constant index that is out of range.
+				msg := "index out of range"
+				if callee.Name() == "runtime.slicePanic" {
+					msg = "slice out of range"
+				}
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Panic, inst, "panic: runtime error: "+msg))
+			case callee.Name() == "runtime._panic" || callee.Name() == "runtime.runtimePanic":
+				if msg, ok := fr.panicMessage(inst, callee); ok {
+					// This init function will always panic at startup, so
+					// report it now.
+					return nil, nil, fr.errorAt(inst, newDiagnostic(Panic, inst, msg))
+				}
+				// The message is not known at compile time. Leave it to panic
+				// at runtime.
+				fr.callExternal(inst, callee)
+			case strings.HasPrefix(callee.Name(), "runtime.print"):
 				// This are all print instructions, which necessarily have side
 				// effects but no results.
-				// TODO: print an error when executing runtime._panic (with the
-				// exact error message it would print at runtime).
 				var params []llvm.Value
 				for i := 0; i < inst.OperandsCount()-1; i++ {
-					operand := fr.getLocal(inst.Operand(i)).Value()
+					operand := fr.getLocalValue(inst.Operand(i))
 					fr.markDirty(operand)
 					params = append(params, operand)
 				}
 				// TODO: accurate debug info, including call chain
 				fr.builder.CreateCall(callee, params, inst.Name())
-			case !callee.IsAFunction().IsNil() && callee.IsDeclaration():
-				// external functions
+			case strings.HasPrefix(callee.Name(), "llvm.memcpy.p0i8.p0i8.") || strings.HasPrefix(callee.Name(), "llvm.memmove.p0i8.p0i8."):
+				dst := fr.getLocal(inst.Operand(0))
+				src := fr.getLocal(inst.Operand(1))
+				n, ok := fr.constantInt(fr.getLocalValue(inst.Operand(2)))
+				if !dst.IsConstant() || !src.IsConstant() || !ok || isVolatileIntrinsic(inst) {
+					fr.callExternal(inst, callee)
+					continue
+				}
+				err := fr.copyMemory(dst.Value(), src.Value(), n)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
+			case strings.HasPrefix(callee.Name(), "llvm.memset.p0i8."):
+				dst := fr.getLocal(inst.Operand(0))
+				value := fr.getLocalValue(inst.Operand(1))
+				n, ok := fr.constantInt(fr.getLocalValue(inst.Operand(2)))
+				if !dst.IsConstant() || value.IsAConstantInt().IsNil() || !ok || isVolatileIntrinsic(inst) {
+					fr.callExternal(inst, callee)
+					continue
+				}
+				err := fr.setMemory(dst.Value(), byte(value.ZExtValue()), n)
+				if err != nil {
+					return nil, nil, fr.errorAt(inst, err)
+				}
+			case getPureFunction(callee) != nil:
+				// Known pure function, which can be evaluated at compile
+				// time if all parameters are known.
 				var params []llvm.Value
+				isConstant := true
 				for i := 0; i < inst.OperandsCount()-1; i++ {
-					operand := fr.getLocal(inst.Operand(i)).Value()
-					fr.markDirty(operand)
-					params = append(params, operand)
+					local := fr.getLocal(inst.Operand(i))
+					if !local.IsConstant() {
+						isConstant = false
+					}
+					params = append(params, local.Value())
 				}
-				// TODO: accurate debug info, including call chain
-				result := fr.builder.CreateCall(callee, params, inst.Name())
-				if inst.Type().TypeKind() != llvm.VoidTypeKind {
-					fr.markDirty(result)
-					fr.locals[inst] = &LocalValue{fr.Eval, result}
+				var result llvm.Value
+				ok := false
+				if isConstant {
+					result, ok = getPureFunction(callee)(params, inst.Type())
+				}
+				if !ok {
+					fr.callExternal(inst, callee)
+					continue
 				}
+				fr.locals[inst] = result
+			case strings.HasPrefix(callee.Name(), "llvm.") && !isRuntimeIntrinsic(callee):
+				// Intrinsics are not regular external functions: they may
+				// refer to the frame of the caller or require constant
+				// operands, so they can't be moved to the residual function.
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, callee, "call to unsupported intrinsic "+callee.Name()))
+			case !callee.IsAFunction().IsNil() && callee.IsDeclaration():
+				// external functions
+				fr.callExternal(inst, callee)
 			case !callee.IsAFunction().IsNil():
 				// regular function
 				var params []Value
@@ -433,6 +698,9 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 					llvmParams := make([]llvm.Value, len(params))
 					for i, param := range params {
 						llvmParams[i] = param.Value()
+						// Pointers passed to the function escape, so the
+						// function may modify what they point to.
+						fr.markDirty(param.Value())
 					}
 					result := fr.builder.CreateCall(callee, llvmParams, inst.Name())
 					ret = &LocalValue{fr.Eval, result}
@@ -446,42 +714,53 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 					//     compile time.
 					//   * Unbounded: cannot call at runtime so we'll try to
 					//     interpret anyway and hope for the best.
-					ret, err = fr.function(callee, params, fr.pkgName, indent+"    ")
+					if isWeak(callee) && !isODR(callee) {
+						// The linker may pick a different definition.
+						return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, callee, "call to function with weak linkage: "+callee.Name()))
+					}
+					if fr.MaxCallDepth > 0 && fr.depth+1 > fr.MaxCallDepth {
+						return nil, nil, fr.errorAt(inst, newDiagnostic(Budget, inst, fmt.Sprintf("exceeded the maximum call depth of %d", fr.MaxCallDepth)))
+					}
+					ret, err = fr.function(callee, params, fr.pkgName, fr.depth+1)
 					if err != nil {
-						return nil, nil, err
+						return nil, nil, fr.errorAt(inst, err)
 					}
 				}
 				if inst.Type().TypeKind() != llvm.VoidTypeKind {
-					fr.locals[inst] = ret
+					if m, ok := ret.(*MapValue); ok {
+						fr.maps[inst] = m
+					} else {
+						fr.locals[inst] = ret.Value()
+					}
 				}
 			default:
 				// function pointers, etc.
-				return nil, nil, &Unsupported{inst}
+				return nil, nil, fr.errorAt(inst, unsupportedInstruction(inst))
 			}
 		case !inst.IsAExtractValueInst().IsNil():
-			agg := fr.getLocal(inst.Operand(0)).(*LocalValue) // must be constant
+			agg := fr.getLocalValue(inst.Operand(0))
 			indices := inst.Indices()
-			if agg.Underlying.IsConstant() {
-				newValue := llvm.ConstExtractValue(agg.Underlying, indices)
-				fr.locals[inst] = fr.getValue(newValue)
+			if agg.IsConstant() {
+				newValue := llvm.ConstExtractValue(agg, indices)
+				fr.locals[inst] = newValue
 			} else {
-				if len(indices) != 1 {
-					return nil, nil, errors.New("cannot handle extractvalue with not exactly 1 index")
+				// Aggregate only known at runtime. Extract one level at a
+				// time, as the builder only supports a single index.
+				value := agg
+				for _, index := range indices {
+					value = fr.builder.CreateExtractValue(value, int(index), "")
 				}
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateExtractValue(agg.Underlying, int(indices[0]), inst.Name())}
+				fr.locals[inst] = value
 			}
 		case !inst.IsAInsertValueInst().IsNil():
-			agg := fr.getLocal(inst.Operand(0)).(*LocalValue) // must be constant
-			val := fr.getLocal(inst.Operand(1))
+			agg := LocalValue{fr.Eval, fr.getLocalValue(inst.Operand(0))}
+			val := LocalValue{fr.Eval, fr.getLocalValue(inst.Operand(1))}
 			indices := inst.Indices()
 			if agg.IsConstant() && val.IsConstant() {
-				newValue := llvm.ConstInsertValue(agg.Underlying, val.Value(), indices)
-				fr.locals[inst] = &LocalValue{fr.Eval, newValue}
+				newValue := llvm.ConstInsertValue(agg.Underlying, val.Underlying, indices)
+				fr.locals[inst] = newValue
 			} else {
-				if len(indices) != 1 {
-					return nil, nil, errors.New("cannot handle insertvalue with not exactly 1 index")
-				}
-				fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateInsertValue(agg.Underlying, val.Value(), int(indices[0]), inst.Name())}
+				fr.locals[inst] = fr.insertValue(agg.Underlying, val.Underlying, indices)
 			}
 
 		case !inst.IsAReturnInst().IsNil() && inst.OperandsCount() == 0:
@@ -490,19 +769,19 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 			return fr.getLocal(inst.Operand(0)), nil, nil
 		case !inst.IsABranchInst().IsNil() && inst.OperandsCount() == 3:
 			// conditional branch (if/then/else)
-			cond := fr.getLocal(inst.Operand(0)).Value()
+			cond := fr.getLocalValue(inst.Operand(0))
 			if cond.Type() != fr.Mod.Context().Int1Type() {
 				panic("expected an i1 in a branch instruction")
 			}
 			thenBB := inst.Operand(1)
 			elseBB := inst.Operand(2)
 			if !cond.IsAInstruction().IsNil() {
-				return nil, nil, errors.New("interp: branch on a non-constant")
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, cond, "branch on a non-constant"))
 			}
 			if !cond.IsAConstantExpr().IsNil() {
 				// This may happen when the instruction builder could not
 				// const-fold some instructions.
-				return nil, nil, errors.New("interp: branch on a non-const-propagated constant expression")
+				return nil, nil, fr.errorAt(inst, newDiagnostic(Unsupported, cond, "branch on a non-const-propagated constant expression"))
 			}
 			switch cond {
 			case llvm.ConstInt(fr.Mod.Context().Int1Type(), 0, false): // false
@@ -518,23 +797,250 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 		case !inst.IsAUnreachableInst().IsNil():
 			// Unreachable was reached (e.g. after a call to panic()).
 			// Report this as an error, as it is not supposed to happen.
-			return nil, nil, ErrUnreachable
+			return nil, nil, fr.errorAt(inst, newDiagnostic(Unreachable, inst, "unreachable executed"))
 
 		default:
-			return nil, nil, &Unsupported{inst}
+			return nil, nil, fr.errorAt(inst, unsupportedInstruction(inst))
 		}
 	}
 
 	panic("interp: reached end of basic block without terminator")
 }
 
-// Get the Value for an operand, which is a constant value of some sort.
+// callExternal emits a call to an external function, to be run at runtime. All
+// globals passed to it are marked dirty, as are its results.
+func (fr *frame) callExternal(inst, callee llvm.Value) {
+	var params []llvm.Value
+	for i := 0; i < inst.OperandsCount()-1; i++ {
+		operand := fr.getLocalValue(inst.Operand(i))
+		fr.markDirty(operand)
+		params = append(params, operand)
+	}
+	// TODO: accurate debug info, including call chain
+	result := fr.builder.CreateCall(callee, params, inst.Name())
+	if inst.Type().TypeKind() != llvm.VoidTypeKind {
+		fr.markDirty(result)
+		fr.locals[inst] = result
+	}
+}
+
+// panicMessage returns the message printed by a call to runtime._panic or
+// runtime.runtimePanic, as far as it is known at compile time. Only string
+// messages are supported.
+func (fr *frame) panicMessage(inst, callee llvm.Value) (string, bool) {
+	if inst.OperandsCount() < 3 {
+		return "", false
+	}
+	switch callee.Name() {
+	case "runtime.runtimePanic":
+		// func runtimePanic(msg string)
+		msg, err := getStringBytes(fr.getLocal(inst.Operand(0)), fr.getLocalValue(inst.Operand(1)))
+		if err != nil {
+			return "", false
+		}
+		return "panic: runtime error: " + string(msg), true
+	case "runtime._panic":
+		// func _panic(message interface{})
+		typecode, ok := fr.getPointer(fr.getLocalValue(inst.Operand(0)))
+		if !ok || typecode.global.Name() != "typeInInterface:reflect/types.type:basic:string" {
+			return "", false
+		}
+		str, ok := fr.getPointer(fr.getLocalValue(inst.Operand(1)))
+		if !ok {
+			return "", false
+		}
+		i8ptrType := llvm.PointerType(fr.Mod.Context().Int8Type(), 0)
+		uintptrType := fr.TargetData.IntPtrType()
+		strPtr, err := fr.load(fr.pointerValue(str, llvm.PointerType(i8ptrType, 0)), i8ptrType)
+		if err != nil {
+			return "", false
+		}
+		lenPtr := pointer{str.global, str.offset + int64(fr.TargetData.PointerSize())}
+		strLen, err := fr.load(fr.pointerValue(lenPtr, llvm.PointerType(uintptrType, 0)), uintptrType)
+		if err != nil {
+			return "", false
+		}
+		msg, err := getStringBytes(fr.getValue(strPtr), strLen)
+		if err != nil {
+			return "", false
+		}
+		return "panic: " + string(msg), true
+	}
+	return "", false
+}
+
+// Get the Value for an operand, which is a constant value of some sort. The
+// same wrapper is returned every time the operand evaluates to the same value
+// in this frame, so that interpreting a loop doesn't allocate a new one for
+// every use.
 func (fr *frame) getLocal(v llvm.Value) Value {
-	if ret, ok := fr.locals[v]; ok {
-		return ret
-	} else if value := fr.getValue(v); value != nil {
+	if m, ok := fr.maps[v]; ok {
+		return m
+	}
+	v = fr.getLocalValue(v)
+	if value, ok := fr.values[v]; ok {
+		return value
+	}
+	value := &LocalValue{fr.Eval, v}
+	fr.values[v] = value
+	return value
+}
+
+// getLocalValue is like getLocal, but returns the LLVM value directly. This
+// avoids allocating a Value in the common case where the operand is only used
+// to build a new instruction. It must not be used for map values.
+func (fr *frame) getLocalValue(v llvm.Value) llvm.Value {
+	if value, ok := fr.locals[v]; ok {
 		return value
+	}
+	return v
+}
+
+// setLocal sets the value of the instruction inst to the (already evaluated)
+// value of operand v, such as in a phi node.
+func (fr *frame) setLocal(inst, v llvm.Value) {
+	if m, ok := fr.maps[v]; ok {
+		fr.maps[inst] = m
 	} else {
-		panic("cannot find value")
+		fr.locals[inst] = fr.getLocalValue(v)
 	}
 }
+
+// insertValue inserts a value in an aggregate at runtime, at the given
+// (possibly nested) indices.
+func (fr *frame) insertValue(agg, val llvm.Value, indices []uint32) llvm.Value {
+	if len(indices) > 1 {
+		inner := fr.builder.CreateExtractValue(agg, int(indices[0]), "")
+		val = fr.insertValue(inner, val, indices[1:])
+	}
+	return fr.builder.CreateInsertValue(agg, val, int(indices[0]), "")
+}
+
+// dynamicType returns the runtime.typeInInterface global of the given typecode,
+// as stored in the first field of an interface value. The returned global is
+// nil for a nil interface. The ok value is false if the dynamic type is not
+// known at compile time.
+func (fr *frame) dynamicType(typecode llvm.Value) (typeInInterface llvm.Value, ok bool) {
+	if !typecode.IsAConstantInt().IsNil() && typecode.ZExtValue() == 0 {
+		return llvm.Value{}, true
+	}
+	if typecode.IsAConstantExpr().IsNil() || typecode.Opcode() != llvm.PtrToInt {
+		return llvm.Value{}, false
+	}
+	p, ok := fr.getPointer(typecode)
+	if !ok || p.offset != 0 || p.global.IsDeclaration() {
+		return llvm.Value{}, false
+	}
+	return p.global, true
+}
+
+// freeAllocas removes the globals created for allocas in this frame once the
+// function returns, unless they are still referenced: for example because the
+// address of the alloca was passed to a function called at runtime.
+func (fr *frame) freeAllocas() {
+	for removed := true; removed; {
+		removed = false
+		remaining := fr.allocas[:0]
+		for _, alloca := range fr.allocas {
+			if isReferenced(alloca) {
+				remaining = append(remaining, alloca)
+				continue
+			}
+			fr.removeGlobal(alloca)
+			removed = true
+		}
+		fr.allocas = remaining
+	}
+}
+
+// isKnownAppend returns whether all parameters of the given runtime.sliceAppend
+// call are known, so that it can be evaluated using sliceAppend.
+func (fr *frame) isKnownAppend(inst llvm.Value) bool {
+	for i := 0; i < 2; i++ {
+		buf := fr.getLocalValue(inst.Operand(i))
+		if !buf.IsConstant() {
+			return false
+		}
+		if _, ok := fr.getPointer(buf); !ok && !buf.IsNull() {
+			return false
+		}
+	}
+	for i := 2; i < 6; i++ {
+		if fr.getLocalValue(inst.Operand(i)).IsAConstantInt().IsNil() {
+			return false
+		}
+	}
+	return true
+}
+
+// sliceAppend evaluates a call to runtime.sliceAppend. Unlike the runtime,
+// which allocates raw memory, it allocates a backing array of the element type
+// when the slice needs to grow. This way elements that contain pointers (such
+// as strings or func values) can be stored in it, which is not possible for raw
+// memory. The capacity is increased in the same way as in the runtime, so that
+// cap() returns the same value as it would at runtime.
+func (fr *frame) sliceAppend(inst llvm.Value) (llvm.Value, error) {
+	srcBuf := fr.getLocalValue(inst.Operand(0))
+	elemsBuf := fr.getLocalValue(inst.Operand(1))
+	srcLen := fr.getLocalValue(inst.Operand(2)).ZExtValue()
+	srcCap := fr.getLocalValue(inst.Operand(3)).ZExtValue()
+	elemsLen := fr.getLocalValue(inst.Operand(4)).ZExtValue()
+	elemSize := fr.getLocalValue(inst.Operand(5)).ZExtValue()
+
+	buf := srcBuf
+	newLen := srcLen + elemsLen
+	newCap := srcCap
+	if newLen > srcCap {
+		// Grow the slice, see runtime.sliceGrow.
+		uintptrBits := inst.Type().StructElementTypes()[1].IntTypeWidth()
+		maxCap := uint64(1)<<uint(uintptrBits-1) - 1
+		if elemSize != 0 {
+			maxCap /= elemSize
+		}
+		if newLen > maxCap {
+			// This panics at runtime.
+			return llvm.Value{}, newDiagnostic(Unsupported, inst, "append beyond the address space")
+		}
+		newCap = srcCap * 2
+		if newCap == 0 {
+			newCap = 1
+		}
+		for newLen > newCap {
+			newCap *= 2
+		}
+		if newCap > maxCap {
+			newCap = newLen
+		}
+		elemType := fr.memoryType(elemsBuf, elemSize)
+		alloc := fr.newAlloc(llvm.ArrayType(elemType, int(newCap)))
+		buf = fr.pointerValue(pointer{alloc, 0}, srcBuf.Type())
+		if err := fr.copyMemory(buf, srcBuf, srcLen*elemSize); err != nil {
+			return llvm.Value{}, err
+		}
+	}
+	if elemsLen != 0 {
+		p, ok := fr.getPointer(buf)
+		if !ok {
+			return llvm.Value{}, newDiagnostic(Unsupported, inst, "append to an unknown slice")
+		}
+		dst := fr.pointerValue(pointer{p.global, p.offset + int64(srcLen*elemSize)}, srcBuf.Type())
+		if err := fr.copyMemory(dst, elemsBuf, elemsLen*elemSize); err != nil {
+			return llvm.Value{}, err
+		}
+	}
+
+	uintptrType := inst.Type().StructElementTypes()[1]
+	result := llvm.ConstNull(inst.Type())
+	result = llvm.ConstInsertValue(result, buf, []uint32{0})
+	result = llvm.ConstInsertValue(result, llvm.ConstInt(uintptrType, newLen, false), []uint32{1})
+	result = llvm.ConstInsertValue(result, llvm.ConstInt(uintptrType, newCap, false), []uint32{2})
+	return result, nil
+}
+
+// newAlloc creates a new zero-initialized global for a heap allocation. It is
+// kept in the module after interpretation if it is still referenced.
+func (fr *frame) newAlloc(allocType llvm.Type) llvm.Value {
+	alloc := fr.addGlobal(allocType, fr.pkgName+"$alloc")
+	alloc.SetInitializer(llvm.ConstNull(allocType))
+	return alloc
+}
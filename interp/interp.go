@@ -7,38 +7,184 @@ package interp
 // methods.
 
 import (
-	"errors"
+	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"tinygo.org/x/go-llvm"
 )
 
+// DebugLevel determines how much debug output is printed during
+// interpretation.
+type DebugLevel int
+
+const (
+	DebugNone         DebugLevel = iota // no debug output
+	DebugSummary                        // one line per package initializer
+	DebugInstructions                   // also print every interpreted instruction
+)
+
+// DefaultMaxInstructions is the default number of instructions that may be
+// executed while interpreting a single package initializer. Initializers that
+// take longer than that (for example, because they contain an infinite loop)
+// are run at runtime instead.
+const DefaultMaxInstructions = 20000000
+
+// DefaultMaxCallDepth is the default maximum number of nested calls while
+// interpreting a package initializer. Initializers that go deeper than that
+// (for example, because of unbounded recursion) are run at runtime instead.
+const DefaultMaxCallDepth = 1000
+
+// DefaultMaxMemory is the default number of bytes of global data that may be
+// created while interpreting a single package initializer, for heap
+// allocations, strings and the like. Initializers that need more than that (for
+// example, because they build a very large table) are run at runtime instead.
+const DefaultMaxMemory = 64 << 20
+
+// DefaultMaxTotalMemory is the default number of bytes of global data that may
+// be created while interpreting all package initializers together.
+const DefaultMaxTotalMemory = 256 << 20
+
+// RevertedAttribute is the string attribute that is added to package
+// initializers that could not be interpreted by Run. Only initializers with
+// this attribute are interpreted again by RunReverted.
+const RevertedAttribute = "tinygo-interp-reverted"
+
+// RuntimeInitAttribute is the string attribute the compiler adds to package
+// initializers of packages with an init function marked with //go:runtimeinit.
+// These initializers are never interpreted, for example because they measure
+// time or access hardware, and are always called at runtime.
+const RuntimeInitAttribute = "tinygo-runtimeinit"
+
+// DefaultEntryPoint is the function that calls all package initializers, in
+// the order in which they must be run.
+const DefaultEntryPoint = "runtime.initAll"
+
+// Config contains the options of an evaluator. The zero value is not very
+// useful: start from DefaultConfig instead.
+type Config struct {
+	TargetData      llvm.TargetData
+	EntryPoint      string // function that calls all package initializers
+	Debug           DebugLevel
+	DebugOutput     io.Writer   // where debug output is written to
+	MaxInstructions int         // instruction limit per package initializer, 0 means no limit
+	MaxCallDepth    int         // maximum call depth while interpreting, 0 means no limit
+	MaxMemory       uint64      // bytes of global data created per package initializer, 0 means no limit
+	MaxTotalMemory  uint64      // bytes of global data created by all package initializers, 0 means no limit
+	FatalKinds      []ErrorKind // kinds of errors that are returned instead of reverting the init function
+	NoRevert        bool        // return every error instead of reverting the init function
+	CPUProfile      string      // path to write a pprof CPU profile of Run or RunReverted to, if not empty
+}
+
+// DefaultConfig returns the configuration used by NewEval. By default, an init
+// function that always panics is reported as an error: set FatalKinds to nil to
+// run it at runtime instead.
+func DefaultConfig(targetData llvm.TargetData) Config {
+	return Config{
+		TargetData:      targetData,
+		EntryPoint:      DefaultEntryPoint,
+		DebugOutput:     os.Stderr,
+		MaxInstructions: DefaultMaxInstructions,
+		MaxCallDepth:    DefaultMaxCallDepth,
+		MaxMemory:       DefaultMaxMemory,
+		MaxTotalMemory:  DefaultMaxTotalMemory,
+		FatalKinds:      []ErrorKind{Panic},
+	}
+}
+
 type Eval struct {
+	Config
 	Mod             llvm.Module
-	TargetData      llvm.TargetData
-	Debug           bool
+	instructions    int    // number of instructions executed in the current package initializer
+	totalMemory     uint64 // bytes of global data created by committed transactions
+	profile         []InitProfile
+	warnings        []*Warning
+	reverted        []*Revert
 	builder         llvm.Builder
 	dirtyGlobals    map[llvm.Value]struct{}
+	writtenGlobals  map[llvm.Value]struct{}   // globals written by committed transactions
+	createdGlobals  []llvm.Value              // globals created by committed transactions
+	globalNames     map[string]int            // number of globals created with a given name
+	constantGlobals map[llvm.Value]llvm.Value // read-only globals created by addConstantGlobal, by initializer
+	stats           Stats
 	sideEffectFuncs map[llvm.Value]*sideEffectResult // cache of side effect scan results
+	tx              *transaction                     // changes made by the init function currently being interpreted
+	locateBuf       []uint32                         // buffer reused by locate
+	indexBuf        []llvm.Value                     // buffer reused for getelementptr indices
+}
+
+// Stats contains statistics about how effective compile-time evaluation was.
+type Stats struct {
+	Inits            int // number of package initializers
+	InitsInterpreted int // package initializers that were interpreted completely
+	InitsReverted    int // package initializers that are run at runtime instead
+	Instructions     int // instructions executed while interpreting initializers
+	GlobalsCreated   int // globals created during interpretation and kept afterwards
+	GlobalsConstant  int // globals that were marked constant after interpretation
+}
+
+// String returns a short human-readable summary of the statistics.
+func (s Stats) String() string {
+	return fmt.Sprintf("%d/%d package inits evaluated at compile time (%d reverted), %d instructions executed, %d globals created, %d globals marked constant",
+		s.InitsInterpreted, s.Inits, s.InitsReverted, s.Instructions, s.GlobalsCreated, s.GlobalsConstant)
+}
+
+// NewEval returns a new evaluator for the given module, configured with
+// DefaultConfig. Debug output is disabled by default, it can be enabled by
+// changing the Debug and DebugOutput fields before calling Run. The other
+// options in Config can be changed in the same way.
+func NewEval(mod llvm.Module, targetData llvm.TargetData) *Eval {
+	return newEval(mod, DefaultConfig(targetData))
 }
 
-// Run evaluates the function with the given name and then eliminates all
-// callers.
+func newEval(mod llvm.Module, config Config) *Eval {
+	return &Eval{
+		Config:          config,
+		Mod:             mod,
+		builder:         mod.Context().NewBuilder(),
+		dirtyGlobals:    map[llvm.Value]struct{}{},
+		writtenGlobals:  map[llvm.Value]struct{}{},
+		globalNames:     map[string]int{},
+		constantGlobals: map[llvm.Value]llvm.Value{},
+	}
+}
+
+// Run evaluates runtime.initAll and then eliminates all callers, printing a
+// trace of all interpreted instructions to stderr if debug is set.
 func Run(mod llvm.Module, targetData llvm.TargetData, debug bool) error {
+	config := DefaultConfig(targetData)
 	if debug {
-		println("\ncompile-time evaluation:")
+		config.Debug = DebugInstructions
 	}
+	_, err := RunWithConfig(mod, config)
+	return err
+}
 
-	name := "runtime.initAll"
-	e := &Eval{
-		Mod:          mod,
-		TargetData:   targetData,
-		Debug:        debug,
-		dirtyGlobals: map[llvm.Value]struct{}{},
+// RunWithConfig creates an evaluator with the given configuration and calls
+// its Run method. The evaluator is returned, also when Run fails, so that the
+// caller can inspect its statistics, warnings and the like.
+func RunWithConfig(mod llvm.Module, config Config) (*Eval, error) {
+	e := newEval(mod, config)
+	return e, e.Run()
+}
+
+// Run evaluates the entry point (usually runtime.initAll) and then eliminates
+// all callers. Package initializers that cannot be interpreted are left to be
+// called at runtime.
+func (e *Eval) Run() error {
+	e.debugf(DebugSummary, "\ncompile-time evaluation:")
+	stopCPUProfile, err := e.startCPUProfile()
+	if err != nil {
+		return err
 	}
-	e.builder = mod.Context().NewBuilder()
+	defer stopCPUProfile()
 
-	initAll := mod.NamedFunction(name)
+	name := e.entryPoint()
+	initAll := e.Mod.NamedFunction(name)
+	if initAll.IsNil() || initAll.IsDeclaration() {
+		return fmt.Errorf("interp: entry point %s not found", name)
+	}
 	bb := initAll.EntryBasicBlock()
 	// Create a dummy alloca in the entry block that we can set the insert point
 	// to. This is necessary because otherwise we might be removing the
@@ -56,59 +202,388 @@ func Run(mod llvm.Module, targetData llvm.TargetData, debug bool) error {
 			break // ret void
 		}
 		if inst.IsACallInst().IsNil() || inst.CalledValue().IsAFunction().IsNil() {
-			return errors.New("expected all instructions in " + name + " to be direct calls")
+			return &Error{
+				PkgName: "runtime",
+				Fn:      initAll,
+				Inst:    inst,
+				Pos:     getPosition(inst),
+				Err:     newDiagnostic(Malformed, inst, "expected all instructions in "+name+" to be direct calls"),
+			}
 		}
 		initCalls = append(initCalls, inst)
 	}
 
 	// Do this in a separate step to avoid corrupting the iterator above.
-	undefPtr := llvm.Undef(llvm.PointerType(mod.Context().Int8Type(), 0))
-	for _, call := range initCalls {
+	undefPtr := llvm.Undef(llvm.PointerType(e.Mod.Context().Int8Type(), 0))
+	var interpreted, residuals []llvm.Value
+	e.stats.Inits += len(initCalls)
+	for i, call := range initCalls {
 		initName := call.CalledValue().Name()
 		if !strings.HasSuffix(initName, ".init") {
-			return errors.New("expected all instructions in " + name + " to be *.init() calls")
+			return &Error{
+				PkgName: "runtime",
+				Fn:      initAll,
+				Inst:    call,
+				Pos:     getPosition(call),
+				Err:     newDiagnostic(Malformed, call, "expected all instructions in "+name+" to be *.init() calls"),
+			}
 		}
 		pkgName := initName[:len(initName)-5]
 		fn := call.CalledValue()
-		call.EraseFromParentAsInstruction()
+		if !fn.GetStringAttributeAtIndex(-1, RuntimeInitAttribute).IsNil() {
+			// The package author asked for this init function to be run at
+			// runtime. Call it in the same order as before, but don't try to
+			// interpret it.
+			e.debugf(DebugSummary, "package %s: init marked to be run at runtime", pkgName)
+			e.reverted = append(e.reverted, &Revert{
+				PkgName: pkgName,
+				Kind:    Unsupported,
+				Reason:  "init marked with //go:runtimeinit",
+			})
+			e.stats.InitsReverted++
+			e.builder.SetInsertPointBefore(dummy)
+			e.builder.CreateCall(fn, []llvm.Value{undefPtr, undefPtr}, "")
+			call.EraseFromParentAsInstruction()
+			if !e.markModified(fn) {
+				e.debugf(DebugSummary, "package %s: init has unknown side effects, not interpreting remaining inits", pkgName)
+				e.warnUnknownSideEffects(pkgName)
+				e.skipRemaining(initCalls[i+1:], pkgName)
+				break
+			}
+			continue
+		}
+		// All code that must still be run at runtime is emitted in a new
+		// function. When the init function can be interpreted, this residual
+		// function replaces it.
+		residual := e.newResidual(fn)
+		e.begin(residual.EntryBasicBlock().LastInstruction())
+		e.instructions = 0
+		endInit := e.startInit(pkgName)
 		_, err := e.Function(fn, []Value{&LocalValue{e, undefPtr}, &LocalValue{e, undefPtr}}, pkgName)
-		if err == ErrUnreachable {
-			break
+		e.stats.Instructions += e.instructions
+		endInit(err != nil)
+		if err != nil && e.isFatal(err) {
+			// For example, a panic that would happen on every startup.
+			e.rollback()
+			residual.EraseFromParentAsFunction()
+			dummy.EraseFromParentAsInstruction()
+			return err
 		}
 		if err != nil {
+			// This init function could not be interpreted completely. Undo
+			// everything it did and run it at runtime instead, after all the
+			// runtime code emitted for previous init functions. This includes
+			// init functions that reach an unreachable instruction (usually
+			// after a panic): they will fail at runtime in exactly the same
+			// way. Later init functions are still interpreted, as they may
+			// well be independent of this one.
+			e.debugf(DebugSummary, "%v (reverted)", err)
+			e.warnReverted(pkgName, err)
+			e.stats.InitsReverted++
+			e.rollback()
+			residual.EraseFromParentAsFunction()
+			e.builder.SetInsertPointBefore(dummy)
+			e.builder.CreateCall(fn, []llvm.Value{undefPtr, undefPtr}, "")
+			call.EraseFromParentAsInstruction()
+			// Remember that this init function was reverted, so that
+			// RunReverted can try again after optimization.
+			fn.AddFunctionAttr(e.Mod.Context().CreateStringAttribute(RevertedAttribute, ""))
+			if !e.markModified(fn) {
+				// It is not known which globals this init function may
+				// modify, so none of the remaining init functions can be
+				// interpreted safely. Leave them to be called at runtime.
+				e.debugf(DebugSummary, "package %s: init has unknown side effects, not interpreting remaining inits", pkgName)
+				e.warnUnknownSideEffects(pkgName)
+				e.skipRemaining(initCalls[i+1:], pkgName)
+				break
+			}
+			continue
+		}
+		e.debugf(DebugSummary, "package %s: interpreted init", pkgName)
+		e.stats.InitsInterpreted++
+		e.commit()
+		if llvm.PrevInstruction(residual.EntryBasicBlock().LastInstruction()).IsNil() {
+			// Everything was done at compile time.
+			residual.EraseFromParentAsFunction()
+			residual = llvm.Value{}
+		} else {
+			// Some calls with side effects, like println, must still be done
+			// at runtime. Call the residual function instead of the init
+			// function, in the same order as before.
+			e.builder.SetInsertPointBefore(dummy)
+			e.builder.CreateCall(residual, []llvm.Value{undefPtr, undefPtr}, "")
+		}
+		call.EraseFromParentAsInstruction()
+		interpreted = append(interpreted, fn)
+		residuals = append(residuals, residual)
+	}
+	dummy.EraseFromParentAsInstruction()
+
+	// Init functions that were fully interpreted are not called anymore, so
+	// they can be removed. Their residual function (if any) takes their name.
+	for i, fn := range interpreted {
+		if fn.FirstUse().IsNil() {
+			name := fn.Name()
+			fn.EraseFromParentAsFunction()
+			if !residuals[i].IsNil() {
+				residuals[i].SetName(name)
+			}
+		}
+	}
+
+	e.removeUnreferencedGlobals()
+	e.markConstantGlobals()
+	e.debugf(DebugSummary, "interp: %v", e.stats)
+
+	return nil
+}
+
+// skipRemaining records the reason why the given init calls are not
+// interpreted: the init function of the given package, which is run at
+// runtime, has unknown side effects.
+func (e *Eval) skipRemaining(initCalls []llvm.Value, pkgName string) {
+	for _, call := range initCalls {
+		initName := call.CalledValue().Name()
+		e.reverted = append(e.reverted, &Revert{
+			PkgName: strings.TrimSuffix(initName, ".init"),
+			Kind:    Unsupported,
+			Reason:  "not interpreted, because the init of package " + pkgName + " has unknown side effects",
+		})
+	}
+}
+
+// RunReverted interprets the package initializers that were reverted by Run
+// once more. It is meant to be called after the optimization pipeline, as some
+// initializers can only be interpreted after inlining and simplification: for
+// example when they call a small function that contains an instruction the
+// interpreter doesn't support. Initializers that were already interpreted by
+// Run don't have the RevertedAttribute and are not touched, so it is safe to
+// call RunReverted more than once.
+//
+// The optimizer may have changed the entry point in arbitrary ways, for example
+// by inlining initializers into it. All other code in it is left to be run at
+// runtime, and all globals it refers to are marked dirty.
+func (e *Eval) RunReverted() error {
+	e.debugf(DebugSummary, "\ncompile-time evaluation (second pass):")
+	stopCPUProfile, err := e.startCPUProfile()
+	if err != nil {
+		return err
+	}
+	defer stopCPUProfile()
+
+	initAll := e.Mod.NamedFunction(e.entryPoint())
+	if initAll.IsNil() || initAll.IsDeclaration() {
+		// Inlined into its caller, so there are no init calls left to
+		// interpret.
+		return nil
+	}
+	bb := initAll.EntryBasicBlock()
+	var insts []llvm.Value
+	for inst := bb.FirstInstruction(); inst != bb.LastInstruction(); inst = llvm.NextInstruction(inst) {
+		insts = append(insts, inst)
+	}
+
+	// Do this in a separate step to avoid corrupting the iterator above.
+	for _, inst := range insts {
+		if inst.IsACallInst().IsNil() {
+			// Code from an inlined initializer, which is run at runtime.
+			for i := 0; i < inst.OperandsCount(); i++ {
+				e.markDirty(inst.Operand(i))
+			}
+			continue
+		}
+		fn := inst.CalledValue()
+		if fn.IsAFunction().IsNil() {
+			e.debugf(DebugSummary, "%s contains an indirect call, not interpreting remaining inits", initAll.Name())
+			break
+		}
+		if fn.IsDeclaration() || fn.GetStringAttributeAtIndex(-1, RevertedAttribute).IsNil() || !strings.HasSuffix(fn.Name(), ".init") {
+			// Not an init function that was reverted before. Leave it to
+			// be called at runtime.
+			for i := 0; i < inst.OperandsCount()-1; i++ {
+				e.markDirty(inst.Operand(i))
+			}
+			if !fn.IsDeclaration() && !e.markModified(fn) {
+				e.debugf(DebugSummary, "%s has unknown side effects, not interpreting remaining inits", fn.Name())
+				break
+			}
+			continue
+		}
+
+		pkgName := fn.Name()[:len(fn.Name())-5]
+		e.stats.Inits++
+		var params []Value
+		for i := 0; i < inst.OperandsCount()-1; i++ {
+			params = append(params, &LocalValue{e, inst.Operand(i)})
+		}
+		residual := e.newResidual(fn)
+		e.begin(residual.EntryBasicBlock().LastInstruction())
+		e.instructions = 0
+		endInit := e.startInit(pkgName)
+		_, err := e.Function(fn, params, pkgName)
+		e.stats.Instructions += e.instructions
+		endInit(err != nil)
+		if err != nil && e.isFatal(err) {
+			e.rollback()
+			residual.EraseFromParentAsFunction()
 			return err
 		}
+		if err != nil {
+			e.debugf(DebugSummary, "%v (reverted)", err)
+			e.warnReverted(pkgName, err)
+			e.stats.InitsReverted++
+			e.rollback()
+			residual.EraseFromParentAsFunction()
+			if !e.markModified(fn) {
+				e.debugf(DebugSummary, "package %s: init has unknown side effects, not interpreting remaining inits", pkgName)
+				e.warnUnknownSideEffects(pkgName)
+				break
+			}
+			continue
+		}
+		e.debugf(DebugSummary, "package %s: interpreted init", pkgName)
+		e.stats.InitsInterpreted++
+		e.commit()
+		name := fn.Name()
+		if llvm.PrevInstruction(residual.EntryBasicBlock().LastInstruction()).IsNil() {
+			residual.EraseFromParentAsFunction()
+			residual = llvm.Value{}
+		} else {
+			e.builder.SetInsertPointBefore(inst)
+			e.builder.CreateCall(residual, getArgs(inst), "")
+		}
+		inst.EraseFromParentAsInstruction()
+		fn.RemoveStringAttributeAtIndex(-1, RevertedAttribute)
+		if fn.FirstUse().IsNil() {
+			fn.EraseFromParentAsFunction()
+			if !residual.IsNil() {
+				residual.SetName(name)
+			}
+		}
 	}
 
+	e.removeUnreferencedGlobals()
+	e.markConstantGlobals()
+	e.debugf(DebugSummary, "interp: %v", e.stats)
+
 	return nil
 }
 
+// entryPoint returns the name of the function that calls all package
+// initializers.
+func (e *Eval) entryPoint() string {
+	if e.EntryPoint == "" {
+		return DefaultEntryPoint
+	}
+	return e.EntryPoint
+}
+
+// getArgs returns the arguments of the given call instruction.
+func getArgs(call llvm.Value) []llvm.Value {
+	args := make([]llvm.Value, call.OperandsCount()-1)
+	for i := range args {
+		args[i] = call.Operand(i)
+	}
+	return args
+}
+
+// newResidual creates an empty function with the same signature as the given
+// init function, to which all code that must be run at runtime is added while
+// interpreting the init function.
+func (e *Eval) newResidual(fn llvm.Value) llvm.Value {
+	residual := llvm.AddFunction(e.Mod, fn.Name()+"$residual", fn.Type().ElementType())
+	residual.SetLinkage(llvm.InternalLinkage)
+	residual.SetUnnamedAddr(true)
+	for i, param := range fn.Params() {
+		residual.Param(i).SetName(param.Name())
+	}
+	bb := e.Mod.Context().AddBasicBlock(residual, "entry")
+	e.builder.SetInsertPointAtEnd(bb)
+	e.builder.CreateRetVoid()
+	return residual
+}
+
+// Stats returns statistics about the work done by Run and
+// EvalCompileTimeCalls.
+func (e *Eval) Stats() Stats {
+	return e.stats
+}
+
+// markConstantGlobals marks globals that were initialized during
+// interpretation as constant if they are never written at runtime. This allows
+// LLVM to propagate their values.
+func (e *Eval) markConstantGlobals() {
+	for global := range e.writtenGlobals {
+		if _, ok := e.dirtyGlobals[global]; ok {
+			continue
+		}
+		if global.IsGlobalConstant() || isWeak(global) || !isReadOnly(global) {
+			continue
+		}
+		global.SetGlobalConstant(true)
+		e.stats.GlobalsConstant++
+	}
+}
+
+// isFatal returns whether the given error must be returned from Run instead of
+// reverting the init function, see FatalKinds and NoRevert.
+func (e *Eval) isFatal(err error) bool {
+	if e.NoRevert {
+		return true
+	}
+	ierr, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	for _, kind := range e.FatalKinds {
+		if ierr.Kind() == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// debugf writes a line of debug output if the debug level is at least the given
+// level.
+func (e *Eval) debugf(level DebugLevel, format string, args ...interface{}) {
+	if e.Debug >= level {
+		fmt.Fprintf(e.DebugOutput, format+"\n", args...)
+	}
+}
+
 func (e *Eval) Function(fn llvm.Value, params []Value, pkgName string) (Value, error) {
-	return e.function(fn, params, pkgName, "")
+	return e.function(fn, params, pkgName, 0)
 }
 
-func (e *Eval) function(fn llvm.Value, params []Value, pkgName, indent string) (Value, error) {
+func (e *Eval) function(fn llvm.Value, params []Value, pkgName string, depth int) (Value, error) {
 	fr := frame{
 		Eval:    e,
 		fn:      fn,
 		pkgName: pkgName,
-		locals:  make(map[llvm.Value]Value),
+		depth:   depth,
+		locals:  make(map[llvm.Value]llvm.Value),
+		maps:    make(map[llvm.Value]*MapValue),
+		values:  make(map[llvm.Value]*LocalValue),
 	}
 	for i, param := range fn.Params() {
-		fr.locals[param] = params[i]
+		if m, ok := params[i].(*MapValue); ok {
+			fr.maps[param] = m
+		} else {
+			fr.locals[param] = params[i].Value()
+		}
 	}
 
 	bb := fn.EntryBasicBlock()
 	var lastBB llvm.BasicBlock
 	for {
-		retval, outgoing, err := fr.evalBasicBlock(bb, lastBB, indent)
+		retval, outgoing, err := fr.evalBasicBlock(bb, lastBB)
 		if outgoing == nil {
 			// returned something (a value or void, or an error)
+			if err == nil {
+				fr.freeAllocas()
+			}
 			return retval, err
 		}
-		if len(outgoing) > 1 {
-			panic("unimplemented: multiple outgoing blocks")
-		}
 		next := outgoing[0]
 		if next.IsABasicBlock().IsNil() {
 			panic("did not switch to a basic block")
@@ -124,29 +599,68 @@ func (e *Eval) getValue(v llvm.Value) Value {
 	return &LocalValue{e, v}
 }
 
+// markModified marks all globals that the given function may modify when it is
+// called at runtime as dirty, so that later init functions read them at runtime
+// instead of using the value they had at compile time. It returns false if the
+// function has unknown side effects (such as indirect calls), in which case it
+// isn't possible to know which globals may be modified.
+func (e *Eval) markModified(fn llvm.Value) bool {
+	result := e.hasSideEffects(fn)
+	if result.severity == sideEffectAll {
+		return false
+	}
+	for global := range result.mentionsGlobals {
+		e.markDirty(global)
+	}
+	return true
+}
+
 // markDirty marks the passed-in LLVM value dirty, recursively. For example,
 // when it encounters a constant GEP on a global, it marks the global dirty.
+// Globals that are referenced from the initializer of a dirty global are marked
+// dirty as well, as they can be modified through it at runtime.
 func (e *Eval) markDirty(v llvm.Value) {
+	e.markDirtyRecursive(v, map[llvm.Value]struct{}{})
+}
+
+func (e *Eval) markDirtyRecursive(v llvm.Value, visited map[llvm.Value]struct{}) {
+	if _, ok := visited[v]; ok {
+		return
+	}
+	visited[v] = struct{}{}
 	if !v.IsAGlobalVariable().IsNil() {
-		if v.IsGlobalConstant() {
-			return
+		if !v.IsGlobalConstant() {
+			e.setDirty(v)
 		}
-		if _, ok := e.dirtyGlobals[v]; !ok {
-			e.dirtyGlobals[v] = struct{}{}
-			e.sideEffectFuncs = nil // re-calculate all side effects
+		if initializer := v.Initializer(); !initializer.IsNil() {
+			e.markReferencedGlobalsDirty(initializer, visited)
 		}
+	} else if global, ok := e.getBaseGlobal(v); ok {
+		// A pointer into a global (such as a getelementptr, which may be
+		// computed at runtime), or an integer derived from it.
+		e.markDirtyRecursive(global, visited)
 	} else if v.IsConstant() {
-		if v.OperandsCount() >= 2 && !v.Operand(0).IsAGlobalVariable().IsNil() {
-			// looks like a constant getelementptr of a global.
-			// TODO: find a way to make sure it really is: v.Opcode() returns 0.
-			e.markDirty(v.Operand(0))
-			return
-		}
-		return // nothing to mark
-	} else if !v.IsAGetElementPtrInst().IsNil() {
-		panic("interp: todo: GEP")
+		// Other constants, such as aggregates, may still contain pointers to
+		// globals.
+		e.markReferencedGlobalsDirty(v, visited)
 	} else {
-		// Not constant and not a global or GEP so doesn't have to be marked
+		// Not derived from a global so doesn't have to be marked
 		// non-constant.
 	}
 }
+
+// markReferencedGlobalsDirty marks all globals referenced from the given
+// constant (usually the initializer of a global) as dirty.
+func (e *Eval) markReferencedGlobalsDirty(v llvm.Value, visited map[llvm.Value]struct{}) {
+	if !v.IsAGlobalVariable().IsNil() {
+		e.markDirtyRecursive(v, visited)
+		return
+	}
+	if v.IsAConstantExpr().IsNil() && v.IsAConstantStruct().IsNil() && v.IsAConstantArray().IsNil() && v.IsAConstantVector().IsNil() {
+		// Other constants (integers, functions, etc.) can't refer to globals.
+		return
+	}
+	for i := 0; i < v.OperandsCount(); i++ {
+		e.markReferencedGlobalsDirty(v.Operand(i), visited)
+	}
+}
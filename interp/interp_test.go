@@ -0,0 +1,859 @@
+package interp
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tinygo.org/x/go-llvm"
+)
+
+func TestInterp(t *testing.T) {
+	for _, name := range []string{
+		"aggregate",
+		"alloc",
+		"alloca",
+		"alloca-merge",
+		"atomic",
+		"bitcast",
+		"cycle",
+		"dirty-escape",
+		"dirty-pointer",
+		"float-convert",
+		"func-table",
+		"gep-index",
+		"gep-nested",
+		"global-dependency",
+		"global-pointers",
+		"inline-asm",
+		"interface-assert",
+		"interface-global",
+		"memcpy-length",
+		"mmio",
+		"multiple-return",
+		"nil-check",
+		"nondeterministic",
+		"pointer-arithmetic",
+		"pointer-compare",
+		"print",
+		"pure",
+		"register",
+		"revert",
+		"revert-dependent",
+		"revert-stale",
+		"revert-unknown",
+		"runtimeinit",
+		"string-dedup",
+		"string-index",
+		"unreachable",
+		"weak",
+		"wide-int",
+		"zero-undef",
+	} {
+		name := name // make tc local to this closure
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			runTest(t, "testdata/"+name)
+		})
+	}
+}
+
+// TestInstructionLimit checks that an init function that doesn't terminate is
+// left to be run at runtime.
+func TestInstructionLimit(t *testing.T) {
+	t.Parallel()
+	runTest(t, "testdata/infinite-loop", func(config *Config) {
+		config.MaxInstructions = 1000
+	})
+}
+
+// TestCallDepthLimit checks that an init function that recurses too deeply is
+// left to be run at runtime, while less deep recursion is still interpreted.
+func TestCallDepthLimit(t *testing.T) {
+	t.Parallel()
+	runTest(t, "testdata/recursion", func(config *Config) {
+		config.MaxCallDepth = 20
+	})
+}
+
+// TestMemoryLimit checks that an init function that allocates more memory than
+// allowed is left to be run at runtime, with a warning, while a later init
+// function that stays within the limit is still interpreted.
+func TestMemoryLimit(t *testing.T) {
+	t.Parallel()
+	e := runTest(t, "testdata/memory-limit", func(config *Config) {
+		config.MaxMemory = 1024
+	})
+	warnings := e.Warnings()
+	if len(warnings) != 1 || warnings[0].PkgName != "main" || warnings[0].Kind != Budget {
+		t.Errorf("expected a single budget warning for package main, got: %v", warnings)
+	}
+}
+
+// TestRunReverted checks that an init function that can only be interpreted
+// after inlining is interpreted in the second pass, and that running the second
+// pass again doesn't change anything.
+func TestRunReverted(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/second-pass.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	if _, err := RunWithConfig(mod, DefaultConfig(targetData)); err != nil {
+		t.Fatal(err)
+	}
+	if mod.NamedFunction("main.init").GetStringAttributeAtIndex(-1, RevertedAttribute).IsNil() {
+		t.Errorf("main.init was not marked as reverted")
+	}
+
+	// Inline main.get into main.init, as the optimization pipeline would.
+	pm := llvm.NewPassManager()
+	defer pm.Dispose()
+	pm.AddFunctionInliningPass()
+	pm.AddInstructionCombiningPass()
+	pm.Run(mod)
+
+	for i, expected := range []int{1, 0} {
+		e := NewEval(mod, targetData)
+		if err := e.RunReverted(); err != nil {
+			t.Fatal(err)
+		}
+		if stats := e.Stats(); stats.InitsInterpreted != expected || stats.InitsReverted != 0 {
+			t.Errorf("pass %d: unexpected stats: %+v", i+2, stats)
+		}
+	}
+	expected := loadModule(t, "testdata/second-pass.out.ll")
+	if diff := compareModules(expected, mod); diff != "" {
+		t.Errorf("output does not match expected output:\n%s", diff)
+	}
+}
+
+// TestProfile checks that Run records one profile entry per interpreted package
+// initializer, and that the profile table has one row for each of them.
+func TestProfile(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/revert.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	e, err := RunWithConfig(mod, DefaultConfig(targetData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := e.Profile()
+	if len(profile) != 2 {
+		t.Fatalf("expected 2 profile entries, got %d: %+v", len(profile), profile)
+	}
+	for i, expected := range []InitProfile{
+		{PkgName: "main", Reverted: true},
+		{PkgName: "other", Reverted: false},
+	} {
+		if profile[i].PkgName != expected.PkgName || profile[i].Reverted != expected.Reverted {
+			t.Errorf("unexpected profile entry %d: %+v", i, profile[i])
+		}
+		if profile[i].Instructions == 0 {
+			t.Errorf("no instructions recorded for package %s", profile[i].PkgName)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := e.WriteProfile(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1+len(profile) {
+		t.Fatalf("expected a header and %d rows, got:\n%s", len(profile), buf.String())
+	}
+	for _, p := range profile {
+		found := 0
+		for _, line := range lines[1:] {
+			if strings.HasSuffix(strings.TrimSpace(line), " "+p.PkgName) {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Errorf("expected one row for package %s, got %d:\n%s", p.PkgName, found, buf.String())
+		}
+	}
+}
+
+// TestWarnings checks that an init function that is reverted results in a
+// single warning that describes why it was reverted.
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/nondeterministic.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	e, err := RunWithConfig(mod, DefaultConfig(targetData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := e.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(warnings), warnings)
+	}
+	if w := warnings[0]; w.PkgName != "main" || w.Kind != Nondeterministic {
+		t.Errorf("unexpected warning: %+v", w)
+	}
+}
+
+// TestReverted checks that the reason an init function is run at runtime is
+// recorded for its package, and that it is dropped once a later pass manages
+// to interpret the init function.
+func TestReverted(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/nondeterministic.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	e, err := RunWithConfig(mod, DefaultConfig(targetData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverted := e.Reverted()
+	if len(reverted) != 1 {
+		t.Fatalf("expected 1 reverted package, got %d: %v", len(reverted), reverted)
+	}
+	r := reverted[0]
+	if r.PkgName != "main" || r.Kind != Nondeterministic {
+		t.Errorf("unexpected revert: %+v", r)
+	}
+	if !strings.Contains(r.Reason, "call to nondeterministic function runtime.ticks") {
+		t.Errorf("unexpected revert reason: %s", r.Reason)
+	}
+
+	// A package that is interpreted in a later pass is no longer reported.
+	if remaining := (&Eval{profile: []InitProfile{{PkgName: "main"}}}).UpdateReverted(reverted); len(remaining) != 0 {
+		t.Errorf("expected no remaining reverted packages, got: %v", remaining)
+	}
+}
+
+// runTest runs the interp pass on an input file (pathPrefix+".ll") and checks
+// whether the result matches the expected output (pathPrefix+".out.ll"). The
+// evaluator can be configured using the optional configure functions, and is
+// returned for further inspection.
+func runTest(t *testing.T, pathPrefix string, configure ...func(*Config)) *Eval {
+	mod := loadModule(t, pathPrefix+".ll")
+
+	// Perform the transform.
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	config := DefaultConfig(targetData)
+	for _, f := range configure {
+		f(&config)
+	}
+	e, err := RunWithConfig(mod, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// See whether the transform output matches with the expected output IR.
+	expected := loadModule(t, pathPrefix+".out.ll")
+	if diff := compareModules(expected, mod); diff != "" {
+		t.Errorf("output does not match expected output:\n%s", diff)
+	}
+	return e
+}
+
+// TestEntryPoint checks that the function that calls all package initializers
+// can be configured, and that other functions are left alone.
+func TestEntryPoint(t *testing.T) {
+	t.Parallel()
+	runTest(t, "testdata/entry-point", func(config *Config) {
+		config.EntryPoint = "main.initAll"
+	})
+}
+
+// TestNoRevert checks that an init function that cannot be interpreted is
+// reported as an error when reverting is not allowed.
+func TestNoRevert(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/revert.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	config := DefaultConfig(targetData)
+	config.NoRevert = true
+	_, err := RunWithConfig(mod, config)
+	ierr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, got: %v", err)
+	}
+	if ierr.PkgName != "main" || ierr.Kind() != Unsupported {
+		t.Errorf("unexpected error: %v", ierr)
+	}
+}
+
+// TestErrorPosition checks that errors returned by Run describe where they
+// happened.
+func TestErrorPosition(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/malformed.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	err := Run(mod, targetData, false)
+	ierr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, got: %v", err)
+	}
+	if ierr.PkgName != "runtime" || ierr.Fn.Name() != "runtime.initAll" {
+		t.Errorf("unexpected package or function: %s, %s", ierr.PkgName, ierr.Fn.Name())
+	}
+	if pos := ierr.Pos.String(); pos != "/src/main.go:12:7" {
+		t.Errorf("unexpected position: %s", pos)
+	}
+	if inst := ierr.Instruction(); !strings.HasPrefix(inst, "store i32 1, i32* @main.x") {
+		t.Errorf("unexpected instruction: %s", inst)
+	}
+	expected := "package runtime: cannot interpret init at /src/main.go:12:7: expected all instructions in runtime.initAll to be direct calls"
+	if ierr.Error() != expected {
+		t.Errorf("unexpected error message: %s", ierr.Error())
+	}
+	if ierr.Kind() != Malformed {
+		t.Errorf("unexpected error kind: %s", ierr.Kind())
+	}
+}
+
+// TestErrorInInit checks that errors that happen while interpreting an init
+// function point to the function and instruction that caused them.
+func TestErrorInInit(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/error-in-init.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	e := NewEval(mod, targetData)
+	undefPtr := &LocalValue{e, llvm.Undef(llvm.PointerType(mod.Context().Int8Type(), 0))}
+	_, err := e.Function(mod.NamedFunction("main.init"), []Value{undefPtr, undefPtr}, "main")
+	ierr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, got: %v", err)
+	}
+	if ierr.PkgName != "main" || ierr.Fn.Name() != "main.helper" {
+		t.Errorf("unexpected package or function: %s, %s", ierr.PkgName, ierr.Fn.Name())
+	}
+	if pos := ierr.Pos.String(); pos != "/src/main.go:10:2" {
+		t.Errorf("unexpected position: %s", pos)
+	}
+	if inst := ierr.Instruction(); !strings.HasPrefix(inst, "%value = load i32, i32* inttoptr (i64 4096 to i32*)") {
+		t.Errorf("unexpected instruction: %s", inst)
+	}
+	expected := "package main: cannot interpret init at /src/main.go:10:2: load from memory-mapped I/O address: i32* inttoptr (i64 4096 to i32*)"
+	if ierr.Error() != expected {
+		t.Errorf("unexpected error message: %s", ierr.Error())
+	}
+	if ierr.Kind() != Unsupported {
+		t.Errorf("unexpected error kind: %s", ierr.Kind())
+	}
+}
+
+// TestPanic checks that an init function that always panics is reported as an
+// error with the panic message, unless panics are not fatal.
+func TestPanic(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/panic.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	_, err := RunWithConfig(mod, DefaultConfig(targetData))
+	ierr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, got: %v", err)
+	}
+	expected := "package main: init panics at /src/main.go:7:7: panic: x"
+	if ierr.Error() != expected {
+		t.Errorf("unexpected error message: %s", ierr.Error())
+	}
+	if ierr.Kind() != Panic {
+		t.Errorf("unexpected error kind: %s", ierr.Kind())
+	}
+
+	// The init function must be left unmodified, to be run at runtime.
+	config := DefaultConfig(targetData)
+	config.FatalKinds = nil
+	e, err := RunWithConfig(mod, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := e.Stats(); stats.InitsReverted != 1 {
+		t.Errorf("expected the init function to be reverted: %+v", stats)
+	}
+	if !mod.NamedGlobal("main.x").Initializer().IsNull() {
+		t.Errorf("store in the init function was not reverted")
+	}
+}
+
+// TestErrorKind checks that errors report the kind of failure for a few
+// representative failures.
+func TestErrorKind(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		path string
+		fn   string
+		kind ErrorKind
+	}{
+		{"testdata/infinite-loop.ll", "main.init", Budget},
+		{"testdata/nondeterministic.ll", "main.init", Nondeterministic},
+		{"testdata/unreachable.ll", "a.init", Unreachable},
+		{"testdata/revert.ll", "main.init", Unsupported},
+		{"testdata/inline-asm.ll", "main.init", Unsupported},
+		{"testdata/inline-asm.ll", "cpu.init", Unsupported},
+		{"testdata/string-index.ll", "main.outOfRange", Panic},
+	} {
+		mod := loadModule(t, tc.path)
+		targetData := llvm.NewTargetData(mod.DataLayout())
+		e := NewEval(mod, targetData)
+		e.MaxInstructions = 1000
+		undefPtr := &LocalValue{e, llvm.Undef(llvm.PointerType(mod.Context().Int8Type(), 0))}
+		_, err := e.Function(mod.NamedFunction(tc.fn), []Value{undefPtr, undefPtr}, "main")
+		targetData.Dispose()
+		ierr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: expected an *Error, got: %v", tc.path, err)
+			continue
+		}
+		diag, ok := ierr.Unwrap().(*Diagnostic)
+		if !ok {
+			t.Errorf("%s: expected a *Diagnostic, got: %v", tc.path, ierr.Unwrap())
+			continue
+		}
+		if diag.Kind != tc.kind {
+			t.Errorf("%s: expected error kind %s, got %s (%v)", tc.path, tc.kind, diag.Kind, err)
+		}
+		if diag.Value.IsNil() {
+			t.Errorf("%s: no offending value in error: %v", tc.path, err)
+		}
+	}
+}
+
+// TestDebugOutput checks that debug output can be captured and contains both
+// the per-init summary and the instruction trace.
+func TestDebugOutput(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/revert.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	buf := &bytes.Buffer{}
+	config := DefaultConfig(targetData)
+	config.Debug = DebugInstructions
+	config.DebugOutput = buf
+	if _, err := RunWithConfig(mod, config); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`package main: cannot interpret init: call to inline assembly: %value = call i64 asm sideeffect "", "=r"() (reverted)`,
+		"package other: interpreted init",
+		"    store i64 7, i64* @other.x",
+		"    call void @externalCall(i64 7)",
+		"interp: 1/2 package inits evaluated at compile time (1 reverted)",
+	} {
+		found := false
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, expected) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("line not found in debug output: %s", expected)
+		}
+	}
+	if t.Failed() {
+		t.Logf("debug output:\n%s", buf.String())
+	}
+}
+
+// TestCompileTimeCalls checks that calls to functions marked for compile-time
+// evaluation are replaced with their result where possible, and that the other
+// calls are reported.
+func TestCompileTimeCalls(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/compiletime.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	e, err := RunWithConfig(mod, DefaultConfig(targetData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := e.EvalCompileTimeCalls()
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	sort.Strings(messages)
+	expectedMessages := []string{
+		"cannot evaluate call to main.hash at compile time: parameter 0 is not a constant",
+		"cannot evaluate call to main.next at compile time: function accesses global main.counter",
+	}
+	if strings.Join(messages, "\n") != strings.Join(expectedMessages, "\n") {
+		t.Errorf("unexpected errors:\n%s", strings.Join(messages, "\n"))
+	}
+	expected := loadModule(t, "testdata/compiletime.out.ll")
+	if diff := compareModules(expected, mod); diff != "" {
+		t.Errorf("output does not match expected output:\n%s", diff)
+	}
+}
+
+// TestDeterministic checks that running the interp pass twice on the same
+// input results in exactly the same output, including the names and order of
+// the globals that are created while interpreting.
+func TestDeterministic(t *testing.T) {
+	t.Parallel()
+	var outputs []string
+	for i := 0; i < 2; i++ {
+		mod := loadModule(t, "testdata/deterministic.ll")
+		targetData := llvm.NewTargetData(mod.DataLayout())
+		err := Run(mod, targetData, false)
+		targetData.Dispose()
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, mod.String())
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("output differs between runs:\n%s", strings.Join(diffLines(strings.Split(outputs[0], "\n"), strings.Split(outputs[1], "\n")), "\n"))
+	}
+}
+
+// TestStats checks the statistics that are collected while interpreting.
+func TestStats(t *testing.T) {
+	t.Parallel()
+	mod := loadModule(t, "testdata/deterministic.ll")
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	e, err := RunWithConfig(mod, DefaultConfig(targetData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := e.Stats()
+	if stats.Instructions == 0 {
+		t.Errorf("expected instructions to be counted")
+	}
+	stats.Instructions = 0
+	expected := Stats{
+		Inits:            2,
+		InitsInterpreted: 1,
+		InitsReverted:    1,
+		GlobalsCreated:   4,
+		GlobalsConstant:  2,
+	}
+	if stats != expected {
+		t.Errorf("unexpected stats:\nexpected: %+v\nactual:   %+v", expected, stats)
+	}
+}
+
+// loadModule parses the LLVM IR file at the given path.
+func loadModule(t *testing.T, path string) llvm.Module {
+	ctx := llvm.NewContext()
+	buf, err := llvm.NewMemoryBufferFromFile(path)
+	os.Stat(path) // make sure this file is tracked by `go test` caching
+	if err != nil {
+		t.Fatalf("could not read file %s: %v", path, err)
+	}
+	mod, err := ctx.ParseIR(buf)
+	if err != nil {
+		t.Fatalf("could not load module:\n%v", err)
+	}
+	return mod
+}
+
+// compareModules compares two modules structurally. Globals and functions are
+// matched by name, so their order doesn't matter. Function bodies are compared
+// after renaming all local values (including basic blocks) to a sequential
+// number, so that a different numbering of SSA values doesn't matter either.
+// Metadata and attribute groups are ignored. It returns a description of the
+// differences, or the empty string if the modules are equal.
+func compareModules(expected, actual llvm.Module) string {
+	expectedItems := moduleItems(expected)
+	actualItems := moduleItems(actual)
+	var names []string
+	for name := range expectedItems {
+		names = append(names, name)
+	}
+	for name := range actualItems {
+		if _, ok := expectedItems[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var diff []string
+	for _, name := range names {
+		expectedLines, inExpected := expectedItems[name]
+		actualLines, inActual := actualItems[name]
+		switch {
+		case !inExpected:
+			diff = append(diff, "unexpected "+name)
+		case !inActual:
+			diff = append(diff, "missing "+name)
+		case strings.Join(expectedLines, "\n") != strings.Join(actualLines, "\n"):
+			diff = append(diff, "mismatch in "+name+":")
+			diff = append(diff, diffLines(expectedLines, actualLines)...)
+		}
+	}
+	return strings.Join(diff, "\n")
+}
+
+var (
+	localNameRe = regexp.MustCompile(`%[-a-zA-Z$._0-9]+|%"[^"]*"`)
+	argumentRe  = regexp.MustCompile(`(%[-a-zA-Z$._0-9]+|%"[^"]*")[,)]`)
+	definedRe   = regexp.MustCompile(`^\s*(%[-a-zA-Z$._0-9]+|%"[^"]*") = `)
+	labelRe     = regexp.MustCompile(`^([-a-zA-Z$._0-9]+|"[^"]*"):`)
+	metadataRe  = regexp.MustCompile(`, ![-a-zA-Z._0-9]+ !\d+`)
+	attrGroupRe = regexp.MustCompile(` #\d+`)
+)
+
+// moduleItems returns the normalized lines of all globals and functions in the
+// module, indexed by name.
+func moduleItems(mod llvm.Module) map[string][]string {
+	items := make(map[string][]string)
+	for global := mod.FirstGlobal(); !global.IsNil(); global = llvm.NextGlobal(global) {
+		items["@"+global.Name()] = normalizeIR(valueString(global))
+	}
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		lines := normalizeIR(valueString(fn))
+
+		// Number all local values in the order in which they are defined.
+		locals := make(map[string]string)
+		define := func(name string) {
+			if _, ok := locals[name]; !ok {
+				locals[name] = "%" + strconv.Itoa(len(locals))
+			}
+		}
+		for i, line := range lines {
+			if i == 0 {
+				for _, match := range argumentRe.FindAllStringSubmatch(line, -1) {
+					define(match[1])
+				}
+			} else if match := definedRe.FindStringSubmatch(line); match != nil {
+				define(match[1])
+			} else if match := labelRe.FindStringSubmatch(line); match != nil {
+				define("%" + match[1])
+			}
+		}
+		for i, line := range lines {
+			if match := labelRe.FindStringSubmatch(line); i != 0 && match != nil {
+				lines[i] = locals["%"+match[1]][1:] + ":"
+				continue
+			}
+			lines[i] = localNameRe.ReplaceAllStringFunc(line, func(name string) string {
+				if local, ok := locals[name]; ok {
+					return local
+				}
+				return name // a named type
+			})
+		}
+		items["@"+fn.Name()] = lines
+	}
+	return items
+}
+
+// normalizeIR splits the textual IR of a global or function into lines,
+// removing lines and parts that are not relevant in comparing IR, such as
+// comments, metadata and attribute groups.
+func normalizeIR(ir string) []string {
+	var out []string
+	for _, line := range strings.Split(ir, "\n") {
+		if i := strings.Index(line, "; "); i >= 0 && !strings.Contains(line[:i], `"`) {
+			line = line[:i]
+		}
+		line = metadataRe.ReplaceAllString(line, "")
+		line = attrGroupRe.ReplaceAllString(line, "")
+		line = strings.TrimRight(line, " ")
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// diffLines returns a simple line-based diff between the expected and actual
+// lines, for use in error messages.
+func diffLines(expected, actual []string) []string {
+	// Compute the longest common subsequence.
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var diff []string
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			diff = append(diff, "  "+expected[i])
+			i++
+			j++
+		case i < len(expected) && (j == len(actual) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "- "+expected[i])
+			i++
+		default:
+			diff = append(diff, "+ "+actual[j])
+			j++
+		}
+	}
+	return diff
+}
+
+// TestLargeInit checks that the synthetic package initializer used in
+// BenchmarkLargeInit is fully interpreted into constant tables.
+func TestLargeInit(t *testing.T) {
+	t.Parallel()
+	ctx := llvm.NewContext()
+	defer ctx.Dispose()
+	mod := newLargeInitModule(ctx, 100)
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	if _, err := RunWithConfig(mod, DefaultConfig(targetData)); err != nil {
+		t.Fatal(err)
+	}
+	if diff := compareModules(newLargeInitOutput(ctx, 100), mod); diff != "" {
+		t.Errorf("output does not match expected output:\n%s", diff)
+	}
+}
+
+// TestGetLocalAllocs checks that using the same operand more than once in a
+// frame, like in a loop, doesn't allocate a new wrapper every time.
+func TestGetLocalAllocs(t *testing.T) {
+	ctx := llvm.NewContext()
+	defer ctx.Dispose()
+	mod := newLargeInitModule(ctx, 4)
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	fr := &frame{
+		Eval:   NewEval(mod, targetData),
+		locals: make(map[llvm.Value]llvm.Value),
+		maps:   make(map[llvm.Value]*MapValue),
+		values: make(map[llvm.Value]*LocalValue),
+	}
+	operand := mod.NamedGlobal("main.squares")
+	first := fr.getLocal(operand)
+	if allocs := testing.AllocsPerRun(100, func() {
+		if fr.getLocal(operand) != first {
+			t.Fatal("got a different wrapper for the same operand")
+		}
+	}); allocs != 0 {
+		t.Errorf("expected no allocations when using an operand again, got %.1f per use", allocs)
+	}
+}
+
+// BenchmarkLargeInit measures interpreting a large synthetic package
+// initializer: a loop filling a table followed by many individual stores, as
+// is common for large composite literals. Run it with -benchmem and compare
+// the allocations per operation when changing how operands are stored.
+func BenchmarkLargeInit(b *testing.B) {
+	const size = 1000
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ctx := llvm.NewContext()
+		mod := newLargeInitModule(ctx, size)
+		targetData := llvm.NewTargetData(mod.DataLayout())
+		b.StartTimer()
+		_, err := RunWithConfig(mod, DefaultConfig(targetData))
+		b.StopTimer()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if i == 0 {
+			if diff := compareModules(newLargeInitOutput(ctx, size), mod); diff != "" {
+				b.Fatalf("output does not match expected output:\n%s", diff)
+			}
+		}
+		targetData.Dispose()
+		ctx.Dispose()
+	}
+}
+
+// newLargeInitModule creates a module with a single package initializer that
+// initializes two tables of the given size.
+func newLargeInitModule(ctx llvm.Context, size int) llvm.Module {
+	mod := ctx.NewModule("main")
+	mod.SetDataLayout("e-m:e-p:64:64-i64:64-n8:16:32:64-S128")
+	i32 := ctx.Int32Type()
+	i8ptr := llvm.PointerType(ctx.Int8Type(), 0)
+	tableType := llvm.ArrayType(i32, size)
+	squares := llvm.AddGlobal(mod, tableType, "main.squares")
+	squares.SetInitializer(llvm.ConstNull(tableType))
+	values := llvm.AddGlobal(mod, tableType, "main.values")
+	values.SetInitializer(llvm.ConstNull(tableType))
+
+	builder := ctx.NewBuilder()
+	defer builder.Dispose()
+	initType := llvm.FunctionType(ctx.VoidType(), []llvm.Type{i8ptr, i8ptr}, false)
+	initFn := llvm.AddFunction(mod, "main.init", initType)
+	entry := ctx.AddBasicBlock(initFn, "entry")
+	loop := ctx.AddBasicBlock(initFn, "loop")
+	done := ctx.AddBasicBlock(initFn, "done")
+
+	// for i := range squares { squares[i] = i * i }
+	builder.SetInsertPointAtEnd(entry)
+	builder.CreateBr(loop)
+	builder.SetInsertPointAtEnd(loop)
+	index := builder.CreatePHI(i32, "i")
+	square := builder.CreateMul(index, index, "")
+	zero := llvm.ConstInt(i32, 0, false)
+	ptr := builder.CreateGEP(squares, []llvm.Value{zero, index}, "")
+	builder.CreateStore(square, ptr)
+	next := builder.CreateAdd(index, llvm.ConstInt(i32, 1, false), "")
+	index.AddIncoming([]llvm.Value{zero, next}, []llvm.BasicBlock{entry, loop})
+	cond := builder.CreateICmp(llvm.IntULT, next, llvm.ConstInt(i32, uint64(size), false), "")
+	builder.CreateCondBr(cond, loop, done)
+
+	// values = [...]int32{0, 7, 14, ...}
+	builder.SetInsertPointAtEnd(done)
+	for i := 0; i < size; i++ {
+		ptr := llvm.ConstGEP(values, []llvm.Value{zero, llvm.ConstInt(i32, uint64(i), false)})
+		builder.CreateStore(llvm.ConstInt(i32, uint64(i*7), false), ptr)
+	}
+	builder.CreateRetVoid()
+
+	initAllType := llvm.FunctionType(ctx.VoidType(), nil, false)
+	initAll := llvm.AddFunction(mod, "runtime.initAll", initAllType)
+	builder.SetInsertPointAtEnd(ctx.AddBasicBlock(initAll, "entry"))
+	undef := llvm.Undef(i8ptr)
+	builder.CreateCall(initFn, []llvm.Value{undef, undef}, "")
+	builder.CreateRetVoid()
+	return mod
+}
+
+// newLargeInitOutput creates the module newLargeInitModule is expected to be
+// turned into: the package initializer is fully interpreted, so both tables
+// are constant and runtime.initAll doesn't call anything anymore.
+func newLargeInitOutput(ctx llvm.Context, size int) llvm.Module {
+	mod := ctx.NewModule("main")
+	mod.SetDataLayout("e-m:e-p:64:64-i64:64-n8:16:32:64-S128")
+	i32 := ctx.Int32Type()
+	squares := make([]llvm.Value, size)
+	values := make([]llvm.Value, size)
+	for i := 0; i < size; i++ {
+		squares[i] = llvm.ConstInt(i32, uint64(i*i), false)
+		values[i] = llvm.ConstInt(i32, uint64(i*7), false)
+	}
+	for _, table := range []struct {
+		name     string
+		elements []llvm.Value
+	}{
+		{"main.squares", squares},
+		{"main.values", values},
+	} {
+		global := llvm.AddGlobal(mod, llvm.ArrayType(i32, size), table.name)
+		global.SetInitializer(llvm.ConstArray(i32, table.elements))
+		global.SetGlobalConstant(true)
+	}
+
+	builder := ctx.NewBuilder()
+	defer builder.Dispose()
+	initAll := llvm.AddFunction(mod, "runtime.initAll", llvm.FunctionType(ctx.VoidType(), nil, false))
+	builder.SetInsertPointAtEnd(ctx.AddBasicBlock(initAll, "entry"))
+	builder.CreateRetVoid()
+	return mod
+}
@@ -0,0 +1,141 @@
+package interp
+
+// This file provides access to some parts of the LLVM C API that are not
+// exposed by the Go bindings.
+
+import (
+	"go/token"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"tinygo.org/x/go-llvm"
+)
+
+/*
+#include <llvm-c/Core.h>
+*/
+import "C"
+
+// valueRef converts a Go LLVM value into its C equivalent.
+func valueRef(v llvm.Value) C.LLVMValueRef {
+	return C.LLVMValueRef(unsafe.Pointer(v.C))
+}
+
+// valueString returns the textual representation of a value as it would be
+// printed in a .ll file, without leading or trailing whitespace.
+func valueString(v llvm.Value) string {
+	cstr := C.LLVMPrintValueToString(valueRef(v))
+	defer C.LLVMDisposeMessage(cstr)
+	return strings.TrimSpace(C.GoString(cstr))
+}
+
+// getPosition returns the source location of the given instruction, as stored
+// in the attached debug information. It returns an invalid position if there
+// is no debug information.
+func getPosition(inst llvm.Value) token.Position {
+	if inst.IsNil() || inst.IsAInstruction().IsNil() {
+		return token.Position{}
+	}
+	line := C.LLVMGetDebugLocLine(valueRef(inst))
+	if line == 0 {
+		return token.Position{}
+	}
+	var length C.unsigned
+	filename := C.GoStringN(C.LLVMGetDebugLocFilename(valueRef(inst), &length), C.int(length))
+	directory := C.GoStringN(C.LLVMGetDebugLocDirectory(valueRef(inst), &length), C.int(length))
+	if directory != "" && !filepath.IsAbs(filename) {
+		filename = filepath.Join(directory, filename)
+	}
+	return token.Position{
+		Filename: filename,
+		Line:     int(line),
+		Column:   int(C.LLVMGetDebugLocColumn(valueRef(inst))),
+	}
+}
+
+// isAtomicRMW returns whether the given instruction is an atomicrmw
+// instruction.
+func isAtomicRMW(inst llvm.Value) bool {
+	return C.LLVMIsAAtomicRMWInst(valueRef(inst)) != nil
+}
+
+// isAtomicCmpXchg returns whether the given instruction is a cmpxchg
+// instruction.
+func isAtomicCmpXchg(inst llvm.Value) bool {
+	return C.LLVMIsAAtomicCmpXchgInst(valueRef(inst)) != nil
+}
+
+// isFence returns whether the given instruction is a fence instruction.
+func isFence(inst llvm.Value) bool {
+	return C.LLVMIsAFenceInst(valueRef(inst)) != nil
+}
+
+// atomicRMWOp is the operation applied by an atomicrmw instruction.
+type atomicRMWOp int
+
+const (
+	atomicRMWXchg atomicRMWOp = iota
+	atomicRMWAdd
+	atomicRMWSub
+	atomicRMWAnd
+	atomicRMWNand
+	atomicRMWOr
+	atomicRMWXor
+	atomicRMWMax
+	atomicRMWMin
+	atomicRMWUMax
+	atomicRMWUMin
+	atomicRMWOther // floating point operations, etc.
+)
+
+// getAtomicRMWOp returns the operation of an atomicrmw instruction. The C API
+// of LLVM 8 has no accessor for it, so it is read from the textual form of the
+// instruction instead.
+func getAtomicRMWOp(inst llvm.Value) atomicRMWOp {
+	fields := strings.Fields(valueString(inst))
+	for i, field := range fields {
+		if field != "atomicrmw" {
+			continue
+		}
+		op := ""
+		if i+1 < len(fields) {
+			op = fields[i+1]
+		}
+		if op == "volatile" && i+2 < len(fields) {
+			op = fields[i+2]
+		}
+		switch op {
+		case "xchg":
+			return atomicRMWXchg
+		case "add":
+			return atomicRMWAdd
+		case "sub":
+			return atomicRMWSub
+		case "and":
+			return atomicRMWAnd
+		case "nand":
+			return atomicRMWNand
+		case "or":
+			return atomicRMWOr
+		case "xor":
+			return atomicRMWXor
+		case "max":
+			return atomicRMWMax
+		case "min":
+			return atomicRMWMin
+		case "umax":
+			return atomicRMWUMax
+		case "umin":
+			return atomicRMWUMin
+		}
+		break
+	}
+	return atomicRMWOther
+}
+
+// constFloatValue returns the value of a floating point constant.
+func constFloatValue(v llvm.Value) float64 {
+	var losesInfo C.LLVMBool
+	return float64(C.LLVMConstRealGetDouble(valueRef(v), &losesInfo))
+}
@@ -0,0 +1,9 @@
+// +build !byollvm
+
+package interp
+
+/*
+#cgo linux  CFLAGS: -I/usr/lib/llvm-8/include
+#cgo darwin CFLAGS: -I/usr/local/opt/llvm/include
+*/
+import "C"
@@ -0,0 +1,925 @@
+package interp
+
+// This file models memory during interpretation. Pointers are represented
+// symbolically as a global plus a byte offset, and loads and stores operate
+// directly on the initializers of globals.
+
+import (
+	"tinygo.org/x/go-llvm"
+)
+
+// pointer is a location in memory: a byte offset from the start of a global
+// variable.
+type pointer struct {
+	global llvm.Value
+	offset int64
+}
+
+// getPointer returns the location a constant pointer points to. It also
+// accepts pointer-sized integers that are derived from a pointer, such as the
+// result of a ptrtoint followed by some arithmetic. The ok value is false if
+// the location cannot be determined at compile time.
+func (e *Eval) getPointer(v llvm.Value) (p pointer, ok bool) {
+	if !v.IsAGlobalVariable().IsNil() {
+		return pointer{v, 0}, true
+	}
+	if v.IsAConstantExpr().IsNil() {
+		return pointer{}, false
+	}
+	switch v.Opcode() {
+	case llvm.BitCast:
+		return e.getPointer(v.Operand(0))
+	case llvm.PtrToInt, llvm.IntToPtr:
+		if !e.isPointerSized(v) || !e.isPointerSized(v.Operand(0)) {
+			// Truncated or extended pointers can't be tracked.
+			return pointer{}, false
+		}
+		return e.getPointer(v.Operand(0))
+	case llvm.GetElementPtr:
+		p, ok := e.getPointer(v.Operand(0))
+		if !ok {
+			return pointer{}, false
+		}
+		indices := make([]llvm.Value, v.OperandsCount()-1)
+		for i := range indices {
+			indices[i] = v.Operand(i + 1)
+		}
+		offset, ok := e.gepOffset(v.Operand(0).Type().ElementType(), indices)
+		if !ok {
+			return pointer{}, false
+		}
+		return e.checkPointer(pointer{p.global, p.offset + offset})
+	case llvm.Add:
+		for i := 0; i < 2; i++ {
+			n := v.Operand(1 - i)
+			if n.IsAConstantInt().IsNil() {
+				continue
+			}
+			if p, ok := e.getPointer(v.Operand(i)); ok {
+				return e.checkPointer(pointer{p.global, p.offset + n.SExtValue()})
+			}
+		}
+	case llvm.Sub:
+		n := v.Operand(1)
+		if !n.IsAConstantInt().IsNil() {
+			if p, ok := e.getPointer(v.Operand(0)); ok {
+				return e.checkPointer(pointer{p.global, p.offset - n.SExtValue()})
+			}
+		}
+	case llvm.And:
+		// Rounding a pointer down to a given alignment, for example as part
+		// of (p + 7) &^ 7. This is only known at compile time if the global
+		// itself is at least as aligned as the rounding operation.
+		mask := v.Operand(1)
+		if mask.IsAConstantInt().IsNil() {
+			return pointer{}, false
+		}
+		p, ok := e.getPointer(v.Operand(0))
+		if !ok {
+			return pointer{}, false
+		}
+		lowBits := ^mask.SExtValue()
+		if lowBits < 0 || lowBits&(lowBits+1) != 0 {
+			// Not of the form ^(2**n - 1).
+			return pointer{}, false
+		}
+		align := int(lowBits + 1)
+		if align > e.TargetData.PreferredAlignment(p.global) {
+			return pointer{}, false
+		}
+		// Make sure the global really gets this alignment, as the result
+		// relies on it. This is undone if the init function is reverted.
+		e.raiseAlignment(p.global, align)
+		return e.checkPointer(pointer{p.global, p.offset &^ lowBits})
+	}
+	return pointer{}, false
+}
+
+// getFunction returns the function the given constant points to, looking
+// through pointer casts. Function pointers may also be stored as integers, for
+// example in func values. It returns a nil value if the constant is not a
+// pointer to a function.
+func (e *Eval) getFunction(v llvm.Value) llvm.Value {
+	for {
+		if !v.IsAFunction().IsNil() {
+			return v
+		}
+		if v.IsAConstantExpr().IsNil() {
+			return llvm.Value{}
+		}
+		switch v.Opcode() {
+		case llvm.BitCast:
+		case llvm.PtrToInt, llvm.IntToPtr:
+			if !e.isPointerSized(v) {
+				return llvm.Value{}
+			}
+		default:
+			return llvm.Value{}
+		}
+		v = v.Operand(0)
+	}
+}
+
+// getBaseGlobal returns the global the given pointer (or pointer-derived
+// integer) is based on. Unlike getPointer, this also works for pointers that
+// are computed at runtime, such as a getelementptr with a non-constant index.
+// It returns false if the base is not a known global.
+func (e *Eval) getBaseGlobal(v llvm.Value) (llvm.Value, bool) {
+	if p, ok := e.getPointer(v); ok {
+		return p.global, true
+	}
+	var opcode llvm.Opcode
+	switch {
+	case !v.IsAConstantExpr().IsNil():
+		opcode = v.Opcode()
+	case !v.IsAInstruction().IsNil():
+		opcode = v.InstructionOpcode()
+	default:
+		return llvm.Value{}, false
+	}
+	switch opcode {
+	case llvm.BitCast, llvm.PtrToInt, llvm.IntToPtr, llvm.GetElementPtr:
+		return e.getBaseGlobal(v.Operand(0))
+	case llvm.Add, llvm.Sub, llvm.And, llvm.Or:
+		// Pointer arithmetic on an integer: the pointer may be either
+		// operand.
+		for i := 0; i < 2; i++ {
+			if global, ok := e.getBaseGlobal(v.Operand(i)); ok {
+				return global, true
+			}
+		}
+	}
+	return llvm.Value{}, false
+}
+
+// checkPointer returns the pointer with ok set to true if it points inside the
+// global (or just past the end of it).
+func (e *Eval) checkPointer(p pointer) (pointer, bool) {
+	if p.offset < 0 || uint64(p.offset) > e.TargetData.TypeAllocSize(p.global.Type().ElementType()) {
+		return pointer{}, false
+	}
+	return p, true
+}
+
+// comparePointers evaluates an icmp instruction between two constant pointers,
+// using the location they point to. Pointers are equal if they point to the
+// same offset in the same global, and a pointer into a global is never nil (see
+// isNonNil), even if the offset is only known at runtime. The
+// ok value is false if the result could not be determined, in which case the
+// comparison should be left to the constant folder. Ordered comparisons between
+// pointers to different globals result in an error, as the layout of globals
+// in memory is not known until link time.
+func (e *Eval) comparePointers(predicate llvm.IntPredicate, lhs, rhs llvm.Value) (result llvm.Value, ok bool, err error) {
+	lhsPtr, lhsOk := e.getPointer(lhs)
+	rhsPtr, rhsOk := e.getPointer(rhs)
+	lhsNil, lhsNilOk := isPointerNil(lhs)
+	rhsNil, rhsNilOk := isPointerNil(rhs)
+	lhsNil = lhsNil && lhsNilOk
+	rhsNil = rhsNil && rhsNilOk
+
+	// cmp is negative if lhs < rhs, zero if they are equal and positive if
+	// lhs > rhs, like strings.Compare.
+	var cmp int64
+	switch {
+	case lhsOk && rhsOk && lhsPtr.global == rhsPtr.global:
+		cmp = lhsPtr.offset - rhsPtr.offset
+	case lhsOk && rhsOk:
+		if predicate != llvm.IntEQ && predicate != llvm.IntNE {
+			return llvm.Value{}, false, newDiagnostic(Unsupported, lhs, "ordered comparison between pointers to different globals: "+valueString(lhs)+" and "+valueString(rhs))
+		}
+		cmp = 1
+	case lhsNil && rhsNil:
+		cmp = 0
+	case rhsNil && e.isNonNil(lhs):
+		cmp = 1
+	case lhsNil && e.isNonNil(rhs):
+		cmp = -1
+	default:
+		return llvm.Value{}, false, nil
+	}
+
+	var value bool
+	switch predicate {
+	case llvm.IntEQ:
+		value = cmp == 0
+	case llvm.IntNE:
+		value = cmp != 0
+	case llvm.IntUGT:
+		value = cmp > 0
+	case llvm.IntUGE:
+		value = cmp >= 0
+	case llvm.IntULT:
+		value = cmp < 0
+	case llvm.IntULE:
+		value = cmp <= 0
+	default:
+		// Signed comparisons of pointers don't happen in Go code.
+		return llvm.Value{}, false, nil
+	}
+	n := uint64(0)
+	if value {
+		n = 1
+	}
+	return llvm.ConstInt(e.Mod.Context().Int1Type(), n, false), true, nil
+}
+
+// isNonNil returns whether the given pointer is known not to be nil, because it
+// points into a global or into a heap allocation created during interpretation.
+// Unlike getPointer, this also works for pointers that are computed at runtime,
+// like a getelementptr with a non-constant index into a global: the front-end
+// only emits inbounds getelementptr instructions, which cannot wrap around to
+// nil. Extern weak globals may be nil, as they may not be defined at all.
+func (e *Eval) isNonNil(v llvm.Value) bool {
+	if p, ok := e.getPointer(v); ok {
+		return p.global.Linkage() != llvm.ExternalWeakLinkage
+	}
+	for {
+		if !v.IsAGlobalValue().IsNil() {
+			return v.Linkage() != llvm.ExternalWeakLinkage
+		}
+		var opcode llvm.Opcode
+		switch {
+		case !v.IsAConstantExpr().IsNil():
+			opcode = v.Opcode()
+		case !v.IsAInstruction().IsNil():
+			opcode = v.InstructionOpcode()
+		default:
+			return false
+		}
+		if opcode != llvm.BitCast && opcode != llvm.GetElementPtr {
+			return false
+		}
+		v = v.Operand(0)
+	}
+}
+
+// constantInt returns the value of an integer that is known during
+// interpretation. Unlike a plain check for a constant integer, it also resolves
+// constant expressions that the IR builder could not fold, such as the
+// difference between two pointers into the same global. The ok value is false
+// if the value is not known.
+func (e *Eval) constantInt(v llvm.Value) (n uint64, ok bool) {
+	if !v.IsAConstantInt().IsNil() {
+		if v.Type().IntTypeWidth() > 64 {
+			return 0, false
+		}
+		return v.ZExtValue(), true
+	}
+	if v.IsAConstantExpr().IsNil() || v.Type().TypeKind() != llvm.IntegerTypeKind || v.Type().IntTypeWidth() > 64 {
+		return 0, false
+	}
+	switch v.Opcode() {
+	case llvm.ZExt:
+		return e.constantInt(v.Operand(0))
+	case llvm.Sub:
+		// The distance between two pointers into the same global, such as
+		// the number of bytes remaining in a buffer.
+		if lhs, ok := e.getPointer(v.Operand(0)); ok {
+			if rhs, ok := e.getPointer(v.Operand(1)); ok && lhs.global == rhs.global {
+				n = uint64(lhs.offset - rhs.offset)
+				break
+			}
+		}
+		fallthrough
+	case llvm.Add, llvm.Mul, llvm.Shl, llvm.LShr, llvm.UDiv:
+		lhs, ok1 := e.constantInt(v.Operand(0))
+		rhs, ok2 := e.constantInt(v.Operand(1))
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		switch v.Opcode() {
+		case llvm.Add:
+			n = lhs + rhs
+		case llvm.Sub:
+			n = lhs - rhs
+		case llvm.Mul:
+			n = lhs * rhs
+		case llvm.Shl:
+			n = lhs << rhs
+		case llvm.LShr:
+			n = lhs >> rhs
+		case llvm.UDiv:
+			if rhs == 0 {
+				return 0, false
+			}
+			n = lhs / rhs
+		}
+	default:
+		return 0, false
+	}
+	if width := v.Type().IntTypeWidth(); width < 64 {
+		n &= 1<<uint(width) - 1
+	}
+	return n, true
+}
+
+// isPointerSized returns whether the given value is a pointer or an integer
+// that is big enough to hold a pointer without losing information.
+func (e *Eval) isPointerSized(v llvm.Value) bool {
+	switch v.Type().TypeKind() {
+	case llvm.PointerTypeKind:
+		return true
+	case llvm.IntegerTypeKind:
+		return v.Type().IntTypeWidth() == e.TargetData.PointerSize()*8
+	default:
+		return false
+	}
+}
+
+// gepOffset calculates the byte offset of a getelementptr with the given
+// source element type and indices, walking through any number of nested arrays
+// and structs. The ok value is false if some of the indices are not known
+// during interpretation.
+func (e *Eval) gepOffset(elementType llvm.Type, indices []llvm.Value) (offset int64, ok bool) {
+	for i, index := range indices {
+		n, ok := e.gepIndex(index)
+		if !ok {
+			return 0, false
+		}
+		if i == 0 {
+			offset += n * int64(e.TargetData.TypeAllocSize(elementType))
+			continue
+		}
+		switch elementType.TypeKind() {
+		case llvm.StructTypeKind:
+			offset += int64(e.TargetData.ElementOffset(elementType, int(n)))
+			elementType = elementType.StructElementTypes()[n]
+		case llvm.ArrayTypeKind, llvm.VectorTypeKind:
+			elementType = elementType.ElementType()
+			offset += n * int64(e.TargetData.TypeAllocSize(elementType))
+		default:
+			return 0, false
+		}
+	}
+	return offset, true
+}
+
+// gepIndex returns the value of a getelementptr index, which is a signed
+// integer of any width. Indices that were computed during interpretation may be
+// constant expressions instead of plain integers, see constantInt.
+func (e *Eval) gepIndex(index llvm.Value) (int64, bool) {
+	if !index.IsAConstantInt().IsNil() {
+		return index.SExtValue(), true
+	}
+	n, ok := e.constantInt(index)
+	if !ok {
+		return 0, false
+	}
+	if width := uint(index.Type().IntTypeWidth()); width < 64 {
+		// Sign extend to 64 bits.
+		return int64(n<<(64-width)) >> (64 - width), true
+	}
+	return int64(n), true
+}
+
+// findIndices returns the indices needed to reach a value of type target at
+// the given byte offset in a value of type t, as used in extractvalue and
+// insertvalue. The ok value is false if there is no such value.
+func (e *Eval) findIndices(t llvm.Type, offset uint64, target llvm.Type) (indices []uint32, ok bool) {
+	if offset == 0 && t == target {
+		return nil, true
+	}
+	if offset >= e.TargetData.TypeAllocSize(t) {
+		return nil, false
+	}
+	var index int
+	var elementType llvm.Type
+	var elementOffset uint64
+	switch t.TypeKind() {
+	case llvm.StructTypeKind:
+		index = e.TargetData.ElementContainingOffset(t, offset)
+		elementType = t.StructElementTypes()[index]
+		elementOffset = e.TargetData.ElementOffset(t, index)
+	case llvm.ArrayTypeKind:
+		elementType = t.ElementType()
+		elementSize := e.TargetData.TypeAllocSize(elementType)
+		if elementSize == 0 {
+			return nil, false
+		}
+		index = int(offset / elementSize)
+		elementOffset = uint64(index) * elementSize
+	default:
+		return nil, false
+	}
+	rest, ok := e.findIndices(elementType, offset-elementOffset, target)
+	if !ok {
+		return nil, false
+	}
+	return append([]uint32{uint32(index)}, rest...), true
+}
+
+// pointerValue returns a constant pointer of the given type that points to the
+// given location. When possible, it is expressed as a getelementptr with
+// regular indices into the global.
+func (e *Eval) pointerValue(p pointer, t llvm.Type) llvm.Value {
+	globalType := p.global.Type().ElementType()
+	if indices, ok := e.findIndices(globalType, uint64(p.offset), t.ElementType()); ok {
+		if len(indices) == 0 {
+			return p.global
+		}
+		int32Type := e.Mod.Context().Int32Type()
+		return llvm.ConstInBoundsGEP(p.global, getLLVMIndices(int32Type, append([]uint32{0}, indices...)))
+	}
+
+	// There is no value of the requested type at this location, so use a
+	// plain byte offset.
+	i8ptrType := llvm.PointerType(e.Mod.Context().Int8Type(), 0)
+	ptr := llvm.ConstBitCast(p.global, i8ptrType)
+	if p.offset != 0 {
+		offset := llvm.ConstInt(e.TargetData.IntPtrType(), uint64(p.offset), false)
+		ptr = llvm.ConstInBoundsGEP(ptr, []llvm.Value{offset})
+	}
+	return llvm.ConstBitCast(ptr, t)
+}
+
+// locate finds the innermost value in a value of type t that fully contains
+// size bytes starting at the given offset, stopping early at a value of type
+// target at exactly that offset. It returns the indices of this value (as used
+// in extractvalue), its type and the remaining offset within it.
+func (e *Eval) locate(t llvm.Type, offset, size uint64, target llvm.Type) (indices []uint32, elementType llvm.Type, elementOffset uint64) {
+	// Reuse the same buffer for every call, as this is called for every load
+	// and store. The indices are only valid until the next call.
+	indices = e.locateBuf[:0]
+	for {
+		if offset == 0 && t == target {
+			return indices, t, offset
+		}
+		var index uint64
+		var subType llvm.Type
+		var subOffset uint64
+		switch t.TypeKind() {
+		case llvm.StructTypeKind:
+			index = uint64(e.TargetData.ElementContainingOffset(t, offset))
+			subType = t.StructElementTypes()[index]
+			subOffset = e.TargetData.ElementOffset(t, int(index))
+		case llvm.ArrayTypeKind:
+			subType = t.ElementType()
+			elementSize := e.TargetData.TypeAllocSize(subType)
+			if elementSize == 0 {
+				return indices, t, offset
+			}
+			index = offset / elementSize
+			subOffset = index * elementSize
+		default:
+			return indices, t, offset
+		}
+		if offset-subOffset+size > e.TargetData.TypeAllocSize(subType) {
+			// The range doesn't fit in a single element.
+			return indices, t, offset
+		}
+		indices = append(indices, uint32(index))
+		e.locateBuf = indices
+		t = subType
+		offset -= subOffset
+	}
+}
+
+// memoryRange returns the location of a load or store of the given type
+// through the given pointer: the global, the indices of the innermost value
+// that contains the accessed bytes and the offset within this value.
+func (e *Eval) memoryRange(ptr llvm.Value, t llvm.Type) (global llvm.Value, indices []uint32, elementType llvm.Type, offset uint64, err error) {
+	p, ok := e.getPointer(ptr)
+	if !ok {
+		return llvm.Value{}, nil, llvm.Type{}, 0, newDiagnostic(Unsupported, ptr, "unknown pointer: "+valueString(ptr))
+	}
+	if p.global.IsDeclaration() {
+		return llvm.Value{}, nil, llvm.Type{}, 0, newDiagnostic(Unsupported, ptr, "external global: "+valueString(ptr))
+	}
+	size := e.TargetData.TypeStoreSize(t)
+	globalType := p.global.Type().ElementType()
+	if uint64(p.offset)+size > e.TargetData.TypeAllocSize(globalType) {
+		return llvm.Value{}, nil, llvm.Type{}, 0, newDiagnostic(Unsupported, ptr, "out of bounds access: "+valueString(ptr))
+	}
+	indices, elementType, offset = e.locate(globalType, uint64(p.offset), size, t)
+	return p.global, indices, elementType, offset, nil
+}
+
+// load reads a value of the given type from the location the pointer points
+// to. The pointer may have been cast to a different type, in which case the
+// underlying bytes are reinterpreted as the requested type.
+func (e *Eval) load(ptr llvm.Value, t llvm.Type) (llvm.Value, error) {
+	global, indices, _, offset, err := e.memoryRange(ptr, t)
+	if err != nil {
+		return llvm.Value{}, newDiagnostic(Unsupported, ptr, "cannot load from "+err.Error())
+	}
+	if _, ok := e.dirtyGlobals[global]; ok {
+		// The global is modified at runtime, for example by an earlier init
+		// function that was reverted. Its initializer is not the value that
+		// would be read at runtime, so the load must happen at runtime too.
+		return llvm.Value{}, newDiagnostic(Unsupported, ptr, "cannot load from global that is modified at runtime: "+valueString(ptr))
+	}
+	if isWeak(global) && !(isODR(global) && global.IsGlobalConstant()) {
+		// The linker may pick a different definition with a different value.
+		// Only constants with an ODR linkage are known to be the same
+		// everywhere.
+		return llvm.Value{}, newDiagnostic(Unsupported, ptr, "cannot load from global with weak linkage: "+valueString(ptr))
+	}
+	element := global.Initializer()
+	if len(indices) != 0 {
+		element = llvm.ConstExtractValue(element, indices)
+	}
+	if offset == 0 {
+		if value, ok := e.convertValue(element, t); ok {
+			return zeroUndef(value), nil
+		}
+	}
+	buf, ok := e.constBytes(element)
+	if !ok {
+		return llvm.Value{}, newDiagnostic(Unsupported, ptr, "cannot load "+t.String()+" from "+valueString(ptr)+": cannot reinterpret "+valueString(element))
+	}
+	value, ok := e.constFromBytes(buf[offset:offset+e.TargetData.TypeStoreSize(t)], t)
+	if !ok {
+		return llvm.Value{}, newDiagnostic(Unsupported, ptr, "cannot load "+t.String()+" from "+valueString(ptr))
+	}
+	return value, nil
+}
+
+// zeroUndef replaces all undef values in the given constant with zero. Memory
+// that is undef (for example, a global with an undef initializer) is read as
+// zero, like in constBytes, so that the result of a load can be used in
+// comparisons and branches.
+func zeroUndef(v llvm.Value) llvm.Value {
+	if v.IsUndef() {
+		return llvm.ConstNull(v.Type())
+	}
+	if v.IsAConstantStruct().IsNil() && v.IsAConstantArray().IsNil() {
+		// Other constants, such as integers, zeroinitializer and arrays of
+		// plain integers, never contain undef values.
+		return v
+	}
+	for i := 0; i < v.OperandsCount(); i++ {
+		element := llvm.ConstExtractValue(v, []uint32{uint32(i)})
+		if newElement := zeroUndef(element); newElement != element {
+			v = llvm.ConstInsertValue(v, newElement, []uint32{uint32(i)})
+		}
+	}
+	return v
+}
+
+// store writes the given value to the location the pointer points to, by
+// updating the initializer of the global. Like load, the value may be of a
+// different type than the value that is stored at this location.
+func (e *Eval) store(ptr, value llvm.Value) error {
+	if value.Type().TypeKind() == llvm.IntegerTypeKind && !value.IsAConstantExpr().IsNil() {
+		// This integer is derived from a pointer. Globals can only be
+		// initialized with a plain ptrtoint of a pointer, so convert it to
+		// that form.
+		if valuePtr, ok := e.getPointer(value); ok {
+			i8ptrType := llvm.PointerType(e.Mod.Context().Int8Type(), 0)
+			value = llvm.ConstPtrToInt(e.pointerValue(valuePtr, i8ptrType), value.Type())
+		} else if fn := e.getFunction(value); !fn.IsNil() {
+			value = llvm.ConstPtrToInt(fn, value.Type())
+		} else {
+			return newDiagnostic(Unsupported, value, "cannot store integer derived from a pointer: "+valueString(value))
+		}
+	}
+	if value.Type().TypeKind() == llvm.PointerTypeKind {
+		if valuePtr, ok := e.getPointer(value); ok {
+			// Store pointers to globals in a canonical form, preferably as
+			// a getelementptr with regular indices.
+			value = e.pointerValue(valuePtr, value.Type())
+		} else if fn := e.getFunction(value); !fn.IsNil() {
+			// Likewise for function pointers.
+			value = llvm.ConstBitCast(fn, value.Type())
+		}
+	}
+	global, indices, elementType, offset, err := e.memoryRange(ptr, value.Type())
+	if err != nil {
+		return newDiagnostic(Unsupported, ptr, "cannot store to "+err.Error())
+	}
+	if isWeak(global) {
+		// The linker may pick a different definition, losing the store.
+		return newDiagnostic(Unsupported, ptr, "cannot store to global with weak linkage: "+valueString(ptr))
+	}
+	newElement, ok := llvm.Value{}, false
+	if offset == 0 {
+		newElement, ok = e.convertValue(value, elementType)
+	}
+	if !ok {
+		element := global.Initializer()
+		if len(indices) != 0 {
+			element = llvm.ConstExtractValue(element, indices)
+		}
+		buf, ok1 := e.constBytes(element)
+		valueBuf, ok2 := e.constBytes(value)
+		if !ok1 || !ok2 {
+			return newDiagnostic(Unsupported, ptr, "cannot store "+valueString(value)+" to "+valueString(ptr))
+		}
+		copy(buf[offset:], valueBuf[:e.TargetData.TypeStoreSize(value.Type())])
+		newElement, ok = e.constFromBytes(buf, elementType)
+		if !ok {
+			return newDiagnostic(Unsupported, ptr, "cannot store "+valueString(value)+" to "+valueString(ptr))
+		}
+	}
+	if len(indices) == 0 {
+		e.setInitializer(global, newElement)
+	} else {
+		e.setInitializer(global, llvm.ConstInsertValue(global.Initializer(), newElement, indices))
+	}
+	return nil
+}
+
+// convertValue converts a value to the given type without going through its
+// byte representation, for values of the same type or for pointer casts. The
+// ok value is false if this is not possible.
+func (e *Eval) convertValue(v llvm.Value, t llvm.Type) (llvm.Value, bool) {
+	if v.Type() == t {
+		return v, true
+	}
+	if e.TargetData.TypeStoreSize(v.Type()) != e.TargetData.TypeStoreSize(t) {
+		return llvm.Value{}, false
+	}
+	fromKind := v.Type().TypeKind()
+	toKind := t.TypeKind()
+	switch {
+	case fromKind == llvm.PointerTypeKind && toKind == llvm.PointerTypeKind:
+		return llvm.ConstBitCast(v, t), true
+	case fromKind == llvm.PointerTypeKind && toKind == llvm.IntegerTypeKind:
+		return llvm.ConstPtrToInt(v, t), true
+	case fromKind == llvm.IntegerTypeKind && toKind == llvm.PointerTypeKind:
+		if _, ok := e.getPointer(v); ok {
+			return llvm.ConstIntToPtr(v, t), true
+		}
+		if fn := e.getFunction(v); !fn.IsNil() {
+			return llvm.ConstBitCast(fn, t), true
+		}
+	}
+	return llvm.Value{}, false
+}
+
+// constBytes returns the in-memory representation of a constant. The ok value
+// is false if the constant has no known representation, for example because
+// it contains a pointer.
+func (e *Eval) constBytes(v llvm.Value) ([]byte, bool) {
+	buf := make([]byte, e.TargetData.TypeAllocSize(v.Type()))
+	if v.IsNull() || v.IsUndef() {
+		// Zero value (undef is treated as zero).
+		return buf, true
+	}
+	t := v.Type()
+	switch t.TypeKind() {
+	case llvm.IntegerTypeKind:
+		if v.IsAConstantInt().IsNil() {
+			return nil, false
+		}
+		e.putInt(buf[:e.TargetData.TypeStoreSize(t)], v)
+	case llvm.FloatTypeKind, llvm.DoubleTypeKind:
+		intType := e.Mod.Context().IntType(int(e.TargetData.TypeSizeInBits(t)))
+		n := llvm.ConstBitCast(v, intType)
+		if n.IsAConstantInt().IsNil() {
+			return nil, false
+		}
+		e.putUint(buf, n.ZExtValue())
+	case llvm.StructTypeKind:
+		for i := range t.StructElementTypes() {
+			elementBuf, ok := e.constBytes(llvm.ConstExtractValue(v, []uint32{uint32(i)}))
+			if !ok {
+				return nil, false
+			}
+			copy(buf[e.TargetData.ElementOffset(t, i):], elementBuf)
+		}
+	case llvm.ArrayTypeKind:
+		elementSize := e.TargetData.TypeAllocSize(t.ElementType())
+		for i := 0; i < t.ArrayLength(); i++ {
+			elementBuf, ok := e.constBytes(llvm.ConstExtractValue(v, []uint32{uint32(i)}))
+			if !ok {
+				return nil, false
+			}
+			copy(buf[uint64(i)*elementSize:], elementBuf)
+		}
+	case llvm.PointerTypeKind:
+		// Only plain data packed in a pointer, such as a small value stored
+		// in an interface, has a known byte representation.
+		if v.IsAConstantExpr().IsNil() || v.Opcode() != llvm.IntToPtr || v.Operand(0).IsAConstantInt().IsNil() {
+			return nil, false
+		}
+		e.putUint(buf[:e.TargetData.TypeStoreSize(t)], v.Operand(0).ZExtValue())
+	default:
+		// Other types without a known byte representation.
+		return nil, false
+	}
+	return buf, true
+}
+
+// constFromBytes is the inverse of constBytes: it creates a constant of the
+// given type from its in-memory representation.
+func (e *Eval) constFromBytes(buf []byte, t llvm.Type) (llvm.Value, bool) {
+	switch t.TypeKind() {
+	case llvm.IntegerTypeKind:
+		return e.getInt(buf[:e.TargetData.TypeStoreSize(t)], t), true
+	case llvm.FloatTypeKind, llvm.DoubleTypeKind:
+		intType := e.Mod.Context().IntType(int(e.TargetData.TypeSizeInBits(t)))
+		return llvm.ConstBitCast(llvm.ConstInt(intType, e.getUint(buf[:e.TargetData.TypeStoreSize(t)]), false), t), true
+	case llvm.PointerTypeKind:
+		// Raw bytes can't point to a global, so this is either nil or plain
+		// data packed in a pointer.
+		n := e.getUint(buf[:e.TargetData.TypeStoreSize(t)])
+		if n == 0 {
+			return llvm.ConstNull(t), true
+		}
+		return llvm.ConstIntToPtr(llvm.ConstInt(e.TargetData.IntPtrType(), n, false), t), true
+	case llvm.StructTypeKind:
+		elementTypes := t.StructElementTypes()
+		elements := make([]llvm.Value, len(elementTypes))
+		for i, elementType := range elementTypes {
+			offset := e.TargetData.ElementOffset(t, i)
+			element, ok := e.constFromBytes(buf[offset:], elementType)
+			if !ok {
+				return llvm.Value{}, false
+			}
+			elements[i] = element
+		}
+		if t.StructName() != "" {
+			return llvm.ConstNamedStruct(t, elements), true
+		}
+		return llvm.ConstStruct(elements, t.IsStructPacked()), true
+	case llvm.ArrayTypeKind:
+		elementType := t.ElementType()
+		elementSize := e.TargetData.TypeAllocSize(elementType)
+		elements := make([]llvm.Value, t.ArrayLength())
+		for i := range elements {
+			element, ok := e.constFromBytes(buf[uint64(i)*elementSize:], elementType)
+			if !ok {
+				return llvm.Value{}, false
+			}
+			elements[i] = element
+		}
+		return llvm.ConstArray(elementType, elements), true
+	default:
+		return llvm.Value{}, false
+	}
+}
+
+// putUint stores the integer n in buf, in the byte order of the target.
+func (e *Eval) putUint(buf []byte, n uint64) {
+	for i := range buf {
+		if e.TargetData.ByteOrder() == llvm.BigEndian {
+			buf[len(buf)-1-i] = byte(n)
+		} else {
+			buf[i] = byte(n)
+		}
+		n >>= 8
+	}
+}
+
+// putInt stores the constant integer v in buf, in the byte order of the
+// target. Unlike putUint, it also supports integers wider than 64 bits.
+func (e *Eval) putInt(buf []byte, v llvm.Value) {
+	t := v.Type()
+	if t.IntTypeWidth() <= 64 {
+		e.putUint(buf, v.ZExtValue())
+		return
+	}
+	// Extract the value one byte at a time, starting at the least
+	// significant byte.
+	int8Type := e.Mod.Context().Int8Type()
+	for i := range buf {
+		b := llvm.ConstTrunc(llvm.ConstLShr(v, llvm.ConstInt(t, uint64(i)*8, false)), int8Type)
+		if e.TargetData.ByteOrder() == llvm.BigEndian {
+			buf[len(buf)-1-i] = byte(b.ZExtValue())
+		} else {
+			buf[i] = byte(b.ZExtValue())
+		}
+	}
+}
+
+// getInt is the inverse of putInt: it reads an integer of the given type from
+// buf. Bits in buf beyond the width of the integer type are ignored.
+func (e *Eval) getInt(buf []byte, t llvm.Type) llvm.Value {
+	width := t.IntTypeWidth()
+	if width <= 64 {
+		n := e.getUint(buf)
+		if width < 64 {
+			n &= 1<<uint(width) - 1
+		}
+		return llvm.ConstInt(t, n, false)
+	}
+	// Build the value one byte at a time, starting at the least significant
+	// byte.
+	result := llvm.ConstNull(t)
+	for i := range buf {
+		b := buf[i]
+		if e.TargetData.ByteOrder() == llvm.BigEndian {
+			b = buf[len(buf)-1-i]
+		}
+		shifted := llvm.ConstShl(llvm.ConstInt(t, uint64(b), false), llvm.ConstInt(t, uint64(i)*8, false))
+		result = llvm.ConstOr(result, shifted)
+	}
+	return result
+}
+
+// getUint reads an integer from buf, in the byte order of the target.
+func (e *Eval) getUint(buf []byte) uint64 {
+	var n uint64
+	for i := range buf {
+		if e.TargetData.ByteOrder() == llvm.BigEndian {
+			n |= uint64(buf[i]) << (8 * uint(len(buf)-1-i))
+		} else {
+			n |= uint64(buf[i]) << (8 * uint(i))
+		}
+	}
+	return n
+}
+
+// copyMemory copies n bytes from src to dst, like memcpy. The bytes are copied
+// as a single value, so that pointers can be copied as long as they are
+// copied as a whole. When that is not possible, for example because only part
+// of an array of function pointers is copied, the values in the source range
+// are copied one by one.
+func (e *Eval) copyMemory(dst, src llvm.Value, n uint64) error {
+	if n == 0 {
+		return nil
+	}
+	value, err := e.load(src, e.memoryType(src, n))
+	if err == nil {
+		return e.store(dst, value)
+	}
+	srcPtr, ok1 := e.getPointer(src)
+	dstPtr, ok2 := e.getPointer(dst)
+	if !ok1 || !ok2 || uint64(srcPtr.offset)+n > e.TargetData.TypeAllocSize(srcPtr.global.Type().ElementType()) {
+		return err
+	}
+	if dstPtr.global == srcPtr.global && dstPtr.offset < srcPtr.offset+int64(n) && srcPtr.offset < dstPtr.offset+int64(n) {
+		// Overlapping ranges (memmove) can't be copied value by value.
+		return err
+	}
+	return e.copyValues(dstPtr, srcPtr, srcPtr.global.Type().ElementType(), 0, n)
+}
+
+// copyValues copies all values within the n bytes at src, where t is a value
+// of the source global at the given offset. Values that are completely in the
+// range are copied as a whole, other aggregates are copied element by element.
+func (e *Eval) copyValues(dst, src pointer, t llvm.Type, offset, n uint64) error {
+	size := e.TargetData.TypeAllocSize(t)
+	start := uint64(src.offset)
+	if offset+size <= start || offset >= start+n {
+		// Not in the range to copy.
+		return nil
+	}
+	if offset >= start && offset+size <= start+n {
+		ptrType := llvm.PointerType(t, 0)
+		value, err := e.load(e.pointerValue(pointer{src.global, int64(offset)}, ptrType), t)
+		if err != nil {
+			return err
+		}
+		return e.store(e.pointerValue(pointer{dst.global, dst.offset + int64(offset-start)}, ptrType), value)
+	}
+	switch t.TypeKind() {
+	case llvm.StructTypeKind:
+		for i, elementType := range t.StructElementTypes() {
+			err := e.copyValues(dst, src, elementType, offset+e.TargetData.ElementOffset(t, i), n)
+			if err != nil {
+				return err
+			}
+		}
+	case llvm.ArrayTypeKind:
+		elementType := t.ElementType()
+		elementSize := e.TargetData.TypeAllocSize(elementType)
+		first := uint64(0)
+		if start > offset && elementSize != 0 {
+			first = (start - offset) / elementSize // skip elements before the range
+		}
+		for i := first; i < uint64(t.ArrayLength()) && offset+i*elementSize < start+n; i++ {
+			err := e.copyValues(dst, src, elementType, offset+i*elementSize, n)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		// Only part of this value is copied.
+		return newDiagnostic(Unsupported, src.global, "cannot copy part of a value of type "+t.String())
+	}
+	return nil
+}
+
+// setMemory sets n bytes starting at dst to the given byte value, like
+// memset.
+func (e *Eval) setMemory(dst llvm.Value, c byte, n uint64) error {
+	if n == 0 {
+		return nil
+	}
+	t := e.memoryType(dst, n)
+	buf := make([]byte, e.TargetData.TypeAllocSize(t))
+	for i := range buf {
+		buf[i] = c
+	}
+	value, ok := e.constFromBytes(buf, t)
+	if !ok {
+		return newDiagnostic(Unsupported, dst, "cannot set memory of type "+t.String())
+	}
+	return e.store(dst, value)
+}
+
+// memoryType returns the type of the value of n bytes at the given pointer:
+// the type of the value that is stored there if there is one of exactly this
+// size, or a byte array otherwise.
+func (e *Eval) memoryType(ptr llvm.Value, n uint64) llvm.Type {
+	p, ok := e.getPointer(ptr)
+	if ok && uint64(p.offset)+n <= e.TargetData.TypeAllocSize(p.global.Type().ElementType()) {
+		_, elementType, offset := e.locate(p.global.Type().ElementType(), uint64(p.offset), n, llvm.Type{})
+		if offset == 0 && e.TargetData.TypeAllocSize(elementType) == n {
+			return elementType
+		}
+	}
+	return llvm.ArrayType(e.Mod.Context().Int8Type(), int(n))
+}
@@ -0,0 +1,89 @@
+package interp
+
+// This file records how much work each package initializer took to interpret,
+// to find out which packages are responsible for slow builds.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// InitProfile describes the cost of interpreting a single package initializer.
+type InitProfile struct {
+	PkgName        string
+	Duration       time.Duration // wall time spent interpreting the initializer
+	Instructions   int           // number of instructions executed
+	GlobalsWritten int           // number of existing globals that were modified
+	Reverted       bool          // whether the initializer is run at runtime instead
+}
+
+// startInit records the start of the interpretation of a package initializer.
+// The returned function must be called once interpretation has finished, before
+// the transaction is committed or rolled back.
+func (e *Eval) startInit(pkgName string) func(reverted bool) {
+	start := time.Now()
+	return func(reverted bool) {
+		e.profile = append(e.profile, InitProfile{
+			PkgName:        pkgName,
+			Duration:       time.Since(start),
+			Instructions:   e.instructions,
+			GlobalsWritten: len(e.tx.initializers),
+			Reverted:       reverted,
+		})
+	}
+}
+
+// Profile returns the cost of each package initializer interpreted by Run and
+// RunReverted, in the order in which they were interpreted. Initializers that
+// were never interpreted (such as those marked with //go:runtimeinit) are not
+// included.
+func (e *Eval) Profile() []InitProfile {
+	return e.profile
+}
+
+// WriteProfile writes a table with the cost of each interpreted package
+// initializer to w, the most expensive initializer first.
+func (e *Eval) WriteProfile(w io.Writer) error {
+	profile := make([]InitProfile, len(e.profile))
+	copy(profile, e.profile)
+	sort.SliceStable(profile, func(i, j int) bool {
+		return profile[i].Duration > profile[j].Duration
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "time\tinstructions\tglobals written\t\tpackage\t")
+	for _, p := range profile {
+		status := ""
+		if p.Reverted {
+			status = "reverted"
+		}
+		fmt.Fprintf(tw, "%.3fms\t%d\t%d\t%s\t%s\t\n", float64(p.Duration)/float64(time.Millisecond), p.Instructions, p.GlobalsWritten, status, p.PkgName)
+	}
+	return tw.Flush()
+}
+
+// startCPUProfile starts a CPU profile that is written to the file at
+// e.CPUProfile, if set. The returned function stops the profile and closes the
+// file.
+func (e *Eval) startCPUProfile() (func(), error) {
+	if e.CPUProfile == "" {
+		return func() {}, nil
+	}
+	f, err := os.Create(e.CPUProfile)
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		f.Close()
+	}, nil
+}
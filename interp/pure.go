@@ -0,0 +1,95 @@
+package interp
+
+// This file implements compile-time evaluation of some pure functions that
+// cannot be interpreted directly, for example because they are LLVM intrinsics
+// or are only declared in the module.
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// pureFunction evaluates a call to a pure function with the given parameters
+// and returns the result. It returns false if the parameters are not supported,
+// in which case the function is called at runtime instead. All parameters are
+// constants.
+type pureFunction func(params []llvm.Value, returnType llvm.Type) (llvm.Value, bool)
+
+// pureFunctions lists the functions that can be evaluated at compile time by
+// name. Overloaded LLVM intrinsics are listed without their type suffix, so
+// that for example llvm.ctlz matches both llvm.ctlz.i32 and llvm.ctlz.i64.
+var pureFunctions = map[string]pureFunction{
+	"llvm.ctlz": intUnaryFunction(func(x uint64, width int) uint64 {
+		return uint64(bits.LeadingZeros64(x) - (64 - width))
+	}),
+	"llvm.cttz": intUnaryFunction(func(x uint64, width int) uint64 {
+		if x == 0 {
+			return uint64(width)
+		}
+		return uint64(bits.TrailingZeros64(x))
+	}),
+	"llvm.ctpop": intUnaryFunction(func(x uint64, width int) uint64 {
+		return uint64(bits.OnesCount64(x))
+	}),
+	"llvm.bswap": intUnaryFunction(func(x uint64, width int) uint64 {
+		return bits.ReverseBytes64(x) >> uint(64-width)
+	}),
+	"llvm.sqrt":  floatUnaryFunction(math.Sqrt),
+	"llvm.fabs":  floatUnaryFunction(math.Abs),
+	"llvm.floor": floatUnaryFunction(math.Floor),
+	"llvm.ceil":  floatUnaryFunction(math.Ceil),
+	"llvm.trunc": floatUnaryFunction(math.Trunc),
+	"math.sqrt":  floatUnaryFunction(math.Sqrt),
+}
+
+// getPureFunction returns the evaluation function for the given callee, or nil
+// if it is not known to be pure.
+func getPureFunction(callee llvm.Value) pureFunction {
+	name := callee.Name()
+	if fn, ok := pureFunctions[name]; ok {
+		return fn
+	}
+	if strings.HasPrefix(name, "llvm.") {
+		// Strip the type suffix of an overloaded intrinsic.
+		if index := strings.LastIndexByte(name, '.'); index > 0 {
+			return pureFunctions[name[:index]]
+		}
+	}
+	return nil
+}
+
+// intUnaryFunction creates a pureFunction from a function on a single integer
+// of up to 64 bits. Any other parameters (like the is_zero_undef flag of
+// llvm.ctlz) are ignored.
+func intUnaryFunction(fn func(x uint64, width int) uint64) pureFunction {
+	return func(params []llvm.Value, returnType llvm.Type) (llvm.Value, bool) {
+		if len(params) == 0 || params[0].IsAConstantInt().IsNil() {
+			return llvm.Value{}, false
+		}
+		width := params[0].Type().IntTypeWidth()
+		if width > 64 || returnType != params[0].Type() {
+			return llvm.Value{}, false
+		}
+		result := fn(params[0].ZExtValue(), width)
+		return llvm.ConstInt(returnType, result, false), true
+	}
+}
+
+// floatUnaryFunction creates a pureFunction from a function on a single
+// floating point value.
+func floatUnaryFunction(fn func(x float64) float64) pureFunction {
+	return func(params []llvm.Value, returnType llvm.Type) (llvm.Value, bool) {
+		if len(params) != 1 || params[0].IsAConstantFP().IsNil() {
+			return llvm.Value{}, false
+		}
+		switch returnType.TypeKind() {
+		case llvm.FloatTypeKind, llvm.DoubleTypeKind:
+		default:
+			return llvm.Value{}, false
+		}
+		return llvm.ConstFloat(returnType, fn(constFloatValue(params[0]))), true
+	}
+}
@@ -20,24 +20,50 @@ type sideEffectResult struct {
 	mentionsGlobals map[llvm.Value]struct{}
 }
 
+// nondeterministicFunctions lists functions that may return a different value
+// each time the program is run, like the current time or environment variables.
+// Calling them at compile time would bake a build-time value into the binary.
+var nondeterministicFunctions = map[string]struct{}{
+	"runtime.nanotime":     {},
+	"runtime.ticks":        {},
+	"time.now":             {},
+	"time.Now":             {},
+	"time.runtimeNano":     {},
+	"math/rand.Seed":       {},
+	"crypto/rand.Read":     {},
+	"os.Getenv":            {},
+	"os.LookupEnv":         {},
+	"os.Environ":           {},
+	"syscall.Getenv":       {},
+	"syscall.runtime_envs": {},
+}
+
+// isNondeterministic returns whether the given function is known to return
+// values that may differ between runs, see nondeterministicFunctions.
+func isNondeterministic(fn llvm.Value) bool {
+	_, ok := nondeterministicFunctions[fn.Name()]
+	return ok
+}
+
 // hasSideEffects scans this function and all descendants, recursively. It
 // returns whether this function has side effects and if it does, which globals
 // it mentions anywhere in this function or any called functions.
 func (e *Eval) hasSideEffects(fn llvm.Value) *sideEffectResult {
+	if isNondeterministic(fn) {
+		// Must be called at runtime, but doesn't modify any globals.
+		return &sideEffectResult{severity: sideEffectLimited}
+	}
 	switch fn.Name() {
-	case "runtime.alloc":
+	case "runtime.alloc", "runtime.sliceAppend":
 		// Cannot be scanned but can be interpreted.
 		return &sideEffectResult{severity: sideEffectNone}
-	case "runtime.nanotime":
-		// Fixed value at compile time.
-		return &sideEffectResult{severity: sideEffectNone}
 	case "runtime._panic":
 		return &sideEffectResult{severity: sideEffectLimited}
-	case "runtime.interfaceImplements":
+	case "runtime.typeAssert", "runtime.interfaceImplements", "runtime.isnil":
 		return &sideEffectResult{severity: sideEffectNone}
 	case "runtime.trackPointer":
 		return &sideEffectResult{severity: sideEffectNone}
-	case "llvm.dbg.value":
+	case "llvm.dbg.value", "llvm.lifetime.start.p0i8", "llvm.lifetime.end.p0i8":
 		return &sideEffectResult{severity: sideEffectNone}
 	}
 	if e.sideEffectFuncs == nil {
@@ -62,10 +88,7 @@ func (e *Eval) hasSideEffects(fn llvm.Value) *sideEffectResult {
 			// any mentioned globals may be read from or written to when
 			// executed, thus must be marked dirty with a call.
 			for i := 0; i < inst.OperandsCount(); i++ {
-				operand := inst.Operand(i)
-				if !operand.IsAGlobalVariable().IsNil() {
-					result.mentionsGlobals[operand] = struct{}{}
-				}
+				addGlobals(result.mentionsGlobals, inst.Operand(i))
 			}
 
 			switch inst.InstructionOpcode() {
@@ -89,6 +112,10 @@ func (e *Eval) hasSideEffects(fn llvm.Value) *sideEffectResult {
 					result.updateSeverity(sideEffectAll)
 					continue
 				}
+				if getPureFunction(child) != nil {
+					// Known pure function, without side effects.
+					continue
+				}
 				if child.IsDeclaration() {
 					// External function call. Assume only limited side effects
 					// (no affected globals, etc.).
@@ -98,6 +125,13 @@ func (e *Eval) hasSideEffects(fn llvm.Value) *sideEffectResult {
 					continue
 				}
 				childSideEffects := e.hasSideEffects(child)
+				// Globals mentioned in the called function may be accessed
+				// through this function as well. Note that this list is
+				// incomplete for recursive functions that are still being
+				// scanned.
+				for global := range childSideEffects.mentionsGlobals {
+					result.mentionsGlobals[global] = struct{}{}
+				}
 				switch childSideEffects.severity {
 				case sideEffectInProgress, sideEffectNone:
 					// no side effects or recursive function - continue scanning
@@ -125,8 +159,11 @@ func (e *Eval) hasSideEffects(fn llvm.Value) *sideEffectResult {
 					result.updateSeverity(sideEffectLimited)
 				}
 			case llvm.IntToPtr:
-				// Pointer casts are not yet supported.
-				result.updateSeverity(sideEffectLimited)
+				if !inst.Operand(0).IsAConstantInt().IsNil() {
+					// A fixed address, such as a memory-mapped I/O register.
+					// Accesses through it can't be interpreted.
+					result.updateSeverity(sideEffectLimited)
+				}
 			default:
 				// Ignore most instructions.
 				// Check this list for completeness:
@@ -139,6 +176,12 @@ func (e *Eval) hasSideEffects(fn llvm.Value) *sideEffectResult {
 		// No side effect was reported for this function.
 		result.severity = sideEffectNone
 	}
+	if isWeak(fn) && !isODR(fn) {
+		// The function may be replaced with a different one at link time, so
+		// it must be called at runtime. Assume it may access the same globals
+		// as this definition.
+		result.updateSeverity(sideEffectLimited)
+	}
 	return result
 }
 
@@ -209,3 +252,16 @@ func (r *sideEffectResult) update(child *sideEffectResult) {
 		r.mentionsGlobals[global] = struct{}{}
 	}
 }
+
+// addGlobals adds all global variables referenced by the given value, either
+// directly or through a constant expression (such as a constant
+// getelementptr), to the set of globals.
+func addGlobals(globals map[llvm.Value]struct{}, v llvm.Value) {
+	if !v.IsAGlobalVariable().IsNil() {
+		globals[v] = struct{}{}
+	} else if !v.IsAConstantExpr().IsNil() {
+		for i := 0; i < v.OperandsCount(); i++ {
+			addGlobals(globals, v.Operand(i))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.value = global i32 0
+@main.ok = global i1 false
+@main.nested = global i32 0
+@main.runtimeValue = global i32 0
+@main.runtimePair = global { { i32, i32 }, i1 } zeroinitializer
+
+declare i32 @externalValue()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Returns a (value, ok) pair, like a Go function with multiple return values.
+define internal { i32, i1 } @main.lookup(i32 %key) unnamed_addr {
+entry:
+  %value = mul i32 %key, 3
+  %pair.0 = insertvalue { i32, i1 } undef, i32 %value, 0
+  %pair.1 = insertvalue { i32, i1 } %pair.0, i1 true, 1
+  ret { i32, i1 } %pair.1
+}
+
+; Returns a nested aggregate.
+define internal { { i32, i32 }, i1 } @main.makeNested(i32 %x) unnamed_addr {
+entry:
+  %inner = insertvalue { { i32, i32 }, i1 } zeroinitializer, i32 %x, 0, 1
+  ret { { i32, i32 }, i1 } %inner
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %pair = call { i32, i1 } @main.lookup(i32 5)
+  %value = extractvalue { i32, i1 } %pair, 0
+  %ok = extractvalue { i32, i1 } %pair, 1
+  store i32 %value, i32* @main.value
+  store i1 %ok, i1* @main.ok
+  %nested = call { { i32, i32 }, i1 } @main.makeNested(i32 7)
+  %nested.value = extractvalue { { i32, i32 }, i1 } %nested, 0, 1
+  store i32 %nested.value, i32* @main.nested
+
+  ; Aggregates with values that are only known at runtime.
+  %runtime = call i32 @externalValue()
+  %runtime.agg = insertvalue { { i32, i32 }, i1 } zeroinitializer, i32 %runtime, 0, 1
+  %runtime.value = extractvalue { { i32, i32 }, i1 } %runtime.agg, 0, 1
+  store i32 %runtime.value, i32* @main.runtimeValue
+  store { { i32, i32 }, i1 } %runtime.agg, { { i32, i32 }, i1 }* @main.runtimePair
+  ret void
+}
@@ -0,0 +1,42 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.value = constant i32 15
+@main.ok = constant i1 true
+@main.nested = constant i32 7
+@main.runtimeValue = global i32 0
+@main.runtimePair = global { { i32, i32 }, i1 } zeroinitializer
+
+declare i32 @externalValue()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal { i32, i1 } @main.lookup(i32 %key) unnamed_addr {
+entry:
+  %value = mul i32 %key, 3
+  %pair.0 = insertvalue { i32, i1 } undef, i32 %value, 0
+  %pair.1 = insertvalue { i32, i1 } %pair.0, i1 true, 1
+  ret { i32, i1 } %pair.1
+}
+
+define internal { { i32, i32 }, i1 } @main.makeNested(i32 %x) unnamed_addr {
+entry:
+  %inner = insertvalue { { i32, i32 }, i1 } zeroinitializer, i32 %x, 0, 1
+  ret { { i32, i32 }, i1 } %inner
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %runtime = call i32 @externalValue()
+  %0 = insertvalue { i32, i32 } zeroinitializer, i32 %runtime, 1
+  %1 = insertvalue { { i32, i32 }, i1 } zeroinitializer, { i32, i32 } %0, 0
+  %2 = extractvalue { { i32, i32 }, i1 } %1, 0
+  %3 = extractvalue { i32, i32 } %2, 1
+  store i32 %3, i32* @main.runtimeValue
+  store { { i32, i32 }, i1 } %1, { { i32, i32 }, i1 }* @main.runtimePair
+  ret void
+}
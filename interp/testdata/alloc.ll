@@ -0,0 +1,53 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Point = type { i32, i32 }
+%runtime._slice = type { i8*, i64, i64 }
+
+@main.point = global %main.Point* null
+@main.value = global i32 0
+@main.slice = global %runtime._slice zeroinitializer
+@main.odd = global i32* null
+
+declare i8* @runtime.alloc(i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; point = &Point{3, 4}
+  %point.raw = call i8* @runtime.alloc(i64 8)
+  %point = bitcast i8* %point.raw to %main.Point*
+  %point.x = getelementptr %main.Point, %main.Point* %point, i32 0, i32 0
+  store i32 3, i32* %point.x
+  %point.y = getelementptr %main.Point, %main.Point* %point, i32 0, i32 1
+  store i32 4, i32* %point.y
+  store %main.Point* %point, %main.Point** @main.point
+
+  ; A heap allocation that is only used temporarily must not be kept.
+  %tmp.raw = call i8* @runtime.alloc(i64 4)
+  %tmp = bitcast i8* %tmp.raw to i32*
+  store i32 5, i32* %tmp
+  %value = load i32, i32* %tmp
+  store i32 %value, i32* @main.value
+
+  ; slice = make([]byte, 3); slice[1] = 6
+  %slice.buf = call i8* @runtime.alloc(i64 3)
+  %slice.1 = getelementptr i8, i8* %slice.buf, i64 1
+  store i8 6, i8* %slice.1
+  %slice.0 = insertvalue %runtime._slice undef, i8* %slice.buf, 0
+  %slice.len = insertvalue %runtime._slice %slice.0, i64 3, 1
+  %slice.cap = insertvalue %runtime._slice %slice.len, i64 3, 2
+  store %runtime._slice %slice.cap, %runtime._slice* @main.slice
+
+  ; An allocation with a size that is not a multiple of the type size.
+  %odd.raw = call i8* @runtime.alloc(i64 6)
+  %odd = bitcast i8* %odd.raw to i32*
+  store i32 7, i32* %odd
+  store i32* %odd, i32** @main.odd
+  ret void
+}
@@ -0,0 +1,20 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Point = type { i32, i32 }
+%runtime._slice = type { i8*, i64, i64 }
+
+@main.point = constant %main.Point* @"main$alloc"
+@main.value = constant i32 5
+@main.slice = constant %runtime._slice { i8* getelementptr inbounds ([3 x i8], [3 x i8]* @"main$alloc.2", i32 0, i32 0), i64 3, i64 3 }
+@main.odd = constant i32* bitcast ([6 x i8]* @"main$alloc.3" to i32*)
+@"main$alloc" = internal global %main.Point { i32 3, i32 4 }
+@"main$alloc.2" = internal global [3 x i8] c"\00\06\00"
+@"main$alloc.3" = internal global [6 x i8] c"\07\00\00\00\00\00"
+
+declare i8* @runtime.alloc(i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
@@ -0,0 +1,97 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = global i64 0
+@main.b = global i64 0
+@main.limit = global i64 10
+@main.clamped = global i64 0
+@other.before = global i64 0
+@other.result = global i64 0
+
+declare i64 @other.read()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; func abs(x int) int {
+;     var result int
+;     if x < 0 {
+;         result = -x
+;     } else {
+;         result = x
+;     }
+;     return result
+; }
+define internal i64 @main.abs(i64 %x) unnamed_addr {
+entry:
+  %result = alloca i64
+  %neg = icmp slt i64 %x, 0
+  br i1 %neg, label %if.then, label %if.else
+
+if.then:
+  %negated = sub i64 0, %x
+  store i64 %negated, i64* %result
+  br label %if.done
+
+if.else:
+  store i64 %x, i64* %result
+  br label %if.done
+
+if.done:
+  %value = load i64, i64* %result
+  ret i64 %value
+}
+
+; Calls abs with arguments that take either side of the if/else, and does the
+; same directly in the init function using a value loaded from a global.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %local = alloca i64
+  %a = call i64 @main.abs(i64 -5)
+  store i64 %a, i64* @main.a
+  %b = call i64 @main.abs(i64 3)
+  store i64 %b, i64* @main.b
+  %limit = load i64, i64* @main.limit
+  %tooLarge = icmp sgt i64 %a, %limit
+  br i1 %tooLarge, label %if.then, label %if.else
+
+if.then:
+  store i64 %limit, i64* %local
+  br label %if.done
+
+if.else:
+  store i64 %a, i64* %local
+  br label %if.done
+
+if.done:
+  %clamped = load i64, i64* %local
+  store i64 %clamped, i64* @main.clamped
+  ret void
+}
+
+; The same pattern, but the branch depends on a value that is only known at
+; runtime. The init function must be reverted, including the store to
+; @other.before and the globals created for the allocas.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %local = alloca i64
+  store i64 1, i64* @other.before
+  %abs = call i64 @main.abs(i64 -2)
+  store i64 %abs, i64* %local
+  %input = call i64 @other.read()
+  %negative = icmp slt i64 %input, 0
+  br i1 %negative, label %if.then, label %if.done
+
+if.then:
+  store i64 %input, i64* %local
+  br label %if.done
+
+if.done:
+  %result = load i64, i64* %local
+  store i64 %result, i64* @other.result
+  ret void
+}
@@ -0,0 +1,48 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Config = type { i32, i8*, [2 x i16] }
+
+@main.name = internal unnamed_addr constant [3 x i8] c"abc"
+@main.cfg1 = global %main.Config zeroinitializer
+@main.cfg2 = global %main.Config zeroinitializer
+
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8* nocapture writeonly, i8* nocapture readonly, i64, i1)
+declare void @externalUse(i32*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; Build a struct in a temporary and copy it into a global with a load and
+  ; store.
+  %tmp1 = alloca %main.Config
+  %tmp1.0 = getelementptr %main.Config, %main.Config* %tmp1, i32 0, i32 0
+  store i32 5, i32* %tmp1.0
+  %tmp1.1 = getelementptr %main.Config, %main.Config* %tmp1, i32 0, i32 1
+  store i8* getelementptr inbounds ([3 x i8], [3 x i8]* @main.name, i32 0, i32 0), i8** %tmp1.1
+  %tmp1.2 = getelementptr %main.Config, %main.Config* %tmp1, i32 0, i32 2, i32 1
+  store i16 7, i16* %tmp1.2
+  %value = load %main.Config, %main.Config* %tmp1
+  store %main.Config %value, %main.Config* @main.cfg1
+
+  ; The same, but copying it with memcpy.
+  %tmp2 = alloca %main.Config
+  %tmp2.raw = bitcast %main.Config* %tmp2 to i8*
+  %tmp2.0 = getelementptr %main.Config, %main.Config* %tmp2, i32 0, i32 0
+  store i32 6, i32* %tmp2.0
+  %tmp2.1 = getelementptr %main.Config, %main.Config* %tmp2, i32 0, i32 1
+  store i8* getelementptr inbounds ([3 x i8], [3 x i8]* @main.name, i32 0, i32 1), i8** %tmp2.1
+  call void @llvm.memcpy.p0i8.p0i8.i64(i8* bitcast (%main.Config* @main.cfg2 to i8*), i8* %tmp2.raw, i64 24, i1 false)
+
+  ; An alloca whose address escapes to a function called at runtime must be
+  ; kept.
+  %tmp3 = alloca i32
+  store i32 8, i32* %tmp3
+  call void @externalUse(i32* %tmp3)
+  ret void
+}
@@ -0,0 +1,28 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Config = type { i32, i8*, [2 x i16] }
+
+@main.name = internal unnamed_addr constant [3 x i8] c"abc"
+@main.cfg1 = constant %main.Config { i32 5, i8* getelementptr inbounds ([3 x i8], [3 x i8]* @main.name, i32 0, i32 0), [2 x i16] [i16 0, i16 7] }
+@main.cfg2 = constant %main.Config { i32 6, i8* getelementptr inbounds ([3 x i8], [3 x i8]* @main.name, i32 0, i32 1), [2 x i16] zeroinitializer }
+@"main$alloca.2" = internal global i32 8
+
+; Function Attrs: argmemonly nofree nounwind willreturn
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8* noalias nocapture writeonly, i8* noalias nocapture readonly, i64, i1 immarg) #0
+
+declare void @externalUse(i32*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void @externalUse(i32* @"main$alloca.2")
+  ret void
+}
+
+attributes #0 = { argmemonly nofree nounwind willreturn }
@@ -0,0 +1,31 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.flag = global i32 0
+@main.counter = global i64 5
+@main.state = global i32 1
+@main.swapped = global i1 false
+@main.old = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; atomic.StoreUint32(&flag, 1)
+  store atomic i32 1, i32* @main.flag seq_cst, align 4
+
+  ; old = atomic.AddInt64(&counter, 3) - 3
+  %add = atomicrmw add i64* @main.counter, i64 3 seq_cst
+  store i64 %add, i64* @main.old
+  fence seq_cst
+
+  ; swapped = atomic.CompareAndSwapUint32(&state, 1, 2)
+  %cas = cmpxchg i32* @main.state, i32 1, i32 2 seq_cst seq_cst
+  %cas.success = extractvalue { i32, i1 } %cas, 1
+  store i1 %cas.success, i1* @main.swapped
+  ret void
+}
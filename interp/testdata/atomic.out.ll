@@ -0,0 +1,13 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.flag = constant i32 1
+@main.counter = constant i64 8
+@main.state = constant i32 2
+@main.swapped = constant i1 true
+@main.old = constant i64 5
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
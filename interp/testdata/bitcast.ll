@@ -0,0 +1,43 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.bytes = global [4 x i8] c"\01\02\03\04"
+@main.word = global i32 0
+@main.buf = global [8 x i8] zeroinitializer
+@main.byte = global i8 0
+@main.ptr = global i8* null
+@main.struct = global { i8*, [4 x i8] } zeroinitializer
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; Read a byte array as a word.
+  %bytes = bitcast [4 x i8]* @main.bytes to i32*
+  %word = load i32, i32* %bytes
+  store i32 %word, i32* @main.word
+
+  ; Write words into a byte array, and read back a single byte.
+  %buf = bitcast [8 x i8]* @main.buf to i32*
+  store i32 287454020, i32* %buf
+  %buf.hi = getelementptr i32, i32* %buf, i32 1
+  %buf.hi16 = bitcast i32* %buf.hi to i16*
+  store i16 -1, i16* %buf.hi16
+  %buf.1 = getelementptr [8 x i8], [8 x i8]* @main.buf, i32 0, i32 1
+  %byte = load i8, i8* %buf.1
+  store i8 %byte, i8* @main.byte
+
+  ; Store a pointer through a pointer of a different type.
+  %ptr = bitcast i8** @main.ptr to i32**
+  store i32* @main.word, i32** %ptr
+
+  ; Store a word into a byte array next to a pointer.
+  %struct.bytes = getelementptr { i8*, [4 x i8] }, { i8*, [4 x i8] }* @main.struct, i32 0, i32 1
+  %struct.word = bitcast [4 x i8]* %struct.bytes to i32*
+  store i32 5, i32* %struct.word
+  ret void
+}
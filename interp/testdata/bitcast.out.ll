@@ -0,0 +1,14 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.bytes = global [4 x i8] c"\01\02\03\04"
+@main.word = global i32 67305985
+@main.buf = constant [8 x i8] c"D3\22\11\FF\FF\00\00"
+@main.byte = constant i8 51
+@main.ptr = constant i8* bitcast (i32* @main.word to i8*)
+@main.struct = constant { i8*, [4 x i8] } { i8* null, [4 x i8] c"\05\00\00\00" }
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
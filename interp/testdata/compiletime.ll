@@ -0,0 +1,38 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.counter = global i64 0
+@main.seed = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
+
+; A pure function marked with //go:compiletime.
+define internal i64 @main.hash(i64 %x) unnamed_addr #0 {
+entry:
+  %mul = mul i64 %x, 1099511628211
+  %xor = xor i64 %mul, 14695981039346656037
+  ret i64 %xor
+}
+
+; Marked with //go:compiletime, but reads a global that may change at runtime.
+define internal i64 @main.next() unnamed_addr #0 {
+entry:
+  %counter = load i64, i64* @main.counter
+  ret i64 %counter
+}
+
+define void @main.main(i64 %n) unnamed_addr {
+entry:
+  %seed = call i64 @main.hash(i64 5)
+  store i64 %seed, i64* @main.seed
+  %dynamic = call i64 @main.hash(i64 %n)
+  store i64 %dynamic, i64* @main.seed
+  %next = call i64 @main.next()
+  store i64 %next, i64* @main.seed
+  ret void
+}
+
+attributes #0 = { "tinygo-compiletime" }
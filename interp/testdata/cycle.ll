@@ -0,0 +1,52 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Node = type { %main.Node*, i64 }
+
+@main.ring = global %main.Node* null
+@main.value = global i64 0
+
+declare i8* @runtime.alloc(i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; a := &Node{value: 1}
+  %a.raw = call i8* @runtime.alloc(i64 16)
+  %a = bitcast i8* %a.raw to %main.Node*
+  %a.next = getelementptr inbounds %main.Node, %main.Node* %a, i32 0, i32 0
+  %a.value = getelementptr inbounds %main.Node, %main.Node* %a, i32 0, i32 1
+  store i64 1, i64* %a.value
+
+  ; b := &Node{next: a, value: 2}
+  %b.raw = call i8* @runtime.alloc(i64 16)
+  %b = bitcast i8* %b.raw to %main.Node*
+  %b.next = getelementptr inbounds %main.Node, %main.Node* %b, i32 0, i32 0
+  store %main.Node* %a, %main.Node** %b.next
+  %b.value = getelementptr inbounds %main.Node, %main.Node* %b, i32 0, i32 1
+  store i64 2, i64* %b.value
+
+  ; a.next = b; ring = a
+  store %main.Node* %b, %main.Node** %a.next
+  store %main.Node* %a, %main.Node** @main.ring
+
+  ; A node that points to itself and is only used temporarily must not be
+  ; kept, even though it is still referenced by itself.
+  ; c := &Node{value: 3}; c.next = c; value = c.next.value
+  %c.raw = call i8* @runtime.alloc(i64 16)
+  %c = bitcast i8* %c.raw to %main.Node*
+  %c.next = getelementptr inbounds %main.Node, %main.Node* %c, i32 0, i32 0
+  store %main.Node* %c, %main.Node** %c.next
+  %c.value = getelementptr inbounds %main.Node, %main.Node* %c, i32 0, i32 1
+  store i64 3, i64* %c.value
+  %next = load %main.Node*, %main.Node** %c.next
+  %next.value = getelementptr inbounds %main.Node, %main.Node* %next, i32 0, i32 1
+  %value = load i64, i64* %next.value
+  store i64 %value, i64* @main.value
+  ret void
+}
@@ -0,0 +1,16 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Node = type { %main.Node*, i64 }
+
+@main.ring = constant %main.Node* @"main$alloc"
+@main.value = constant i64 3
+@"main$alloc" = internal global %main.Node { %main.Node* @"main$alloc.1", i64 1 }
+@"main$alloc.1" = internal global %main.Node { %main.Node* @"main$alloc", i64 2 }
+
+declare i8* @runtime.alloc(i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
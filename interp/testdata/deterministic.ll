@@ -0,0 +1,52 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+
+@main.hello = global %runtime._string zeroinitializer
+@main.ptrs = global [3 x i32*] zeroinitializer
+@other.ptr = global i32* null
+@main.str.hello = internal constant [5 x i8] c"hello"
+@main.str.world = internal constant [6 x i8] c" world"
+
+declare i8* @runtime.alloc(i64)
+
+declare %runtime._string @runtime.stringConcat(i8*, i64, i8*, i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Creates a number of new globals, for the heap allocations and the string.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %hello = call %runtime._string @runtime.stringConcat(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @main.str.hello, i32 0, i32 0), i64 5, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @main.str.world, i32 0, i32 0), i64 6)
+  store %runtime._string %hello, %runtime._string* @main.hello
+  %a.raw = call i8* @runtime.alloc(i64 4)
+  %a = bitcast i8* %a.raw to i32*
+  store i32 1, i32* %a
+  store i32* %a, i32** getelementptr inbounds ([3 x i32*], [3 x i32*]* @main.ptrs, i32 0, i32 0)
+  %b.raw = call i8* @runtime.alloc(i64 4)
+  %b = bitcast i8* %b.raw to i32*
+  store i32 2, i32* %b
+  store i32* %b, i32** getelementptr inbounds ([3 x i32*], [3 x i32*]* @main.ptrs, i32 0, i32 1)
+  %c.raw = call i8* @runtime.alloc(i64 4)
+  %c = bitcast i8* %c.raw to i32*
+  store i32 3, i32* %c
+  store i32* %c, i32** getelementptr inbounds ([3 x i32*], [3 x i32*]* @main.ptrs, i32 0, i32 2)
+  ret void
+}
+
+; Creates a global, but is reverted afterwards.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %raw = call i8* @runtime.alloc(i64 4)
+  %ptr = bitcast i8* %raw to i32*
+  store i32 4, i32* %ptr
+  store i32* %ptr, i32** @other.ptr
+  call void asm sideeffect "", ""()
+  ret void
+}
@@ -0,0 +1,32 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.table = global [4 x i32] zeroinitializer
+@main.second = global i32 0
+
+declare i8* @main.external()
+
+declare void @main.use(i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.setRegister(i32* %ptr) unnamed_addr {
+entry:
+  store volatile i32 1, i32* %ptr
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void @main.setRegister(i32* getelementptr inbounds ([4 x i32], [4 x i32]* @main.table, i32 0, i32 1))
+  %second = load i32, i32* getelementptr inbounds ([4 x i32], [4 x i32]* @main.table, i32 0, i32 1)
+  store i32 %second, i32* @main.second
+  %ext = call i8* @main.external()
+  %0 = getelementptr i8, i8* %ext, i32 1
+  call void @main.use(i8* %0)
+  ret void
+}
@@ -0,0 +1,50 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = global { i32, i32 } { i32 1, i32 2 }
+@main.b = global { i32, i32 } { i32 3, i32 4 }
+@main.x = global i32 0
+@main.y = global i32 0
+@other.ptr = global i8* null
+
+declare void @externalPointer(i8*)
+declare void @externalInt(i64)
+declare i32* @externalGetPointer()
+declare i64 @externalGetInt()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; Pass a pointer to a byte offset within @main.a that doesn't match any
+  ; element, and an integer derived from a pointer to @main.b. Both globals
+  ; may be modified by the external functions, so they must be read at
+  ; runtime afterwards.
+  call void @externalPointer(i8* getelementptr (i8, i8* bitcast ({ i32, i32 }* @main.a to i8*), i64 2))
+  call void @externalInt(i64 ptrtoint (i32* getelementptr ({ i32, i32 }, { i32, i32 }* @main.b, i32 0, i32 1) to i64))
+  %a = load i32, i32* getelementptr ({ i32, i32 }, { i32, i32 }* @main.a, i32 0, i32 0)
+  store i32 %a, i32* @main.x
+  %b = load i32, i32* getelementptr ({ i32, i32 }, { i32, i32 }* @main.b, i32 0, i32 0)
+  store i32 %b, i32* @main.y
+
+  ; Pointer arithmetic on a pointer that is only known at runtime.
+  %ptr = call i32* @externalGetPointer()
+  %gep = getelementptr i32, i32* %ptr, i32 1
+  store i32 5, i32* %gep
+  ret void
+}
+
+; Converts an integer that is only known at runtime into a pointer. Stores
+; through this pointer can't be tracked, so this init must be reverted.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %int = call i64 @externalGetInt()
+  %ptr = inttoptr i64 %int to i8*
+  store i8* %ptr, i8** @other.ptr
+  ret void
+}
@@ -0,0 +1,45 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = global { i32, i32 } { i32 1, i32 2 }
+@main.b = global { i32, i32 } { i32 3, i32 4 }
+@main.x = global i32 0
+@main.y = global i32 0
+@other.ptr = global i8* null
+
+declare void @externalPointer(i8*)
+
+declare void @externalInt(i64)
+
+declare i32* @externalGetPointer()
+
+declare i64 @externalGetInt()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %int = call i64 @externalGetInt()
+  %ptr = inttoptr i64 %int to i8*
+  store i8* %ptr, i8** @other.ptr
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void @externalPointer(i8* getelementptr (i8, i8* bitcast ({ i32, i32 }* @main.a to i8*), i64 2))
+  call void @externalInt(i64 ptrtoint (i32* getelementptr inbounds ({ i32, i32 }, { i32, i32 }* @main.b, i32 0, i32 1) to i64))
+  %a = load i32, i32* getelementptr inbounds ({ i32, i32 }, { i32, i32 }* @main.a, i32 0, i32 0)
+  store i32 %a, i32* @main.x
+  %b = load i32, i32* getelementptr inbounds ({ i32, i32 }, { i32, i32 }* @main.b, i32 0, i32 0)
+  store i32 %b, i32* @main.y
+  %ptr = call i32* @externalGetPointer()
+  %0 = getelementptr i32, i32* %ptr, i32 1
+  store i32 5, i32* %0
+  ret void
+}
@@ -0,0 +1,22 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.x = constant i32 3
+@other.y = global i32 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define void @main.initAll() unnamed_addr {
+entry:
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 5, i32* @other.y
+  ret void
+}
@@ -0,0 +1,34 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.x = global i32 0
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr !dbg !5 {
+entry:
+  store i32 1, i32* @main.x, !dbg !8
+  call void @main.helper(), !dbg !9
+  ret void
+}
+
+define internal void @main.helper() unnamed_addr !dbg !10 {
+entry:
+  %value = load i32, i32* inttoptr (i64 4096 to i32*), !dbg !11
+  store i32 %value, i32* @main.x
+  ret void
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_Go, file: !1, producer: "TinyGo", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, enums: !2)
+!1 = !DIFile(filename: "main.go", directory: "/src")
+!2 = !{}
+!3 = !{i32 2, !"Debug Info Version", i32 3}
+!4 = !{i32 2, !"Dwarf Version", i32 4}
+!5 = distinct !DISubprogram(name: "main.init", scope: !1, file: !1, line: 3, type: !6, scopeLine: 3, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!6 = !DISubroutineType(types: !7)
+!7 = !{null}
+!8 = !DILocation(line: 5, column: 4, scope: !5)
+!9 = !DILocation(line: 6, column: 8, scope: !5)
+!10 = distinct !DISubprogram(name: "main.helper", scope: !1, file: !1, line: 9, type: !6, scopeLine: 9, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!11 = !DILocation(line: 10, column: 2, scope: !10)
@@ -0,0 +1,50 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.v = global i64 7
+@main.scaled = global i32 0
+@main.small = global float 0.000000e+00
+@main.wide = global double 0.000000e+00
+@main.unsigned = global i8 0
+@other.big = global double 1.000000e+20
+@other.n = global i32 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; scaled = int32(float64(v) * 2.5)
+  %v = load i64, i64* @main.v
+  %v.float = sitofp i64 %v to double
+  %mul = fmul double %v.float, 2.500000e+00
+  %scaled = fptosi double %mul to i32
+  store i32 %scaled, i32* @main.scaled
+  ; small = float32(float64(v) / 3), rounded to the nearest float32
+  %div = fdiv double %v.float, 3.000000e+00
+  %small = fptrunc double %div to float
+  store float %small, float* @main.small
+  ; wide = float64(small)
+  %wide = fpext float %small to double
+  store double %wide, double* @main.wide
+  ; unsigned = uint8(float64(uint64(scaled)))
+  %scaled.ext = zext i32 %scaled to i64
+  %scaled.float = uitofp i64 %scaled.ext to double
+  %unsigned = fptoui double %scaled.float to i8
+  store i8 %unsigned, i8* @main.unsigned
+  ret void
+}
+
+; The result of converting a float that doesn't fit in the integer type depends
+; on the target, so this init must be run at runtime.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %big = load double, double* @other.big
+  %n = fptosi double %big to i32
+  store i32 %n, i32* @other.n
+  ret void
+}
@@ -0,0 +1,24 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.v = global i64 7
+@main.scaled = constant i32 17
+@main.small = constant float 0x4002AAAAA0000000
+@main.wide = constant double 0x4002AAAAA0000000
+@main.unsigned = constant i8 17
+@other.big = global double 1.000000e+20
+@other.n = global i32 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %big = load double, double* @other.big
+  %n = fptosi double %big to i32
+  store i32 %n, i32* @other.n
+  ret void
+}
@@ -0,0 +1,67 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.handlers = global [3 x { i8*, i32 (i8*, i8*)* }] zeroinitializer
+@main.table = global [3 x { i8*, i32 (i8*, i8*)* }] zeroinitializer
+@main.first = global [2 x { i8*, i32 (i8*, i8*)* }] zeroinitializer
+@main.result = global i32 0
+
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8* nocapture writeonly, i8* nocapture readonly, i64, i1)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal i32 @main.h0(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret i32 10
+}
+
+define internal i32 @main.h1(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret i32 11
+}
+
+define internal i32 @main.h2(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret i32 12
+}
+
+; Builds a table of func values, rearranges it, copies it to other globals and
+; calls a function from it.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; handlers = [3]func() int32{h0, h1, h2}
+  %f0.0 = insertvalue { i8*, i32 (i8*, i8*)* } undef, i8* undef, 0
+  %f0 = insertvalue { i8*, i32 (i8*, i8*)* } %f0.0, i32 (i8*, i8*)* @main.h0, 1
+  store { i8*, i32 (i8*, i8*)* } %f0, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers, i32 0, i32 0)
+  %f1.0 = insertvalue { i8*, i32 (i8*, i8*)* } undef, i8* undef, 0
+  %f1 = insertvalue { i8*, i32 (i8*, i8*)* } %f1.0, i32 (i8*, i8*)* @main.h1, 1
+  store { i8*, i32 (i8*, i8*)* } %f1, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers, i32 0, i32 1)
+  %f2.0 = insertvalue { i8*, i32 (i8*, i8*)* } undef, i8* undef, 0
+  %f2 = insertvalue { i8*, i32 (i8*, i8*)* } %f2.0, i32 (i8*, i8*)* @main.h2, 1
+  store { i8*, i32 (i8*, i8*)* } %f2, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers, i32 0, i32 2)
+
+  ; handlers[0], handlers[2] = handlers[2], handlers[0]
+  %a = load { i8*, i32 (i8*, i8*)* }, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers, i32 0, i32 0)
+  %b = load { i8*, i32 (i8*, i8*)* }, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers, i32 0, i32 2)
+  store { i8*, i32 (i8*, i8*)* } %b, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers, i32 0, i32 0)
+  store { i8*, i32 (i8*, i8*)* } %a, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers, i32 0, i32 2)
+
+  ; table = handlers
+  %all = load [3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers
+  store [3 x { i8*, i32 (i8*, i8*)* }] %all, [3 x { i8*, i32 (i8*, i8*)* }]* @main.table
+
+  ; copy(first[:], handlers[:2])
+  call void @llvm.memcpy.p0i8.p0i8.i64(i8* bitcast ([2 x { i8*, i32 (i8*, i8*)* }]* @main.first to i8*), i8* bitcast ([3 x { i8*, i32 (i8*, i8*)* }]* @main.handlers to i8*), i64 32, i1 false)
+
+  ; result = table[1]()
+  %h = load { i8*, i32 (i8*, i8*)* }, { i8*, i32 (i8*, i8*)* }* getelementptr inbounds ([3 x { i8*, i32 (i8*, i8*)* }], [3 x { i8*, i32 (i8*, i8*)* }]* @main.table, i32 0, i32 1)
+  %h.context = extractvalue { i8*, i32 (i8*, i8*)* } %h, 0
+  %h.fn = extractvalue { i8*, i32 (i8*, i8*)* } %h, 1
+  %result = call i32 %h.fn(i8* %h.context, i8* undef)
+  store i32 %result, i32* @main.result
+  ret void
+}
@@ -0,0 +1,29 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.handlers = constant [3 x { i8*, i32 (i8*, i8*)* }] [{ i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h2 }, { i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h1 }, { i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h0 }]
+@main.table = constant [3 x { i8*, i32 (i8*, i8*)* }] [{ i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h2 }, { i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h1 }, { i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h0 }]
+@main.first = constant [2 x { i8*, i32 (i8*, i8*)* }] [{ i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h2 }, { i8*, i32 (i8*, i8*)* } { i8* undef, i32 (i8*, i8*)* @main.h1 }]
+@main.result = constant i32 11
+
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8* nocapture writeonly, i8* nocapture readonly, i64, i1)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
+
+define internal i32 @main.h0(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret i32 10
+}
+
+define internal i32 @main.h1(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret i32 11
+}
+
+define internal i32 @main.h2(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret i32 12
+}
@@ -0,0 +1,47 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.table = global [4 x i32] zeroinitializer
+@main.values = global [4 x i32] zeroinitializer
+@main.index = global i64 2
+@other.table = global [4 x i32] zeroinitializer
+@other.index = global i64 5
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Fills a table in a loop and stores to an index loaded from another global.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %next, %loop ]
+  %square = mul i64 %i, %i
+  %square.i32 = trunc i64 %square to i32
+  %ptr = getelementptr inbounds [4 x i32], [4 x i32]* @main.table, i64 0, i64 %i
+  store i32 %square.i32, i32* %ptr
+  %next = add i64 %i, 1
+  %cond = icmp ult i64 %next, 4
+  br i1 %cond, label %loop, label %done
+
+done:
+  %index = load i64, i64* @main.index
+  %value.ptr = getelementptr inbounds [4 x i32], [4 x i32]* @main.values, i64 0, i64 %index
+  store i32 9, i32* %value.ptr
+  ret void
+}
+
+; Stores to an index that is out of bounds, so must be reverted.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 1, i32* getelementptr inbounds ([4 x i32], [4 x i32]* @other.table, i64 0, i64 0)
+  %index = load i64, i64* @other.index
+  %ptr = getelementptr inbounds [4 x i32], [4 x i32]* @other.table, i64 0, i64 %index
+  store i32 3, i32* %ptr
+  ret void
+}
@@ -0,0 +1,23 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.table = constant [4 x i32] [i32 0, i32 1, i32 4, i32 9]
+@main.values = constant [4 x i32] [i32 0, i32 0, i32 9, i32 0]
+@main.index = global i64 2
+@other.table = global [4 x i32] zeroinitializer
+@other.index = global i64 5
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 1, i32* getelementptr inbounds ([4 x i32], [4 x i32]* @other.table, i64 0, i64 0)
+  %index = load i64, i64* @other.index
+  %ptr = getelementptr inbounds [4 x i32], [4 x i32]* @other.table, i64 0, i64 %index
+  store i32 3, i32* %ptr
+  ret void
+}
@@ -0,0 +1,53 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Entry = type { i32, [3 x i16] }
+
+@main.table = global [4 x %main.Entry] zeroinitializer
+@main.last = global i16 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Fills table[i].id and table[i].coords[j] in nested loops, using indices of
+; different widths.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  br label %outer
+
+outer:
+  %i = phi i64 [ 0, %entry ], [ %i.next, %outer.next ]
+  %entry.ptr = getelementptr inbounds [4 x %main.Entry], [4 x %main.Entry]* @main.table, i64 0, i64 %i
+  %id.ptr = getelementptr inbounds %main.Entry, %main.Entry* %entry.ptr, i32 0, i32 0
+  %id = trunc i64 %i to i32
+  store i32 %id, i32* %id.ptr
+  br label %inner
+
+inner:
+  %j = phi i32 [ 0, %outer ], [ %j.next, %inner ]
+  %coord.ptr = getelementptr inbounds [4 x %main.Entry], [4 x %main.Entry]* @main.table, i64 0, i64 %i, i32 1, i32 %j
+  %base = mul i32 %id, 10
+  %value.i32 = add i32 %base, %j
+  %value = trunc i32 %value.i32 to i16
+  store i16 %value, i16* %coord.ptr
+  %j.next = add i32 %j, 1
+  %j.done = icmp eq i32 %j.next, 3
+  br i1 %j.done, label %outer.next, label %inner
+
+outer.next:
+  %i.next = add i64 %i, 1
+  %i.done = icmp eq i64 %i.next, 4
+  br i1 %i.done, label %exit, label %outer
+
+exit:
+  ; Read back the last coordinate using a negative index relative to the end
+  ; of the table.
+  %end = getelementptr inbounds [4 x %main.Entry], [4 x %main.Entry]* @main.table, i64 1, i64 0
+  %last.ptr = getelementptr inbounds %main.Entry, %main.Entry* %end, i64 -1, i32 1, i64 2
+  %last = load i16, i16* %last.ptr
+  store i16 %last, i16* @main.last
+  ret void
+}
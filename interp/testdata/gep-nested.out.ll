@@ -0,0 +1,12 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Entry = type { i32, [3 x i16] }
+
+@main.table = constant [4 x %main.Entry] [%main.Entry { i32 0, [3 x i16] [i16 0, i16 1, i16 2] }, %main.Entry { i32 1, [3 x i16] [i16 10, i16 11, i16 12] }, %main.Entry { i32 2, [3 x i16] [i16 20, i16 21, i16 22] }, %main.Entry { i32 3, [3 x i16] [i16 30, i16 31, i16 32] }]
+@main.last = constant i16 32
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
@@ -0,0 +1,49 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@a.idx = global i32 0
+@main.options = global [3 x i64] [i64 10, i64 20, i64 1]
+@main.first = global i64 0
+@main.second = global i64 0
+@main.third = global i64* null
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @a.init(i8* undef, i8* undef)
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @a.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 2, i32* @a.idx
+  ret void
+}
+
+; Equivalent to:
+;
+;     func init() {
+;         first = options[a.idx]
+;         second = options[first]
+;         third = &options[0]
+;         if second > 10 {
+;             third = &options[2]
+;         }
+;     }
+;
+; Where the if statement has been turned into a select by the optimizer.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %idx = load i32, i32* @a.idx
+  %idx.ext = sext i32 %idx to i64
+  %first.ptr = getelementptr inbounds [3 x i64], [3 x i64]* @main.options, i64 0, i64 %idx.ext
+  %first = load i64, i64* %first.ptr
+  store i64 %first, i64* @main.first
+  %second.ptr = getelementptr inbounds [3 x i64], [3 x i64]* @main.options, i64 0, i64 %first
+  %second = load i64, i64* %second.ptr
+  store i64 %second, i64* @main.second
+  %cmp = icmp ugt i64 %second, 10
+  %third = select i1 %cmp, i64* getelementptr inbounds ([3 x i64], [3 x i64]* @main.options, i64 0, i64 2), i64* getelementptr inbounds ([3 x i64], [3 x i64]* @main.options, i64 0, i64 0)
+  store i64* %third, i64** @main.third
+  ret void
+}
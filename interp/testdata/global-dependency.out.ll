@@ -0,0 +1,13 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@a.idx = constant i32 2
+@main.options = global [3 x i64] [i64 10, i64 20, i64 1]
+@main.first = constant i64 1
+@main.second = constant i64 20
+@main.third = constant i64* getelementptr inbounds ([3 x i64], [3 x i64]* @main.options, i32 0, i32 2)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
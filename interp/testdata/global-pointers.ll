@@ -0,0 +1,48 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Config = type { i32, i32 }
+%main.Node = type { i32, %main.Node* }
+
+@main.defaults = global %main.Config { i32 1, i32 2 }
+@main.cfg = global %main.Config* null
+@main.second = global i32* null
+@main.leaf = global %main.Node zeroinitializer
+@main.root = global %main.Node zeroinitializer
+@main.list = global %main.Node* null
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; var cfg = &defaults
+  store %main.Config* @main.defaults, %main.Config** @main.cfg
+
+  ; An interior pointer, calculated using a byte offset.
+  %defaults.raw = bitcast %main.Config* @main.defaults to i8*
+  %second.raw = getelementptr i8, i8* %defaults.raw, i64 4
+  %second = bitcast i8* %second.raw to i32*
+  store i32* %second, i32** @main.second
+
+  ; var root = Node{next: &leaf}
+  %leaf.value = getelementptr %main.Node, %main.Node* @main.leaf, i32 0, i32 0
+  store i32 1, i32* %leaf.value
+  %root.value = getelementptr %main.Node, %main.Node* @main.root, i32 0, i32 0
+  store i32 2, i32* %root.value
+  %root.next = getelementptr %main.Node, %main.Node* @main.root, i32 0, i32 1
+  store %main.Node* @main.leaf, %main.Node** %root.next
+
+  ; A node that is allocated on the stack but outlives the init function, as
+  ; its address is stored in a global.
+  %node = alloca %main.Node
+  %node.value = getelementptr %main.Node, %main.Node* %node, i32 0, i32 0
+  store i32 3, i32* %node.value
+  %node.next = getelementptr %main.Node, %main.Node* %node, i32 0, i32 1
+  store %main.Node* @main.root, %main.Node** %node.next
+  store %main.Node* %node, %main.Node** @main.list
+  ret void
+}
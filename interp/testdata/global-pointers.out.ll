@@ -0,0 +1,18 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Config = type { i32, i32 }
+%main.Node = type { i32, %main.Node* }
+
+@main.defaults = global %main.Config { i32 1, i32 2 }
+@main.cfg = constant %main.Config* @main.defaults
+@main.second = constant i32* getelementptr inbounds (%main.Config, %main.Config* @main.defaults, i32 0, i32 1)
+@main.leaf = global %main.Node { i32 1, %main.Node* null }
+@main.root = global %main.Node { i32 2, %main.Node* @main.leaf }
+@main.list = constant %main.Node* @"main$alloca"
+@"main$alloca" = internal global %main.Node { i32 3, %main.Node* @main.root }
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
@@ -0,0 +1,22 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.counter = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; This loop never terminates, so interpretation must stop at some point.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %next, %loop ]
+  %next = add i64 %i, 1
+  store i64 %next, i64* @main.counter
+  br label %loop
+}
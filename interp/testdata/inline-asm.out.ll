@@ -0,0 +1,37 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+module asm ".globl main.readStatus"
+module asm "main.readStatus:"
+module asm "  movl $1, %eax"
+module asm "  ret"
+
+@main.status = global i32 0
+@main.ready = global i1 false
+@cpu.caller = global i8* null
+@other.x = constant i64 7
+
+declare i8* @llvm.returnaddress(i32)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @cpu.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i1 true, i1* @main.ready
+  %status = call i32 asm sideeffect "call main.readStatus", "={eax},~{dirflag},~{fpsr},~{flags}"()
+  call void asm sideeffect "mfence", "~{memory}"()
+  store i32 %status, i32* @main.status
+  ret void
+}
+
+define internal void @cpu.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %caller = call i8* @llvm.returnaddress(i32 0)
+  store i8* %caller, i8** @cpu.caller
+  ret void
+}
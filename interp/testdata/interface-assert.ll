@@ -0,0 +1,77 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._interface = type { i64, i8* }
+%runtime.typecodeID = type { %runtime.typecodeID*, i64 }
+%runtime.typeInInterface = type { %runtime.typecodeID*, %runtime.interfaceMethodInfo*, %runtime.interfaceMethodInfo* }
+%runtime.interfaceMethodInfo = type { i8*, i64 }
+%main.buffer = type { i32 }
+
+@main.buf = global %main.buffer { i32 5 }
+@main.out = global %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:pointer:named:main.buffer" to i64), i8* bitcast (%main.buffer* @main.buf to i8*) }
+@main.none = global %runtime._interface zeroinitializer
+@main.size = global i32 0
+@main.isWriter = global i1 false
+@main.isStringer = global i1 false
+@main.noneIsBuffer = global i1 false
+@"reflect/types.type:pointer:named:main.buffer" = external constant %runtime.typecodeID
+@"typeInInterface:reflect/types.type:pointer:named:main.buffer" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:pointer:named:main.buffer", %runtime.interfaceMethodInfo* getelementptr ([1 x %runtime.interfaceMethodInfo], [1 x %runtime.interfaceMethodInfo]* @"*main.buffer$methodset", i32 0, i32 0), %runtime.interfaceMethodInfo* null }
+@"reflect/methods.Write([]uint8) (int, error)" = linkonce_odr constant i8 0
+@"reflect/methods.String() string" = linkonce_odr constant i8 0
+@"*main.buffer$methodset" = private constant [1 x %runtime.interfaceMethodInfo] [%runtime.interfaceMethodInfo { i8* @"reflect/methods.Write([]uint8) (int, error)", i64 ptrtoint (void ()* @"(*main.buffer).Write$invoke" to i64) }]
+@"main.Writer$interface" = private constant [1 x i8*] [i8* @"reflect/methods.Write([]uint8) (int, error)"]
+@"main.Stringer$interface" = private constant [1 x i8*] [i8* @"reflect/methods.String() string"]
+
+declare i1 @runtime.typeAssert(i64, %runtime.typecodeID*, i8*, i8*)
+declare i1 @runtime.interfaceImplements(i64, i8**, i8*, i8*)
+declare void @"(*main.buffer).Write$invoke"()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Equivalent to:
+;
+;     func init() {
+;         if b, ok := out.(*buffer); ok {
+;             size = b.n
+;         }
+;         _, isWriter = out.(Writer)
+;         _, isStringer = out.(Stringer)
+;         _, noneIsBuffer = none.(*buffer)
+;     }
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %out = load %runtime._interface, %runtime._interface* @main.out
+  %out.typecode = extractvalue %runtime._interface %out, 0
+  %buffer.ok = call i1 @runtime.typeAssert(i64 %out.typecode, %runtime.typecodeID* @"reflect/types.type:pointer:named:main.buffer", i8* undef, i8* undef)
+  br i1 %buffer.ok, label %typeassert.ok, label %typeassert.next
+
+typeassert.ok:
+  %buffer.ptr = extractvalue %runtime._interface %out, 1
+  %buffer.value = bitcast i8* %buffer.ptr to %main.buffer*
+  br label %typeassert.next
+
+typeassert.next:
+  %buffer = phi %main.buffer* [ null, %entry ], [ %buffer.value, %typeassert.ok ]
+  br i1 %buffer.ok, label %if.then, label %if.done
+
+if.then:
+  %n.ptr = getelementptr inbounds %main.buffer, %main.buffer* %buffer, i32 0, i32 0
+  %n = load i32, i32* %n.ptr
+  store i32 %n, i32* @main.size
+  br label %if.done
+
+if.done:
+  %writer.ok = call i1 @runtime.interfaceImplements(i64 %out.typecode, i8** getelementptr ([1 x i8*], [1 x i8*]* @"main.Writer$interface", i32 0, i32 0), i8* undef, i8* undef)
+  store i1 %writer.ok, i1* @main.isWriter
+  %stringer.ok = call i1 @runtime.interfaceImplements(i64 %out.typecode, i8** getelementptr ([1 x i8*], [1 x i8*]* @"main.Stringer$interface", i32 0, i32 0), i8* undef, i8* undef)
+  store i1 %stringer.ok, i1* @main.isStringer
+  %none = load %runtime._interface, %runtime._interface* @main.none
+  %none.typecode = extractvalue %runtime._interface %none, 0
+  %none.ok = call i1 @runtime.typeAssert(i64 %none.typecode, %runtime.typecodeID* @"reflect/types.type:pointer:named:main.buffer", i8* undef, i8* undef)
+  store i1 %none.ok, i1* @main.noneIsBuffer
+  ret void
+}
@@ -0,0 +1,32 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._interface = type { i64, i8* }
+%runtime.typecodeID = type { %runtime.typecodeID*, i64 }
+%runtime.typeInInterface = type { %runtime.typecodeID*, %runtime.interfaceMethodInfo*, %runtime.interfaceMethodInfo* }
+%runtime.interfaceMethodInfo = type { i8*, i64 }
+%main.buffer = type { i32 }
+
+@main.buf = global %main.buffer { i32 5 }
+@main.out = global %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:pointer:named:main.buffer" to i64), i8* bitcast (%main.buffer* @main.buf to i8*) }
+@main.none = global %runtime._interface zeroinitializer
+@main.size = constant i32 5
+@main.isWriter = constant i1 true
+@main.isStringer = constant i1 false
+@main.noneIsBuffer = constant i1 false
+@"reflect/types.type:pointer:named:main.buffer" = external constant %runtime.typecodeID
+@"typeInInterface:reflect/types.type:pointer:named:main.buffer" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:pointer:named:main.buffer", %runtime.interfaceMethodInfo* getelementptr ([1 x %runtime.interfaceMethodInfo], [1 x %runtime.interfaceMethodInfo]* @"*main.buffer$methodset", i32 0, i32 0), %runtime.interfaceMethodInfo* null }
+@"reflect/methods.Write([]uint8) (int, error)" = linkonce_odr constant i8 0
+@"reflect/methods.String() string" = linkonce_odr constant i8 0
+@"*main.buffer$methodset" = private constant [1 x %runtime.interfaceMethodInfo] [%runtime.interfaceMethodInfo { i8* @"reflect/methods.Write([]uint8) (int, error)", i64 ptrtoint (void ()* @"(*main.buffer).Write$invoke" to i64) }]
+@"main.Writer$interface" = private constant [1 x i8*] [i8* @"reflect/methods.Write([]uint8) (int, error)"]
+@"main.Stringer$interface" = private constant [1 x i8*] [i8* @"reflect/methods.String() string"]
+
+declare i1 @runtime.typeAssert(i64, %runtime.typecodeID*, i8*, i8*)
+declare i1 @runtime.interfaceImplements(i64, i8**, i8*, i8*)
+declare void @"(*main.buffer).Write$invoke"()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
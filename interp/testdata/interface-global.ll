@@ -0,0 +1,70 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._interface = type { i64, i8* }
+%runtime._string = type { i8*, i64 }
+%runtime.typecodeID = type { %runtime.typecodeID*, i64 }
+%runtime.typeInInterface = type { %runtime.typecodeID*, %runtime.interfaceMethodInfo*, %runtime.interfaceMethodInfo* }
+%runtime.interfaceMethodInfo = type { i8*, i64 }
+%main.stderrLogger = type { i32 }
+%main.point = type { i16, i16 }
+
+@main.defaultLogger = global %runtime._interface zeroinitializer
+@main.defaultName = global %runtime._interface zeroinitializer
+@main.origin = global %runtime._interface zeroinitializer
+@"reflect/types.type:pointer:named:main.stderrLogger" = external constant %runtime.typecodeID
+@"reflect/types.type:named:main.name" = external constant %runtime.typecodeID
+@"reflect/types.type:named:main.point" = external constant %runtime.typecodeID
+@"typeInInterface:reflect/types.type:pointer:named:main.stderrLogger" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:pointer:named:main.stderrLogger", %runtime.interfaceMethodInfo* null, %runtime.interfaceMethodInfo* null }
+@"typeInInterface:reflect/types.type:named:main.name" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:named:main.name", %runtime.interfaceMethodInfo* null, %runtime.interfaceMethodInfo* null }
+@"typeInInterface:reflect/types.type:named:main.point" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:named:main.point", %runtime.interfaceMethodInfo* null, %runtime.interfaceMethodInfo* null }
+@"main.init$string" = internal unnamed_addr constant [6 x i8] c"tinygo"
+
+declare i8* @runtime.alloc(i64)
+declare void @llvm.lifetime.start.p0i8(i64, i8*)
+declare void @llvm.lifetime.end.p0i8(i64, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; defaultLogger = &stderrLogger{fd: 2}
+  ; The value is a pointer, which is stored in the interface directly.
+  %logger.raw = call i8* @runtime.alloc(i64 4)
+  %logger = bitcast i8* %logger.raw to %main.stderrLogger*
+  %logger.fd = getelementptr inbounds %main.stderrLogger, %main.stderrLogger* %logger, i32 0, i32 0
+  store i32 2, i32* %logger.fd
+  %logger.ptr = bitcast %main.stderrLogger* %logger to i8*
+  %logger.itf = insertvalue %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:pointer:named:main.stderrLogger" to i64), i8* undef }, i8* %logger.ptr, 1
+  store %runtime._interface %logger.itf, %runtime._interface* @main.defaultLogger
+
+  ; defaultName = name("tinygo")
+  ; The value is too big to be packed in a pointer, so it is materialized as a
+  ; new global. The raw heap pointer is used in the interface.
+  %name.raw = call i8* @runtime.alloc(i64 16)
+  %name = bitcast i8* %name.raw to { %runtime._string }*
+  %name.0 = getelementptr inbounds { %runtime._string }, { %runtime._string }* %name, i32 0, i32 0
+  store %runtime._string { i8* getelementptr inbounds ([6 x i8], [6 x i8]* @"main.init$string", i32 0, i32 0), i64 6 }, %runtime._string* %name.0
+  %name.itf = insertvalue %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:named:main.name" to i64), i8* undef }, i8* %name.raw, 1
+  store %runtime._interface %name.itf, %runtime._interface* @main.defaultName
+
+  ; origin = point{1, 2}
+  ; The value is packed in the pointer itself, through a temporary alloca.
+  %point.raw = alloca i8*
+  %point.raw.bitcast = bitcast i8** %point.raw to i8*
+  call void @llvm.lifetime.start.p0i8(i64 8, i8* %point.raw.bitcast)
+  %point = bitcast i8** %point.raw to { %main.point }*
+  %point.x = getelementptr inbounds { %main.point }, { %main.point }* %point, i32 0, i32 0, i32 0
+  store i16 1, i16* %point.x
+  %point.y = getelementptr inbounds { %main.point }, { %main.point }* %point, i32 0, i32 0, i32 1
+  store i16 2, i16* %point.y
+  %point.ptr = load i8*, i8** %point.raw
+  call void @llvm.lifetime.end.p0i8(i64 8, i8* %point.raw.bitcast)
+  %point.itf = insertvalue %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:named:main.point" to i64), i8* undef }, i8* %point.ptr, 1
+  store %runtime._interface %point.itf, %runtime._interface* @main.origin
+  ret void
+}
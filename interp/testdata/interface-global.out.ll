@@ -0,0 +1,32 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._interface = type { i64, i8* }
+%runtime._string = type { i8*, i64 }
+%runtime.typecodeID = type { %runtime.typecodeID*, i64 }
+%runtime.typeInInterface = type { %runtime.typecodeID*, %runtime.interfaceMethodInfo*, %runtime.interfaceMethodInfo* }
+%runtime.interfaceMethodInfo = type { i8*, i64 }
+%main.stderrLogger = type { i32 }
+%main.point = type { i16, i16 }
+
+@main.defaultLogger = constant %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:pointer:named:main.stderrLogger" to i64), i8* bitcast (%main.stderrLogger* @"main$alloc" to i8*) }
+@main.defaultName = constant %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:named:main.name" to i64), i8* bitcast ({ %runtime._string }* @"main$alloc.1" to i8*) }
+@main.origin = constant %runtime._interface { i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:named:main.point" to i64), i8* inttoptr (i64 131073 to i8*) }
+@"reflect/types.type:pointer:named:main.stderrLogger" = external constant %runtime.typecodeID
+@"reflect/types.type:named:main.name" = external constant %runtime.typecodeID
+@"reflect/types.type:named:main.point" = external constant %runtime.typecodeID
+@"typeInInterface:reflect/types.type:pointer:named:main.stderrLogger" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:pointer:named:main.stderrLogger", %runtime.interfaceMethodInfo* null, %runtime.interfaceMethodInfo* null }
+@"typeInInterface:reflect/types.type:named:main.name" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:named:main.name", %runtime.interfaceMethodInfo* null, %runtime.interfaceMethodInfo* null }
+@"typeInInterface:reflect/types.type:named:main.point" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:named:main.point", %runtime.interfaceMethodInfo* null, %runtime.interfaceMethodInfo* null }
+@"main.init$string" = internal unnamed_addr constant [6 x i8] c"tinygo"
+@"main$alloc" = internal global %main.stderrLogger { i32 2 }
+@"main$alloc.1" = internal global { %runtime._string } { %runtime._string { i8* getelementptr inbounds ([6 x i8], [6 x i8]* @"main.init$string", i32 0, i32 0), i64 6 } }
+
+declare i8* @runtime.alloc(i64)
+declare void @llvm.lifetime.start.p0i8(i64, i8*)
+declare void @llvm.lifetime.end.p0i8(i64, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
@@ -0,0 +1,45 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.src = global [4 x i32] [i32 1, i32 2, i32 3, i32 4]
+@main.srcLen = global i64 3
+@main.dst = global [8 x i32] zeroinitializer
+@main.dstLen = global i64 8
+@main.copied = global i64 0
+@main.buf = global [8 x i8] c"abcdefgh"
+@main.tail = global [8 x i8] zeroinitializer
+
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8* nocapture writeonly, i8* nocapture readonly, i64, i1)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; Copy min(srcLen, dstLen) elements, like copy(dst, src[:srcLen]). The length
+  ; is only known after loading both lengths.
+  %srcLen = load i64, i64* @main.srcLen
+  %dstLen = load i64, i64* @main.dstLen
+  %less = icmp ult i64 %srcLen, %dstLen
+  br i1 %less, label %copy, label %dstShorter
+
+dstShorter:
+  br label %copy
+
+copy:
+  %n = phi i64 [ %srcLen, %entry ], [ %dstLen, %dstShorter ]
+  %size = mul i64 %n, 4
+  call void @llvm.memcpy.p0i8.p0i8.i64(i8* bitcast ([8 x i32]* @main.dst to i8*), i8* bitcast ([4 x i32]* @main.src to i8*), i64 %size, i1 false)
+  store i64 %n, i64* @main.copied
+
+  ; Copy the rest of a buffer, starting at the number of copied elements. The
+  ; length is the distance between two pointers into the same global.
+  %start = getelementptr inbounds [8 x i8], [8 x i8]* @main.buf, i64 0, i64 %n
+  %startInt = ptrtoint i8* %start to i64
+  %remaining = sub i64 ptrtoint (i8* getelementptr inbounds ([8 x i8], [8 x i8]* @main.buf, i64 1, i64 0) to i64), %startInt
+  call void @llvm.memcpy.p0i8.p0i8.i64(i8* getelementptr inbounds ([8 x i8], [8 x i8]* @main.tail, i64 0, i64 0), i8* %start, i64 %remaining, i1 false)
+  ret void
+}
@@ -0,0 +1,20 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.src = global [4 x i32] [i32 1, i32 2, i32 3, i32 4]
+@main.srcLen = global i64 3
+@main.dst = constant [8 x i32] [i32 1, i32 2, i32 3, i32 0, i32 0, i32 0, i32 0, i32 0]
+@main.dstLen = global i64 8
+@main.copied = constant i64 3
+@main.buf = global [8 x i8] c"abcdefgh"
+@main.tail = constant [8 x i8] c"defgh\00\00\00"
+
+; Function Attrs: argmemonly nofree nounwind willreturn
+declare void @llvm.memcpy.p0i8.p0i8.i64(i8* noalias nocapture writeonly, i8* noalias nocapture readonly, i64, i1 immarg) #0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
+
+attributes #0 = { argmemonly nofree nounwind willreturn }
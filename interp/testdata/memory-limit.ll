@@ -0,0 +1,34 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.buf = global i8* null
+@other.small = global i32* null
+
+declare i8* @runtime.alloc(i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Allocates a buffer that is larger than the memory limit of the test, so must
+; be run at runtime.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %buf = call i8* @runtime.alloc(i64 4096)
+  store i8 1, i8* %buf
+  store i8* %buf, i8** @main.buf
+  ret void
+}
+
+; Allocates a small object, which is still within the limit.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %small.raw = call i8* @runtime.alloc(i64 4)
+  %small = bitcast i8* %small.raw to i32*
+  store i32 5, i32* %small
+  store i32* %small, i32** @other.small
+  ret void
+}
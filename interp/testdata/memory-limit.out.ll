@@ -0,0 +1,22 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.buf = global i8* null
+@other.small = constant i32* @"other$alloc"
+@"other$alloc" = internal global i32 5
+
+declare i8* @runtime.alloc(i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %buf = call i8* @runtime.alloc(i64 4096)
+  store i8 1, i8* %buf
+  store i8* %buf, i8** @main.buf
+  ret void
+}
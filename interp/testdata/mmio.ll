@@ -0,0 +1,37 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32-S128"
+target triple = "armv7m-none-eabi"
+
+@machine.initialized = global i1 false
+@main.value = global i32 0
+@other.x = global i32 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @machine.init(i8* undef, i8* undef)
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @machine.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; Enable a peripheral clock through a volatile register store.
+  store i1 true, i1* @machine.initialized
+  store volatile i32 1, i32* inttoptr (i32 1073872896 to i32*)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; Plain store to a fixed address, derived from an integer literal.
+  %reg = getelementptr i32, i32* inttoptr (i32 1073872896 to i32*), i32 2
+  store i32 5, i32* %reg
+  store i32 5, i32* @main.value
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 3, i32* @other.x
+  ret void
+}
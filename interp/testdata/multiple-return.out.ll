@@ -0,0 +1,51 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.table = global [3 x i32] [i32 10, i32 20, i32 30]
+@main.value = constant i32 20
+@main.found = constant i1 true
+@main.missingFound = constant i1 false
+@main.pair = constant { i32, { i8*, i64 } } { i32 7, { i8*, i64 } { i8* getelementptr inbounds ([5 x i8], [5 x i8]* @main.name, i32 0, i32 0), i64 5 } }
+@main.dynamic = global i32 0
+@main.name = internal unnamed_addr constant [5 x i8] c"hello"
+
+declare i64 @main.index()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal { i32, i1 } @main.lookup(i64 %i) unnamed_addr {
+entry:
+  %inRange = icmp ult i64 %i, 3
+  br i1 %inRange, label %found, label %missing
+
+found:                                            ; preds = %entry
+  %ptr = getelementptr [3 x i32], [3 x i32]* @main.table, i64 0, i64 %i
+  %value = load i32, i32* %ptr
+  %result.0 = insertvalue { i32, i1 } undef, i32 %value, 0
+  %result.1 = insertvalue { i32, i1 } %result.0, i1 true, 1
+  ret { i32, i1 } %result.1
+
+missing:                                          ; preds = %entry
+  ret { i32, i1 } zeroinitializer
+}
+
+define internal { i32, { i8*, i64 } } @main.makePair() unnamed_addr {
+entry:
+  %str = insertvalue { i8*, i64 } undef, i8* getelementptr inbounds ([5 x i8], [5 x i8]* @main.name, i32 0, i32 0), 0
+  %str.len = insertvalue { i8*, i64 } %str, i64 5, 1
+  %pair = insertvalue { i32, { i8*, i64 } } { i32 7, { i8*, i64 } undef }, { i8*, i64 } %str.len, 1
+  ret { i32, { i8*, i64 } } %pair
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %index = call i64 @main.index()
+  %dynamic = call { i32, i1 } @main.lookup(i64 %index)
+  %0 = extractvalue { i32, i1 } %dynamic, 0
+  store i32 %0, i32* @main.dynamic
+  ret void
+}
@@ -0,0 +1,60 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Point = type { i32, i32 }
+
+@main.point = global %main.Point* null
+@main.table = global [4 x i32] zeroinitializer
+
+declare i8* @runtime.alloc(i64)
+
+declare i1 @runtime.isnil(i8*)
+
+declare void @runtime.nilPanic(i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Equivalent to:
+;
+;     func init() {
+;         p := new(Point)
+;         p.y = 4
+;         point = p
+;         q := &table[2]
+;         *q = 5
+;     }
+;
+; Including the nil checks the front-end inserts before each dereference.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %p.raw = call i8* @runtime.alloc(i64 8)
+  %p = bitcast i8* %p.raw to %main.Point*
+  %p.check = bitcast %main.Point* %p to i8*
+  %p.isnil = call i1 @runtime.isnil(i8* %p.check)
+  br i1 %p.isnil, label %p.nil, label %p.next
+
+p.nil:
+  call void @runtime.nilPanic(i8* undef, i8* null)
+  unreachable
+
+p.next:
+  %p.y = getelementptr inbounds %main.Point, %main.Point* %p, i32 0, i32 1
+  store i32 4, i32* %p.y
+  store %main.Point* %p, %main.Point** @main.point
+  %q = getelementptr inbounds [4 x i32], [4 x i32]* @main.table, i32 0, i32 2
+  %q.check = bitcast i32* %q to i8*
+  %q.isnil = call i1 @runtime.isnil(i8* %q.check)
+  br i1 %q.isnil, label %q.nil, label %q.next
+
+q.nil:
+  call void @runtime.nilPanic(i8* undef, i8* null)
+  unreachable
+
+q.next:
+  store i32 5, i32* %q
+  ret void
+}
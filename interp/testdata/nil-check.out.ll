@@ -0,0 +1,19 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.Point = type { i32, i32 }
+
+@main.point = constant %main.Point* @"main$alloc"
+@main.table = constant [4 x i32] [i32 0, i32 0, i32 5, i32 0]
+@"main$alloc" = internal global %main.Point { i32 0, i32 4 }
+
+declare i8* @runtime.alloc(i64)
+
+declare i1 @runtime.isnil(i8*)
+
+declare void @runtime.nilPanic(i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
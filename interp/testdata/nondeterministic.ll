@@ -0,0 +1,37 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.seed = global i64 0
+@main.count = global i64 0
+@other.x = global i32 0
+
+declare i64 @runtime.ticks()
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal i64 @runtime.nanotime() unnamed_addr {
+entry:
+  %ticks = call i64 @runtime.ticks()
+  %nanos = mul i64 %ticks, 1000
+  ret i64 %nanos
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; count = 1; seed = time.Now().UnixNano()
+  store i64 1, i64* @main.count
+  %now = call i64 @runtime.nanotime()
+  store i64 %now, i64* @main.seed
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 3, i32* @other.x
+  ret void
+}
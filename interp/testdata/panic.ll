@@ -0,0 +1,48 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+%runtime.typecodeID = type { %runtime.typecodeID*, i64 }
+%runtime.typeInInterface = type { %runtime.typecodeID*, %runtime.interfaceMethodInfo* }
+%runtime.interfaceMethodInfo = type { i8*, i64 }
+
+@main.x = global i32 0
+@"reflect/types.type:basic:string" = external constant %runtime.typecodeID
+@"typeInInterface:reflect/types.type:basic:string" = private constant %runtime.typeInInterface { %runtime.typecodeID* @"reflect/types.type:basic:string", %runtime.interfaceMethodInfo* null }
+@"main.init$string" = internal unnamed_addr constant [1 x i8] c"x"
+@"main.init$pack" = internal unnamed_addr constant %runtime._string { i8* getelementptr inbounds ([1 x i8], [1 x i8]* @"main.init$string", i32 0, i32 0), i64 1 }
+
+declare void @runtime._panic(i64, i8*, i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Equivalent to:
+;
+;     func init() {
+;         x = 1
+;         panic("x")
+;     }
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr !dbg !5 {
+entry:
+  store i32 1, i32* @main.x, !dbg !8
+  call void @runtime._panic(i64 ptrtoint (%runtime.typeInInterface* @"typeInInterface:reflect/types.type:basic:string" to i64), i8* bitcast (%runtime._string* @"main.init$pack" to i8*), i8* undef, i8* undef), !dbg !9
+  unreachable
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_Go, file: !1, producer: "TinyGo", isOptimized: true, runtimeVersion: 0, emissionKind: FullDebug, enums: !2)
+!1 = !DIFile(filename: "main.go", directory: "/src")
+!2 = !{}
+!3 = !{i32 2, !"Debug Info Version", i32 3}
+!4 = !{i32 2, !"Dwarf Version", i32 4}
+!5 = distinct !DISubprogram(name: "main.init", scope: !1, file: !1, line: 5, type: !6, scopeLine: 5, spFlags: DISPFlagDefinition, unit: !0, retainedNodes: !2)
+!6 = !DISubroutineType(types: !7)
+!7 = !{null}
+!8 = !DILocation(line: 6, column: 4, scope: !5)
+!9 = !DILocation(line: 7, column: 7, scope: !5)
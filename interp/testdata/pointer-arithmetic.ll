@@ -0,0 +1,61 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.buf = global [16 x i8] zeroinitializer, align 8
+@main.aligned = global i8* null
+@main.next = global i64 0
+@main.value = global i8 0
+@main.words = global [2 x i64] zeroinitializer
+@other.ptr = global i8* null
+@other.words = global [2 x i32] zeroinitializer
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Rounds a pointer into @main.buf up to an 8-byte boundary using
+; (p + 7) &^ 7 and stores through the resulting pointer.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %p = ptrtoint i8* getelementptr inbounds ([16 x i8], [16 x i8]* @main.buf, i64 0, i64 1) to i64
+  %add = add i64 %p, 7
+  %rounded = and i64 %add, -8
+  %ptr = inttoptr i64 %rounded to i8*
+  store i8* %ptr, i8** @main.aligned
+  store i8 5, i8* %ptr
+  %next = add i64 %rounded, 2
+  store i64 %next, i64* @main.next
+  %nextptr = inttoptr i64 %next to i8*
+  store i8 3, i8* %nextptr
+  %value = load i8, i8* %ptr
+  store i8 %value, i8* @main.value
+
+  ; Same rounding on a global without explicit alignment. The global must get
+  ; the alignment that the result relies on.
+  %w = ptrtoint [2 x i64]* @main.words to i64
+  %wadd = add i64 %w, 15
+  %wrounded = and i64 %wadd, -8
+  %wptr = inttoptr i64 %wrounded to i64*
+  store i64 9, i64* %wptr
+  ret void
+}
+
+; The result of an xor on a pointer is not known at compile time, so this
+; initializer must be reverted. This also reverts the alignment that rounding
+; the pointer to @other.words required.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %o = ptrtoint [2 x i32]* @other.words to i64
+  %oadd = add i64 %o, 3
+  %orounded = and i64 %oadd, -4
+  %optr = inttoptr i64 %orounded to i32*
+  store i32 1, i32* %optr
+  %p = ptrtoint i8* getelementptr inbounds ([16 x i8], [16 x i8]* @main.buf, i64 0, i64 0) to i64
+  %x = xor i64 %p, 85
+  %ptr = inttoptr i64 %x to i8*
+  store i8* %ptr, i8** @other.ptr
+  ret void
+}
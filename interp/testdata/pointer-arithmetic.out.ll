@@ -0,0 +1,30 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.buf = global [16 x i8] c"\00\00\00\00\00\00\00\00\05\00\03\00\00\00\00\00", align 8
+@main.aligned = constant i8* getelementptr inbounds ([16 x i8], [16 x i8]* @main.buf, i32 0, i32 8)
+@main.next = constant i64 ptrtoint (i8* getelementptr inbounds ([16 x i8], [16 x i8]* @main.buf, i32 0, i32 10) to i64)
+@main.value = constant i8 5
+@main.words = global [2 x i64] [i64 0, i64 9], align 8
+@other.ptr = global i8* null
+@other.words = global [2 x i32] zeroinitializer
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %o = ptrtoint [2 x i32]* @other.words to i64
+  %oadd = add i64 %o, 3
+  %orounded = and i64 %oadd, -4
+  %optr = inttoptr i64 %orounded to i32*
+  store i32 1, i32* %optr
+  %p = ptrtoint i8* getelementptr inbounds ([16 x i8], [16 x i8]* @main.buf, i64 0, i64 0) to i64
+  %x = xor i64 %p, 85
+  %ptr = inttoptr i64 %x to i8*
+  store i8* %ptr, i8** @other.ptr
+  ret void
+}
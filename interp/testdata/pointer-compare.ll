@@ -0,0 +1,63 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.storage = global [4 x i32] zeroinitializer
+@main.table = global [4 x i32]* null
+@main.defaultConfig = global i32 3
+@main.config = global i32* @main.defaultConfig
+@main.isDefault = global i1 false
+@main.ordered = global i1 false
+@other.a = global i32 0
+@other.b = global i32 0
+@other.less = global i1 false
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Initializes a table behind a nil check, and compares pointers into globals.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %table = load [4 x i32]*, [4 x i32]** @main.table
+  %isNil = icmp eq [4 x i32]* %table, null
+  br i1 %isNil, label %init, label %done
+
+init:
+  store [4 x i32]* @main.storage, [4 x i32]** @main.table
+  store i32 1, i32* getelementptr inbounds ([4 x i32], [4 x i32]* @main.storage, i64 0, i64 0)
+  store i32 2, i32* getelementptr inbounds ([4 x i32], [4 x i32]* @main.storage, i64 0, i64 1)
+  br label %done
+
+done:
+  %table2 = load [4 x i32]*, [4 x i32]** @main.table
+  %notNil = icmp ne [4 x i32]* %table2, null
+  br i1 %notNil, label %compare, label %exit
+
+compare:
+  %config = load i32*, i32** @main.config
+  %isDefault = icmp eq i32* %config, @main.defaultConfig
+  store i1 %isDefault, i1* @main.isDefault
+  %elem1 = getelementptr inbounds [4 x i32], [4 x i32]* %table2, i64 0, i64 1
+  %elem2 = getelementptr inbounds [4 x i32], [4 x i32]* %table2, i64 0, i64 2
+  %sameElem = icmp eq i32* %elem2, getelementptr inbounds ([4 x i32], [4 x i32]* @main.storage, i64 0, i64 2)
+  %ordered = icmp ult i32* %elem1, %elem2
+  %result = and i1 %sameElem, %ordered
+  store i1 %result, i1* @main.ordered
+  br label %exit
+
+exit:
+  ret void
+}
+
+; Ordered comparison between pointers to different globals, whose layout is not
+; known yet. This must be reverted.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 1, i32* @other.a
+  %less = icmp ult i32* @other.a, @other.b
+  store i1 %less, i1* @other.less
+  ret void
+}
@@ -0,0 +1,26 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.storage = global [4 x i32] [i32 1, i32 2, i32 0, i32 0]
+@main.table = constant [4 x i32]* @main.storage
+@main.defaultConfig = global i32 3
+@main.config = global i32* @main.defaultConfig
+@main.isDefault = constant i1 true
+@main.ordered = constant i1 true
+@other.a = global i32 0
+@other.b = global i32 0
+@other.less = global i1 false
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i32 1, i32* @other.a
+  %less = icmp ult i32* @other.a, @other.b
+  store i1 %less, i1* @other.less
+  ret void
+}
@@ -0,0 +1,33 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = global i64 0
+@main.b = global i64 0
+@main.str = internal unnamed_addr constant [4 x i8] c"init"
+
+declare void @runtime.printstring(i8*, i64, i8*, i8*)
+
+declare void @runtime.printint64(i64, i8*, i8*)
+
+declare void @runtime.printnl(i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Prints output in between stores to globals. The stores are done at compile
+; time while the print calls are kept, in the same order, to be run at runtime.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i64 3, i64* @main.a
+  call void @runtime.printstring(i8* getelementptr inbounds ([4 x i8], [4 x i8]* @main.str, i32 0, i32 0), i64 4, i8* undef, i8* undef)
+  call void @runtime.printnl(i8* undef, i8* undef)
+  %a = load i64, i64* @main.a
+  %b = mul i64 %a, 5
+  store i64 %b, i64* @main.b
+  call void @runtime.printint64(i64 %b, i8* undef, i8* undef)
+  call void @runtime.printnl(i8* undef, i8* undef)
+  ret void
+}
@@ -0,0 +1,27 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = constant i64 3
+@main.b = constant i64 15
+@main.str = internal unnamed_addr constant [4 x i8] c"init"
+
+declare void @runtime.printstring(i8*, i64, i8*, i8*)
+
+declare void @runtime.printint64(i64, i8*, i8*)
+
+declare void @runtime.printnl(i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void @runtime.printstring(i8* getelementptr inbounds ([4 x i8], [4 x i8]* @main.str, i32 0, i32 0), i64 4, i8* undef, i8* undef)
+  call void @runtime.printnl(i8* undef, i8* undef)
+  call void @runtime.printint64(i64 15, i8* undef, i8* undef)
+  call void @runtime.printnl(i8* undef, i8* undef)
+  ret void
+}
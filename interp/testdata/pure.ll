@@ -0,0 +1,38 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.leadingZeros = global i32 0
+@main.root = global double 0.000000e+00
+@main.swapped = global i16 0
+
+declare i32 @llvm.ctlz.i32(i32, i1)
+
+declare double @llvm.sqrt.f64(double)
+
+declare i16 @llvm.bswap.i16(i16)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal double @math.Sqrt(double %x) unnamed_addr {
+entry:
+  %result = call double @llvm.sqrt.f64(double %x)
+  ret double %result
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; leadingZeros = bits.LeadingZeros32(4096)
+  %lz = call i32 @llvm.ctlz.i32(i32 4096, i1 false)
+  store i32 %lz, i32* @main.leadingZeros
+  ; root = math.Sqrt(2)
+  %root = call double @math.Sqrt(double 2.000000e+00)
+  store double %root, double* @main.root
+  ; swapped = bits.ReverseBytes16(0x1234)
+  %swapped = call i16 @llvm.bswap.i16(i16 4660)
+  store i16 %swapped, i16* @main.swapped
+  ret void
+}
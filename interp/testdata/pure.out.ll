@@ -0,0 +1,28 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.leadingZeros = constant i32 19
+@main.root = constant double 0x3FF6A09E667F3BCD
+@main.swapped = constant i16 13330
+
+; Function Attrs: nofree nosync nounwind readnone speculatable willreturn
+declare i32 @llvm.ctlz.i32(i32, i1 immarg) #0
+
+; Function Attrs: nofree nosync nounwind readnone speculatable willreturn
+declare double @llvm.sqrt.f64(double) #0
+
+; Function Attrs: nofree nosync nounwind readnone speculatable willreturn
+declare i16 @llvm.bswap.i16(i16) #0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
+
+define internal double @math.Sqrt(double %x) unnamed_addr {
+entry:
+  %result = call double @llvm.sqrt.f64(double %x)
+  ret double %result
+}
+
+attributes #0 = { nofree nosync nounwind readnone speculatable willreturn }
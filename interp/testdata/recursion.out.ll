@@ -0,0 +1,33 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.depth = constant i32 5
+@other.depth = global i32 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal i32 @main.build(i32 %n) unnamed_addr {
+entry:
+  %done = icmp eq i32 %n, 0
+  br i1 %done, label %return, label %recurse
+
+recurse:                                          ; preds = %entry
+  %next = sub i32 %n, 1
+  %inner = call i32 @main.build(i32 %next)
+  %result = add i32 %inner, 1
+  ret i32 %result
+
+return:                                           ; preds = %entry
+  ret i32 0
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %depth = call i32 @main.build(i32 100)
+  store i32 %depth, i32* @other.depth
+  ret void
+}
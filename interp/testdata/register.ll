@@ -0,0 +1,78 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+%registry.Handler = type { %runtime._string, { i8*, void (i8*, i8*)* } }
+%registry.slice = type { %registry.Handler*, i64, i64 }
+
+@registry.handlers = global %registry.slice zeroinitializer
+@a.name = internal unnamed_addr constant [5 x i8] c"alpha"
+@b.name = internal unnamed_addr constant [5 x i8] c"bravo"
+
+declare i8* @runtime.alloc(i64)
+
+declare { i8*, i64, i64 } @runtime.sliceAppend(i8*, i8*, i64, i64, i64, i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @a.init(i8* undef, i8* undef)
+  call void @b.init(i8* undef, i8* undef)
+  ret void
+}
+
+; func Register(name string, fn func()) {
+;     handlers = append(handlers, Handler{name, fn})
+; }
+define internal void @registry.Register(i8* %name.data, i64 %name.len, i8* %fn.context, void (i8*, i8*)* %fn.ptr, i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %varargs.raw = call i8* @runtime.alloc(i64 32)
+  %varargs = bitcast i8* %varargs.raw to [1 x %registry.Handler]*
+  %elem = getelementptr inbounds [1 x %registry.Handler], [1 x %registry.Handler]* %varargs, i64 0, i64 0
+  %name.0 = insertvalue %runtime._string undef, i8* %name.data, 0
+  %name = insertvalue %runtime._string %name.0, i64 %name.len, 1
+  %fn.0 = insertvalue { i8*, void (i8*, i8*)* } undef, i8* %fn.context, 0
+  %fn = insertvalue { i8*, void (i8*, i8*)* } %fn.0, void (i8*, i8*)* %fn.ptr, 1
+  %handler.0 = insertvalue %registry.Handler undef, %runtime._string %name, 0
+  %handler = insertvalue %registry.Handler %handler.0, { i8*, void (i8*, i8*)* } %fn, 1
+  store %registry.Handler %handler, %registry.Handler* %elem
+  %handlers = load %registry.slice, %registry.slice* @registry.handlers
+  %append.srcBuf = extractvalue %registry.slice %handlers, 0
+  %append.srcPtr = bitcast %registry.Handler* %append.srcBuf to i8*
+  %append.srcLen = extractvalue %registry.slice %handlers, 1
+  %append.srcCap = extractvalue %registry.slice %handlers, 2
+  %append.elemsPtr = bitcast %registry.Handler* %elem to i8*
+  %append.new = call { i8*, i64, i64 } @runtime.sliceAppend(i8* %append.srcPtr, i8* %append.elemsPtr, i64 %append.srcLen, i64 %append.srcCap, i64 1, i64 32)
+  %append.newPtr = extractvalue { i8*, i64, i64 } %append.new, 0
+  %append.newBuf = bitcast i8* %append.newPtr to %registry.Handler*
+  %append.newLen = extractvalue { i8*, i64, i64 } %append.new, 1
+  %append.newCap = extractvalue { i8*, i64, i64 } %append.new, 2
+  %new.0 = insertvalue %registry.slice undef, %registry.Handler* %append.newBuf, 0
+  %new.1 = insertvalue %registry.slice %new.0, i64 %append.newLen, 1
+  %new = insertvalue %registry.slice %new.1, i64 %append.newCap, 2
+  store %registry.slice %new, %registry.slice* @registry.handlers
+  ret void
+}
+
+define internal void @a.handle(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret void
+}
+
+define internal void @b.handle(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ret void
+}
+
+; func init() { registry.Register("alpha", handle) }
+define internal void @a.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void @registry.Register(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @a.name, i32 0, i32 0), i64 5, i8* null, void (i8*, i8*)* @a.handle, i8* undef, i8* undef)
+  ret void
+}
+
+; func init() { registry.Register("bravo", handle) }
+define internal void @b.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void @registry.Register(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @b.name, i32 0, i32 0), i64 5, i8* null, void (i8*, i8*)* @b.handle, i8* undef, i8* undef)
+  ret void
+}
@@ -0,0 +1,33 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@a.x = global i64 1
+@a.buf = global i64 2
+@a.ptr = global i64* @a.buf
+@b.x = global i64 0
+@b.buf = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @a.init(i8* undef, i8* undef)
+  call void @b.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @a.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i64 3, i64* @a.x
+  %ptr = load i64*, i64** @a.ptr
+  store i64 4, i64* %ptr
+  call void asm sideeffect "", ""()
+  ret void
+}
+
+define internal void @b.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %x = load i64, i64* @a.x
+  store i64 %x, i64* @b.x
+  %buf = load i64, i64* @a.buf
+  store i64 %buf, i64* @b.buf
+  ret void
+}
@@ -0,0 +1,45 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+
+@a.name = global [5 x i8] c"hello"
+@b.greeting = global %runtime._string zeroinitializer
+@c.greeting = global %runtime._string zeroinitializer
+@main.str.world = internal constant [6 x i8] c" world"
+
+declare %runtime._string @runtime.stringConcat(i8*, i64, i8*, i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @a.init(i8* undef, i8* undef)
+  call void @b.init(i8* undef, i8* undef)
+  call void @c.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Modifies @a.name, then executes inline assembly, which cannot be
+; interpreted.
+define internal void @a.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i8 72, i8* getelementptr inbounds ([5 x i8], [5 x i8]* @a.name, i32 0, i32 0)
+  call void asm sideeffect "", ""()
+  ret void
+}
+
+; Reads @a.name, which is only initialized at runtime. This init must be run at
+; runtime as well, instead of concatenating the initial value of @a.name.
+define internal void @b.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %greeting = call %runtime._string @runtime.stringConcat(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @a.name, i32 0, i32 0), i64 5, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @main.str.world, i32 0, i32 0), i64 6)
+  store %runtime._string %greeting, %runtime._string* @b.greeting
+  ret void
+}
+
+; Doesn't depend on @a.name, so can still be interpreted.
+define internal void @c.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %greeting = call %runtime._string @runtime.stringConcat(i8* getelementptr inbounds ([6 x i8], [6 x i8]* @main.str.world, i32 0, i32 0), i64 6, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @main.str.world, i32 0, i32 0), i64 6)
+  store %runtime._string %greeting, %runtime._string* @c.greeting
+  ret void
+}
@@ -0,0 +1,25 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@a.callback = global void ()* null
+@b.x = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @a.init(i8* undef, i8* undef)
+  call void @b.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @a.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %callback = load void ()*, void ()** @a.callback
+  call void %callback()
+  ret void
+}
+
+define internal void @b.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i64 5, i64* @b.x
+  ret void
+}
@@ -0,0 +1,31 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = global i64 0
+@main.b = global i64 0
+@main.c = global i64 0
+@other.x = constant i64 7
+
+declare void @externalCall(i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i64 3, i64* @main.a
+  store i64 5, i64* @main.b
+  %value = call i64 asm sideeffect "", "=r"()
+  store i64 %value, i64* @main.c
+  ret void
+}
+
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  call void @externalCall(i64 7)
+  ret void
+}
@@ -0,0 +1,26 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = global i64 0
+@other.x = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Could be interpreted, but is marked to be run at runtime.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr "tinygo-runtimeinit" {
+entry:
+  store i64 3, i64* @main.a
+  ret void
+}
+
+; Interpreted normally.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i64 7, i64* @other.x
+  ret void
+}
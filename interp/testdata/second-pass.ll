@@ -0,0 +1,35 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = global i64 0
+@other.x = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Calls a function containing a select instruction, which cannot be
+; interpreted. Once @main.get is inlined, the select is folded and this init can
+; be interpreted in the second pass.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr noinline {
+entry:
+  %value = call i64 @main.get(i1 true)
+  store i64 %value, i64* @main.a
+  ret void
+}
+
+define internal i64 @main.get(i1 %cond) unnamed_addr {
+entry:
+  %value = select i1 %cond, i64 5, i64 3
+  ret i64 %value
+}
+
+; Interpreted in the first pass already.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i64 7, i64* @other.x
+  ret void
+}
@@ -0,0 +1,10 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = constant i64 5
+@other.x = constant i64 7
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
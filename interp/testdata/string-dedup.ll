@@ -0,0 +1,33 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+
+@a.hello = global %runtime._string zeroinitializer
+@b.hello = global %runtime._string zeroinitializer
+@main.str.hello = internal constant [5 x i8] c"hello"
+@main.str.world = internal constant [6 x i8] c" world"
+
+declare %runtime._string @runtime.stringConcat(i8*, i64, i8*, i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @a.init(i8* undef, i8* undef)
+  call void @b.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Both packages build the same string, which should be stored only once.
+define internal void @a.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %hello = call %runtime._string @runtime.stringConcat(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @main.str.hello, i32 0, i32 0), i64 5, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @main.str.world, i32 0, i32 0), i64 6)
+  store %runtime._string %hello, %runtime._string* @a.hello
+  ret void
+}
+
+define internal void @b.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %hello = call %runtime._string @runtime.stringConcat(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @main.str.hello, i32 0, i32 0), i64 5, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @main.str.world, i32 0, i32 0), i64 6)
+  store %runtime._string %hello, %runtime._string* @b.hello
+  ret void
+}
@@ -0,0 +1,17 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+
+@a.hello = constant %runtime._string { i8* getelementptr inbounds ([11 x i8], [11 x i8]* @"a$stringconcat", i32 0, i32 0), i64 11 }
+@b.hello = constant %runtime._string { i8* getelementptr inbounds ([11 x i8], [11 x i8]* @"a$stringconcat", i32 0, i32 0), i64 11 }
+@main.str.hello = internal constant [5 x i8] c"hello"
+@main.str.world = internal constant [6 x i8] c" world"
+@"a$stringconcat" = internal unnamed_addr constant [11 x i8] c"hello world"
+
+declare %runtime._string @runtime.stringConcat(i8*, i64, i8*, i64)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
@@ -0,0 +1,79 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+
+@"main.init$string" = internal unnamed_addr constant [6 x i8] c"tinygo"
+@main.name = global %runtime._string { i8* getelementptr inbounds ([6 x i8], [6 x i8]* @"main.init$string", i32 0, i32 0), i64 6 }
+@main.last = global i8 0
+@main.suffix = global %runtime._string zeroinitializer
+
+declare void @runtime.lookupPanic(i8*, i8*)
+declare void @runtime.slicePanic(i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Equivalent to:
+;
+;     func init() {
+;         last = name[len(name)-1]
+;         suffix = name[4:]
+;     }
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %name = load %runtime._string, %runtime._string* @main.name
+  %len = extractvalue %runtime._string %name, 1
+  %index = sub i64 %len, 1
+  %lookup.outofbounds = icmp uge i64 %index, %len
+  br i1 %lookup.outofbounds, label %lookup.outofbounds, label %lookup.next
+
+lookup.outofbounds:
+  call void @runtime.lookupPanic(i8* undef, i8* undef)
+  unreachable
+
+lookup.next:
+  %buf = extractvalue %runtime._string %name, 0
+  %last.ptr = getelementptr inbounds i8, i8* %buf, i64 %index
+  %last = load i8, i8* %last.ptr
+  store i8 %last, i8* @main.last
+  %slice.lowhigh = icmp ugt i64 4, %len
+  %slice.highmax = icmp ugt i64 %len, %len
+  %slice.outofbounds = or i1 %slice.lowhigh, %slice.highmax
+  br i1 %slice.outofbounds, label %slice.outofbounds, label %slice.next
+
+slice.outofbounds:
+  call void @runtime.slicePanic(i8* undef, i8* undef)
+  unreachable
+
+slice.next:
+  %suffix.ptr = getelementptr inbounds i8, i8* %buf, i64 4
+  %suffix.len = sub i64 %len, 4
+  %suffix.0 = insertvalue %runtime._string undef, i8* %suffix.ptr, 0
+  %suffix.1 = insertvalue %runtime._string %suffix.0, i64 %suffix.len, 1
+  store %runtime._string %suffix.1, %runtime._string* @main.suffix
+  ret void
+}
+
+; Equivalent to:
+;
+;     func outOfRange() {
+;         _ = name[len(name)]
+;     }
+define internal void @main.outOfRange(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %name = load %runtime._string, %runtime._string* @main.name
+  %len = extractvalue %runtime._string %name, 1
+  %lookup.outofbounds = icmp uge i64 %len, %len
+  br i1 %lookup.outofbounds, label %lookup.outofbounds, label %lookup.next
+
+lookup.outofbounds:
+  call void @runtime.lookupPanic(i8* undef, i8* undef)
+  unreachable
+
+lookup.next:
+  ret void
+}
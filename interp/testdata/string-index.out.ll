@@ -0,0 +1,37 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%runtime._string = type { i8*, i64 }
+
+@"main.init$string" = internal unnamed_addr constant [6 x i8] c"tinygo"
+@main.name = global %runtime._string { i8* getelementptr inbounds ([6 x i8], [6 x i8]* @"main.init$string", i32 0, i32 0), i64 6 }
+@main.last = constant i8 111
+@main.suffix = constant %runtime._string { i8* getelementptr inbounds ([6 x i8], [6 x i8]* @"main.init$string", i32 0, i32 4), i64 2 }
+
+declare void @runtime.lookupPanic(i8*, i8*)
+declare void @runtime.slicePanic(i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
+
+; Equivalent to:
+;
+;     func outOfRange() {
+;         _ = name[len(name)]
+;     }
+define internal void @main.outOfRange(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %name = load %runtime._string, %runtime._string* @main.name
+  %len = extractvalue %runtime._string %name, 1
+  %lookup.outofbounds = icmp uge i64 %len, %len
+  br i1 %lookup.outofbounds, label %lookup.outofbounds, label %lookup.next
+
+lookup.outofbounds:
+  call void @runtime.lookupPanic(i8* undef, i8* undef)
+  unreachable
+
+lookup.next:
+  ret void
+}
@@ -0,0 +1,29 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@a.x = global i64 0
+@b.y = constant i64 2
+@c.z = global i64 0
+
+declare void @runtime._panic(i8*, i8*)
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @a.init(i8* undef, i8* undef)
+  call void @c.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @a.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  store i64 1, i64* @a.x
+  call void @runtime._panic(i8* undef, i8* undef)
+  unreachable
+}
+
+define internal void @c.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %x = load i64, i64* @a.x
+  store i64 %x, i64* @c.z
+  ret void
+}
@@ -0,0 +1,40 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.table = linkonce_odr constant [2 x i32] [i32 3, i32 4]
+@main.x = global i32 0
+@main.hook = global i32 0
+@other.weak = weak global i32 5
+@other.y = global i32 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  call void @other.init(i8* undef, i8* undef)
+  ret void
+}
+
+; A weak function may be replaced at link time, so it must be called at
+; runtime.
+define weak i32 @main.getHook() {
+entry:
+  ret i32 7
+}
+
+; Reading from a linkonce_odr constant is fine: all definitions are the same.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %x = load i32, i32* getelementptr inbounds ([2 x i32], [2 x i32]* @main.table, i32 0, i32 1)
+  store i32 %x, i32* @main.x
+  %hook = call i32 @main.getHook()
+  store i32 %hook, i32* @main.hook
+  ret void
+}
+
+; Reading from a weak global is not: a different definition may be used.
+define internal void @other.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %y = load i32, i32* @other.weak
+  store i32 %y, i32* @other.y
+  ret void
+}
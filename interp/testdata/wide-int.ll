@@ -0,0 +1,57 @@
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.hash = global i64 0
+@main.product = global i128 0
+@main.high = global i32 0
+@main.packed = global i24 0
+@main.packedByte = global i8 0
+@main.parity = global i1 false
+@main.count = global i128 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  ; Hash mixing using a 64x64->128 bit multiply, as in wyhash:
+  ; hi, lo := bits.Mul64(x, k); hash = hi ^ lo
+  %x = zext i64 -7046029254386353131 to i128
+  %m = mul i128 %x, 11400714819323198485
+  store i128 %m, i128* @main.product
+  %m.hi = lshr i128 %m, 64
+  %hi = trunc i128 %m.hi to i64
+  %lo = trunc i128 %m to i64
+  %hash = xor i64 %hi, %lo
+  store i64 %hash, i64* @main.hash
+
+  ; Read part of a 128-bit value through a different type.
+  %high.ptr = getelementptr i32, i32* bitcast (i128* @main.product to i32*), i64 3
+  %high = load i32, i32* %high.ptr
+  store i32 %high, i32* @main.high
+
+  ; Bitfield packing in a 24-bit integer.
+  %a = zext i8 5 to i24
+  %b = zext i8 200 to i24
+  %b.shifted = shl i24 %b, 12
+  %packed = or i24 %a, %b.shifted
+  %packed.wrapped = add i24 %packed, 16773120 ; wraps around
+  store i24 %packed.wrapped, i24* @main.packed
+  %byte.ptr = getelementptr i8, i8* bitcast (i24* @main.packed to i8*), i64 2
+  %byte = load i8, i8* %byte.ptr
+  store i8 %byte, i8* @main.packedByte
+
+  ; Arithmetic on i1 values other than booleans wraps around as well.
+  %parity = add i1 true, true
+  %parity.not = xor i1 %parity, true
+  store i1 %parity.not, i1* @main.parity
+
+  ; Sign extension to a wide integer, followed by a wrapping subtraction.
+  %neg = sext i32 -1 to i128
+  %count = sub i128 %neg, 18446744073709551615
+  store i128 %count, i128* @main.count
+  ret void
+}
@@ -0,0 +1,15 @@
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.hash = constant i64 -4716206262453413295
+@main.product = constant i128 129976298391535590275940155690706295225
+@main.high = constant i32 1640531526
+@main.packed = constant i24 815109
+@main.packedByte = constant i8 12
+@main.parity = constant i1 true
+@main.count = constant i128 -18446744073709551616
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
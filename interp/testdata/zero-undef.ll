@@ -0,0 +1,50 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.state = type { i32, i64 }
+
+@main.state = global %main.state zeroinitializer
+@main.seed = global i64 42
+@main.counter = global i32 undef
+@main.partial = global { i32, i32 } { i32 undef, i32 5 }
+@main.partialCopy = global i64 0
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  call void @main.init(i8* undef, i8* undef)
+  ret void
+}
+
+; Reads from globals that are (partially) zero or undef before they are
+; written. Undef memory is read as zero.
+define internal void @main.init(i8* %context, i8* %parentHandle) unnamed_addr {
+entry:
+  %count.ptr = getelementptr inbounds %main.state, %main.state* @main.state, i64 0, i32 1
+  %count = load i64, i64* %count.ptr
+  %isZero = icmp eq i64 %count, 0
+  br i1 %isZero, label %seed, label %flags
+
+seed:
+  %seed = load i64, i64* @main.seed
+  store i64 %seed, i64* %count.ptr
+  br label %flags
+
+flags:
+  %flags.ptr = getelementptr inbounds %main.state, %main.state* @main.state, i64 0, i32 0
+  %flags = load i32, i32* %flags.ptr
+  %newFlags = or i32 %flags, 4
+  store i32 %newFlags, i32* %flags.ptr
+  %counter = load i32, i32* @main.counter
+  %counterIsZero = icmp eq i32 %counter, 0
+  br i1 %counterIsZero, label %increment, label %partial
+
+increment:
+  %next = add i32 %counter, 1
+  store i32 %next, i32* @main.counter
+  br label %partial
+
+partial:
+  %partial = load i64, i64* bitcast ({ i32, i32 }* @main.partial to i64*)
+  store i64 %partial, i64* @main.partialCopy
+  ret void
+}
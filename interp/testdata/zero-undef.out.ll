@@ -0,0 +1,15 @@
+target datalayout = "e-m:e-p:64:64-i64:64-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+%main.state = type { i32, i64 }
+
+@main.state = constant %main.state { i32 4, i64 42 }
+@main.seed = global i64 42
+@main.counter = constant i32 1
+@main.partial = global { i32, i32 } { i32 undef, i32 5 }
+@main.partialCopy = constant i64 21474836480
+
+define void @runtime.initAll() unnamed_addr {
+entry:
+  ret void
+}
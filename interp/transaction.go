@@ -0,0 +1,301 @@
+package interp
+
+// This file keeps track of all changes made to the module while interpreting a
+// single package initializer, so that they can be undone when the initializer
+// turns out to be impossible to interpret at compile time.
+
+import (
+	"fmt"
+	"strconv"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// transaction records the changes made to the module during the interpretation
+// of a single package initializer. All changes are applied directly to the
+// module, but enough information is kept to restore the module to the state it
+// had before the initializer started running.
+type transaction struct {
+	// Instruction just before the first instruction emitted for runtime
+	// execution in this transaction, or nil if there was no such instruction.
+	start llvm.Value
+
+	// Instruction before which all runtime instructions are inserted.
+	end llvm.Value
+
+	// The initializers of globals as they were before the transaction started,
+	// for all globals that have been modified since.
+	initializers map[llvm.Value]llvm.Value
+
+	// The alignment of globals as it was before the transaction started, for
+	// all existing globals whose alignment was raised since.
+	alignments map[llvm.Value]int
+
+	// Globals created during this transaction, in creation order.
+	globals   []llvm.Value
+	globalSet map[llvm.Value]struct{}
+
+	// Number of bytes of global data created during this transaction,
+	// including globals that were removed again.
+	memory uint64
+}
+
+// begin starts a new transaction. All runtime instructions emitted from now on
+// must be inserted before the end instruction.
+func (e *Eval) begin(end llvm.Value) {
+	e.tx = &transaction{
+		start:        llvm.PrevInstruction(end),
+		end:          end,
+		initializers: map[llvm.Value]llvm.Value{},
+		alignments:   map[llvm.Value]int{},
+		globalSet:    map[llvm.Value]struct{}{},
+	}
+	e.builder.SetInsertPointBefore(end)
+}
+
+// commit makes all changes in the current transaction permanent. Globals that
+// were created in this transaction but ended up unreferenced (such as heap
+// allocations that were only used temporarily) are removed.
+func (e *Eval) commit() {
+	for global := range e.tx.initializers {
+		e.writtenGlobals[global] = struct{}{}
+	}
+	unreachable := unreachableGlobals(e.tx.globals)
+	for i := len(e.tx.globals) - 1; i >= 0; i-- {
+		if _, ok := unreachable[e.tx.globals[i]]; ok {
+			e.removeGlobal(e.tx.globals[i])
+		}
+	}
+	e.stats.GlobalsCreated += len(e.tx.globals)
+	for _, global := range e.tx.globals {
+		e.totalMemory += e.TargetData.TypeAllocSize(global.Type().ElementType())
+	}
+	e.createdGlobals = append(e.createdGlobals, e.tx.globals...)
+	e.tx = nil
+}
+
+// rollback undoes all changes made in the current transaction: it removes all
+// instructions emitted for runtime execution, restores the initializers of all
+// modified globals and removes all created globals. Globals that were marked
+// dirty stay dirty: the init function will be run at runtime instead, where it
+// may well modify them again.
+func (e *Eval) rollback() {
+	tx := e.tx
+	e.tx = nil
+
+	// Remove emitted instructions, in reverse order so that no instruction is
+	// removed while it is still in use.
+	for inst := llvm.PrevInstruction(tx.end); inst != tx.start; inst = llvm.PrevInstruction(tx.end) {
+		inst.EraseFromParentAsInstruction()
+	}
+
+	// Restore modified globals.
+	for global, initializer := range tx.initializers {
+		global.SetInitializer(initializer)
+	}
+	for global, align := range tx.alignments {
+		global.SetAlignment(align)
+	}
+
+	// Remove created globals. Any remaining references to them are in other
+	// created globals that are about to be removed as well, or in unused
+	// constant expressions.
+	for i := len(tx.globals) - 1; i >= 0; i-- {
+		global := tx.globals[i]
+		e.forgetConstantGlobal(global)
+		global.ReplaceAllUsesWith(llvm.Undef(global.Type()))
+		global.EraseFromParentAsGlobal()
+	}
+
+	// Created globals may have been marked dirty.
+	for _, global := range tx.globals {
+		delete(e.dirtyGlobals, global)
+	}
+	e.sideEffectFuncs = nil // re-calculate all side effects
+}
+
+// addGlobal creates a new global with internal linkage, which will be removed
+// again when the current transaction is rolled back. The name is made unique
+// by adding a number that only depends on the order in which globals are
+// created, so that the output is the same on every build.
+func (e *Eval) addGlobal(t llvm.Type, name string) llvm.Value {
+	n := e.globalNames[name]
+	e.globalNames[name] = n + 1
+	if n != 0 {
+		name += "." + strconv.Itoa(n)
+	}
+	global := llvm.AddGlobal(e.Mod, t, name)
+	global.SetLinkage(llvm.InternalLinkage)
+	if e.tx != nil {
+		e.tx.globals = append(e.tx.globals, global)
+		e.tx.globalSet[global] = struct{}{}
+		e.tx.memory += e.TargetData.TypeAllocSize(t)
+	}
+	return global
+}
+
+// checkMemory returns a *Diagnostic if the globals created in the current
+// transaction exceed MaxMemory or MaxTotalMemory, and nil otherwise. The given
+// instruction is reported as the offending value.
+func (e *Eval) checkMemory(inst llvm.Value) *Diagnostic {
+	if e.tx == nil {
+		return nil
+	}
+	if e.MaxMemory > 0 && e.tx.memory > e.MaxMemory {
+		return newDiagnostic(Budget, inst, fmt.Sprintf("exceeded the limit of %d bytes of memory per package initializer", e.MaxMemory))
+	}
+	if e.MaxTotalMemory > 0 && e.totalMemory+e.tx.memory > e.MaxTotalMemory {
+		return newDiagnostic(Budget, inst, fmt.Sprintf("exceeded the limit of %d bytes of memory for all package initializers", e.MaxTotalMemory))
+	}
+	return nil
+}
+
+// addConstantGlobal returns a read-only global with the given initializer, for
+// data that is never written such as the result of a string concatenation.
+// These globals are unnamed_addr so their address is not significant: a global
+// created earlier with the same initializer (and thus the same type and
+// content) is reused instead of creating a new one.
+func (e *Eval) addConstantGlobal(initializer llvm.Value, name string) llvm.Value {
+	if global, ok := e.constantGlobals[initializer]; ok {
+		return global
+	}
+	global := e.addGlobal(initializer.Type(), name)
+	global.SetInitializer(initializer)
+	global.SetGlobalConstant(true)
+	global.SetUnnamedAddr(true)
+	e.constantGlobals[initializer] = global
+	return global
+}
+
+// forgetConstantGlobal makes sure the given global, which is about to be
+// removed, is not reused by addConstantGlobal anymore.
+func (e *Eval) forgetConstantGlobal(global llvm.Value) {
+	if !global.IsGlobalConstant() {
+		return
+	}
+	if initializer := global.Initializer(); e.constantGlobals[initializer] == global {
+		delete(e.constantGlobals, initializer)
+	}
+}
+
+// removeGlobal removes a global that was created during the current
+// transaction and turned out not to be needed.
+func (e *Eval) removeGlobal(global llvm.Value) {
+	if e.tx != nil {
+		if _, ok := e.tx.globalSet[global]; !ok {
+			panic("interp: removing a global that was not created in this transaction")
+		}
+		delete(e.tx.globalSet, global)
+		for i, g := range e.tx.globals {
+			if g == global {
+				e.tx.globals = append(e.tx.globals[:i], e.tx.globals[i+1:]...)
+				break
+			}
+		}
+	}
+	delete(e.dirtyGlobals, global)
+	delete(e.writtenGlobals, global)
+	e.forgetConstantGlobal(global)
+	global.ReplaceAllUsesWith(llvm.Undef(global.Type()))
+	global.EraseFromParentAsGlobal()
+}
+
+// removeUnreferencedGlobals removes globals created by committed transactions
+// that are not referenced anymore. For example, the old backing array of a
+// slice that was grown by a later package initializer.
+func (e *Eval) removeUnreferencedGlobals() {
+	unreachable := unreachableGlobals(e.createdGlobals)
+	remaining := e.createdGlobals[:0]
+	for _, global := range e.createdGlobals {
+		if _, ok := unreachable[global]; !ok {
+			remaining = append(remaining, global)
+			continue
+		}
+		e.removeGlobal(global)
+		e.stats.GlobalsCreated--
+	}
+	e.createdGlobals = remaining
+}
+
+// unreachableGlobals returns the given globals that can't be reached from code
+// or from any other global, except through other unreachable globals. Unlike
+// checking each global with isReferenced, this also finds globals that refer
+// to each other, such as the nodes of a linked list that was only used
+// temporarily.
+func unreachableGlobals(globals []llvm.Value) map[llvm.Value]struct{} {
+	unreachable := make(map[llvm.Value]struct{}, len(globals))
+	for _, global := range globals {
+		unreachable[global] = struct{}{}
+	}
+
+	// Find the globals that are referenced from outside the given set, and
+	// remember which globals in the set refer to each other.
+	references := make(map[llvm.Value][]llvm.Value)
+	var worklist []llvm.Value
+	for _, global := range globals {
+		users, usedByCode := globalUsers(global, nil)
+		reachable := usedByCode
+		for _, user := range users {
+			if _, ok := unreachable[user]; !ok {
+				reachable = true
+			} else if user != global {
+				references[user] = append(references[user], global)
+			}
+		}
+		if reachable {
+			worklist = append(worklist, global)
+		}
+	}
+
+	// Everything referenced from a reachable global is reachable as well.
+	for len(worklist) != 0 {
+		global := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if _, ok := unreachable[global]; !ok {
+			continue
+		}
+		delete(unreachable, global)
+		worklist = append(worklist, references[global]...)
+	}
+	return unreachable
+}
+
+// setInitializer replaces the initializer of the given global, remembering the
+// old initializer in case the current transaction is rolled back.
+func (e *Eval) setInitializer(global, initializer llvm.Value) {
+	if e.tx != nil {
+		if _, ok := e.tx.globalSet[global]; !ok {
+			if _, ok := e.tx.initializers[global]; !ok {
+				e.tx.initializers[global] = global.Initializer()
+			}
+		}
+	}
+	global.SetInitializer(initializer)
+}
+
+// raiseAlignment makes sure the given global is aligned to at least align
+// bytes, remembering the old alignment in case the current transaction is
+// rolled back.
+func (e *Eval) raiseAlignment(global llvm.Value, align int) {
+	if global.Alignment() >= align {
+		return
+	}
+	if e.tx != nil {
+		if _, ok := e.tx.globalSet[global]; !ok {
+			if _, ok := e.tx.alignments[global]; !ok {
+				e.tx.alignments[global] = global.Alignment()
+			}
+		}
+	}
+	global.SetAlignment(align)
+}
+
+// setDirty marks the given global as dirty. Unlike other changes, this is not
+// undone when the current transaction is rolled back.
+func (e *Eval) setDirty(global llvm.Value) {
+	if _, ok := e.dirtyGlobals[global]; ok {
+		return
+	}
+	e.dirtyGlobals[global] = struct{}{}
+	e.sideEffectFuncs = nil // re-calculate all side effects
+}
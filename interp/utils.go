@@ -1,6 +1,9 @@
 package interp
 
 import (
+	"math"
+	"strings"
+
 	"tinygo.org/x/go-llvm"
 )
 
@@ -16,18 +19,169 @@ func getUses(value llvm.Value) []llvm.Value {
 	return uses
 }
 
+// isReferenced returns whether the value is used by an instruction or by the
+// initializer of a global, either directly or through constant expressions.
+// Constant expressions that are not used anywhere are ignored.
+func isReferenced(value llvm.Value) bool {
+	for use := value.FirstUse(); !use.IsNil(); use = use.NextUse() {
+		user := use.User()
+		if !user.IsAInstruction().IsNil() || !user.IsAGlobalVariable().IsNil() {
+			return true
+		}
+		if isReferenced(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// globalUsers returns the globals with an initializer that uses the given
+// value, either directly or through constant expressions. The second return
+// value reports whether the value is used by an instruction as well.
+func globalUsers(value llvm.Value, users []llvm.Value) ([]llvm.Value, bool) {
+	usedByCode := false
+	for use := value.FirstUse(); !use.IsNil(); use = use.NextUse() {
+		user := use.User()
+		switch {
+		case !user.IsAInstruction().IsNil():
+			usedByCode = true
+		case !user.IsAGlobalVariable().IsNil():
+			users = append(users, user)
+		default:
+			var ok bool
+			users, ok = globalUsers(user, users)
+			usedByCode = usedByCode || ok
+		}
+	}
+	return users, usedByCode
+}
+
+// isReadOnly returns whether the given global is only ever loaded from, either
+// directly or through constant expressions such as a bitcast or getelementptr.
+// Any other use, such as a store or passing the pointer to a function, may
+// modify the global.
+func isReadOnly(global llvm.Value) bool {
+	for use := global.FirstUse(); !use.IsNil(); use = use.NextUse() {
+		user := use.User()
+		switch {
+		case !user.IsALoadInst().IsNil():
+			// Loads don't modify memory.
+		case !user.IsAConstantExpr().IsNil() && (user.Opcode() == llvm.BitCast || user.Opcode() == llvm.GetElementPtr):
+			if !isReadOnly(user) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isWeak returns whether the definition of the given global or function may be
+// replaced with a different definition at link time, like a weak symbol.
+func isWeak(v llvm.Value) bool {
+	switch v.Linkage() {
+	case llvm.LinkOnceAnyLinkage, llvm.LinkOnceODRLinkage, llvm.WeakAnyLinkage, llvm.WeakODRLinkage, llvm.ExternalWeakLinkage, llvm.CommonLinkage:
+		return true
+	default:
+		return false
+	}
+}
+
+// isODR returns whether the given global or function has a linkage where other
+// definitions it may be replaced with are known to be equivalent (the one
+// definition rule), like linkonce_odr.
+func isODR(v llvm.Value) bool {
+	switch v.Linkage() {
+	case llvm.LinkOnceODRLinkage, llvm.WeakODRLinkage:
+		return true
+	default:
+		return false
+	}
+}
+
+// isVolatileIntrinsic returns whether the given call to llvm.memcpy,
+// llvm.memmove or llvm.memset has its isvolatile flag set.
+func isVolatileIntrinsic(call llvm.Value) bool {
+	isVolatile := call.Operand(call.OperandsCount() - 2)
+	return isVolatile.IsAConstantInt().IsNil() || isVolatile.ZExtValue() != 0
+}
+
+// runtimeIntrinsics lists the LLVM intrinsics (without type suffix) that are
+// not evaluated at compile time, but can be called at runtime like an external
+// function when their operands are not known.
+var runtimeIntrinsics = map[string]struct{}{
+	"llvm.assume":             {},
+	"llvm.expect":             {},
+	"llvm.sadd.with.overflow": {},
+	"llvm.uadd.with.overflow": {},
+	"llvm.ssub.with.overflow": {},
+	"llvm.usub.with.overflow": {},
+	"llvm.smul.with.overflow": {},
+	"llvm.umul.with.overflow": {},
+	"llvm.smax":               {},
+	"llvm.smin":               {},
+	"llvm.umax":               {},
+	"llvm.umin":               {},
+	"llvm.abs":                {},
+	"llvm.fshl":               {},
+	"llvm.fshr":               {},
+}
+
+// isRuntimeIntrinsic returns whether the given intrinsic may be called at
+// runtime from a residual function, see runtimeIntrinsics. Pure intrinsics and
+// llvm.memcpy and friends are also included.
+func isRuntimeIntrinsic(fn llvm.Value) bool {
+	if getPureFunction(fn) != nil {
+		return true
+	}
+	name := fn.Name()
+	if strings.HasPrefix(name, "llvm.memcpy.") || strings.HasPrefix(name, "llvm.memmove.") || strings.HasPrefix(name, "llvm.memset.") {
+		return true
+	}
+	if _, ok := runtimeIntrinsics[name]; ok {
+		return true
+	}
+	// Strip the type suffix of an overloaded intrinsic.
+	if index := strings.LastIndexByte(name, '.'); index > 0 {
+		_, ok := runtimeIntrinsics[name[:index]]
+		return ok
+	}
+	return false
+}
+
+// isFixedAddress returns whether the given pointer is derived from a fixed
+// integer address, which usually means it points to a memory-mapped I/O
+// register. Accesses through such a pointer must happen at runtime.
+func isFixedAddress(ptr llvm.Value) bool {
+	for !ptr.IsAConstantExpr().IsNil() {
+		switch ptr.Opcode() {
+		case llvm.IntToPtr:
+			return !ptr.Operand(0).IsAConstantInt().IsNil()
+		case llvm.BitCast, llvm.GetElementPtr:
+			ptr = ptr.Operand(0)
+		default:
+			return false
+		}
+	}
+	return false
+}
+
 // getStringBytes loads the byte slice of a Go string represented as a
 // {ptr, len} pair.
-func getStringBytes(strPtr Value, strLen llvm.Value) []byte {
+func getStringBytes(strPtr Value, strLen llvm.Value) ([]byte, error) {
 	if !strLen.IsConstant() {
-		panic("getStringBytes with a non-constant length")
+		return nil, newDiagnostic(Unsupported, strLen, "string with a non-constant length")
 	}
 	buf := make([]byte, strLen.ZExtValue())
 	for i := range buf {
-		c := strPtr.GetElementPtr([]uint32{uint32(i)}).Load()
+		c, err := strPtr.GetElementPtr([]uint32{uint32(i)}).Load()
+		if err != nil {
+			return nil, err
+		}
 		buf[i] = byte(c.ZExtValue())
 	}
-	return buf
+	return buf, nil
 }
 
 // getLLVMIndices converts an []uint32 into an []llvm.Value, for use in
@@ -51,6 +205,29 @@ func isScalar(t llvm.Type) bool {
 	}
 }
 
+// floatFitsInt returns whether the float f, truncated towards zero, can be
+// represented in an integer of the given width. Converting a float that doesn't
+// fit (including NaN and infinities) results in a poison value in LLVM, while
+// the hardware either saturates or returns some fixed value depending on the
+// target.
+func floatFitsInt(f float64, width int, signed bool) bool {
+	if math.IsNaN(f) {
+		return false
+	}
+	f = math.Trunc(f)
+	if signed {
+		return f >= -math.Ldexp(1, width-1) && f < math.Ldexp(1, width-1)
+	}
+	return f >= 0 && f < math.Ldexp(1, width)
+}
+
+// floatOutOfRange returns a *Diagnostic for a float to integer conversion of a
+// value that doesn't fit in the integer type. The result of such a conversion
+// depends on the target, so the conversion must be done at runtime.
+func floatOutOfRange(inst, value llvm.Value) *Diagnostic {
+	return newDiagnostic(Unsupported, inst, "float out of range for conversion to integer: "+valueString(value))
+}
+
 // isPointerNil returns whether this is a nil pointer or not. The ok value
 // indicates whether the result is certain: if it is false the result boolean is
 // not valid.
@@ -14,8 +14,8 @@ type Value interface {
 	Value() llvm.Value            // returns a LLVM value
 	Type() llvm.Type              // equal to Value().Type()
 	IsConstant() bool             // returns true if this value is a constant value
-	Load() llvm.Value             // dereference a pointer
-	Store(llvm.Value)             // store to a pointer
+	Load() (llvm.Value, error)    // dereference a pointer
+	Store(llvm.Value) error       // store to a pointer
 	GetElementPtr([]uint32) Value // returns an interior pointer
 	String() string               // string representation, for debugging
 }
@@ -36,76 +36,47 @@ func (v *LocalValue) Type() llvm.Type {
 }
 
 func (v *LocalValue) IsConstant() bool {
-	if _, ok := v.Eval.dirtyGlobals[v.Underlying]; ok {
-		return false
+	if p, ok := v.Eval.getPointer(v.Underlying); ok {
+		if _, ok := v.Eval.dirtyGlobals[p.global]; ok {
+			return false
+		}
 	}
 	return v.Underlying.IsConstant()
 }
 
 // Load loads a constant value if this is a constant pointer.
-func (v *LocalValue) Load() llvm.Value {
-	if !v.Underlying.IsAGlobalVariable().IsNil() {
-		return v.Underlying.Initializer()
-	}
-	switch v.Underlying.Opcode() {
-	case llvm.GetElementPtr:
-		indices := v.getConstGEPIndices()
-		if indices[0] != 0 {
-			panic("invalid GEP")
-		}
-		global := v.Eval.getValue(v.Underlying.Operand(0))
-		agg := global.Load()
-		return llvm.ConstExtractValue(agg, indices[1:])
-	case llvm.BitCast:
-		panic("interp: load from a bitcast")
-	default:
-		panic("interp: load from a constant")
-	}
+func (v *LocalValue) Load() (llvm.Value, error) {
+	return v.Eval.load(v.Underlying, v.Underlying.Type().ElementType())
 }
 
 // Store stores to the underlying value if the value type is a pointer type,
-// otherwise it panics.
-func (v *LocalValue) Store(value llvm.Value) {
-	if !v.Underlying.IsAGlobalVariable().IsNil() {
-		if !value.IsConstant() {
-			v.MarkDirty()
-			v.Eval.builder.CreateStore(value, v.Underlying)
-		} else {
-			v.Underlying.SetInitializer(value)
-		}
-		return
-	}
-	switch v.Underlying.Opcode() {
-	case llvm.GetElementPtr:
-		indices := v.getConstGEPIndices()
-		if indices[0] != 0 {
-			panic("invalid GEP")
+// otherwise it returns an error. Stores of non-constant values are done at
+// runtime, marking the global stored to as dirty.
+func (v *LocalValue) Store(value llvm.Value) error {
+	if !value.IsConstant() {
+		p, ok := v.Eval.getPointer(v.Underlying)
+		if !ok {
+			return newDiagnostic(Unsupported, v.Underlying, "cannot store to unknown pointer: "+valueString(v.Underlying))
 		}
-		global := &LocalValue{v.Eval, v.Underlying.Operand(0)}
-		agg := global.Load()
-		agg = llvm.ConstInsertValue(agg, value, indices[1:])
-		global.Store(agg)
-		return
-	default:
-		panic("interp: store on a constant")
+		v.Eval.setDirty(p.global)
+		v.Eval.builder.CreateStore(value, v.Underlying)
+		return nil
 	}
+	return v.Eval.store(v.Underlying, value)
 }
 
 // GetElementPtr returns a GEP when the underlying value is of pointer type.
 func (v *LocalValue) GetElementPtr(indices []uint32) Value {
-	if !v.Underlying.IsAGlobalVariable().IsNil() {
-		int32Type := v.Underlying.Type().Context().Int32Type()
-		gep := llvm.ConstGEP(v.Underlying, getLLVMIndices(int32Type, indices))
-		return &LocalValue{v.Eval, gep}
+	if v.Underlying.Type().TypeKind() != llvm.PointerTypeKind {
+		panic("interp: GEP on a non-pointer")
 	}
-	switch v.Underlying.Opcode() {
-	case llvm.GetElementPtr, llvm.IntToPtr:
-		int32Type := v.Underlying.Type().Context().Int32Type()
-		llvmIndices := getLLVMIndices(int32Type, indices)
-		return &LocalValue{v.Eval, llvm.ConstGEP(v.Underlying, llvmIndices)}
-	default:
-		panic("interp: GEP on a constant")
+	int32Type := v.Underlying.Type().Context().Int32Type()
+	llvmIndices := getLLVMIndices(int32Type, indices)
+	if !v.Underlying.IsConstant() {
+		// Pointer only known at runtime.
+		return &LocalValue{v.Eval, v.Eval.builder.CreateGEP(v.Underlying, llvmIndices, "")}
 	}
+	return &LocalValue{v.Eval, llvm.ConstGEP(v.Underlying, llvmIndices)}
 }
 
 func (v *LocalValue) String() string {
@@ -116,17 +87,6 @@ func (v *LocalValue) String() string {
 	return "&LocalValue{Type: " + v.Type().String() + ", IsConstant: " + isConstant + "}"
 }
 
-// getConstGEPIndices returns indices of this constant GEP, if this is a GEP
-// instruction. If it is not, the behavior is undefined.
-func (v *LocalValue) getConstGEPIndices() []uint32 {
-	indices := make([]uint32, v.Underlying.OperandsCount()-1)
-	for i := range indices {
-		operand := v.Underlying.Operand(i + 1)
-		indices[i] = uint32(operand.ZExtValue())
-	}
-	return indices
-}
-
 // MarkDirty marks this global as dirty, meaning that every load from and store
 // to this global (from now on) must be performed at runtime.
 func (v *LocalValue) MarkDirty() {
@@ -136,7 +96,7 @@ func (v *LocalValue) MarkDirty() {
 	if !v.IsConstant() {
 		return // already dirty
 	}
-	v.Eval.dirtyGlobals[v.Underlying] = struct{}{}
+	v.Eval.setDirty(v.Underlying)
 }
 
 // MapValue implements a Go map which is created at compile time and stored as a
@@ -147,6 +107,7 @@ type MapValue struct {
 	Underlying llvm.Value
 	Keys       []Value
 	Values     []Value
+	keyBufs    [][]byte // raw key contents (used for hashing)
 	KeySize    int
 	ValueSize  int
 	KeyType    llvm.Type
@@ -163,9 +124,8 @@ func (v *MapValue) newBucket() llvm.Value {
 		llvm.ArrayType(v.ValueType, 8),    // value type
 	}, false)
 	bucketValue := llvm.ConstNull(bucketType)
-	bucket := llvm.AddGlobal(v.Eval.Mod, bucketType, v.PkgName+"$mapbucket")
+	bucket := v.Eval.addGlobal(bucketType, v.PkgName+"$mapbucket")
 	bucket.SetInitializer(bucketValue)
-	bucket.SetLinkage(llvm.InternalLinkage)
 	bucket.SetUnnamedAddr(true)
 	return bucket
 }
@@ -191,32 +151,9 @@ func (v *MapValue) Value() llvm.Value {
 	// Insert each key/value pair in the hashmap.
 	bucketGlobal := firstBucketGlobal
 	for i, key := range v.Keys {
-		var keyBuf []byte
 		llvmKey := key.Value()
 		llvmValue := v.Values[i].Value()
-		if key.Type().TypeKind() == llvm.StructTypeKind && key.Type().StructName() == "runtime._string" {
-			keyPtr := llvm.ConstExtractValue(llvmKey, []uint32{0})
-			keyLen := llvm.ConstExtractValue(llvmKey, []uint32{1})
-			keyPtrVal := v.Eval.getValue(keyPtr)
-			keyBuf = getStringBytes(keyPtrVal, keyLen)
-		} else if key.Type().TypeKind() == llvm.IntegerTypeKind {
-			keyBuf = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
-			n := key.Value().ZExtValue()
-			for i := range keyBuf {
-				keyBuf[i] = byte(n)
-				n >>= 8
-			}
-		} else if key.Type().TypeKind() == llvm.ArrayTypeKind &&
-			key.Type().ElementType().TypeKind() == llvm.IntegerTypeKind &&
-			key.Type().ElementType().IntTypeWidth() == 8 {
-			keyBuf = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
-			for i := range keyBuf {
-				keyBuf[i] = byte(llvm.ConstExtractValue(llvmKey, []uint32{uint32(i)}).ZExtValue())
-			}
-		} else {
-			panic("interp: map key type not implemented: " + key.Type().String())
-		}
-		hash := v.hash(keyBuf)
+		hash := v.hash(v.keyBufs[i])
 
 		if i%8 == 0 && i != 0 {
 			// Bucket is full, create a new one.
@@ -254,9 +191,8 @@ func (v *MapValue) Value() llvm.Value {
 	})
 
 	// Create a pointer to this hashmap.
-	hashmapPtr := llvm.AddGlobal(v.Eval.Mod, hashmap.Type(), v.PkgName+"$map")
+	hashmapPtr := v.Eval.addGlobal(hashmap.Type(), v.PkgName+"$map")
 	hashmapPtr.SetInitializer(hashmap)
-	hashmapPtr.SetLinkage(llvm.InternalLinkage)
 	hashmapPtr.SetUnnamedAddr(true)
 	v.Underlying = llvm.ConstInBoundsGEP(hashmapPtr, []llvm.Value{zero})
 	return v.Underlying
@@ -271,14 +207,15 @@ func (v *MapValue) IsConstant() bool {
 	return true // TODO: dirty maps
 }
 
-// Load panics: maps are of reference type so cannot be dereferenced.
-func (v *MapValue) Load() llvm.Value {
-	panic("interp: load from a map")
+// Load returns an error: maps are of reference type so cannot be
+// dereferenced.
+func (v *MapValue) Load() (llvm.Value, error) {
+	return llvm.Value{}, newDiagnostic(Unsupported, v.Underlying, "load from a map")
 }
 
-// Store panics: maps are of reference type so cannot be stored to.
-func (v *MapValue) Store(value llvm.Value) {
-	panic("interp: store on a map")
+// Store returns an error: maps are of reference type so cannot be stored to.
+func (v *MapValue) Store(value llvm.Value) error {
+	return newDiagnostic(Unsupported, v.Underlying, "store on a map")
 }
 
 // GetElementPtr panics: maps are of reference type so their (interior)
@@ -289,7 +226,7 @@ func (v *MapValue) GetElementPtr(indices []uint32) Value {
 
 // PutString does a map assign operation, assuming that the map is of type
 // map[string]T.
-func (v *MapValue) PutString(keyBuf, keyLen, valPtr *LocalValue) {
+func (v *MapValue) PutString(keyBuf, keyLen, valPtr *LocalValue) error {
 	if !v.Underlying.IsNil() {
 		panic("map already created")
 	}
@@ -297,7 +234,10 @@ func (v *MapValue) PutString(keyBuf, keyLen, valPtr *LocalValue) {
 	if valPtr.Underlying.Opcode() == llvm.BitCast {
 		valPtr = &LocalValue{v.Eval, valPtr.Underlying.Operand(0)}
 	}
-	value := valPtr.Load()
+	value, err := valPtr.Load()
+	if err != nil {
+		return err
+	}
 	if v.ValueType.IsNil() {
 		v.ValueType = value.Type()
 		if int(v.Eval.TargetData.TypeAllocSize(v.ValueType)) != v.ValueSize {
@@ -314,14 +254,20 @@ func (v *MapValue) PutString(keyBuf, keyLen, valPtr *LocalValue) {
 	key := llvm.ConstNull(keyType)
 	key = llvm.ConstInsertValue(key, keyBuf.Value(), []uint32{0})
 	key = llvm.ConstInsertValue(key, keyLen.Value(), []uint32{1})
+	keyBytes, err := getStringBytes(keyBuf, keyLen.Value())
+	if err != nil {
+		return err
+	}
 
 	// TODO: avoid duplicate keys
 	v.Keys = append(v.Keys, &LocalValue{v.Eval, key})
 	v.Values = append(v.Values, &LocalValue{v.Eval, value})
+	v.keyBufs = append(v.keyBufs, keyBytes)
+	return nil
 }
 
 // PutBinary does a map assign operation.
-func (v *MapValue) PutBinary(keyPtr, valPtr *LocalValue) {
+func (v *MapValue) PutBinary(keyPtr, valPtr *LocalValue) error {
 	if !v.Underlying.IsNil() {
 		panic("map already created")
 	}
@@ -329,7 +275,10 @@ func (v *MapValue) PutBinary(keyPtr, valPtr *LocalValue) {
 	if valPtr.Underlying.Opcode() == llvm.BitCast {
 		valPtr = &LocalValue{v.Eval, valPtr.Underlying.Operand(0)}
 	}
-	value := valPtr.Load()
+	value, err := valPtr.Load()
+	if err != nil {
+		return err
+	}
 	if v.ValueType.IsNil() {
 		v.ValueType = value.Type()
 		if int(v.Eval.TargetData.TypeAllocSize(v.ValueType)) != v.ValueSize {
@@ -346,7 +295,10 @@ func (v *MapValue) PutBinary(keyPtr, valPtr *LocalValue) {
 	} else if keyPtr.Underlying.Opcode() == llvm.GetElementPtr {
 		keyPtr = &LocalValue{v.Eval, keyPtr.Underlying.Operand(0)}
 	}
-	key := keyPtr.Load()
+	key, err := keyPtr.Load()
+	if err != nil {
+		return err
+	}
 	if v.KeyType.IsNil() {
 		v.KeyType = key.Type()
 		if int(v.Eval.TargetData.TypeAllocSize(v.KeyType)) != v.KeySize {
@@ -358,9 +310,30 @@ func (v *MapValue) PutBinary(keyPtr, valPtr *LocalValue) {
 		}
 	}
 
+	var keyBytes []byte
+	if key.Type().TypeKind() == llvm.IntegerTypeKind {
+		keyBytes = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
+		n := key.ZExtValue()
+		for i := range keyBytes {
+			keyBytes[i] = byte(n)
+			n >>= 8
+		}
+	} else if key.Type().TypeKind() == llvm.ArrayTypeKind &&
+		key.Type().ElementType().TypeKind() == llvm.IntegerTypeKind &&
+		key.Type().ElementType().IntTypeWidth() == 8 {
+		keyBytes = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
+		for i := range keyBytes {
+			keyBytes[i] = byte(llvm.ConstExtractValue(key, []uint32{uint32(i)}).ZExtValue())
+		}
+	} else {
+		return newDiagnostic(Unsupported, key, "map key type not implemented: "+key.Type().String())
+	}
+
 	// TODO: avoid duplicate keys
 	v.Keys = append(v.Keys, &LocalValue{v.Eval, key})
 	v.Values = append(v.Values, &LocalValue{v.Eval, value})
+	v.keyBufs = append(v.keyBufs, keyBytes)
+	return nil
 }
 
 // Get FNV-1a hash of this string.
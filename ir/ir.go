@@ -27,14 +27,16 @@ type Program struct {
 // Function or method.
 type Function struct {
 	*ssa.Function
-	LLVMFn    llvm.Value
-	module    string     // go:wasm-module
-	linkName  string     // go:linkname, go:export, go:interrupt
-	exported  bool       // go:export
-	nobounds  bool       // go:nobounds
-	flag      bool       // used by dead code elimination
-	interrupt bool       // go:interrupt
-	inline    InlineType // go:inline
+	LLVMFn      llvm.Value
+	module      string     // go:wasm-module
+	linkName    string     // go:linkname, go:export, go:interrupt
+	exported    bool       // go:export
+	nobounds    bool       // go:nobounds
+	flag        bool       // used by dead code elimination
+	interrupt   bool       // go:interrupt
+	inline      InlineType // go:inline
+	compiletime bool       // go:compiletime
+	runtimeinit bool       // go:runtimeinit
 }
 
 // Interface type that is at some point used in a type assert (to check whether
@@ -185,6 +187,12 @@ func (p *Program) addFunction(ssaFn *ssa.Function) {
 
 	for _, anon := range ssaFn.AnonFuncs {
 		p.addFunction(anon)
+		if ssaFn.Synthetic == "package initializer" && p.functionMap[anon].runtimeinit {
+			// One of the init functions of this package must be run at
+			// runtime, so the package initializer as a whole must be run at
+			// runtime.
+			f.runtimeinit = true
+		}
 	}
 }
 
@@ -240,6 +248,10 @@ func (f *Function) parsePragmas() {
 				f.inline = InlineHint
 			case "//go:noinline":
 				f.inline = InlineNone
+			case "//go:compiletime":
+				f.compiletime = true
+			case "//go:runtimeinit":
+				f.runtimeinit = true
 			case "//go:interrupt":
 				if len(parts) != 2 {
 					continue
@@ -293,6 +305,19 @@ func (f *Function) IsInterrupt() bool {
 	return f.interrupt
 }
 
+// Return true for functions annotated with //go:compiletime. Calls to these
+// functions are evaluated at compile time where possible.
+func (f *Function) IsCompileTime() bool {
+	return f.compiletime
+}
+
+// Return true for init functions annotated with //go:runtimeinit, and for
+// package initializers of packages with such an init function. These are never
+// evaluated at compile time.
+func (f *Function) IsRuntimeInit() bool {
+	return f.runtimeinit
+}
+
 // Return the inline directive of this function.
 func (f *Function) Inline() InlineType {
 	return f.inline
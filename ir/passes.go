@@ -1,7 +1,10 @@
 package ir
 
 import (
+	"go/token"
 	"go/types"
+	"sort"
+	"strings"
 
 	"golang.org/x/tools/go/ssa"
 )
@@ -65,14 +68,14 @@ func (p *Program) SimpleDCE() {
 	}
 
 	// Initial set of live functions. Include main.main, *.init and runtime.*
-	// functions.
+	// functions, including those implemented in other packages.
 	main := p.mainPkg.Members["main"].(*ssa.Function)
 	runtimePkg := p.Program.ImportedPackage("runtime")
 	mathPkg := p.Program.ImportedPackage("math")
 	p.GetFunction(main).flag = true
 	worklist := []*ssa.Function{main}
 	for _, f := range p.Functions {
-		if f.exported || f.Synthetic == "package initializer" || f.Pkg == runtimePkg || (f.Pkg == mathPkg && f.Pkg != nil) {
+		if f.exported || f.Synthetic == "package initializer" || f.Pkg == runtimePkg || (f.Pkg == mathPkg && f.Pkg != nil) || strings.HasPrefix(f.LinkName(), "runtime.") {
 			if f.flag {
 				continue
 			}
@@ -81,48 +84,87 @@ func (p *Program) SimpleDCE() {
 		}
 	}
 
+	// markMethods marks all methods of the given type as live, because a value
+	// of this type is put in an interface and may be used to call them.
+	markMethods := func(typ types.Type) {
+		for _, sel := range getAllMethods(p.Program, typ) {
+			fn := p.Program.MethodValue(sel)
+			callee := p.GetFunction(fn)
+			if callee == nil {
+				// TODO: why is this necessary?
+				p.addFunction(fn)
+				callee = p.GetFunction(fn)
+			}
+			if !callee.flag {
+				callee.flag = true
+				worklist = append(worklist, callee.Function)
+			}
+		}
+	}
+
 	// Mark all called functions recursively.
-	for len(worklist) != 0 {
-		f := worklist[len(worklist)-1]
-		worklist = worklist[:len(worklist)-1]
-		for _, block := range f.Blocks {
-			for _, instr := range block.Instrs {
-				if instr, ok := instr.(*ssa.MakeInterface); ok {
-					for _, sel := range getAllMethods(p.Program, instr.X.Type()) {
-						fn := p.Program.MethodValue(sel)
-						callee := p.GetFunction(fn)
-						if callee == nil {
-							// TODO: why is this necessary?
-							p.addFunction(fn)
-							callee = p.GetFunction(fn)
-						}
-						if !callee.flag {
-							callee.flag = true
-							worklist = append(worklist, callee.Function)
+	markedReflectTypes := false
+	var namedTypes []types.Type // named types put in an interface
+	for {
+		for len(worklist) != 0 {
+			f := worklist[len(worklist)-1]
+			worklist = worklist[:len(worklist)-1]
+			for _, block := range f.Blocks {
+				for _, instr := range block.Instrs {
+					if instr, ok := instr.(*ssa.MakeInterface); ok {
+						markMethods(instr.X.Type())
+						if _, ok := instr.X.Type().(*types.Named); ok {
+							// The reflect package can take the address of a
+							// named value in an interface, so the methods of
+							// the pointer type may be called as well. This is
+							// only known once all functions have been marked.
+							if markedReflectTypes {
+								markMethods(types.NewPointer(instr.X.Type()))
+							} else {
+								namedTypes = append(namedTypes, instr.X.Type())
+							}
 						}
 					}
-				}
-				for _, operand := range instr.Operands(nil) {
-					if operand == nil || *operand == nil {
-						continue
-					}
-					switch operand := (*operand).(type) {
-					case *ssa.Function:
-						f := p.GetFunction(operand)
-						if f == nil {
-							// FIXME HACK: this function should have been
-							// discovered already. It is not for bound methods.
-							p.addFunction(operand)
-							f = p.GetFunction(operand)
+					for _, operand := range instr.Operands(nil) {
+						if operand == nil || *operand == nil {
+							continue
 						}
-						if !f.flag {
-							f.flag = true
-							worklist = append(worklist, operand)
+						switch operand := (*operand).(type) {
+						case *ssa.Function:
+							f := p.GetFunction(operand)
+							if f == nil {
+								// FIXME HACK: this function should have been
+								// discovered already. It is not for bound methods.
+								p.addFunction(operand)
+								f = p.GetFunction(operand)
+							}
+							if !f.flag {
+								f.flag = true
+								worklist = append(worklist, operand)
+							}
 						}
 					}
 				}
 			}
 		}
+
+		// When the reflect package is used, it may put values in an interface
+		// that the program itself never puts in an interface (for example the
+		// element of a slice or a pointer to a named value), so all their
+		// methods may be called as well. This may make more functions live, so
+		// run the loop again.
+		if markedReflectTypes || !p.UsesReflect() {
+			break
+		}
+		markedReflectTypes = true
+		for _, typ := range p.Program.RuntimeTypes() {
+			if !types.IsInterface(typ) {
+				markMethods(typ)
+			}
+		}
+		for _, typ := range namedTypes {
+			markMethods(types.NewPointer(typ))
+		}
 	}
 
 	// Remove unmarked functions.
@@ -136,3 +178,87 @@ func (p *Program) SimpleDCE() {
 	}
 	p.Functions = livefunctions
 }
+
+// UsesReflect returns whether reflect.ValueOf is used in this program. Only
+// then can the reflect package create values of arbitrary types at runtime.
+// Dead code elimination must have marked live functions before this is called.
+func (p *Program) UsesReflect() bool {
+	reflectPkg := p.Program.ImportedPackage("reflect")
+	if reflectPkg == nil {
+		return false
+	}
+	valueOf, ok := reflectPkg.Members["ValueOf"].(*ssa.Function)
+	if !ok {
+		return false
+	}
+	f := p.GetFunction(valueOf)
+	return f != nil && f.flag
+}
+
+// ReflectTypes returns all non-interface types with methods that the reflect
+// package may put in an interface at runtime, sorted by name. It returns nil
+// when the program doesn't use reflection.
+func (p *Program) ReflectTypes() []types.Type {
+	if !p.UsesReflect() {
+		return nil
+	}
+	var list []types.Type
+	for _, typ := range p.Program.RuntimeTypes() {
+		if types.IsInterface(typ) || p.Program.MethodSets.MethodSet(typ).Len() == 0 {
+			continue
+		}
+		list = append(list, typ)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].String() < list[j].String()
+	})
+	return list
+}
+
+// ComparesInterfaces returns whether a live function compares two interface
+// values (possibly as part of a struct or array) that may both have a dynamic
+// type. These comparisons are implemented by the reflect package, comparisons
+// against nil are not. Dead code elimination must have marked live functions
+// before this is called.
+func (p *Program) ComparesInterfaces() bool {
+	for _, f := range p.Functions {
+		for _, block := range f.Blocks {
+			for _, instr := range block.Instrs {
+				binop, ok := instr.(*ssa.BinOp)
+				if !ok || (binop.Op != token.EQL && binop.Op != token.NEQ) {
+					continue
+				}
+				if _, ok := binop.X.(*ssa.Const); ok {
+					continue
+				}
+				if _, ok := binop.Y.(*ssa.Const); ok {
+					continue
+				}
+				if containsInterface(binop.X.Type()) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// containsInterface returns whether comparing values of the given type compares
+// interface values.
+func containsInterface(typ types.Type) bool {
+	switch typ := typ.Underlying().(type) {
+	case *types.Interface:
+		return true
+	case *types.Array:
+		return containsInterface(typ.Elem())
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			if containsInterface(typ.Field(i).Type()) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
@@ -0,0 +1,147 @@
+package loader
+
+// This file checks for functions that are implemented in Go assembly, which
+// is not supported. Packages like those in crypto/... declare such functions
+// without a body and usually have a pure Go implementation as well, which is
+// selected with build tags.
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// pureGoTags are the build tags that are commonly used to select a pure Go
+// implementation instead of an assembly implementation.
+var pureGoTags = []string{"purego", "noasm", "appengine"}
+
+// AssemblyError returns an error for the given function if it is declared
+// without a body in a package with assembly (.s) files, in which case it is
+// most likely implemented in assembly. It returns nil for other functions,
+// including functions that are declared with //go:linkname or //export, or
+// that are implemented elsewhere with //go:linkname (such as the functions in
+// the math package implemented by the runtime).
+func (p *Program) AssemblyError(fn *types.Func) error {
+	if fn.Pkg() == nil || fn.Type().(*types.Signature).Recv() != nil {
+		return nil
+	}
+	pkg := p.Packages[fn.Pkg().Path()]
+	if pkg == nil || len(pkg.SFiles) == 0 {
+		return nil
+	}
+	if _, ok := p.linknameTargets()[fn.Pkg().Path()+"."+fn.Name()]; ok {
+		return nil
+	}
+	decl := findFuncDecl(pkg.Files, fn.Name())
+	if decl == nil || decl.Body != nil || hasPragma(decl.Doc) {
+		return nil
+	}
+	err := &AssemblyError{
+		Pos:    p.fset.Position(decl.Name.Pos()),
+		Func:   fn.Pkg().Path() + "." + fn.Name(),
+		SFiles: pkg.SFiles,
+	}
+
+	// Look for a pure Go implementation in a file that was excluded by build
+	// constraints.
+	for _, name := range pkg.IgnoredGoFiles {
+		f, parseErr := p.parseFile(filepath.Join(pkg.Package.Dir, name), parser.ParseComments)
+		if parseErr != nil {
+			continue
+		}
+		if decl := findFuncDecl([]*ast.File{f}, fn.Name()); decl == nil || decl.Body == nil {
+			continue
+		}
+		err.Fallback = name
+		err.Tags = buildConstraintTags(f, pureGoTags)
+		break
+	}
+	return err
+}
+
+// linknameTargets returns the set of symbols (like "math.sqrt") that are
+// implemented in one of the loaded packages using a //go:linkname pragma.
+func (p *Program) linknameTargets() map[string]struct{} {
+	if p.linknames != nil {
+		return p.linknames
+	}
+	p.linknames = make(map[string]struct{})
+	for _, pkg := range p.Packages {
+		for _, f := range pkg.Files {
+			for _, group := range f.Comments {
+				for _, comment := range group.List {
+					parts := strings.Fields(comment.Text)
+					if len(parts) == 3 && parts[0] == "//go:linkname" {
+						p.linknames[parts[2]] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	return p.linknames
+}
+
+// findFuncDecl returns the declaration of the function (not method) with the
+// given name in the given files, or nil if there is no such function.
+func findFuncDecl(files []*ast.File, name string) *ast.FuncDecl {
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && decl.Recv == nil && decl.Name.Name == name {
+				return decl
+			}
+		}
+	}
+	return nil
+}
+
+// hasPragma returns whether the given doc comment contains a pragma that
+// provides the implementation of a function without a body.
+func hasPragma(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if strings.HasPrefix(comment.Text, "//go:linkname ") || strings.HasPrefix(comment.Text, "//go:export ") || strings.HasPrefix(comment.Text, "//export ") {
+			return true
+		}
+	}
+	return false
+}
+
+// buildConstraintTags returns the tags of the given list that are required (not
+// negated) somewhere in the build constraints of the given file.
+func buildConstraintTags(f *ast.File, tags []string) []string {
+	mentioned := make(map[string]bool)
+	for _, group := range f.Comments {
+		if group.Pos() >= f.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if !strings.HasPrefix(comment.Text, "// +build ") && !strings.HasPrefix(comment.Text, "//go:build ") {
+				continue
+			}
+			for _, field := range strings.FieldsFunc(comment.Text, isConstraintSeparator) {
+				mentioned[field] = true
+			}
+		}
+	}
+	var found []string
+	for _, tag := range tags {
+		if mentioned[tag] {
+			found = append(found, tag)
+		}
+	}
+	return found
+}
+
+// isConstraintSeparator returns whether the given character separates terms in
+// a build constraint. Negated terms keep their ! prefix.
+func isConstraintSeparator(c rune) bool {
+	switch c {
+	case ' ', ',', '(', ')', '&', '|':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package loader
+
+// This file prepares the build context that selects the files of a package.
+// Build constraints themselves (//go:build and // +build lines, and _GOOS and
+// _GOARCH file name suffixes) are evaluated by go/build, but TinyGo targets
+// describe the system they are compatible with using build tags: baremetal
+// targets claim to be linux/arm for example, and a custom target may not set
+// GOOS and GOARCH at all. The build context is completed so that go/build sees
+// the same GOOS, GOARCH and tags as the target.
+
+import "go/build"
+
+// knownOS lists the values of GOOS known to go/build. A file name with one of
+// these as suffix (like foo_linux.go) is only built for that GOOS.
+var knownOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"js":        true,
+	"linux":     true,
+	"nacl":      true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"plan9":     true,
+	"solaris":   true,
+	"wasip1":    true,
+	"windows":   true,
+	"zos":       true,
+}
+
+// knownArch lists the values of GOARCH known to go/build, like knownOS.
+var knownArch = map[string]bool{
+	"386":         true,
+	"amd64":       true,
+	"amd64p32":    true,
+	"arm":         true,
+	"armbe":       true,
+	"arm64":       true,
+	"arm64be":     true,
+	"loong64":     true,
+	"mips":        true,
+	"mipsle":      true,
+	"mips64":      true,
+	"mips64le":    true,
+	"mips64p32":   true,
+	"mips64p32le": true,
+	"ppc":         true,
+	"ppc64":       true,
+	"ppc64le":     true,
+	"riscv":       true,
+	"riscv64":     true,
+	"s390":        true,
+	"s390x":       true,
+	"sparc":       true,
+	"sparc64":     true,
+	"wasm":        true,
+}
+
+// unixOS lists the operating systems that imply the "unix" build tag.
+var unixOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"linux":     true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"solaris":   true,
+}
+
+// impliedTags lists build tags that imply another build tag, like GOOS=android
+// implies GOOS=linux in the go tool.
+var impliedTags = map[string]string{
+	"android": "linux",
+	"illumos": "solaris",
+	"ios":     "darwin",
+}
+
+// targetContext returns a copy of the given build context as seen by go/build
+// for the target. When GOOS or GOARCH is not set, it is taken from the first
+// build tag that is a known GOOS or GOARCH. Build tags implied by GOOS and by
+// other build tags are added: for example, a target with the "linux" build tag
+// also matches "unix". It returns the build context itself when there is
+// nothing to change.
+func targetContext(ctx *build.Context) *build.Context {
+	goos, goarch := ctx.GOOS, ctx.GOARCH
+	for _, tag := range ctx.BuildTags {
+		if goos == "" && knownOS[tag] {
+			goos = tag
+		}
+		if goarch == "" && knownArch[tag] {
+			goarch = tag
+		}
+	}
+
+	tags := append([]string{goos}, ctx.BuildTags...)
+	hasTag := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		hasTag[tag] = true
+	}
+	var extraTags []string
+	for _, tag := range tags {
+		// Implied tags are all operating systems, so check them for "unix"
+		// as well.
+		for _, tag := range []string{tag, impliedTags[tag]} {
+			if tag != "" && !hasTag[tag] {
+				hasTag[tag] = true
+				extraTags = append(extraTags, tag)
+			}
+			if unixOS[tag] && !hasTag["unix"] {
+				hasTag["unix"] = true
+				extraTags = append(extraTags, "unix")
+			}
+		}
+	}
+	if len(extraTags) == 0 && goos == ctx.GOOS && goarch == ctx.GOARCH {
+		return ctx
+	}
+	newCtx := *ctx
+	newCtx.GOOS = goos
+	newCtx.GOARCH = goarch
+	newCtx.BuildTags = append(append([]string{}, ctx.BuildTags...), extraTags...)
+	return &newCtx
+}
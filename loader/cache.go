@@ -0,0 +1,368 @@
+package loader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/gcexportdata"
+)
+
+// Cache holds packages that have already been parsed and typechecked, so that
+// later loads can reuse them when nothing they depend upon has changed. A cache
+// can be shared by multiple programs (for example, in a long-running editor
+// integration), but it must not be used by multiple programs at the same time.
+//
+// Packages are keyed by a hash of their source files, the build configuration
+// and the exported API of the packages they import, so a change in any of these
+// loads the package again. Changing only the function bodies of a dependency
+// doesn't change the key of the packages importing it: those are typechecked
+// again against the new dependency, but they are not parsed again.
+//
+// If the cache has a directory, the export data of every package is also
+// written to it so that later processes can load the type information of
+// unchanged packages without parsing them, see Program.TypesOnly.
+type Cache struct {
+	Dir     string // directory with export data, or "" to keep the cache in memory
+	fset    *token.FileSet
+	entries map[string]*cacheEntry
+
+	// Statistics, mostly useful for testing.
+	Hits   int // number of packages that were reused
+	Misses int // number of packages that had to be typechecked
+	Parsed int // number of packages that had to be parsed
+}
+
+// cgoEnvironment lists the environment variables that change the flags of a
+// package that uses cgo.
+var cgoEnvironment = []string{
+	"PKG_CONFIG",
+	"PKG_CONFIG_PATH",
+	"CGO_CFLAGS_ALLOW",
+	"CGO_CFLAGS_DISALLOW",
+	"CGO_CPPFLAGS_ALLOW",
+	"CGO_CPPFLAGS_DISALLOW",
+	"CGO_CXXFLAGS_ALLOW",
+	"CGO_CXXFLAGS_DISALLOW",
+	"CGO_FFLAGS_ALLOW",
+	"CGO_FFLAGS_DISALLOW",
+	"CGO_LDFLAGS_ALLOW",
+	"CGO_LDFLAGS_DISALLOW",
+}
+
+// cacheEntry is a single package stored in the cache.
+type cacheEntry struct {
+	files   []*ast.File
+	pkg     *types.Package
+	info    types.Info
+	apiHash string
+
+	// Type information of the imported packages this package was checked
+	// against. The package can only be reused as-is when the program uses the
+	// very same packages, otherwise it refers to stale types.
+	imports map[string]*types.Package
+
+	// Whether the package was loaded from export data, in which case it has
+	// no files and no type information of its contents.
+	typesOnly bool
+
+	cgoCompileFlags []string
+	cgoLinkFlags    []string
+}
+
+// exportEntry is a single package as stored in the cache directory.
+type exportEntry struct {
+	ExportData      []byte
+	CgoCompileFlags []string
+	CgoLinkFlags    []string
+}
+
+// NewCache returns a new, empty package cache. If dir is not empty, export data
+// is stored in and loaded from this directory.
+func NewCache(dir string) *Cache {
+	return &Cache{
+		Dir:     dir,
+		fset:    token.NewFileSet(),
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// loadFromCache calculates the cache key of this package and loads it from the
+// cache if possible. It returns true if the package was found in the cache, in
+// which case it does not need to be parsed or typechecked anymore. If only the
+// parsed files could be reused, they are set but false is returned.
+func (p *Package) loadFromCache() (bool, error) {
+	key, err := p.hashSources()
+	if err != nil || key == "" {
+		p.Cache.Misses++
+		return false, err
+	}
+	p.cacheKey = key
+	entry, ok := p.Cache.entries[key]
+	if ok && entry.typesOnly && (!p.TypesOnly || !entry.sameImports(p)) {
+		// Packages loaded from export data have no files to reuse.
+		ok = false
+	}
+	if !ok && p.TypesOnly && p.Cache.Dir != "" {
+		entry, err = p.loadExportData()
+		if err != nil {
+			return false, err
+		}
+		ok = entry != nil
+	}
+	if !ok {
+		p.Cache.Misses++
+		return false, nil
+	}
+	if !entry.sameImports(p) {
+		// One of the dependencies changed without changing its API. The files
+		// are still the same, but they must be typechecked again.
+		p.Cache.Misses++
+		p.Files = entry.files
+		p.CgoCompileFlags = entry.cgoCompileFlags
+		p.CgoLinkFlags = entry.cgoLinkFlags
+		return false, nil
+	}
+	p.Cache.Hits++
+	p.Files = entry.files
+	p.Pkg = entry.pkg
+	p.Info = entry.info
+	p.apiHash = entry.apiHash
+	p.CgoCompileFlags = entry.cgoCompileFlags
+	p.CgoLinkFlags = entry.cgoLinkFlags
+	return true, nil
+}
+
+// sameImports returns whether the imports of this cache entry are the same
+// packages as the ones imported by p.
+func (e *cacheEntry) sameImports(p *Package) bool {
+	for to, importedPkg := range p.Imports {
+		if e.imports[to] != importedPkg.Pkg {
+			return false
+		}
+	}
+	return true
+}
+
+// storeInCache stores this package in the cache after it has been typechecked
+// successfully.
+func (p *Package) storeInCache() error {
+	if p.cacheKey == "" || p.Pkg == nil {
+		return nil
+	}
+	exportData, err := p.exportData()
+	if err != nil {
+		return err
+	}
+	p.apiHash = hashBytes(exportData)
+	entry := &cacheEntry{
+		files:   p.Files,
+		pkg:     p.Pkg,
+		info:    p.Info,
+		apiHash: p.apiHash,
+		imports: make(map[string]*types.Package, len(p.Imports)),
+
+		cgoCompileFlags: p.CgoCompileFlags,
+		cgoLinkFlags:    p.CgoLinkFlags,
+	}
+	for to, importedPkg := range p.Imports {
+		entry.imports[to] = importedPkg.Pkg
+	}
+	p.Cache.entries[p.cacheKey] = entry
+	if p.Cache.Dir != "" && p.synthetic == nil {
+		return p.storeExportData(exportData)
+	}
+	return nil
+}
+
+// exportData returns the export data of this package, which describes its
+// exported API. Positions are left out, so that moving code around doesn't
+// change the export data.
+func (p *Package) exportData() ([]byte, error) {
+	if p.synthetic != nil {
+		// Synthetic packages never change, so their source is a good enough
+		// description of their API.
+		return []byte(p.cacheKey), nil
+	}
+	buf := &bytes.Buffer{}
+	err := gcexportdata.Write(buf, token.NewFileSet(), p.Pkg)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exportPath returns the path of the file in the cache directory that holds
+// the export data of this package.
+func (p *Package) exportPath() string {
+	return filepath.Join(p.Cache.Dir, p.cacheKey[:2], p.cacheKey+".export")
+}
+
+// storeExportData writes the export data of this package to the cache
+// directory, unless it is already there.
+func (p *Package) storeExportData(exportData []byte) error {
+	path := p.exportPath()
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that other processes never see a
+	// partially written file.
+	f, err := ioutil.TempFile(filepath.Dir(path), p.cacheKey+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = gob.NewEncoder(f).Encode(&exportEntry{
+		ExportData:      exportData,
+		CgoCompileFlags: p.CgoCompileFlags,
+		CgoLinkFlags:    p.CgoLinkFlags,
+	})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadExportData loads the type information of this package from the cache
+// directory. It returns nil if the package is not in the cache directory.
+func (p *Package) loadExportData() (*cacheEntry, error) {
+	f, err := os.Open(p.exportPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var stored exportEntry
+	err = gob.NewDecoder(f).Decode(&stored)
+	if err != nil {
+		// A corrupt cache entry is not fatal, the package can be loaded
+		// from source instead.
+		return nil, nil
+	}
+
+	// Reuse all packages that are already loaded, so that objects that refer
+	// to them use the same types.
+	imports := make(map[string]*types.Package)
+	for _, pkg := range p.Sorted() {
+		if pkg.Pkg != nil {
+			imports[pkg.ImportPath] = pkg.Pkg
+		}
+	}
+	pkg, err := gcexportdata.Read(bytes.NewReader(stored.ExportData), p.fset, imports, p.ImportPath)
+	if err != nil {
+		return nil, nil
+	}
+	entry := &cacheEntry{
+		pkg:       pkg,
+		apiHash:   hashBytes(stored.ExportData),
+		imports:   make(map[string]*types.Package, len(p.Imports)),
+		typesOnly: true,
+
+		cgoCompileFlags: stored.CgoCompileFlags,
+		cgoLinkFlags:    stored.CgoLinkFlags,
+	}
+	for to, importedPkg := range p.Imports {
+		entry.imports[to] = importedPkg.Pkg
+	}
+	p.Cache.entries[p.cacheKey] = entry
+	return entry, nil
+}
+
+// hashBytes returns the hex encoded SHA-256 hash of the given data.
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashSources returns the cache key of this package, or "" if the package can't
+// be cached because one of its dependencies has no known API. All imported
+// packages must already have been loaded.
+func (p *Package) hashSources() (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "path %q\ndir %q\ngo %q\n", p.ImportPath, p.Package.Dir, p.GoVersion)
+
+	// Build configuration: build tags and target, which determine which files
+	// are part of a package and the sizes of types.
+	for _, ctx := range []*build.Context{p.Build, p.OverlayBuild} {
+		if ctx == nil {
+			continue
+		}
+		fmt.Fprintf(h, "context %s %s %s %v %q\n", ctx.GOOS, ctx.GOARCH, ctx.Compiler, ctx.CgoEnabled, ctx.BuildTags)
+	}
+	if sizes := p.TypeChecker.Sizes; sizes != nil {
+		fmt.Fprintf(h, "sizes %d %d %d\n", sizes.Sizeof(types.Typ[types.Int]), sizes.Sizeof(types.Typ[types.UnsafePointer]), sizes.Alignof(types.Typ[types.Int64]))
+	}
+
+	// Contents of all source files. The C files in the package directory are
+	// included as well when the package uses cgo, as the preamble may include
+	// them.
+	files := append(append([]string{}, p.GoFiles...), p.CgoFiles...)
+	if len(p.CgoFiles) != 0 {
+		files = append(files, p.HFiles...)
+		files = append(files, p.CFiles...)
+		files = append(files, p.CXXFiles...)
+	}
+	for _, file := range files {
+		fmt.Fprintf(h, "file %q\n", file)
+		rd, err := p.openFile(filepath.Join(p.Package.Dir, file))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, rd)
+		rd.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(p.CgoFiles) != 0 {
+		fmt.Fprintf(h, "cflags %q %q\n", p.CFlags, p.ClangHeaders)
+
+		// Packages loaded from the cache don't write generated cgo files.
+		fmt.Fprintf(h, "cgodir %q\n", p.CgoDir)
+
+		// The flags from #cgo directives also depend on pkg-config and on
+		// the flags that are allowed.
+		for _, name := range cgoEnvironment {
+			fmt.Fprintf(h, "env %s=%q\n", name, os.Getenv(name))
+		}
+	}
+
+	// Exported API of the imported packages, so that a package is loaded again
+	// when the API of one of its dependencies changes.
+	imports := make([]string, 0, len(p.Imports))
+	for to := range p.Imports {
+		imports = append(imports, to)
+	}
+	sort.Strings(imports)
+	for _, to := range imports {
+		importedPkg := p.Imports[to]
+		if importedPkg.apiHash == "" {
+			return "", nil
+		}
+		fmt.Fprintf(h, "import %q %s\n", to, importedPkg.apiHash)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -1,7 +1,13 @@
 package loader
 
 import (
+	"fmt"
+	"go/scanner"
 	"go/token"
+	"go/types"
+	"io"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -16,6 +22,192 @@ func (e Errors) Error() string {
 	return "could not compile: " + e.Errs[0].Error()
 }
 
+// ErrorList is returned when one or more packages could not be parsed or
+// typechecked. It contains the errors of every broken package, with the errors
+// of each package sorted by position.
+type ErrorList []Errors
+
+func (e ErrorList) Error() string {
+	return e[0].Error()
+}
+
+// Format writes the errors of each package like go build does: a "# path"
+// header line for each package, followed by its errors sorted by position.
+func (e ErrorList) Format(w io.Writer) {
+	for _, pkgErrs := range e {
+		pkgErrs.Format(w)
+	}
+}
+
+// Format writes the errors like go build does: a "# path" header line,
+// followed by the errors sorted by position, one per line. Each error starts
+// with its position as file:line:column, with a ./ prefix for files in the
+// current directory, so that tools that parse the output of go build can parse
+// it as well.
+func (e Errors) Format(w io.Writer) {
+	fmt.Fprintln(w, "#", e.Pkg.ImportPath)
+	errs := append([]error(nil), e.Errs...)
+	sortErrors(errs)
+	for _, err := range errs {
+		fmt.Fprintln(w, formatError(err))
+	}
+}
+
+// formatError returns the given error as a single line in the format used by go
+// build, see Errors.Format.
+func formatError(err error) string {
+	pos := errorPosition(err)
+	if !pos.IsValid() {
+		return err.Error()
+	}
+	if !filepath.IsAbs(pos.Filename) && filepath.Dir(pos.Filename) == "." {
+		pos.Filename = "." + string(filepath.Separator) + pos.Filename
+	}
+	return pos.String() + ": " + errorMessage(err)
+}
+
+// DependencyError is reported for a package that is not typechecked because it
+// imports a package that has errors.
+type DependencyError struct {
+	ImportPath string
+	Pos        token.Position
+}
+
+func (e *DependencyError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.msg()
+	}
+	return e.Pos.String() + ": " + e.msg()
+}
+
+func (e *DependencyError) msg() string {
+	return "depends on broken package \"" + e.ImportPath + "\""
+}
+
+// AssemblyError is returned for a function that is implemented in Go assembly,
+// which is not supported. See Program.AssemblyError.
+type AssemblyError struct {
+	Pos      token.Position
+	Func     string   // qualified function name, like crypto/cipher.xorBytes
+	SFiles   []string // assembly files of the package
+	Fallback string   // file with a pure Go implementation excluded by build constraints, if any
+	Tags     []string // build tags that may select the pure Go implementation
+}
+
+func (e *AssemblyError) Error() string {
+	if !e.Pos.IsValid() {
+		return e.msg()
+	}
+	return e.Pos.String() + ": " + e.msg()
+}
+
+func (e *AssemblyError) msg() string {
+	msg := "function " + e.Func + " is implemented in assembly (" + strings.Join(e.SFiles, ", ") + "), which is not supported"
+	if e.Fallback == "" {
+		return msg
+	}
+	msg += "; the pure Go implementation in " + e.Fallback + " is excluded by build constraints"
+	if len(e.Tags) != 0 {
+		msg += ", try building with -tags=" + e.Tags[0]
+	}
+	return msg
+}
+
+// errorPosition returns the source position of the given error, or an invalid
+// position if it is not known.
+func errorPosition(err error) token.Position {
+	switch err := err.(type) {
+	case *scanner.Error:
+		return err.Pos
+	case types.Error:
+		return err.Fset.Position(err.Pos)
+	case *DependencyError:
+		return err.Pos
+	case *AssemblyError:
+		return err.Pos
+	default:
+		return token.Position{}
+	}
+}
+
+// errorMessage returns the message of the given error, without the source
+// position.
+func errorMessage(err error) string {
+	switch err := err.(type) {
+	case *scanner.Error:
+		return err.Msg
+	case types.Error:
+		return err.Msg
+	case *DependencyError:
+		return err.msg()
+	case *AssemblyError:
+		return err.msg()
+	default:
+		return err.Error()
+	}
+}
+
+// appendError appends the given error to the list of errors, splitting a
+// scanner.ErrorList into the individual errors it contains.
+func appendError(errs []error, err error) []error {
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, err := range list {
+			errs = append(errs, err)
+		}
+		return errs
+	}
+	return append(errs, err)
+}
+
+// sortErrors sorts the list of errors by file, line and column. Errors without
+// a position are put first.
+func sortErrors(errs []error) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		a := errorPosition(errs[i])
+		b := errorPosition(errs[j])
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// PackageNotFoundError is returned when an imported package cannot be found in
+// GOROOT or in any of the GOPATH entries.
+type PackageNotFoundError struct {
+	ImportPath string
+	Dirs       []string // directories that were searched, in order
+}
+
+func (e *PackageNotFoundError) Error() string {
+	return "cannot find package \"" + e.ImportPath + "\" in any of:\n\t" + strings.Join(e.Dirs, "\n\t")
+}
+
+// ModuleNotFoundError is returned when an imported package is not part of the
+// standard library nor of any module in the build list.
+type ModuleNotFoundError struct {
+	ImportPath string
+	GoMod      string // go.mod file of the main module
+}
+
+func (e *ModuleNotFoundError) Error() string {
+	return "no required module provides package " + e.ImportPath + "; to add it to " + e.GoMod + ":\n\tgo get " + e.ImportPath
+}
+
+// CgoRequiredError is returned when a package only has files that need cgo,
+// while cgo is not enabled for the target.
+type CgoRequiredError struct {
+	ImportPath string
+	CgoFiles   []string
+}
+
+func (e *CgoRequiredError) Error() string {
+	return "package " + e.ImportPath + " requires cgo, which is not supported on this target (cgo files: " + strings.Join(e.CgoFiles, ", ") + ")"
+}
+
 // ImportCycleErrors is returned when encountering an import cycle. The list of
 // packages is a list from the root package to the leaf package that imports one
 // of the packages in the list.
@@ -0,0 +1,15 @@
+// +build go1.18
+
+package loader
+
+import "go/types"
+
+// typesGoVersion is true when go/types supports language versions, see
+// setGoVersion.
+const typesGoVersion = true
+
+// setGoVersion sets the language version that the typechecker accepts, like
+// "go1.17".
+func setGoVersion(conf *types.Config, version string) {
+	conf.GoVersion = version
+}
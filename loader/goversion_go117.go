@@ -0,0 +1,14 @@
+// +build !go1.18
+
+package loader
+
+import "go/types"
+
+// typesGoVersion is false when go/types doesn't support language versions.
+const typesGoVersion = false
+
+// setGoVersion does nothing: before Go 1.18, go/types accepts all language
+// features it knows about, which are the features of the Go version it is
+// part of.
+func setGoVersion(conf *types.Config, version string) {
+}
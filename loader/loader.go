@@ -5,9 +5,11 @@ import (
 	"errors"
 	"go/ast"
 	"go/build"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"go/types"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -23,6 +25,10 @@ type Program struct {
 	Build        *build.Context
 	OverlayBuild *build.Context
 	OverlayPath  func(path string) string
+	FileOverlay  map[string][]byte // file contents by absolute path, read instead of the file system
+	Cache        *Cache            // previously loaded packages, may be nil
+	TypesOnly    bool              // only type information is needed, so packages may be loaded from export data in the cache
+	ModCache     string            // module cache directory, defaults to GOMODCACHE or GOPATH/pkg/mod
 	Packages     map[string]*Package
 	sorted       []*Package
 	fset         *token.FileSet
@@ -31,6 +37,15 @@ type Program struct {
 	TINYGOROOT   string // root of the TinyGo installation or root of the source code
 	CFlags       []string
 	ClangHeaders string
+	CgoDir       string // directory to write generated cgo files to, if set
+	linknames    map[string]struct{}
+	goVersions   map[string]string // Go version from go.mod by directory
+
+	// Modules in the build list by module path, if the working directory is
+	// in a module.
+	modulesLoaded bool
+	mainModule    *module
+	modules       map[string]*module
 }
 
 // Package holds a loaded package, its imports, and its parsed files.
@@ -39,9 +54,19 @@ type Package struct {
 	*build.Package
 	Imports   map[string]*Package
 	Importing bool
+	broken    bool   // parsing or typechecking failed
+	cacheKey  string // key in Program.Cache, if used
+	apiHash   string // hash of the export data, if Program.Cache is used
+	synthetic *syntheticPackage
+	GoVersion string // language version from go.mod (like "go1.17"), or "" for the latest version
 	Files     []*ast.File
 	Pkg       *types.Package
 	types.Info
+
+	// Flags for the C compiler and the linker from #cgo directives (including
+	// pkg-config), for packages that use cgo.
+	CgoCompileFlags []string
+	CgoLinkFlags    []string
 }
 
 // Import loads the given package relative to srcDir (for the vendor directory).
@@ -51,22 +76,121 @@ func (p *Program) Import(path, srcDir string) (*Package, error) {
 		p.Packages = make(map[string]*Package)
 	}
 
+	// Packages like unsafe are provided by the loader itself.
+	if synthetic := lookupSynthetic(targetContext(p.Build), path); synthetic != nil {
+		if existingPkg, ok := p.Packages[path]; ok {
+			return existingPkg, nil
+		}
+		return p.importSynthetic(path, synthetic)
+	}
+
+	if err := p.loadModules(); err != nil {
+		return nil, err
+	}
+
 	// Load this package.
 	ctx := p.Build
+	overlaid := false
 	if newPath := p.OverlayPath(path); newPath != "" {
 		ctx = p.OverlayBuild
 		path = newPath
+		overlaid = true
+	}
+	ctx = p.overlayContext(targetContext(ctx))
+	if p.mainModule != nil && !overlaid && !build.IsLocalImport(path) && !p.inGoroot(srcDir) {
+		// Packages outside the standard library are provided by a module,
+		// not by GOPATH or a vendor directory.
+		if m, dir := p.findModule(path); m != nil {
+			return p.importModulePackage(ctx, m, path, dir)
+		}
+		if first := strings.Split(path, "/")[0]; strings.Contains(first, ".") {
+			return nil, &ModuleNotFoundError{ImportPath: path, GoMod: filepath.Join(p.mainModule.Dir, "go.mod")}
+		}
+		srcDir = "" // don't look in GOPATH for vendor directories
 	}
 	buildPkg, err := ctx.Import(path, srcDir, build.ImportComment)
 	if err != nil {
+		if dirs := searchedDirs(ctx, path); dirs != nil {
+			return nil, &PackageNotFoundError{ImportPath: path, Dirs: dirs}
+		}
+		if _, ok := err.(*build.NoGoError); ok && !ctx.CgoEnabled {
+			if cgoErr := cgoRequired(ctx, path, srcDir); cgoErr != nil {
+				return nil, cgoErr
+			}
+		}
 		return nil, err
 	}
+	if build.IsLocalImport(buildPkg.ImportPath) {
+		// Relative imports (like "./foo") outside of a GOPATH keep their
+		// import path as-is, so the same package may be imported under
+		// several names. Use the same canonical path as the go tool does.
+		dir, err := filepath.Abs(buildPkg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if importPath := p.moduleImportPath(dir); importPath != "" {
+			buildPkg.ImportPath = importPath
+		} else {
+			buildPkg.ImportPath = "_/" + strings.TrimPrefix(filepath.ToSlash(dir), "/")
+		}
+	}
+	return p.addPackage(buildPkg)
+}
+
+// importModulePackage loads the package with the given import path from the
+// given directory of a module, downloading the module if needed.
+func (p *Program) importModulePackage(ctx *build.Context, m *module, path, dir string) (*Package, error) {
+	if existingPkg, ok := p.Packages[path]; ok {
+		return existingPkg, nil
+	}
+	if err := p.downloadModule(m); err != nil {
+		return nil, err
+	}
+	if !p.isDir(dir) {
+		return nil, &PackageNotFoundError{ImportPath: path, Dirs: []string{dir}}
+	}
+	buildPkg, err := ctx.ImportDir(dir, build.ImportComment)
+	if err != nil {
+		return nil, err
+	}
+	buildPkg.ImportPath = path
+	return p.addPackage(buildPkg)
+}
+
+// inGoroot returns whether the given directory is part of the standard
+// library, where imports are resolved using vendor directories instead of
+// modules.
+func (p *Program) inGoroot(dir string) bool {
+	for _, ctx := range []*build.Context{p.Build, p.OverlayBuild} {
+		if ctx == nil || ctx.GOROOT == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(filepath.Join(ctx.GOROOT, "src"), dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPackage adds a package that was found by Import to the program, unless a
+// package with the same import path was already added.
+func (p *Program) addPackage(buildPkg *build.Package) (*Package, error) {
 	if existingPkg, ok := p.Packages[buildPkg.ImportPath]; ok {
 		// Already imported, or at least started the import.
 		return existingPkg, nil
 	}
+	goVersion := ""
+	if !buildPkg.Goroot {
+		// Standard library packages always use the latest language version.
+		var err error
+		goVersion, err = p.goVersion(buildPkg.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
 	p.sorted = nil // invalidate the sorted order of packages
 	pkg := p.newPackage(buildPkg)
+	pkg.GoVersion = goVersion
 	p.Packages[buildPkg.ImportPath] = pkg
 
 	if p.mainPkg == "" {
@@ -76,6 +200,39 @@ func (p *Program) Import(path, srcDir string) (*Package, error) {
 	return pkg, nil
 }
 
+// searchedDirs returns the directories in which a package with the given import
+// path is searched, in the order in which they are searched: the src directory
+// of GOROOT and of each entry in the GOPATH list. It returns nil if any of these
+// directories exists, in which case the package was found but could not be
+// imported for a different reason.
+func searchedDirs(ctx *build.Context, path string) []string {
+	if build.IsLocalImport(path) {
+		return nil
+	}
+	var dirs []string
+	for _, srcDir := range ctx.SrcDirs() {
+		dir := filepath.Join(srcDir, filepath.FromSlash(path))
+		if _, err := os.Stat(dir); err == nil {
+			return nil
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// cgoRequired returns an error if the given package could be imported with cgo
+// enabled, meaning that it only has a cgo implementation. It returns nil
+// otherwise.
+func cgoRequired(ctx *build.Context, path, srcDir string) error {
+	cgoCtx := *ctx
+	cgoCtx.CgoEnabled = true
+	buildPkg, err := cgoCtx.Import(path, srcDir, build.ImportComment)
+	if err != nil || len(buildPkg.CgoFiles) == 0 {
+		return nil
+	}
+	return &CgoRequiredError{ImportPath: buildPkg.ImportPath, CgoFiles: buildPkg.CgoFiles}
+}
+
 // ImportFile loads and parses the import statements in the given path and
 // creates a pseudo-package out of it.
 func (p *Program) ImportFile(path string) (*Package, error) {
@@ -99,8 +256,13 @@ func (p *Program) ImportFile(path string) (*Package, error) {
 	for _, importSpec := range file.Imports {
 		buildPkg.Imports = append(buildPkg.Imports, importSpec.Path.Value[1:len(importSpec.Path.Value)-1])
 	}
+	goVersion, err := p.goVersion(buildPkg.Dir)
+	if err != nil {
+		return nil, err
+	}
 	p.sorted = nil // invalidate the sorted order of packages
 	pkg := p.newPackage(buildPkg)
+	pkg.GoVersion = goVersion
 	p.Packages[buildPkg.ImportPath] = pkg
 
 	if p.mainPkg == "" {
@@ -182,9 +344,11 @@ func (p *Program) sort() {
 
 // Parse recursively imports all packages, parses them, and typechecks them.
 //
-// The returned error may be an Errors error, which contains a list of errors.
+// The returned error may be an ErrorList error, which contains the errors of
+// all packages that could not be parsed or typechecked.
 //
-// Idempotent.
+// Idempotent. Packages imported after an earlier call are parsed and
+// typechecked by the next call, the others are left as they are.
 func (p *Program) Parse(compileTestBinary bool) error {
 	includeTests := compileTestBinary
 
@@ -201,29 +365,100 @@ func (p *Program) Parse(compileTestBinary bool) error {
 		}
 	}
 
-	// Parse all packages.
+	// The test binary modifies the main package after parsing, so don't use
+	// the cache in that case.
+	useCache := p.Cache != nil && !compileTestBinary
+	if useCache {
+		p.fset = p.Cache.fset
+	}
+
+	// Parse all packages. Continue after errors, so that the errors of all
+	// packages can be reported at once.
+	var errs ErrorList
 	for _, pkg := range p.Sorted() {
+		if pkg.Pkg != nil {
+			// Already parsed and typechecked in an earlier call.
+			continue
+		}
+		if useCache {
+			cached, err := pkg.loadFromCache()
+			if err != nil {
+				return err
+			}
+			if cached {
+				continue
+			}
+		}
+		if len(pkg.Files) == 0 && p.Cache != nil {
+			p.Cache.Parsed++
+		}
 		err := pkg.Parse(includeTests)
 		if err != nil {
-			return err
+			pkgErrs, ok := err.(Errors)
+			if !ok {
+				return err
+			}
+			pkg.broken = true
+			errs = append(errs, pkgErrs)
+			continue
+		}
+		if useCache {
+			// The cache key of a package depends on the API of the packages
+			// it imports, so packages must be typechecked right away.
+			if err := pkg.checkAndStore(&errs); err != nil {
+				return err
+			}
 		}
 	}
 
-	if compileTestBinary {
+	if compileTestBinary && p.Packages[p.mainPkg].Pkg == nil {
 		err := p.SwapTestMain()
 		if err != nil {
 			return err
 		}
 	}
 
-	// Typecheck all packages.
-	for _, pkg := range p.Sorted() {
-		err := pkg.Check()
-		if err != nil {
-			return err
+	// Typecheck all packages. Packages that import a broken package are not
+	// typechecked, as that would only report follow-up errors.
+	if !useCache {
+		for _, pkg := range p.Sorted() {
+			if err := pkg.checkAndStore(&errs); err != nil {
+				return err
+			}
 		}
 	}
+	if errs != nil {
+		return errs
+	}
+
+	return nil
+}
 
+// checkAndStore typechecks a package that has been parsed, adding errors to
+// errs, and stores it in the cache if there is one. Non-nil errors returned
+// from this function are fatal errors.
+func (p *Package) checkAndStore(errs *ErrorList) error {
+	if p.broken {
+		return nil
+	}
+	if depErrs := p.brokenDependencies(); depErrs != nil {
+		p.broken = true
+		*errs = append(*errs, Errors{p, depErrs})
+		return nil
+	}
+	err := p.Check()
+	if err != nil {
+		pkgErrs, ok := err.(Errors)
+		if !ok {
+			return err
+		}
+		p.broken = true
+		*errs = append(*errs, pkgErrs)
+		return nil
+	}
+	if p.Cache != nil && p.cacheKey != "" {
+		return p.storeInCache()
+	}
 	return nil
 }
 
@@ -310,7 +545,7 @@ func (p *Program) parseFile(path string, mode parser.Mode) (*ast.File, error) {
 		p.fset = token.NewFileSet()
 	}
 
-	rd, err := os.Open(path)
+	rd, err := p.openFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -335,11 +570,8 @@ func (p *Package) Parse(includeTests bool) error {
 
 	// Load the AST.
 	// TODO: do this in parallel.
-	if p.ImportPath == "unsafe" {
-		// Special case for the unsafe package. Don't even bother loading
-		// the files.
-		p.Pkg = types.Unsafe
-		return nil
+	if p.synthetic != nil {
+		return p.parseSynthetic()
 	}
 
 	files, err := p.parseFiles(includeTests)
@@ -368,12 +600,16 @@ func (p *Package) Check() error {
 
 	// Do typechecking of the package.
 	checker.Importer = p
+	if p.GoVersion != "" {
+		setGoVersion(&checker, p.GoVersion)
+	}
 
 	typesPkg, err := checker.Check(p.ImportPath, p.fset, p.Files, &p.Info)
 	if err != nil {
 		if err, ok := err.(Errors); ok {
 			return err
 		}
+		sortErrors(typeErrors)
 		return Errors{p, typeErrors}
 	}
 	p.Pkg = typesPkg
@@ -398,7 +634,7 @@ func (p *Package) parseFiles(includeTests bool) ([]*ast.File, error) {
 	for _, file := range gofiles {
 		f, err := p.parseFile(filepath.Join(p.Package.Dir, file), parser.ParseComments)
 		if err != nil {
-			fileErrs = append(fileErrs, err)
+			fileErrs = appendError(fileErrs, err)
 			continue
 		}
 		if err != nil {
@@ -407,44 +643,155 @@ func (p *Package) parseFiles(includeTests bool) ([]*ast.File, error) {
 		}
 		files = append(files, f)
 	}
+	var cgoFiles []*ast.File
 	for _, file := range p.CgoFiles {
 		path := filepath.Join(p.Package.Dir, file)
 		f, err := p.parseFile(path, parser.ParseComments)
 		if err != nil {
-			fileErrs = append(fileErrs, err)
+			fileErrs = appendError(fileErrs, err)
 			continue
 		}
 		files = append(files, f)
+		cgoFiles = append(cgoFiles, f)
 	}
 	if len(p.CgoFiles) != 0 {
-		cflags := append(p.CFlags, "-I"+p.Package.Dir)
+		flags, errs := cgo.ParseFlags(p.fset, cgoFiles, p.Package.Dir, targetContext(p.Build))
+		fileErrs = append(fileErrs, errs...)
+		pkgConfigCFlags, pkgConfigLDFlags, err := cgo.PkgConfig(flags.PkgConfig)
+		if err != nil {
+			fileErrs = append(fileErrs, err)
+		}
+		p.CgoCompileFlags = flags.CompileFlags(pkgConfigCFlags)
+		p.CgoLinkFlags = flags.LinkFlags(pkgConfigLDFlags)
+		cflags := append(append([]string{}, p.CFlags...), p.CgoCompileFlags...)
+		cflags = append(cflags, "-I"+p.Package.Dir)
 		if p.ClangHeaders != "" {
 			cflags = append(cflags, "-I"+p.ClangHeaders)
 		}
+		// Extract the preambles before cgo.Process removes the import "C"
+		// declarations they're attached to.
+		var preambles string
+		if p.CgoDir != "" {
+			preambles = cgoPreambles(p.fset, files)
+		}
 		generated, errs := cgo.Process(files, p.Program.Dir, p.fset, cflags)
 		if errs != nil {
 			fileErrs = append(fileErrs, errs...)
 		}
 		files = append(files, generated)
+		if p.CgoDir != "" {
+			err := p.writeCgoFiles(generated, preambles)
+			if err != nil {
+				fileErrs = append(fileErrs, err)
+			}
+		}
 	}
 	if len(fileErrs) != 0 {
+		sortErrors(fileErrs)
 		return nil, Errors{p, fileErrs}
 	}
 
 	return files, nil
 }
 
+// cgoPreambles returns the C preambles of all import "C" declarations in the
+// given files, each preceded by a comment with the file it came from. The
+// #cgo directives are removed like cgo.Process does, so that this is the C
+// code that libclang parsed.
+func cgoPreambles(fset *token.FileSet, files []*ast.File) string {
+	var preambles strings.Builder
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.IMPORT {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				if spec.(*ast.ImportSpec).Path.Value != `"C"` {
+					continue
+				}
+				preambles.WriteString("// " + fset.Position(genDecl.Pos()).String() + "\n")
+				preambles.WriteString(cgo.RemoveDirectives(genDecl.Doc.Text()) + "\n")
+			}
+		}
+	}
+	return preambles.String()
+}
+
+// writeCgoFiles writes the Go declarations generated by cgo for this package
+// and the C preambles they were generated from to a directory below CgoDir,
+// named after the import path of the package.
+func (p *Package) writeCgoFiles(generated *ast.File, preambles string) error {
+	dir := filepath.Join(p.CgoDir, filepath.FromSlash(p.ImportPath))
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	// The generated declarations use names like "C.foo", which are not valid
+	// Go identifiers. Rename them while printing, so that the written file can
+	// be parsed again.
+	var renamed []*ast.Ident
+	ast.Inspect(generated, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok && strings.HasPrefix(ident.Name, "C.") {
+			renamed = append(renamed, ident)
+		}
+		return true
+	})
+	originalNames := make([]string, len(renamed))
+	for i, ident := range renamed {
+		originalNames[i] = ident.Name
+		ident.Name = "_Cgo_" + strings.Replace(ident.Name[len("C."):], "$", "_", -1)
+	}
+	buf := &bytes.Buffer{}
+	err = format.Node(buf, p.fset, generated)
+	for i, ident := range renamed {
+		ident.Name = originalNames[i]
+	}
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "_cgo_gotypes.go"), buf.Bytes(), 0666)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "_cgo_preamble.c"), []byte(preambles), 0666)
+}
+
 // Import implements types.Importer. It loads and parses packages it encounters
 // along the way, if needed.
 func (p *Package) Import(to string) (*types.Package, error) {
-	if to == "unsafe" {
-		return types.Unsafe, nil
-	}
 	if _, ok := p.Imports[to]; ok {
 		return p.Imports[to].Pkg, nil
-	} else {
-		return nil, errors.New("package not imported: " + to)
 	}
+	if synthetic := lookupSynthetic(p.Build, to); synthetic != nil && synthetic.types != nil {
+		// Generated code (like the output of cgo) may import packages such
+		// as unsafe that are not in the list of imports.
+		return synthetic.types, nil
+	}
+	return nil, errors.New("package not imported: " + to)
+}
+
+// brokenDependencies returns an error for each import of this package that
+// could not be parsed or typechecked, or nil if there are no such imports.
+func (p *Package) brokenDependencies() []error {
+	var errs []error
+	for to, importedPkg := range p.Imports {
+		if !importedPkg.broken {
+			continue
+		}
+		var pos token.Position
+		if positions := p.ImportPos[to]; len(positions) != 0 {
+			pos = positions[0]
+			if relpath, err := filepath.Rel(p.Program.Dir, pos.Filename); err == nil && filepath.IsAbs(pos.Filename) {
+				// Relative paths for readability, like parser errors.
+				pos.Filename = relpath
+			}
+		}
+		errs = append(errs, &DependencyError{importedPkg.ImportPath, pos})
+	}
+	sortErrors(errs)
+	return errs
 }
 
 // importRecursively calls Program.Import() on all imported packages, and calls
@@ -0,0 +1,1061 @@
+package loader
+
+import (
+	"bytes"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newTestProgram returns a Program that loads packages from the given GOPATH,
+// without any overlay.
+func newTestProgram(gopath string) *Program {
+	ctx := build.Default
+	ctx.GOROOT = runtime.GOROOT()
+	ctx.GOPATH = gopath
+	ctx.CgoEnabled = false
+	// Setting a file system callback makes go/build look up packages in GOPATH
+	// directly, instead of asking the go command in module mode.
+	ctx.JoinPath = filepath.Join
+	return &Program{
+		Build:       &ctx,
+		OverlayPath: func(path string) string { return "" },
+	}
+}
+
+// writeFile writes a file with the given contents, creating the directory it
+// is in as needed.
+func writeFile(t *testing.T, path, contents string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMultipleGopath checks that packages are found in every entry of a GOPATH
+// list, and that all searched directories are listed when a package can't be
+// found.
+func TestMultipleGopath(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	first := filepath.Join(tmpdir, "first")
+	second := filepath.Join(tmpdir, "second")
+	writeFile(t, filepath.Join(first, "src", "example.com", "one", "one.go"), "package one\n")
+	writeFile(t, filepath.Join(second, "src", "example.com", "two", "two.go"), "package two\n")
+
+	p := newTestProgram(first + string(filepath.ListSeparator) + second)
+	for _, tc := range []struct {
+		path string
+		root string
+	}{
+		{"example.com/one", first},
+		{"example.com/two", second},
+	} {
+		pkg, err := p.Import(tc.path, "")
+		if err != nil {
+			t.Errorf("could not import %s: %v", tc.path, err)
+			continue
+		}
+		if !strings.HasPrefix(pkg.Package.Dir, tc.root) {
+			t.Errorf("package %s loaded from %s, expected it in %s", tc.path, pkg.Package.Dir, tc.root)
+		}
+	}
+
+	_, err = p.Import("example.com/missing", "")
+	notFound, ok := err.(*PackageNotFoundError)
+	if !ok {
+		t.Fatalf("expected a *PackageNotFoundError, got: %v", err)
+	}
+	for _, root := range []string{first, second} {
+		dir := filepath.Join(root, "src", "example.com", "missing")
+		found := false
+		for _, searched := range notFound.Dirs {
+			if searched == dir {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s in the list of searched directories: %v", dir, notFound.Dirs)
+		}
+	}
+}
+
+// TestRelativeImports checks that relative imports are resolved against the
+// directory of the importing package, and that a package imported through
+// different relative paths is only loaded once.
+func TestRelativeImports(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	writeFile(t, filepath.Join(tmpdir, "app", "main.go"), `package main
+
+import (
+	"./internal/driver"
+	"./other"
+)
+
+func main() {
+	driver.Init()
+	other.Init()
+}
+`)
+	writeFile(t, filepath.Join(tmpdir, "app", "internal", "driver", "driver.go"), `package driver
+
+import "./port"
+
+func Init() {
+	port.Configure()
+}
+`)
+	writeFile(t, filepath.Join(tmpdir, "app", "internal", "driver", "port", "port.go"), `package port
+
+func Configure() {}
+`)
+	writeFile(t, filepath.Join(tmpdir, "app", "other", "other.go"), `package other
+
+import "../internal/driver"
+
+func Init() {
+	driver.Init()
+}
+`)
+
+	p := newTestProgram(filepath.Join(tmpdir, "gopath"))
+	p.Dir = tmpdir
+	mainPkg, err := p.Import("./app", tmpdir)
+	if err != nil {
+		t.Fatal("could not import main package:", err)
+	}
+	if err := p.Parse(false); err != nil {
+		t.Fatal("could not load program:", err)
+	}
+
+	if len(p.Packages) != 4 {
+		var paths []string
+		for path := range p.Packages {
+			paths = append(paths, path)
+		}
+		t.Fatalf("expected 4 packages, got %d: %v", len(p.Packages), paths)
+	}
+	for path := range p.Packages {
+		if build.IsLocalImport(path) {
+			t.Errorf("package loaded under relative import path %s", path)
+		}
+	}
+	driver := mainPkg.Imports["./internal/driver"]
+	if driver == nil || driver.Imports["./port"] == nil {
+		t.Fatal("relative imports were not loaded")
+	}
+	if other := mainPkg.Imports["./other"]; other.Imports["../internal/driver"] != driver {
+		t.Error("package imported through two relative paths was loaded twice")
+	}
+	if driver.Pkg == nil || driver.Pkg.Path() != driver.ImportPath {
+		t.Error("package was not typechecked under its canonical path")
+	}
+}
+
+// TestFileOverlay checks that a program can be loaded from files that only
+// exist in memory, and that files in the overlay take precedence over files
+// on disk.
+func TestFileOverlay(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src")
+	// This file does not compile, so the test fails if it is read.
+	writeFile(t, filepath.Join(src, "example.com", "lib", "lib.go"), "package lib\n\nfunc Value() int { return \"\" }\n")
+
+	p := newTestProgram(tmpdir)
+	p.Dir = tmpdir
+	p.FileOverlay = map[string][]byte{
+		filepath.Join(src, "example.com", "app", "main.go"): []byte(`package main
+
+import (
+	"example.com/lib"
+	"example.com/lib/util"
+)
+
+func main() {
+	println(lib.Value() + util.Double(2))
+}
+`),
+		filepath.Join(src, "example.com", "lib", "lib.go"): []byte(`package lib
+
+func Value() int { return 3 }
+`),
+		filepath.Join(src, "example.com", "lib", "util", "util.go"): []byte(`package util
+
+func Double(n int) int { return n * 2 }
+`),
+	}
+	if _, err := p.Import("example.com/app", ""); err != nil {
+		t.Fatal("could not import main package:", err)
+	}
+	if err := p.Parse(false); err != nil {
+		t.Fatal("could not load program:", err)
+	}
+	for _, path := range []string{"example.com/app", "example.com/lib", "example.com/lib/util"} {
+		pkg := p.Packages[path]
+		if pkg == nil || pkg.Pkg == nil {
+			t.Errorf("package %s was not loaded", path)
+		}
+	}
+}
+
+// TestParseAfterImport checks that packages imported after the program was
+// parsed are loaded by parsing it again, without loading the other packages a
+// second time.
+func TestParseAfterImport(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src")
+	writeFile(t, filepath.Join(src, "example.com", "app", "main.go"), "package main\n\nfunc main() {}\n")
+	writeFile(t, filepath.Join(src, "example.com", "extra", "extra.go"), "package extra\n\nfunc Value() int { return 3 }\n")
+
+	p := newTestProgram(tmpdir)
+	p.Dir = tmpdir
+	if _, err := p.Import("example.com/app", ""); err != nil {
+		t.Fatal("could not import main package:", err)
+	}
+	if err := p.Parse(false); err != nil {
+		t.Fatal("could not load program:", err)
+	}
+	mainPkg := p.Packages["example.com/app"].Pkg
+
+	if _, err := p.Import("example.com/extra", ""); err != nil {
+		t.Fatal("could not import extra package:", err)
+	}
+	if err := p.Parse(false); err != nil {
+		t.Fatal("could not load program again:", err)
+	}
+	if p.Packages["example.com/app"].Pkg != mainPkg {
+		t.Error("main package was typechecked again")
+	}
+	if extra := p.Packages["example.com/extra"]; extra == nil || extra.Pkg == nil {
+		t.Error("package example.com/extra was not loaded")
+	}
+}
+
+// TestErrorList checks that loading continues after errors, so that all errors
+// in all packages are reported at once.
+func TestErrorList(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src", "example.com")
+	writeFile(t, filepath.Join(src, "app", "main.go"), `package main
+
+import "example.com/lib"
+
+func main() {
+	lib.Foo()
+}
+`)
+	writeFile(t, filepath.Join(src, "lib", "a.go"), `package lib
+
+func Foo() {
+	var _ int = "a"
+	undefinedFunc()
+}
+`)
+	writeFile(t, filepath.Join(src, "lib", "b.go"), `package lib
+
+func Bar() string {
+	return 3
+}
+`)
+
+	p := newTestProgram(tmpdir)
+	p.Dir = tmpdir
+	if _, err := p.Import("example.com/app", ""); err != nil {
+		t.Fatal("could not import main package:", err)
+	}
+	err = p.Parse(false)
+	errList, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got: %v", err)
+	}
+	if len(errList) != 2 {
+		t.Fatalf("expected errors in 2 packages, got %d: %v", len(errList), errList)
+	}
+
+	libErrs := errList[0]
+	if libErrs.Pkg.ImportPath != "example.com/lib" {
+		t.Errorf("expected errors in example.com/lib first, got %s", libErrs.Pkg.ImportPath)
+	}
+	expected := []struct {
+		file string
+		line int
+	}{
+		{"a.go", 4},
+		{"a.go", 5},
+		{"b.go", 4},
+	}
+	if len(libErrs.Errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %v", len(expected), len(libErrs.Errs), libErrs.Errs)
+	}
+	for i, err := range libErrs.Errs {
+		pos := errorPosition(err)
+		if filepath.Base(pos.Filename) != expected[i].file || pos.Line != expected[i].line || pos.Column == 0 {
+			t.Errorf("expected error %d at %s:%d, got: %v", i, expected[i].file, expected[i].line, err)
+		}
+	}
+
+	appErrs := errList[1]
+	if appErrs.Pkg.ImportPath != "example.com/app" || len(appErrs.Errs) != 1 {
+		t.Fatalf("expected a single error in example.com/app, got: %v", appErrs.Errs)
+	}
+	if depErr, ok := appErrs.Errs[0].(*DependencyError); !ok || depErr.ImportPath != "example.com/lib" || depErr.Pos.Line != 3 {
+		t.Errorf("expected a dependency error on line 3, got: %v", appErrs.Errs[0])
+	}
+}
+
+// TestErrorFormat checks that errors are printed like go build prints them:
+// grouped per package, sorted by position and with columns, with file names
+// relative to the current directory.
+func TestErrorFormat(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src", "example.com")
+	writeFile(t, filepath.Join(src, "app", "main.go"), `package main
+
+import "example.com/lib"
+
+func main() {
+	lib.Foo()
+}
+`)
+	writeFile(t, filepath.Join(src, "lib", "a.go"), `package lib
+
+func Foo() {
+	a0()
+	a1()
+}
+`)
+	writeFile(t, filepath.Join(src, "lib", "b.go"), `package lib
+
+func Bar() int {
+	return b
+}
+`)
+
+	p := newTestProgram(tmpdir)
+	p.Dir = filepath.Join(src, "lib")
+	if _, err := p.Import("example.com/app", ""); err != nil {
+		t.Fatal("could not import main package:", err)
+	}
+	err = p.Parse(false)
+	errList, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected an ErrorList, got: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	errList.Format(buf)
+	expected := strings.Join([]string{
+		"# example.com/lib",
+		filepath.FromSlash("./a.go") + ":4:2: undefined: a0",
+		filepath.FromSlash("./a.go") + ":5:2: undefined: a1",
+		filepath.FromSlash("./b.go") + ":4:9: undefined: b",
+		"# example.com/app",
+		filepath.FromSlash("../app/main.go") + ":3:8: depends on broken package \"example.com/lib\"",
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected error output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+// TestCache checks that unchanged packages are loaded from the cache, and that
+// packages are loaded again when they or their dependencies change.
+func TestCache(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src", "example.com")
+	writeFile(t, filepath.Join(src, "app", "main.go"), `package main
+
+import "example.com/lib"
+
+func main() {
+	lib.Foo()
+}
+`)
+	writeFile(t, filepath.Join(src, "lib", "lib.go"), "package lib\n\nfunc Foo() {}\n")
+	writeFile(t, filepath.Join(src, "other", "other.go"), "package other\n")
+
+	cache := NewCache(filepath.Join(tmpdir, "cache"))
+	load := func(typesOnly bool, tags ...string) *Program {
+		p := newTestProgram(tmpdir)
+		p.Dir = tmpdir
+		p.Build.BuildTags = tags
+		p.Cache = cache
+		p.TypesOnly = typesOnly
+		for _, path := range []string{"example.com/app", "example.com/other"} {
+			if _, err := p.Import(path, ""); err != nil {
+				t.Fatal("could not import package:", err)
+			}
+		}
+		if err := p.Parse(false); err != nil {
+			t.Fatal("could not load program:", err)
+		}
+		return p
+	}
+	expect := func(when string, hits, misses, parsed int) {
+		if cache.Hits != hits || cache.Misses != misses || cache.Parsed != parsed {
+			t.Errorf("%s: expected %d hits, %d misses and %d parsed packages, got %d hits, %d misses and %d parsed packages", when, hits, misses, parsed, cache.Hits, cache.Misses, cache.Parsed)
+		}
+		cache.Hits = 0
+		cache.Misses = 0
+		cache.Parsed = 0
+	}
+
+	load(false)
+	expect("first load", 0, 3, 3)
+
+	p := load(false)
+	expect("unchanged load", 3, 0, 0)
+	if obj := p.Packages["example.com/lib"].Pkg.Scope().Lookup("Foo"); obj == nil {
+		t.Error("package loaded from cache has no type information")
+	}
+
+	// Changing only the body of a function doesn't change the API of a
+	// package, so packages importing it are typechecked but not parsed again.
+	writeFile(t, filepath.Join(src, "lib", "lib.go"), "package lib\n\nfunc Foo() {\n\tprintln()\n}\n")
+	p = load(false)
+	expect("changed function body", 1, 2, 1)
+	if p.Packages["example.com/app"].Pkg.Imports()[0] != p.Packages["example.com/lib"].Pkg {
+		t.Error("package typechecked against a stale dependency")
+	}
+
+	// Changing the API of a package loads it and all packages importing it
+	// again.
+	writeFile(t, filepath.Join(src, "lib", "lib.go"), "package lib\n\nfunc Foo() {}\n\nfunc Bar() {}\n")
+	load(false)
+	expect("changed dependency", 1, 2, 2)
+
+	// Build tags can change the list of files, so invalidate all packages.
+	load(false, "sometag")
+	expect("changed build tags", 0, 3, 3)
+
+	// A new cache with the same directory (like in a new process) loads the
+	// type information from export data, without parsing.
+	cache = NewCache(cache.Dir)
+	p = load(true)
+	expect("types from export data", 3, 0, 0)
+	if obj := p.Packages["example.com/lib"].Pkg.Scope().Lookup("Bar"); obj == nil {
+		t.Error("package loaded from export data has no type information")
+	}
+
+	// Export data is not enough when the syntax is needed as well.
+	load(false)
+	expect("syntax after export data", 0, 3, 3)
+}
+
+// TestCacheCgo checks that the flags of a package that uses cgo survive a
+// change in one of its dependencies, and that the headers it includes are part
+// of its cache key.
+func TestCacheCgo(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src", "example.com")
+	writeFile(t, filepath.Join(src, "wrapper", "wrapper.go"), `package wrapper
+
+// #cgo CFLAGS: -DVALUE=3
+// #cgo LDFLAGS: -lm
+// #include "value.h"
+import "C"
+
+import "example.com/lib"
+
+func Value() int {
+	lib.Foo()
+	return int(C.value())
+}
+`)
+	writeFile(t, filepath.Join(src, "wrapper", "value.h"), "static int value(void) { return VALUE; }\n")
+	writeFile(t, filepath.Join(src, "lib", "lib.go"), "package lib\n\nfunc Foo() {}\n")
+
+	cache := NewCache("")
+	load := func() *Package {
+		cache.Parsed = 0
+		p := newTestProgram(tmpdir)
+		p.Dir = tmpdir
+		p.Build.CgoEnabled = true
+		p.Cache = cache
+		if _, err := p.Import("example.com/wrapper", ""); err != nil {
+			t.Fatal("could not import package:", err)
+		}
+		if err := p.Parse(false); err != nil {
+			t.Fatal("could not load program:", err)
+		}
+		return p.Packages["example.com/wrapper"]
+	}
+	expectFlags := func(when string, pkg *Package) {
+		if strings.Join(pkg.CgoCompileFlags, " ") != "-DVALUE=3" || strings.Join(pkg.CgoLinkFlags, " ") != "-lm" {
+			t.Errorf("%s: unexpected cgo flags: %q, %q", when, pkg.CgoCompileFlags, pkg.CgoLinkFlags)
+		}
+	}
+
+	expectFlags("first load", load())
+
+	// The cgo package is typechecked again, but it isn't parsed again so the
+	// flags must come from the cache.
+	writeFile(t, filepath.Join(src, "lib", "lib.go"), "package lib\n\nfunc Foo() {\n\tprintln()\n}\n")
+	expectFlags("changed dependency function body", load())
+	expectFlags("unchanged load", load())
+
+	// Changing a header included by the preamble must parse the package again.
+	writeFile(t, filepath.Join(src, "wrapper", "value.h"), "static int value(void) { return VALUE + 1; }\n")
+	load()
+	if cache.Parsed != 1 {
+		t.Error("package was not parsed again after a change in an included header")
+	}
+}
+
+// TestCgoConstraints checks that exactly one of a cgo implementation and a
+// pure Go fallback is selected, depending on whether cgo is enabled.
+func TestCgoConstraints(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src", "example.com")
+	writeFile(t, filepath.Join(src, "impl", "impl.go"), "package impl\n\nfunc Value() int { return value() }\n")
+	writeFile(t, filepath.Join(src, "impl", "impl_cgo.go"), `//go:build cgo
+// +build cgo
+
+package impl
+
+// static int value(void) { return 3; }
+import "C"
+
+func value() int { return int(C.value()) }
+`)
+	writeFile(t, filepath.Join(src, "impl", "impl_nocgo.go"), `//go:build !cgo
+// +build !cgo
+
+package impl
+
+func value() int { return 3 }
+`)
+	writeFile(t, filepath.Join(src, "cgoonly", "cgoonly_cgo.go"), "package cgoonly\n\nimport \"C\"\n")
+
+	for _, cgoEnabled := range []bool{false, true} {
+		p := newTestProgram(tmpdir)
+		p.Dir = tmpdir
+		p.Build.CgoEnabled = cgoEnabled
+		pkg, err := p.Import("example.com/impl", "")
+		if err != nil {
+			t.Fatalf("cgo=%v: could not import package: %v", cgoEnabled, err)
+		}
+		goFiles := strings.Join(pkg.GoFiles, " ")
+		cgoFiles := strings.Join(pkg.CgoFiles, " ")
+		if cgoEnabled {
+			if goFiles != "impl.go" || cgoFiles != "impl_cgo.go" {
+				t.Errorf("cgo=%v: unexpected files: %q, cgo files: %q", cgoEnabled, goFiles, cgoFiles)
+			}
+			continue
+		}
+		if goFiles != "impl.go impl_nocgo.go" || cgoFiles != "" {
+			t.Errorf("cgo=%v: unexpected files: %q, cgo files: %q", cgoEnabled, goFiles, cgoFiles)
+		}
+		if err := p.Parse(false); err != nil {
+			t.Errorf("cgo=%v: could not load package with fallback implementation: %v", cgoEnabled, err)
+		}
+	}
+
+	p := newTestProgram(tmpdir)
+	_, err = p.Import("example.com/cgoonly", "")
+	if cgoErr, ok := err.(*CgoRequiredError); !ok || cgoErr.ImportPath != "example.com/cgoonly" {
+		t.Errorf("expected a *CgoRequiredError for a package without fallback, got: %v", err)
+	}
+}
+
+// TestCgoDir checks that the code generated by cgo is written to disk, and
+// that the written Go code can be parsed again.
+func TestCgoDir(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	writeFile(t, filepath.Join(tmpdir, "src", "example.com", "add", "add.go"), `package add
+
+// #cgo CFLAGS: -DADD
+// #cgo	LDFLAGS: -lm
+// int add(int a, int b);
+import "C"
+
+func Add(a, b int) int {
+	return int(C.add(C.int(a), C.int(b)))
+}
+`)
+
+	p := newTestProgram(tmpdir)
+	p.Dir = tmpdir
+	p.Build.CgoEnabled = true
+	p.CgoDir = filepath.Join(tmpdir, "cgo")
+	if _, err := p.Import("example.com/add", ""); err != nil {
+		t.Fatal("could not import package:", err)
+	}
+	if err := p.Parse(false); err != nil {
+		t.Fatal("could not load program:", err)
+	}
+
+	dir := filepath.Join(p.CgoDir, "example.com", "add")
+	if _, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, "_cgo_gotypes.go"), nil, 0); err != nil {
+		t.Error("could not parse generated Go code:", err)
+	}
+	preamble, err := ioutil.ReadFile(filepath.Join(dir, "_cgo_preamble.c"))
+	if err != nil {
+		t.Fatal("could not read C preamble:", err)
+	}
+	if !strings.Contains(string(preamble), "int add(int a, int b);") {
+		t.Errorf("C preamble does not contain the declaration from add.go:\n%s", preamble)
+	}
+	if strings.Contains(string(preamble), "#cgo") {
+		t.Errorf("C preamble contains #cgo directives:\n%s", preamble)
+	}
+}
+
+// TestAssembly checks that a function implemented in assembly is reported with
+// a suggestion to use the pure Go implementation, in a package laid out like
+// the packages in crypto/...
+func TestAssembly(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	src := filepath.Join(tmpdir, "src", "example.com")
+	writeFile(t, filepath.Join(src, "xor", "xor.go"), `package xor
+
+func XORBytes(dst, a, b []byte) int {
+	return xorBytes(dst, a, b)
+}
+`)
+	writeFile(t, filepath.Join(src, "xor", "xor_amd64.go"), `//go:build amd64 && !purego
+// +build amd64,!purego
+
+package xor
+
+//go:noescape
+func xorBytes(dst, a, b []byte) int
+`)
+	writeFile(t, filepath.Join(src, "xor", "xor_amd64.s"), "TEXT ·xorBytes(SB), 4, $0\n\tRET\n")
+	writeFile(t, filepath.Join(src, "xor", "xor_generic.go"), `//go:build !amd64 || purego
+// +build !amd64 purego
+
+package xor
+
+func xorBytes(dst, a, b []byte) int {
+	n := len(a)
+	for i := 0; i < n; i++ {
+		dst[i] = a[i] ^ b[i]
+	}
+	return n
+}
+`)
+
+	for _, tags := range [][]string{nil, {"purego"}} {
+		p := newTestProgram(tmpdir)
+		p.Dir = tmpdir
+		p.Build.GOARCH = "amd64"
+		p.Build.BuildTags = tags
+		pkg, err := p.Import("example.com/xor", "")
+		if err != nil {
+			t.Fatalf("tags=%v: could not import package: %v", tags, err)
+		}
+		if err := p.Parse(false); err != nil {
+			t.Fatalf("tags=%v: could not load package: %v", tags, err)
+		}
+		fn := pkg.Pkg.Scope().Lookup("xorBytes").(*types.Func)
+		err = p.AssemblyError(fn)
+		if tags != nil {
+			if err != nil {
+				t.Errorf("tags=%v: unexpected error for the pure Go implementation: %v", tags, err)
+			}
+			continue
+		}
+		asmErr, ok := err.(*AssemblyError)
+		if !ok {
+			t.Fatalf("expected an *AssemblyError, got: %v", err)
+		}
+		if asmErr.Func != "example.com/xor.xorBytes" || asmErr.Fallback != "xor_generic.go" || strings.Join(asmErr.Tags, " ") != "purego" {
+			t.Errorf("unexpected error: %+v", asmErr)
+		}
+		expected := filepath.FromSlash("src/example.com/xor/xor_amd64.go") + ":7:6: function example.com/xor.xorBytes is implemented in assembly (xor_amd64.s), which is not supported; the pure Go implementation in xor_generic.go is excluded by build constraints, try building with -tags=purego"
+		if asmErr.Error() != expected {
+			t.Errorf("unexpected error message:\n%s\nexpected:\n%s", asmErr.Error(), expected)
+		}
+		if err := p.AssemblyError(pkg.Pkg.Scope().Lookup("XORBytes").(*types.Func)); err != nil {
+			t.Errorf("unexpected error for a function with a body: %v", err)
+		}
+	}
+}
+
+// TestSyntheticPackages checks that unsafe and (on WebAssembly) syscall/js are
+// provided by the loader, without looking them up in GOROOT.
+func TestSyntheticPackages(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	goroot := filepath.Join(tmpdir, "goroot")
+	if err := os.Mkdir(goroot, 0777); err != nil {
+		t.Fatal(err)
+	}
+	gopath := filepath.Join(tmpdir, "gopath")
+	writeFile(t, filepath.Join(gopath, "src", "example.com", "main", "main.go"), `package main
+
+import (
+	"syscall/js"
+	"unsafe"
+)
+
+var size = unsafe.Sizeof(js.Value{})
+
+func main() {
+	js.Global().Get("console").Call("log", js.ValueOf(int(size)))
+}
+`)
+
+	p := newTestProgram(gopath)
+	p.Dir = tmpdir
+	p.Build.GOROOT = goroot
+	p.Build.GOOS = "js"
+	p.Build.GOARCH = "wasm"
+	pkg, err := p.Import("example.com/main", "")
+	if err != nil {
+		t.Fatal("could not import package:", err)
+	}
+	if err := p.Parse(false); err != nil {
+		t.Fatal("could not load package:", err)
+	}
+	if pkg.Imports["unsafe"].Pkg != types.Unsafe {
+		t.Error("unsafe is not types.Unsafe")
+	}
+	js := pkg.Imports["syscall/js"].Pkg
+	if js == nil || js.Path() != "syscall/js" || js.Name() != "js" {
+		t.Fatalf("unexpected syscall/js package: %v", js)
+	}
+	global, ok := js.Scope().Lookup("Global").(*types.Func)
+	if !ok {
+		t.Fatal("syscall/js.Global is not a function")
+	}
+	if s := global.Type().String(); s != "func() syscall/js.Value" {
+		t.Errorf("unexpected type of syscall/js.Global: %s", s)
+	}
+	size := pkg.Pkg.Scope().Lookup("size")
+	if size == nil || size.Type() != types.Typ[types.Uintptr] {
+		t.Errorf("unexpected type of main.size: %v", size)
+	}
+
+	// On other systems, syscall/js is looked up on the file system like any
+	// other package.
+	p = newTestProgram(gopath)
+	p.Build.GOROOT = goroot
+	_, err = p.Import("syscall/js", "")
+	if _, ok := err.(*PackageNotFoundError); !ok {
+		t.Errorf("expected a *PackageNotFoundError for syscall/js, got: %v", err)
+	}
+	if _, err := p.Import("unsafe", ""); err != nil {
+		t.Error("could not import unsafe:", err)
+	}
+}
+
+// TestGoVersion checks that the go directive in go.mod determines which
+// language features may be used.
+func TestGoVersion(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := filepath.Join(tmpdir, "src", "example.com", "generic")
+	writeFile(t, filepath.Join(dir, "generic.go"), `package generic
+
+func Max[T int | float64](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+`)
+
+	for _, tc := range []struct {
+		gomod     string
+		goVersion string
+		err       string
+	}{
+		{"", "", ""}, // GOPATH mode
+		{"module example.com/generic\n\ngo 1.18\n", "go1.18", ""},
+		{"module example.com/generic\n\ngo 1.17 // comment\n", "go1.17", "requires go1.18"},
+		{"module example.com/generic\n", "", ""},
+	} {
+		os.Remove(filepath.Join(dir, "go.mod"))
+		if tc.gomod != "" {
+			writeFile(t, filepath.Join(dir, "go.mod"), tc.gomod)
+		}
+		p := newTestProgram(tmpdir)
+		p.Dir = tmpdir
+		pkg, err := p.Import("example.com/generic", "")
+		if err != nil {
+			t.Fatalf("%q: could not import package: %v", tc.gomod, err)
+		}
+		if pkg.GoVersion != tc.goVersion {
+			t.Errorf("%q: expected Go version %q, got %q", tc.gomod, tc.goVersion, pkg.GoVersion)
+		}
+		if !typesGoVersion {
+			// Generics can't be parsed before Go 1.18.
+			continue
+		}
+		err = p.Parse(false)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%q: could not load package: %v", tc.gomod, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: expected an error containing %q, got: %v", tc.gomod, tc.err, err)
+		}
+	}
+
+	// An invalid go directive is reported with its position.
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/generic\n\ngo one\n")
+	_, err = newTestProgram(tmpdir).Import("example.com/generic", "")
+	if err == nil || !strings.HasSuffix(err.Error(), "go.mod:3: invalid go version: go one") {
+		t.Errorf("expected an error for an invalid go directive, got: %v", err)
+	}
+}
+
+// TestModules checks that packages are found in the main module, in a module
+// replaced by a local directory and in the module cache, when the working
+// directory is in a module.
+func TestModules(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	app := filepath.Join(tmpdir, "app")
+	lib := filepath.Join(tmpdir, "lib")
+	modcache := filepath.Join(tmpdir, "modcache")
+	writeFile(t, filepath.Join(app, "go.mod"), `module example.com/app
+
+go 1.18
+
+require (
+	example.com/Dep v1.1.0
+	example.com/lib v0.0.0 // indirect
+)
+
+replace example.com/lib => ../lib
+`)
+	writeFile(t, filepath.Join(app, "main.go"), `package main
+
+import (
+	"example.com/Dep/sub"
+	"example.com/app/util"
+	"example.com/lib"
+)
+
+func main() {
+	util.Use(lib.Value + sub.Value)
+}
+`)
+	writeFile(t, filepath.Join(app, "util", "util.go"), "package util\n\nfunc Use(n int) {}\n")
+	writeFile(t, filepath.Join(lib, "go.mod"), "module example.com/lib\n\nrequire example.com/Dep v1.2.0\n")
+	writeFile(t, filepath.Join(lib, "lib.go"), "package lib\n\nimport \"example.com/Dep/sub\"\n\nconst Value = sub.Value + 1\n")
+	for _, v := range []string{"v1.1.0", "v1.2.0"} {
+		dir := filepath.Join(modcache, "example.com", "!dep@"+v)
+		writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/Dep\n")
+		writeFile(t, filepath.Join(dir, "sub", "sub.go"), "package sub\n\nconst Value = "+strings.TrimPrefix(v, "v1.")[:1]+"\n")
+	}
+
+	p := newTestProgram(filepath.Join(tmpdir, "gopath"))
+	p.Dir = app
+	p.ModCache = modcache
+	pkg, err := p.Import(".", app)
+	if err != nil {
+		t.Fatal("could not import package:", err)
+	}
+	if pkg.ImportPath != "example.com/app" {
+		t.Errorf("unexpected import path of the main package: %s", pkg.ImportPath)
+	}
+	if err := p.Parse(false); err != nil {
+		t.Fatal("could not load program:", err)
+	}
+	for path, dir := range map[string]string{
+		"example.com/app/util": filepath.Join(app, "util"),
+		"example.com/lib":      lib,
+		"example.com/Dep/sub":  filepath.Join(modcache, "example.com", "!dep@v1.2.0", "sub"),
+	} {
+		if importedPkg := pkg.Imports[path]; importedPkg == nil || importedPkg.Package.Dir != dir {
+			t.Errorf("package %s not loaded from %s", path, dir)
+		}
+	}
+	if pkg.GoVersion != "go1.18" {
+		t.Errorf("unexpected Go version of the main package: %q", pkg.GoVersion)
+	}
+
+	_, err = p.Import("example.com/missing", app)
+	if _, ok := err.(*ModuleNotFoundError); !ok {
+		t.Errorf("expected a *ModuleNotFoundError, got: %v", err)
+	}
+}
+
+// TestBuildTags checks that exactly one file of a package with constraint
+// guarded variants is selected for each set of build tags, and that tags
+// implied by the target's build tags are set.
+func TestBuildTags(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := filepath.Join(tmpdir, "src", "example.com", "variant")
+	writeFile(t, filepath.Join(dir, "a.go"), "//go:build alpha && !beta\n\npackage variant\n\nconst Variant = \"a\"\n")
+	writeFile(t, filepath.Join(dir, "b.go"), "// +build beta,!alpha\n\npackage variant\n\nconst Variant = \"b\"\n")
+	writeFile(t, filepath.Join(dir, "c.go"), "//go:build alpha && beta\n\npackage variant\n\nconst Variant = \"c\"\n")
+	writeFile(t, filepath.Join(dir, "d.go"), "//go:build !alpha && !beta\n// +build !alpha,!beta\n\npackage variant\n\nconst Variant = \"d\"\n")
+	dir = filepath.Join(tmpdir, "src", "example.com", "implied")
+	writeFile(t, filepath.Join(dir, "unix.go"), "//go:build unix && linux\n\npackage implied\n\nconst Variant = \"unix\"\n")
+	writeFile(t, filepath.Join(dir, "other.go"), "//go:build !unix\n\npackage implied\n\nconst Variant = \"other\"\n")
+
+	for _, tc := range []struct {
+		path    string
+		goos    string
+		tags    []string
+		variant string
+	}{
+		{"example.com/variant", runtime.GOOS, []string{"alpha"}, "a"},
+		{"example.com/variant", runtime.GOOS, []string{"beta"}, "b"},
+		{"example.com/variant", runtime.GOOS, []string{"alpha", "beta"}, "c"},
+		{"example.com/variant", runtime.GOOS, nil, "d"},
+		{"example.com/implied", "js", nil, "other"},
+		{"example.com/implied", "js", []string{"linux"}, "unix"},
+		{"example.com/implied", "js", []string{"android"}, "unix"},
+	} {
+		p := newTestProgram(tmpdir)
+		p.Dir = tmpdir
+		p.Build.GOOS = tc.goos
+		p.Build.BuildTags = tc.tags
+		pkg, err := p.Import(tc.path, "")
+		if err != nil {
+			t.Errorf("%s %v: could not import package: %v", tc.path, tc.tags, err)
+			continue
+		}
+		if len(pkg.GoFiles) != 1 {
+			t.Errorf("%s %v: expected one file, got %v", tc.path, tc.tags, pkg.GoFiles)
+			continue
+		}
+		if err := p.Parse(false); err != nil {
+			t.Errorf("%s %v: could not load package: %v", tc.path, tc.tags, err)
+			continue
+		}
+		variant := pkg.Pkg.Scope().Lookup("Variant").(*types.Const).Val().ExactString()
+		if variant != `"`+tc.variant+`"` {
+			t.Errorf("%s %v: expected variant %q, got %s", tc.path, tc.tags, tc.variant, variant)
+		}
+	}
+}
+
+// TestFileSuffixes checks the files selected by their _GOOS and _GOARCH suffix
+// for a few simulated targets, including baremetal targets that claim to be
+// linux/arm and targets that only set build tags.
+func TestFileSuffixes(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-loader-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := filepath.Join(tmpdir, "src", "example.com", "suffix")
+	for _, name := range []string{
+		"suffix.go",
+		"suffix_amd64.go",
+		"suffix_arm.go",
+		"suffix_avr.go", // not a known GOARCH, so always included
+		"suffix_darwin.go",
+		"suffix_js.go",
+		"suffix_js_wasm.go",
+		"suffix_linux.go",
+		"suffix_linux_amd64.go",
+		"suffix_linux_arm.go",
+		"suffix_linux_test.go",
+		"suffix_unix.go", // not a file name suffix, so always included
+		"suffix_wasm.go",
+	} {
+		writeFile(t, filepath.Join(dir, name), "package suffix\n")
+	}
+
+	linuxARM := "suffix.go suffix_arm.go suffix_avr.go suffix_linux.go suffix_linux_arm.go suffix_unix.go"
+	jsWasm := "suffix.go suffix_avr.go suffix_js.go suffix_js_wasm.go suffix_unix.go suffix_wasm.go"
+	for _, tc := range []struct {
+		target       string
+		goos, goarch string
+		tags         []string
+		files        string
+	}{
+		{"cortex-m", "linux", "arm", []string{"tinygo", "cortexm", "baremetal", "linux", "arm"}, linuxARM},
+		{"avr", "linux", "arm", []string{"tinygo", "avr", "baremetal", "linux", "arm"}, linuxARM},
+		{"custom baremetal", "", "", []string{"tinygo", "baremetal", "linux", "arm"}, linuxARM},
+		{"wasm", "js", "wasm", []string{"tinygo", "js", "wasm"}, jsWasm},
+		{"custom wasm", "", "", []string{"tinygo", "js", "wasm"}, jsWasm},
+		{"linux/amd64", "linux", "amd64", []string{"tinygo", "linux", "amd64"}, "suffix.go suffix_amd64.go suffix_avr.go suffix_linux.go suffix_linux_amd64.go suffix_unix.go"},
+		{"android/arm64", "android", "arm64", []string{"tinygo", "android", "arm64"}, "suffix.go suffix_avr.go suffix_linux.go suffix_unix.go"},
+	} {
+		p := newTestProgram(tmpdir)
+		p.Build.GOOS = tc.goos
+		p.Build.GOARCH = tc.goarch
+		p.Build.BuildTags = tc.tags
+		pkg, err := p.Import("example.com/suffix", "")
+		if err != nil {
+			t.Errorf("%s: could not import package: %v", tc.target, err)
+			continue
+		}
+		if files := strings.Join(pkg.GoFiles, " "); files != tc.files {
+			t.Errorf("%s: unexpected files:\nexpected: %s\nactual:   %s", tc.target, tc.files, files)
+		}
+
+		// The synthetic syscall/js package is also used when GOOS and GOARCH
+		// come from the build tags.
+		if tc.files == jsWasm {
+			pkg, err := p.Import("syscall/js", "")
+			if err != nil {
+				t.Errorf("%s: could not import syscall/js: %v", tc.target, err)
+			} else if pkg.synthetic == nil {
+				t.Errorf("%s: expected the synthetic syscall/js package", tc.target)
+			}
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package loader
+
+// This file implements support for Go modules: it reads go.mod files, selects
+// the version of each required module, and finds the directory of packages in
+// those modules (in the main module, in a local replacement or in the module
+// cache).
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// module is a single module of the build list.
+type module struct {
+	Path    string // module path, like "example.com/foo"
+	Version string // selected version, or "" for the main module
+	Dir     string // directory with the source code of the module
+
+	// Module path and version to download, if the module is in the module
+	// cache. Empty for the main module and for local replacements.
+	srcPath    string
+	srcVersion string
+}
+
+// modFile is the parsed contents of a go.mod file. Only the directives that
+// are needed to build a package are kept.
+type modFile struct {
+	module    string
+	goVersion string
+	require   []moduleVersion
+	replace   []replacement
+}
+
+// moduleVersion is a module path with a version, like in a require directive.
+type moduleVersion struct {
+	path    string
+	version string
+}
+
+// replacement is a single replace directive. The version of old is empty when
+// all versions are replaced, the version of new is empty when it is a local
+// directory.
+type replacement struct {
+	old moduleVersion
+	new moduleVersion
+}
+
+// loadModules looks for a go.mod file in the working directory and its
+// parents. When there is one, imports are resolved using the modules in the
+// build list instead of GOPATH. Like the go tool, setting GO111MODULE=off
+// disables modules.
+func (p *Program) loadModules() error {
+	if p.modulesLoaded {
+		return nil
+	}
+	p.modulesLoaded = true
+	if p.Dir == "" || os.Getenv("GO111MODULE") == "off" {
+		return nil
+	}
+	gomod := ""
+	for dir := p.Dir; ; dir = filepath.Dir(dir) {
+		if p.fileExists(filepath.Join(dir, "go.mod")) {
+			gomod = filepath.Join(dir, "go.mod")
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			return nil // GOPATH mode
+		}
+	}
+	f, err := p.parseModFile(gomod)
+	if err != nil {
+		return err
+	}
+	if f.module == "" {
+		return fmt.Errorf("%s: no module declaration", gomod)
+	}
+	mainModule := &module{Path: f.module, Dir: filepath.Dir(gomod)}
+	p.mainModule = mainModule
+	p.modules = map[string]*module{mainModule.Path: mainModule}
+
+	// Select the highest version of each module that is required anywhere in
+	// the module graph (minimal version selection). Only replace directives
+	// of the main module are used, like the go tool does.
+	versions := make(map[string]string)
+	worklist := append([]moduleVersion{}, f.require...)
+	for len(worklist) != 0 {
+		req := worklist[0]
+		worklist = worklist[1:]
+		if req.path == mainModule.Path {
+			continue
+		}
+		if v, ok := versions[req.path]; ok && compareVersions(v, req.version) >= 0 {
+			continue
+		}
+		versions[req.path] = req.version
+		m := p.moduleVersion(req, f.replace)
+		requires, err := p.moduleRequirements(m)
+		if err != nil {
+			return err
+		}
+		worklist = append(worklist, requires...)
+	}
+	for path, v := range versions {
+		p.modules[path] = p.moduleVersion(moduleVersion{path, v}, f.replace)
+	}
+	return nil
+}
+
+// moduleVersion returns the module for the given required module version,
+// taking replace directives into account.
+func (p *Program) moduleVersion(req moduleVersion, replace []replacement) *module {
+	src := req
+	for _, r := range replace {
+		if r.old.path == req.path && (r.old.version == "" || r.old.version == req.version) {
+			src = r.new
+			if r.old.version != "" {
+				break // more specific than a replacement of all versions
+			}
+		}
+	}
+	if src.version == "" {
+		// Local directory, relative to the main module.
+		dir := filepath.FromSlash(src.path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(p.mainModule.Dir, dir)
+		}
+		return &module{Path: req.path, Version: req.version, Dir: dir}
+	}
+	return &module{
+		Path:       req.path,
+		Version:    req.version,
+		Dir:        filepath.Join(p.modCache(), escapeModulePath(src.path)+"@"+escapeModulePath(src.version)),
+		srcPath:    src.path,
+		srcVersion: src.version,
+	}
+}
+
+// moduleRequirements returns the modules required by the go.mod file of the
+// given module. Modules that are not (yet) in the module cache are assumed to
+// have no requirements.
+func (p *Program) moduleRequirements(m *module) ([]moduleVersion, error) {
+	paths := []string{filepath.Join(m.Dir, "go.mod")}
+	if m.srcPath != "" {
+		// The module cache keeps the go.mod file of each module version that
+		// is in the build graph, also when the module itself wasn't
+		// downloaded.
+		paths = append(paths, filepath.Join(p.modCache(), "cache", "download", escapeModulePath(m.srcPath), "@v", escapeModulePath(m.srcVersion)+".mod"))
+	}
+	for _, path := range paths {
+		if !p.fileExists(path) {
+			continue
+		}
+		f, err := p.parseModFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return f.require, nil
+	}
+	return nil, nil
+}
+
+// findModule returns the module in the build list that provides the package
+// with the given import path, and the directory of that package. It returns
+// nil if no module provides it, for example because it is part of the standard
+// library.
+func (p *Program) findModule(path string) (*module, string) {
+	var found *module
+	for modulePath, m := range p.modules {
+		if path != modulePath && !strings.HasPrefix(path, modulePath+"/") {
+			continue
+		}
+		if found == nil || len(modulePath) > len(found.Path) {
+			found = m
+		}
+	}
+	if found == nil {
+		return nil, ""
+	}
+	return found, filepath.Join(found.Dir, filepath.FromSlash(strings.TrimPrefix(path[len(found.Path):], "/")))
+}
+
+// moduleImportPath returns the import path of the package in the given
+// directory if it is part of the main module, or "" otherwise.
+func (p *Program) moduleImportPath(dir string) string {
+	if p.mainModule == nil {
+		return ""
+	}
+	rel, err := filepath.Rel(p.mainModule.Dir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	if rel == "." {
+		return p.mainModule.Path
+	}
+	return p.mainModule.Path + "/" + filepath.ToSlash(rel)
+}
+
+// downloadModule downloads the given module into the module cache using the go
+// tool, if it isn't there already.
+func (p *Program) downloadModule(m *module) error {
+	if m.srcPath == "" {
+		return nil
+	}
+	if fi, err := os.Stat(m.Dir); err == nil && fi.IsDir() {
+		return nil
+	}
+	cmd := exec.Command("go", "mod", "download", m.srcPath+"@"+m.srcVersion)
+	cmd.Dir = p.mainModule.Dir
+	cmd.Env = append(os.Environ(), "GOMODCACHE="+p.modCache())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not download module %s@%s: %s", m.srcPath, m.srcVersion, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// modCache returns the directory of the module cache: ModCache if set,
+// otherwise GOMODCACHE or the pkg/mod directory in the first GOPATH entry.
+func (p *Program) modCache() string {
+	if p.ModCache != "" {
+		return p.ModCache
+	}
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(p.Build.GOPATH)
+	if len(gopath) == 0 {
+		return ""
+	}
+	return filepath.Join(gopath[0], "pkg", "mod")
+}
+
+// fileExists returns whether the given file exists, in the file overlay or
+// on the file system.
+func (p *Program) fileExists(path string) bool {
+	if _, ok := p.overlayFile(path); ok {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// escapeModulePath escapes a module path or version for use in the module
+// cache, which must work on case-insensitive file systems: every upper case
+// letter is replaced with an exclamation mark followed by the lower case
+// letter.
+func escapeModulePath(path string) string {
+	var escaped strings.Builder
+	for _, c := range path {
+		if unicode.IsUpper(c) {
+			escaped.WriteByte('!')
+			c = unicode.ToLower(c)
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
+
+// compareVersions compares two semantic versions (like "v1.2.3" or
+// "v0.0.0-20190227180812-8dcc6e70cdef"), returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	aRelease, aPre := splitVersion(a)
+	bRelease, bPre := splitVersion(b)
+	for i := 0; i < 3; i++ {
+		if aRelease[i] != bRelease[i] {
+			if aRelease[i] < bRelease[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1 // a release is newer than a prerelease
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// splitVersion splits a semantic version in its major, minor and patch
+// numbers and the prerelease suffix. Build metadata is ignored.
+func splitVersion(v string) ([3]int, string) {
+	var release [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	pre := ""
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+	for i, part := range strings.SplitN(v, ".", 3) {
+		release[i], _ = strconv.Atoi(part)
+	}
+	return release, pre
+}
+
+// goVersion returns the Go language version (like "go1.17") declared with the
+// go directive in the go.mod file of the module that contains the given
+// directory. It returns "" if the directory is not in a module or the go.mod
+// file has no go directive, in which case all language features of the Go
+// toolchain are available, like in GOPATH mode.
+func (p *Program) goVersion(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if p.goVersions == nil {
+		p.goVersions = make(map[string]string)
+	}
+	var visited []string
+	v := ""
+	for {
+		if cached, ok := p.goVersions[dir]; ok {
+			v = cached
+			break
+		}
+		visited = append(visited, dir)
+		if path := filepath.Join(dir, "go.mod"); p.fileExists(path) {
+			f, err := p.parseModFile(path)
+			if err != nil {
+				return "", err
+			}
+			v = f.goVersion
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	for _, dir := range visited {
+		p.goVersions[dir] = v
+	}
+	return v, nil
+}
+
+// parseModFile parses the given go.mod file. Directives that are not needed
+// to build a package, like exclude and retract, are ignored.
+func (p *Program) parseModFile(path string) (*modFile, error) {
+	rd, err := p.openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	f := &modFile{}
+	block := "" // directive of the current block, like "require"
+	scanner := bufio.NewScanner(rd)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "//"); i >= 0 {
+			text = text[:i]
+		}
+		fields, err := modFields(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		directive := block
+		if block == "" {
+			directive = fields[0]
+			fields = fields[1:]
+			if len(fields) == 1 && fields[0] == "(" {
+				block = directive
+				continue
+			}
+		} else if len(fields) == 1 && fields[0] == ")" {
+			block = ""
+			continue
+		}
+		switch directive {
+		case "module":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("%s:%d: usage: module module/path", path, line)
+			}
+			f.module = fields[0]
+		case "go":
+			if len(fields) != 1 || !goVersionRE.MatchString(fields[0]) {
+				return nil, fmt.Errorf("%s:%d: invalid go version: %s", path, line, strings.TrimSpace(text))
+			}
+			f.goVersion = "go" + fields[0]
+		case "require":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s:%d: usage: require module/path v1.2.3", path, line)
+			}
+			f.require = append(f.require, moduleVersion{fields[0], fields[1]})
+		case "replace":
+			var r replacement
+			switch {
+			case len(fields) == 3 && fields[1] == "=>":
+				r = replacement{moduleVersion{fields[0], ""}, moduleVersion{fields[2], ""}}
+			case len(fields) == 4 && fields[1] == "=>":
+				r = replacement{moduleVersion{fields[0], ""}, moduleVersion{fields[2], fields[3]}}
+			case len(fields) == 4 && fields[2] == "=>":
+				r = replacement{moduleVersion{fields[0], fields[1]}, moduleVersion{fields[3], ""}}
+			case len(fields) == 5 && fields[2] == "=>":
+				r = replacement{moduleVersion{fields[0], fields[1]}, moduleVersion{fields[3], fields[4]}}
+			default:
+				return nil, fmt.Errorf("%s:%d: usage: replace module/path [v1.2.3] => other/module v1.4 or replace module/path [v1.2.3] => ../local/directory", path, line)
+			}
+			if r.new.version == "" && !isLocalModulePath(r.new.path) {
+				return nil, fmt.Errorf("%s:%d: replacement module without version must be a directory path (rooted or starting with ./ or ../)", path, line)
+			}
+			f.replace = append(f.replace, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// goVersionRE matches the versions accepted by the go directive of a go.mod
+// file, like "1.17", "1.21.0" or "1.21rc1".
+var goVersionRE = regexp.MustCompile(`^([1-9][0-9]*)\.(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*))?([a-z]+[0-9]+)?$`)
+
+// isLocalModulePath returns whether the replacement path of a replace
+// directive is a directory instead of a module path.
+func isLocalModulePath(path string) bool {
+	return filepath.IsAbs(path) || build.IsLocalImport(path)
+}
+
+// modFields splits a line of a go.mod file in its fields. Fields may be
+// quoted, like in Go source code.
+func modFields(text string) ([]string, error) {
+	var fields []string
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return fields, nil
+		}
+		if text[0] == '"' || text[0] == '`' {
+			end := strings.IndexByte(text[1:], text[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			field, err := strconv.Unquote(text[:end+2])
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field)
+			text = text[end+2:]
+			continue
+		}
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		fields = append(fields, text[:end])
+		text = text[end:]
+	}
+}
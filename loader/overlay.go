@@ -0,0 +1,121 @@
+package loader
+
+import (
+	"bytes"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// overlayFile returns the contents of the given file from the file overlay, if
+// it is present there.
+func (p *Program) overlayFile(path string) ([]byte, bool) {
+	if len(p.FileOverlay) == 0 {
+		return nil, false
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false
+	}
+	for name, contents := range p.FileOverlay {
+		if filepath.Clean(name) == path {
+			return contents, true
+		}
+	}
+	return nil, false
+}
+
+// openFile opens the given file for reading, preferring the file overlay over
+// the file system.
+func (p *Program) openFile(path string) (io.ReadCloser, error) {
+	if contents, ok := p.overlayFile(path); ok {
+		return ioutil.NopCloser(bytes.NewReader(contents)), nil
+	}
+	return os.Open(path)
+}
+
+// overlayContext returns a copy of the given build context that finds files in
+// the file overlay before looking at the file system. It returns the build
+// context itself when there is no file overlay.
+func (p *Program) overlayContext(ctx *build.Context) *build.Context {
+	if len(p.FileOverlay) == 0 {
+		return ctx
+	}
+	newCtx := *ctx
+	newCtx.JoinPath = filepath.Join
+	newCtx.OpenFile = p.openFile
+	newCtx.IsDir = p.isDir
+	newCtx.ReadDir = p.readDir
+	return &newCtx
+}
+
+// isDir implements build.Context.IsDir. A directory exists if it exists on the
+// file system or if the file overlay contains a file inside it.
+func (p *Program) isDir(path string) bool {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return true
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for name := range p.FileOverlay {
+		if strings.HasPrefix(filepath.Clean(name), path+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDir implements build.Context.ReadDir. Files in the file overlay replace
+// files with the same name on the file system, and are added to the directory
+// listing if they only exist in the file overlay.
+func (p *Program) readDir(dir string) ([]os.FileInfo, error) {
+	realInfos, err := ioutil.ReadDir(dir)
+	if err != nil && !(os.IsNotExist(err) && p.isDir(dir)) {
+		return nil, err
+	}
+	infos := make(map[string]os.FileInfo, len(realInfos))
+	for _, info := range realInfos {
+		infos[info.Name()] = info
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for name, contents := range p.FileOverlay {
+		name = filepath.Clean(name)
+		if filepath.Dir(name) != absDir {
+			continue
+		}
+		base := filepath.Base(name)
+		infos[base] = overlayFileInfo{base, int64(len(contents))}
+	}
+	list := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list, nil
+}
+
+// overlayFileInfo describes a regular file that only exists in the file
+// overlay.
+type overlayFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi overlayFileInfo) Name() string       { return fi.name }
+func (fi overlayFileInfo) Size() int64        { return fi.size }
+func (fi overlayFileInfo) Mode() os.FileMode  { return 0444 }
+func (fi overlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi overlayFileInfo) IsDir() bool        { return false }
+func (fi overlayFileInfo) Sys() interface{}   { return nil }
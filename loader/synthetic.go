@@ -0,0 +1,135 @@
+package loader
+
+// This file contains the packages that are provided by the loader itself
+// instead of being loaded from the file system, like the unsafe package.
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+)
+
+// syntheticPackage is a package that is not looked up on the file system.
+// Either it has no source at all (like unsafe), or its source is provided by
+// the loader.
+type syntheticPackage struct {
+	// Type information of a package without any source, or nil if the package
+	// is parsed and typechecked from files.
+	types *types.Package
+
+	// Source of the package, by file name.
+	files map[string]string
+
+	// match returns whether the package is synthetic for the given build
+	// context. If nil, it always is.
+	match func(ctx *build.Context) bool
+}
+
+// syntheticPackages is the registry of synthetic packages by import path. It
+// is consulted before looking for packages on the file system.
+var syntheticPackages = map[string]*syntheticPackage{
+	"unsafe": {
+		types: types.Unsafe,
+	},
+	"syscall/js": {
+		files: map[string]string{"js.go": syscallJSSource},
+		match: func(ctx *build.Context) bool {
+			return ctx.GOOS == "js" && ctx.GOARCH == "wasm"
+		},
+	},
+}
+
+// lookupSynthetic returns the synthetic package with the given import path for
+// the given build context, or nil if it should be loaded from the file system.
+func lookupSynthetic(ctx *build.Context, importPath string) *syntheticPackage {
+	synthetic := syntheticPackages[importPath]
+	if synthetic == nil || (synthetic.match != nil && !synthetic.match(ctx)) {
+		return nil
+	}
+	return synthetic
+}
+
+// importSynthetic creates a package for the given synthetic package, like
+// Import does for packages on the file system.
+func (p *Program) importSynthetic(importPath string, synthetic *syntheticPackage) (*Package, error) {
+	buildPkg := &build.Package{
+		ImportPath: importPath,
+		Name:       path.Base(importPath),
+		Goroot:     true,
+		ImportPos:  make(map[string][]token.Position),
+	}
+	if synthetic.types != nil {
+		buildPkg.Name = synthetic.types.Name()
+	}
+	imports := make(map[string]struct{})
+	for _, name := range synthetic.fileNames() {
+		buildPkg.GoFiles = append(buildPkg.GoFiles, name)
+		f, err := p.parseSyntheticFile(importPath, name, synthetic.files[name], parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, importSpec := range f.Imports {
+			to := strings.Trim(importSpec.Path.Value, `"`)
+			imports[to] = struct{}{}
+			buildPkg.ImportPos[to] = append(buildPkg.ImportPos[to], p.fset.Position(importSpec.Pos()))
+		}
+	}
+	for to := range imports {
+		buildPkg.Imports = append(buildPkg.Imports, to)
+	}
+	sort.Strings(buildPkg.Imports)
+
+	p.sorted = nil // invalidate the sorted order of packages
+	pkg := p.newPackage(buildPkg)
+	pkg.synthetic = synthetic
+	p.Packages[importPath] = pkg
+	return pkg, nil
+}
+
+// fileNames returns the names of the source files of this package, sorted.
+func (s *syntheticPackage) fileNames() []string {
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseSyntheticFile parses a source file of a synthetic package. The file is
+// named after the import path, as it doesn't exist on the file system.
+func (p *Program) parseSyntheticFile(importPath, name, src string, mode parser.Mode) (*ast.File, error) {
+	if p.fset == nil {
+		p.fset = token.NewFileSet()
+	}
+	return parser.ParseFile(p.fset, "$synthetic/"+importPath+"/"+name, src, mode)
+}
+
+// parseSynthetic parses the files of a synthetic package, or sets the type
+// information directly when the package has no source.
+func (p *Package) parseSynthetic() error {
+	if p.synthetic.types != nil {
+		p.Pkg = p.synthetic.types
+		return nil
+	}
+	var fileErrs []error
+	for _, name := range p.synthetic.fileNames() {
+		f, err := p.parseSyntheticFile(p.ImportPath, name, p.synthetic.files[name], parser.ParseComments)
+		if err != nil {
+			fileErrs = appendError(fileErrs, err)
+			continue
+		}
+		p.Files = append(p.Files, f)
+	}
+	if len(fileErrs) != 0 {
+		p.Files = nil
+		sortErrors(fileErrs)
+		return Errors{p, fileErrs}
+	}
+	return nil
+}
@@ -12,9 +12,11 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"unicode"
 
 	"github.com/tinygo-org/tinygo/compiler"
 	"github.com/tinygo-org/tinygo/interp"
@@ -44,23 +46,35 @@ func (e *multiError) Error() string {
 }
 
 type BuildConfig struct {
-	opt           string
-	gc            string
-	panicStrategy string
-	scheduler     string
-	printIR       bool
-	dumpSSA       bool
-	verifyIR      bool
-	debug         bool
-	printSizes    string
-	cFlags        []string
-	ldFlags       []string
-	tags          string
-	wasmAbi       string
-	heapSize      int64
-	testConfig    compiler.TestConfig
+	opt              string
+	gc               string
+	panicStrategy    string
+	scheduler        string
+	printIR          bool
+	dumpSSA          bool
+	interpDebug      interp.DebugLevel
+	interpProfile    bool
+	interpWarnings   bool
+	interpCPUProfile string
+	initReport       bool
+	verifyIR         bool
+	debug            bool
+	printSizes       string
+	cFlags           []string
+	ldFlags          []string
+	stringVars       map[string]string // -ldflags="-X importpath.name=value"
+	cgoDir           string
+	tags             string
+	wasmAbi          string
+	heapSize         int64
+	testConfig       compiler.TestConfig
 }
 
+// packageCache holds the packages loaded by earlier builds in this process, so
+// that programs built one after another (like in the tests) don't parse and
+// typecheck the standard library again.
+var packageCache = loader.NewCache("")
+
 // Helper function for Compiler object.
 func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, action func(string) error) error {
 	if config.gc == "" && spec.GC != "" {
@@ -85,7 +99,7 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 	if goroot == "" {
 		return errors.New("cannot locate $GOROOT, please set it manually")
 	}
-	tags := spec.BuildTags
+	tags := append([]string{}, spec.BuildTags...)
 	major, minor, err := getGorootVersion(goroot)
 	if err != nil {
 		return fmt.Errorf("could not read version from GOROOT (%v): %v", goroot, err)
@@ -96,9 +110,7 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 	for i := 1; i <= minor; i++ {
 		tags = append(tags, fmt.Sprintf("go1.%d", i))
 	}
-	if extraTags := strings.Fields(config.tags); len(extraTags) != 0 {
-		tags = append(tags, extraTags...)
-	}
+	tags = append(tags, parseTags(config.tags)...)
 	scheduler := spec.Scheduler
 	if config.scheduler != "" {
 		scheduler = config.scheduler
@@ -115,6 +127,8 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 		CFlags:        cflags,
 		LDFlags:       ldflags,
 		ClangHeaders:  getClangHeaderPath(root),
+		CgoDir:        config.cgoDir,
+		CgoEnabled:    spec.CgoEnabled(),
 		Debug:         config.debug,
 		DumpSSA:       config.dumpSSA,
 		VerifyIR:      config.verifyIR,
@@ -123,6 +137,7 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 		GOPATH:        getGopath(),
 		BuildTags:     tags,
 		TestConfig:    config.testConfig,
+		PackageCache:  packageCache,
 	}
 	c, err := compiler.NewCompiler(pkgName, compilerConfig)
 	if err != nil {
@@ -145,10 +160,44 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 		return errors.New("verification error after IR construction")
 	}
 
-	err = interp.Run(c.Module(), c.TargetData(), config.dumpSSA)
+	// Set string variables passed with -ldflags="-X ...". This must happen
+	// before package initializers are interpreted, so that globals derived
+	// from these variables are still calculated at compile time.
+	names := make([]string, 0, len(config.stringVars))
+	for name := range config.stringVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.SetStringVar(name, config.stringVars[name]); err != nil {
+			return err
+		}
+	}
+
+	interpDebug := config.interpDebug
+	if config.dumpSSA && interpDebug < interp.DebugInstructions {
+		interpDebug = interp.DebugInstructions
+	}
+	eval := interp.NewEval(c.Module(), c.TargetData())
+	eval.Debug = interpDebug
+	eval.CPUProfile = config.interpCPUProfile
+	err = eval.Run()
 	if err != nil {
 		return err
 	}
+	if config.interpProfile {
+		fmt.Fprintln(os.Stderr, "\ncompile-time evaluation profile:")
+		if err := eval.WriteProfile(os.Stderr); err != nil {
+			return err
+		}
+	}
+	if config.interpWarnings {
+		printInterpWarnings(eval.Warnings())
+	}
+	reverted := eval.Reverted()
+	// Calls that cannot be evaluated are reported in the debug output and
+	// are left to be done at runtime.
+	eval.EvalCompileTimeCalls()
 	if err := c.Verify(); err != nil {
 		return errors.New("verification error after interpreting runtime.initAll")
 	}
@@ -192,6 +241,33 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 		return errors.New("verification failure after LLVM optimization passes")
 	}
 
+	// Some package initializers can only be interpreted after inlining and
+	// simplification. Try the ones that were reverted before once more.
+	eval = interp.NewEval(c.Module(), c.TargetData())
+	eval.Debug = interpDebug
+	if config.interpCPUProfile != "" {
+		// Don't overwrite the CPU profile of the first pass.
+		eval.CPUProfile = config.interpCPUProfile + ".reverted"
+	}
+	if err := eval.RunReverted(); err != nil {
+		return err
+	}
+	if config.interpProfile && len(eval.Profile()) != 0 {
+		fmt.Fprintln(os.Stderr, "\ncompile-time evaluation profile (second pass):")
+		if err := eval.WriteProfile(os.Stderr); err != nil {
+			return err
+		}
+	}
+	if config.interpWarnings {
+		printInterpWarnings(eval.Warnings())
+	}
+	if err := c.Verify(); err != nil {
+		return errors.New("verification error after interpreting reverted package initializers")
+	}
+	if config.initReport {
+		printInitReport(eval.UpdateReverted(reverted))
+	}
+
 	// On the AVR, pointers can point either to flash or to RAM, but we don't
 	// know. As a temporary fix, load all global variables in RAM.
 	// In the future, there should be a compiler pass that determines which
@@ -278,7 +354,8 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 				if names, ok := commands[spec.Compiler]; ok {
 					cmdNames = names
 				}
-				err := execCommand(cmdNames, append(cflags, "-c", "-o", outpath, path)...)
+				pkgCFlags := append(append([]string{}, cflags...), pkg.CgoCompileFlags...)
+				err := execCommand(cmdNames, append(pkgCFlags, "-c", "-o", outpath, path)...)
 				if err != nil {
 					return &commandError{"failed to build", path, err}
 				}
@@ -286,6 +363,13 @@ func Compile(pkgName, outpath string, spec *TargetSpec, config *BuildConfig, act
 			}
 		}
 
+		// Add linker flags of packages using cgo, from #cgo LDFLAGS and
+		// pkg-config directives. They are added as-is (not deduplicated) as
+		// some flags take the next flag as argument, like -L dir.
+		for _, pkg := range c.Packages() {
+			ldflags = append(ldflags, pkg.CgoLinkFlags...)
+		}
+
 		// Link the object files together.
 		err = Link(spec.Linker, ldflags...)
 		if err != nil {
@@ -549,6 +633,49 @@ func Run(pkgName, target string, config *BuildConfig) error {
 	})
 }
 
+// parseLDFlags splits the value of the -ldflags flag into flags for the linker
+// and string variables to set, which are passed as -X importpath.name=value
+// like with the Go linker.
+func parseLDFlags(s string) (ldflags []string, stringVars map[string]string, err error) {
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		var arg string
+		switch field := fields[i]; {
+		case field == "-X" || field == "--X":
+			if i+1 == len(fields) {
+				return nil, nil, errors.New("missing argument to -X")
+			}
+			i++
+			arg = fields[i]
+		case strings.HasPrefix(field, "-X="):
+			arg = field[len("-X="):]
+		case strings.HasPrefix(field, "--X="):
+			arg = field[len("--X="):]
+		default:
+			ldflags = append(ldflags, field)
+			continue
+		}
+		eq := strings.IndexByte(arg, '=')
+		if eq < 0 {
+			return nil, nil, fmt.Errorf("-X flag requires argument of the form importpath.name=value, got %q", arg)
+		}
+		if stringVars == nil {
+			stringVars = make(map[string]string)
+		}
+		stringVars[arg[:eq]] = arg[eq+1:]
+	}
+	return ldflags, stringVars, nil
+}
+
+// parseTags splits the value of the -tags flag into build tags. Like with the
+// go tool, tags are separated by commas, but a space-separated list is still
+// accepted.
+func parseTags(s string) []string {
+	return strings.FieldsFunc(s, func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})
+}
+
 // parseSize converts a human-readable size (with k/m/g suffix) into a plain
 // number.
 func parseSize(s string) (int64, error) {
@@ -589,21 +716,45 @@ func usage() {
 	flag.PrintDefaults()
 }
 
+// printInterpWarnings prints the warnings collected while interpreting package
+// initializers, such as initializers that are run at runtime instead.
+func printInterpWarnings(warnings []*interp.Warning) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s (%s)\n", w, w.Kind)
+	}
+}
+
+// printInitReport prints why each package initializer that is run at runtime
+// could not be interpreted at compile time.
+func printInitReport(reverted []*interp.Revert) {
+	if len(reverted) == 0 {
+		fmt.Fprintln(os.Stderr, "\nall package initializers were interpreted at compile time")
+		return
+	}
+	fmt.Fprintln(os.Stderr, "\npackage initializers run at runtime:")
+	for _, r := range reverted {
+		fmt.Fprintf(os.Stderr, "%s (%s)\n", r, r.Kind)
+	}
+}
+
 func handleCompilerError(err error) {
 	if err != nil {
 		switch err := err.(type) {
-		case *interp.Unsupported:
-			// hit an unknown/unsupported instruction
-			fmt.Fprintln(os.Stderr, "unsupported instruction during init evaluation:")
-			err.Inst.Dump()
-			fmt.Fprintln(os.Stderr)
+		case *interp.Error:
+			// failed to interpret a package initializer
+			fmt.Fprintln(os.Stderr, "error:", err)
+			if inst := err.Instruction(); inst != "" && err.Kind() != interp.Panic {
+				fmt.Fprintln(os.Stderr, "\t"+inst)
+			}
+			if err.Kind() == interp.Malformed {
+				fmt.Fprintln(os.Stderr, "this is likely a compiler bug, please report it")
+			}
 		case types.Error:
 			fmt.Fprintln(os.Stderr, err)
 		case loader.Errors:
-			fmt.Fprintln(os.Stderr, "#", err.Pkg.ImportPath)
-			for _, err := range err.Errs {
-				fmt.Fprintln(os.Stderr, err)
-			}
+			err.Format(os.Stderr)
+		case loader.ErrorList:
+			err.Format(os.Stderr)
 		case *multiError:
 			for _, err := range err.Errs {
 				fmt.Fprintln(os.Stderr, err)
@@ -623,15 +774,21 @@ func main() {
 	scheduler := flag.String("scheduler", "", "which scheduler to use (coroutines, tasks)")
 	printIR := flag.Bool("printir", false, "print LLVM IR")
 	dumpSSA := flag.Bool("dumpssa", false, "dump internal Go SSA")
+	interpDebug := flag.String("interp-debug", "none", "debug output of compile-time evaluation (none, summary, instructions)")
+	interpProfile := flag.Bool("interp-profile", false, "print the time spent interpreting each package initializer")
+	interpWarnings := flag.Bool("interp-warnings", false, "print why package initializers are run at runtime instead of at compile time")
+	initReport := flag.Bool("print-init-report", false, "print why each package initializer that is run at runtime could not be interpreted at compile time")
+	interpCPUProfile := flag.String("interp-cpuprofile", "", "write a CPU profile of compile-time evaluation to this file (and of the second pass to this file with a .reverted suffix)")
 	verifyIR := flag.Bool("verifyir", false, "run extra verification steps on LLVM IR")
-	tags := flag.String("tags", "", "a space-separated list of extra build tags")
+	tags := flag.String("tags", "", "a comma-separated list of extra build tags")
 	target := flag.String("target", "", "LLVM target | .json file with TargetSpec")
 	printSize := flag.String("size", "", "print sizes (none, short, full)")
 	nodebug := flag.Bool("no-debug", false, "disable DWARF debug symbol generation")
 	ocdOutput := flag.Bool("ocd-output", false, "print OCD daemon output during debug")
 	port := flag.String("port", "/dev/ttyACM0", "flash port")
 	cFlags := flag.String("cflags", "", "additional cflags for compiler")
-	ldFlags := flag.String("ldflags", "", "additional ldflags for linker")
+	ldFlags := flag.String("ldflags", "", "additional ldflags for linker, and -X importpath.name=value to set string variables")
+	keepCgo := flag.String("keep-cgo", "", "write the code generated by cgo to this directory")
 	wasmAbi := flag.String("wasm-abi", "js", "WebAssembly ABI conventions: js (no i64 params) or generic")
 	heapSize := flag.String("heap-size", "1M", "default heap size in bytes (only supported by WebAssembly)")
 
@@ -644,17 +801,22 @@ func main() {
 
 	flag.CommandLine.Parse(os.Args[2:])
 	config := &BuildConfig{
-		opt:           *opt,
-		gc:            *gc,
-		panicStrategy: *panicStrategy,
-		scheduler:     *scheduler,
-		printIR:       *printIR,
-		dumpSSA:       *dumpSSA,
-		verifyIR:      *verifyIR,
-		debug:         !*nodebug,
-		printSizes:    *printSize,
-		tags:          *tags,
-		wasmAbi:       *wasmAbi,
+		opt:              *opt,
+		gc:               *gc,
+		panicStrategy:    *panicStrategy,
+		scheduler:        *scheduler,
+		printIR:          *printIR,
+		dumpSSA:          *dumpSSA,
+		interpProfile:    *interpProfile,
+		interpWarnings:   *interpWarnings,
+		interpCPUProfile: *interpCPUProfile,
+		initReport:       *initReport,
+		verifyIR:         *verifyIR,
+		debug:            !*nodebug,
+		printSizes:       *printSize,
+		cgoDir:           *keepCgo,
+		tags:             *tags,
+		wasmAbi:          *wasmAbi,
 	}
 
 	if *cFlags != "" {
@@ -662,7 +824,26 @@ func main() {
 	}
 
 	if *ldFlags != "" {
-		config.ldFlags = strings.Split(*ldFlags, " ")
+		var err error
+		config.ldFlags, config.stringVars, err = parseLDFlags(*ldFlags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not parse -ldflags:", err)
+			usage()
+			os.Exit(1)
+		}
+	}
+
+	switch *interpDebug {
+	case "none":
+		config.interpDebug = interp.DebugNone
+	case "summary":
+		config.interpDebug = interp.DebugSummary
+	case "instructions":
+		config.interpDebug = interp.DebugInstructions
+	default:
+		fmt.Fprintln(os.Stderr, "Interp debug level must be one of none, summary or instructions.")
+		usage()
+		os.Exit(1)
 	}
 
 	if *panicStrategy != "print" && *panicStrategy != "trap" {
@@ -6,12 +6,20 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/tinygo-org/tinygo/loader"
@@ -58,6 +66,9 @@ func TestCompiler(t *testing.T) {
 
 	t.Log("running tests for emulated cortex-m3...")
 	for _, path := range matches {
+		if path == filepath.Join("testdata", "cgo")+string(filepath.Separator) {
+			continue // cgo is not supported on bare metal targets
+		}
 		t.Run(path, func(t *testing.T) {
 			runTest(path, tmpdir, "qemu", t)
 		})
@@ -89,6 +100,9 @@ func TestCompiler(t *testing.T) {
 			if path == filepath.Join("testdata", "gc.go") {
 				continue // known to fail
 			}
+			if path == filepath.Join("testdata", "cgo")+string(filepath.Separator) {
+				continue // cgo is not supported on WebAssembly
+			}
 			t.Run(path, func(t *testing.T) {
 				runTest(path, tmpdir, "wasm", t)
 			})
@@ -96,6 +110,386 @@ func TestCompiler(t *testing.T) {
 	}
 }
 
+// TestReflectConformance runs the reflect conformance program in
+// tests/reflectconformance on the host and on emulated targets with a
+// different pointer size, as the way values are stored in a reflect.Value
+// depends on the pointer size.
+func TestReflectConformance(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	path := filepath.Join("tests", "reflectconformance") + string(filepath.Separator)
+	t.Run("host", func(t *testing.T) {
+		runTest(path, tmpdir, "", t)
+	})
+	// 32-bit little-endian. This also runs in short mode, as the host is
+	// usually 64-bit.
+	t.Run("cortex-m3", func(t *testing.T) {
+		runTest(path, tmpdir, "qemu", t)
+	})
+	if testing.Short() {
+		return
+	}
+	if runtime.GOOS == "linux" {
+		// 16-bit, with 8-bit alignment.
+		t.Run("avr", func(t *testing.T) {
+			runTest(path, tmpdir, "atmega1284p", t)
+		})
+		// 64-bit, even when the host is not.
+		t.Run("linux/arm64", func(t *testing.T) {
+			runTest(path, tmpdir, "aarch64--linux-gnu", t)
+		})
+	}
+}
+
+// TestReflectSidetables checks that programs that don't use reflection don't
+// carry any struct field metadata: it must only be emitted when reflect needs
+// it.
+func TestReflectSidetables(t *testing.T) {
+	ir, err := buildIR(filepath.Join(TESTDATA, "structs.go"), testBuildConfig())
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	for _, name := range []string{
+		"reflect.structTypesSidetable",
+		"reflect.structNamesSidetable",
+		"reflect.interfaceTypesSidetable",
+		"reflect.methodSetsSidetable",
+		"reflect/types.structFieldName",
+		"reflect/types.structFieldTag",
+		"reflect/types.structFieldPkgPath",
+		"reflect/types.interfaceMethodName",
+		"reflect/types.interfaceMethodPkgPath",
+	} {
+		if bytes.Contains(ir, []byte(name)) {
+			t.Errorf("program without reflection contains %s", name)
+		}
+	}
+}
+
+// sidetableSizes returns the size in bytes of every reflect sidetable in the
+// given IR. Sidetables are global arrays of integers with names like
+// reflect.structTypesSidetable.
+func sidetableSizes(ir []byte) map[string]int {
+	sidetableRegexp := regexp.MustCompile(`(?m)^@(reflect\.\w+Sidetable) = .*?\[(\d+) x i(\d+)\]`)
+	sizes := make(map[string]int)
+	for _, match := range sidetableRegexp.FindAllSubmatch(ir, -1) {
+		length, _ := strconv.Atoi(string(match[2]))
+		bits, _ := strconv.Atoi(string(match[3]))
+		sizes[string(match[1])] = length * bits / 8
+	}
+	return sizes
+}
+
+// TestReflectMethodListSharing checks that a named type, the pointer to it and
+// an interface with the same methods share a single method list in the
+// reflect sidetables.
+func TestReflectMethodListSharing(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Build the same program twice: once with only the named type and once
+	// also with the pointer type and an interface with the same methods.
+	const code = `package main
+
+import "reflect"
+
+type T struct{ X int }
+
+func (T) A() int { return 1 }
+func (T) B() int { return 2 }
+
+type AB interface {
+	A() int
+	B() int
+}
+
+func main() {
+	println(reflect.TypeOf(T{}).NumMethod())
+	%s
+}
+`
+	var sizes [2]map[string]int
+	for i, extra := range []string{"", "println(reflect.TypeOf(&T{}).NumMethod(), reflect.TypeOf((*AB)(nil)).Elem().NumMethod())"} {
+		path := filepath.Join(tmpdir, "methods"+strconv.Itoa(i)+".go")
+		err := ioutil.WriteFile(path, []byte(fmt.Sprintf(code, extra)), 0666)
+		if err != nil {
+			t.Fatal("could not write test program:", err)
+		}
+		outpath := filepath.Join(tmpdir, "methods"+strconv.Itoa(i)+".ll")
+		err = Build(path, outpath, "", testBuildConfig())
+		if err != nil {
+			t.Fatal("failed to build:", err)
+		}
+		ir, err := ioutil.ReadFile(outpath)
+		if err != nil {
+			t.Fatal("could not read IR:", err)
+		}
+		sizes[i] = sidetableSizes(ir)
+	}
+	const name = "reflect.interfaceTypesSidetable"
+	if sizes[0][name] == 0 {
+		t.Fatalf("no %s found", name)
+	}
+	if sizes[0][name] != sizes[1][name] {
+		t.Errorf("method lists are not shared: %s grew from %d to %d bytes", name, sizes[0][name], sizes[1][name])
+	}
+}
+
+// TestReflectStringTable checks that struct field names and tags that are
+// used by more than one struct type are stored only once, using a program that
+// declares its types the way a JSON API client would. The program is built
+// with one and with three struct types, and the struct names sidetable may
+// only grow by the names and tags that weren't used before. Without
+// deduplication, it would grow by the names and tags of every new field.
+//
+// Names and tags are not left out for struct types that reflect can't reach:
+// Type.Field reads both, so a program that reads any struct field needs all of
+// them. Only whole sidetables are left out when they are unused.
+func TestReflectStringTable(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	const code = `package main
+
+import "reflect"
+
+type User struct {
+	ID        int    ` + "`json:\"id\"`" + `
+	Name      string ` + "`json:\"name,omitempty\"`" + `
+	CreatedAt int64  ` + "`json:\"created_at\"`" + `
+}
+
+%s
+
+func main() {
+	for _, v := range []interface{}{User{}, %s} {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			println(field.Name, field.Tag)
+		}
+	}
+}
+`
+	const extraTypes = `type Repository struct {
+	ID        int    ` + "`json:\"id\"`" + `
+	Name      string ` + "`json:\"name,omitempty\"`" + `
+	Owner     User   ` + "`json:\"owner\"`" + `
+	CreatedAt int64  ` + "`json:\"created_at\"`" + `
+}
+
+type Issue struct {
+	ID        int        ` + "`json:\"id\"`" + `
+	Name      string     ` + "`json:\"name,omitempty\"`" + `
+	Author    User       ` + "`json:\"author\"`" + `
+	Repo      Repository ` + "`json:\"repo\"`" + `
+	CreatedAt int64      ` + "`json:\"created_at\"`" + `
+}`
+
+	const name = "reflect.structNamesSidetable"
+	var sizes, naiveSizes, uniqueSizes [2]int
+	for i, extra := range [][2]string{{"", ""}, {extraTypes, "Repository{}, Issue{}"}} {
+		source := fmt.Sprintf(code, extra[0], extra[1])
+		path := filepath.Join(tmpdir, "api"+strconv.Itoa(i)+".go")
+		err := ioutil.WriteFile(path, []byte(source), 0666)
+		if err != nil {
+			t.Fatal("could not write test program:", err)
+		}
+		outpath := filepath.Join(tmpdir, "api"+strconv.Itoa(i)+".ll")
+		err = Build(path, outpath, "", testBuildConfig())
+		if err != nil {
+			t.Fatal("failed to build:", err)
+		}
+		ir, err := ioutil.ReadFile(outpath)
+		if err != nil {
+			t.Fatal("could not read IR:", err)
+		}
+		sizes[i] = sidetableSizes(ir)[name]
+		if sizes[i] == 0 {
+			t.Fatalf("no %s found", name)
+		}
+		naiveSizes[i], uniqueSizes[i] = structStringSizes(t, source)
+	}
+	growth := sizes[1] - sizes[0]
+	t.Logf("%s grew by %d bytes, %d bytes without deduplication", name, growth, naiveSizes[1]-naiveSizes[0])
+	if growth > uniqueSizes[1]-uniqueSizes[0] {
+		t.Errorf("%s grew by %d bytes, expected at most %d bytes for the new names and tags", name, growth, uniqueSizes[1]-uniqueSizes[0])
+	}
+}
+
+// structStringSizes returns the number of bytes needed to store the names and
+// tags of all struct fields in the given source as varint-prefixed strings,
+// once for every field and once for every distinct string.
+func structStringSizes(t *testing.T, source string) (naive, unique int) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, 0)
+	if err != nil {
+		t.Fatal("could not parse test program:", err)
+	}
+	seen := make(map[string]bool)
+	buf := make([]byte, binary.MaxVarintLen64)
+	ast.Inspect(file, func(node ast.Node) bool {
+		structType, ok := node.(*ast.StructType)
+		if !ok {
+			return true
+		}
+		for _, field := range structType.Fields.List {
+			values := []string{field.Names[0].Name}
+			if field.Tag != nil {
+				tag, _ := strconv.Unquote(field.Tag.Value)
+				values = append(values, tag)
+			}
+			for _, s := range values {
+				size := binary.PutUvarint(buf, uint64(len(s))) + len(s)
+				naive += size
+				if !seen[s] {
+					seen[s] = true
+					unique += size
+				}
+			}
+		}
+		return true
+	})
+	return naive, unique
+}
+
+// TestStringVars checks that string variables set with -ldflags="-X ..." are
+// known to package initializers at compile time.
+func TestStringVars(t *testing.T) {
+	ldflags, stringVars, err := parseLDFlags("-s -X main.Version=1.2.3 -X=main.BuildID=abc")
+	if err != nil {
+		t.Fatal("could not parse ldflags:", err)
+	}
+	if len(ldflags) != 1 || ldflags[0] != "-s" {
+		t.Errorf("unexpected linker flags: %q", ldflags)
+	}
+	config := testBuildConfig()
+	config.stringVars = stringVars
+	ir, err := buildIR(filepath.Join(TESTDATA, "ldflags.go"), config)
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	if !bytes.Contains(ir, []byte(`c"v1.2.3 (abc)"`)) {
+		t.Error("derived string was not calculated at compile time")
+	}
+	if regexp.MustCompile(`call .*@runtime\.stringConcat\(`).Match(ir) {
+		t.Error("string concatenation was not folded")
+	}
+
+	// Only package-level string variables can be set.
+	for _, name := range []string{"main.count", "main.main", "main.missing", "unknown/pkg.Version"} {
+		config.stringVars = map[string]string{name: "x"}
+		_, err = buildIR(filepath.Join(TESTDATA, "ldflags.go"), config)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("expected an error about %s, got: %v", name, err)
+		}
+	}
+}
+
+// TestReflectPanics checks that invalid uses of reflect.Value panic with the
+// same messages as the standard library. Panics cannot be recovered yet, so
+// every case is built and run as a separate program, which is slow: the cases
+// are skipped in short mode.
+func TestReflectPanics(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a separate program for every case")
+	}
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tests := []struct {
+		name string
+		code string
+		msg  string
+	}{
+		{"Bool", `reflect.ValueOf(3).Bool()`, "reflect: call of reflect.Value.Bool on int Value"},
+		{"ZeroValue", `reflect.Value{}.Int()`, "reflect: call of reflect.Value.Int on zero Value"},
+		{"Len", `reflect.ValueOf(3).Len()`, "reflect: call of reflect.Value.Len on int Value"},
+		{"Field", `reflect.ValueOf(3).Field(0)`, "reflect: call of reflect.Value.Field on int Value"},
+		{"Unaddressable", `reflect.ValueOf(3).SetInt(5)`, "reflect: reflect.Value.SetInt using unaddressable value"},
+		{"Unexported", `reflect.ValueOf(&struct{ x int }{}).Elem().Field(0).SetInt(5)`, "reflect: reflect.Value.SetInt using value obtained using unexported field"},
+		{"Interface", `reflect.ValueOf(struct{ x int }{}).Field(0).Interface()`, "reflect.Value.Interface: cannot return value obtained from unexported field or method"},
+		{"Set", `reflect.ValueOf(new(int)).Elem().Set(reflect.ValueOf("a"))`, "reflect.Set: value of type string is not assignable to type int"},
+		{"SetUnexported", `reflect.ValueOf(new(int)).Elem().Set(reflect.ValueOf(struct{ x int }{}).Field(0))`, "reflect: reflect.Value.Set using value obtained using unexported field"},
+		{"UnsafeAddr", `reflect.ValueOf(3).UnsafeAddr()`, "reflect.Value.UnsafeAddr of unaddressable value"},
+		{"MapIndex", `reflect.ValueOf(map[string]int{}).MapIndex(reflect.ValueOf(3))`, "reflect.Value.MapIndex: value of type int is not assignable to type string"},
+		{"AppendSlice", `reflect.AppendSlice(reflect.ValueOf([]int{}), reflect.ValueOf([]string{}))`, "reflect.AppendSlice: int != string"},
+		{"Copy", `reflect.Copy(reflect.ValueOf([]int{}), reflect.ValueOf([]string{}))`, "reflect.Copy: int != string"},
+		{"Grow", `reflect.ValueOf([]int{}).Grow(1)`, "reflect: reflect.Value.Grow using unaddressable value"},
+
+		// Sizes that exceed the address space. The element types are sized
+		// relative to uintptr, so that these are the same boundaries as on a
+		// target with a 16-bit uintptr.
+		{"MakeSliceSize", `reflect.MakeSlice(reflect.TypeOf([][^uintptr(0) >> 8]byte{}), 0, 512)`, "reflect.MakeSlice: cap out of range"},
+		{"GrowSize", `reflect.ValueOf(new([][^uintptr(0) >> 8]byte)).Elem().Grow(512)`, "reflect.Value.Grow: slice overflow"},
+		{"ArrayOfSize", `reflect.ArrayOf(512, reflect.TypeOf([^uintptr(0) >> 8]byte{}))`, "reflect.ArrayOf: array size would exceed virtual address space"},
+		{"MakeMapSize", `reflect.MakeMap(reflect.TypeOf(map[string][300]byte{}))`, "reflect.MakeMapWithSize: key or element type of map[string][300]uint8 is too large"},
+		{"StructOfSize", `t := reflect.TypeOf([^uintptr(0) >> 2]byte{}); reflect.StructOf([]reflect.StructField{{Name: "A", Type: t}, {Name: "B", Type: t}, {Name: "C", Type: t}})`, "reflect.StructOf: struct size would exceed virtual address space"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(tmpdir, tc.name+".go")
+			code := "package main\n\nimport \"reflect\"\n\nfunc main() {\n\t" + tc.code + "\n\tprintln(\"no panic\")\n}\n"
+			err := ioutil.WriteFile(path, []byte(code), 0666)
+			if err != nil {
+				t.Fatal("could not write test program:", err)
+			}
+			binary := filepath.Join(tmpdir, tc.name)
+			err = Build(path, binary, "", testBuildConfig())
+			if err != nil {
+				t.Fatal("failed to build:", err)
+			}
+			stdout := &bytes.Buffer{}
+			cmd := exec.Command(binary)
+			cmd.Stdout = stdout
+			cmd.Run() // the program is expected to abort
+			expected := "panic: " + tc.msg + "\n"
+			if !bytes.Contains(stdout.Bytes(), []byte(expected)) {
+				t.Errorf("expected output %q, got %q", expected, stdout.String())
+			}
+		})
+	}
+}
+
+// testBuildConfig returns the build options used by the tests that inspect the
+// output of the compiler.
+func testBuildConfig() *BuildConfig {
+	return &BuildConfig{
+		opt:      "z",
+		verifyIR: true,
+		wasmAbi:  "js",
+	}
+}
+
+// buildIR builds the given program for the host and returns the resulting LLVM
+// IR in textual form.
+func buildIR(path string, config *BuildConfig) ([]byte, error) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	outpath := filepath.Join(tmpdir, "out.ll")
+	err = Build("./"+path, outpath, "", config)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(outpath)
+}
+
 func runTest(path, tmpdir string, target string, t *testing.T) {
 	// Get the expected output for this test.
 	txtpath := path[:len(path)-3] + ".txt"
@@ -128,6 +522,12 @@ func runTest(path, tmpdir string, target string, t *testing.T) {
 			for _, err := range errLoader.Errs {
 				t.Log("failed to build:", err)
 			}
+		} else if errList, ok := err.(loader.ErrorList); ok {
+			for _, errLoader := range errList {
+				for _, err := range errLoader.Errs {
+					t.Log("failed to build:", err)
+				}
+			}
 		} else {
 			t.Log("failed to build:", err)
 		}
@@ -137,6 +537,7 @@ func runTest(path, tmpdir string, target string, t *testing.T) {
 
 	// Run the test.
 	var cmd *exec.Cmd
+	emulator := ""
 	if target == "" {
 		cmd = exec.Command(binary)
 	} else {
@@ -147,12 +548,16 @@ func runTest(path, tmpdir string, target string, t *testing.T) {
 		if len(spec.Emulator) == 0 {
 			t.Fatal("no emulator available for target:", target)
 		}
+		emulator = spec.Emulator[0]
 		args := append(spec.Emulator[1:], binary)
-		cmd = exec.Command(spec.Emulator[0], args...)
+		cmd = exec.Command(emulator, args...)
 	}
 	stdout := &bytes.Buffer{}
 	cmd.Stdout = stdout
-	if target != "" {
+	if emulator == "simavr" {
+		// simavr prints the UART output as log messages on stderr.
+		cmd.Stderr = stdout
+	} else if target != "" {
 		cmd.Stderr = os.Stderr
 	}
 	err = cmd.Run()
@@ -162,6 +567,13 @@ func runTest(path, tmpdir string, target string, t *testing.T) {
 
 	// putchar() prints CRLF, convert it to LF.
 	actual := bytes.Replace(stdout.Bytes(), []byte{'\r', '\n'}, []byte{'\n'}, -1)
+	if emulator == "simavr" {
+		// Strip the colors simavr prints around each line. It prints control
+		// characters as dots, so CRLF line endings show up as two dots.
+		actual = bytes.Replace(actual, []byte("\x1b[32m"), nil, -1)
+		actual = bytes.Replace(actual, []byte("\x1b[0m"), nil, -1)
+		actual = bytes.Replace(actual, []byte("..\n"), []byte("\n"), -1)
+	}
 
 	// Check whether the command ran successfully.
 	fail := false
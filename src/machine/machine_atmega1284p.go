@@ -0,0 +1,7 @@
+// +build avr,atmega1284p
+
+package machine
+
+// CPU_FREQUENCY is the maximum clock frequency of the chip, which is also the
+// frequency simavr is run at in the tests.
+const CPU_FREQUENCY = 20000000
@@ -0,0 +1,82 @@
+package reflect
+
+// This file implements conversions between values of different types. The
+// string conversions use the same runtime functions as compiled code, so that
+// the result is exactly the same as with a Go conversion expression.
+
+import (
+	"unsafe"
+)
+
+//go:linkname stringFromBytes runtime.stringFromBytes
+func stringFromBytes(x []byte) string
+
+//go:linkname stringToBytes runtime.stringToBytes
+func stringToBytes(x string) []byte
+
+//go:linkname stringFromRunes runtime.stringFromRunes
+func stringFromRunes(runeSlice []rune) string
+
+//go:linkname stringToRunes runtime.stringToRunes
+func stringToRunes(s string) []rune
+
+// ConvertibleTo returns whether a value of type t can be converted to type u.
+// Only conversions between types with the same underlying basic type and
+// between strings and byte or rune slices are supported at the moment.
+func (t Type) ConvertibleTo(u Type) bool {
+	if t == u {
+		return true
+	}
+	switch {
+	case t.Kind() == String && u.Kind() == Slice:
+		return isByteOrRuneSlice(u)
+	case t.Kind() == Slice && u.Kind() == String:
+		return isByteOrRuneSlice(t)
+	case t.Kind() == u.Kind():
+		// Basic types (named or not) of the same kind have the same
+		// underlying type.
+		return t%2 == 0 && u%2 == 0
+	}
+	return false
+}
+
+// isByteOrRuneSlice returns whether t is a slice type with an unnamed byte or
+// rune element type, which can be converted to and from a string.
+func isByteOrRuneSlice(t Type) bool {
+	elem := t.Elem()
+	return elem == Uint8.basicType() || elem == Int32.basicType()
+}
+
+// Convert returns the value v converted to type t. It panics if the conversion
+// is not possible, see ConvertibleTo.
+func (v Value) Convert(t Type) Value {
+	if !v.Type().ConvertibleTo(t) {
+		panic("reflect.Value.Convert: value of type " + v.Type().String() + " cannot be converted to type " + t.String())
+	}
+	flags := v.flags & valueFlagExported
+	switch {
+	case v.Kind() == String && t.Kind() == Slice:
+		s := *(*string)(v.value)
+		if t.Elem() == Uint8.basicType() {
+			slice := new([]byte)
+			*slice = stringToBytes(s)
+			return Value{t, unsafe.Pointer(slice), flags}
+		}
+		slice := new([]rune)
+		*slice = stringToRunes(s)
+		return Value{t, unsafe.Pointer(slice), flags}
+	case v.Kind() == Slice && t.Kind() == String:
+		s := new(string)
+		if v.Type().Elem() == Uint8.basicType() {
+			*s = stringFromBytes(*(*[]byte)(v.value))
+		} else {
+			*s = stringFromRunes(*(*[]rune)(v.value))
+		}
+		return Value{t, unsafe.Pointer(s), flags}
+	}
+
+	// The underlying type is the same, so only the type code changes. Make a
+	// copy of the value, as the original may be modified later.
+	i := v.valueInterface()
+	return Value{t, (*interfaceHeader)(unsafe.Pointer(&i)).value, flags}
+}
@@ -0,0 +1,436 @@
+package reflect
+
+// This file implements ArrayOf, MapOf and StructOf. The compiler stores array,
+// map and struct types in sidetables, with the index in the sidetable shifted
+// left by one in the type code. Types constructed at runtime that the compiler
+// didn't emit are stored in dynamicTypes instead, and have the lowest bit of
+// this number set to indicate that it is an index into dynamicTypes.
+//
+// The garbage collector doesn't know the layout of types constructed at
+// runtime, so every dynamic type also carries a pointer bitmap that is
+// computed from its element or field types. All allocations done by the
+// reflect package pass the pointer bitmap of the allocated type to the runtime
+// (see runtime.allocLayout).
+//
+// Types may be constructed from multiple goroutines or from interrupts, so
+// dynamicTypes, dynamicTypeIndex and pointerBitmaps are only accessed while
+// holding typeLock.
+
+import (
+	"unsafe"
+)
+
+// dynamicType is an array, map or struct type that was constructed at runtime.
+type dynamicType struct {
+	kind Kind // Array, Map or Struct
+
+	// The type data, in the same format as an entry in the sidetable of this
+	// kind of type (like arrayTypesSidetable).
+	data []byte
+
+	// The struct field names and tags, in the same format as
+	// structNamesSidetable. Only used for struct types.
+	names []byte
+
+	// The pointer bitmap of this type, see pointerBitmap.
+	bitmap []byte
+}
+
+// dynamicTypes lists all types constructed at runtime. Types are never
+// removed from it, so that a type code stays valid forever.
+var dynamicTypes []*dynamicType
+
+// dynamicTypeIndex maps the key of every type in dynamicTypes (see
+// dynamicTypeKey) to its type code, so that constructing the same type twice
+// returns the same Type.
+var dynamicTypeIndex map[string]Type
+
+// pointerBitmaps caches the pointer bitmaps of types emitted by the compiler
+// that contain pointers, so they don't have to be recomputed for every
+// allocation.
+var pointerBitmaps map[Type][]byte
+
+// makeComplexType returns the type code of the (unnamed) non-basic type of
+// the given kind with the given upper bits, see the top of type.go.
+func makeComplexType(kind Kind, data uintptr) Type {
+	n := kind - Array
+	if kind > String {
+		// String is a basic type, so it has no number here.
+		n--
+	}
+	return Type(data<<5) + Type(n<<1) + 1
+}
+
+// dynamic returns the descriptor of a type constructed at runtime, or nil
+// if t was emitted by the compiler. It may only be called for array, map and
+// struct types.
+func (t Type) dynamic() *dynamicType {
+	id := uintptr(t.stripPrefix())
+	if id%2 == 0 {
+		return nil
+	}
+	typeLock.Lock()
+	dt := dynamicTypes[id>>1]
+	typeLock.Unlock()
+	return dt
+}
+
+// typeData returns a pointer to the data of an array, map or struct type. The
+// table is the sidetable for this kind of type, which is used for types
+// emitted by the compiler.
+func (t Type) typeData(table unsafe.Pointer) unsafe.Pointer {
+	if dt := t.dynamic(); dt != nil {
+		return unsafe.Pointer(&dt.data[0])
+	}
+	return unsafe.Pointer(uintptr(table) + uintptr(t.stripPrefix())>>1)
+}
+
+// structNames returns the table with the names and tags of the fields of a
+// struct type.
+func (t Type) structNames() unsafe.Pointer {
+	if dt := t.dynamic(); dt != nil {
+		return unsafe.Pointer(&dt.names[0])
+	}
+	return unsafe.Pointer(&structNamesSidetable)
+}
+
+// dynamicTypeKey returns the key of a type in dynamicTypeIndex. The length of
+// the type data follows from its contents, so it can't be confused with the
+// names that follow it.
+func dynamicTypeKey(kind Kind, data, names []byte) string {
+	return string(append(append([]byte{byte(kind)}, data...), names...))
+}
+
+// addDynamicType returns the type of the given kind with the given data and
+// names, registering it if it wasn't constructed before. The pointer bitmap
+// must already be computed by the caller from the element or field types, as
+// the type can't be inspected before it is registered.
+func addDynamicType(kind Kind, data, names, bitmap []byte) Type {
+	key := dynamicTypeKey(kind, data, names)
+	typeLock.Lock()
+	t, ok := dynamicTypeIndex[key]
+	if !ok {
+		// Another goroutine may have added the same type since the caller
+		// looked for it in the sidetables, so check again while holding the
+		// lock before adding it.
+		dynamicTypes = append(dynamicTypes, &dynamicType{kind: kind, data: data, names: names, bitmap: bitmap})
+		t = makeComplexType(kind, uintptr(len(dynamicTypes)-1)<<1|1)
+		if dynamicTypeIndex == nil {
+			dynamicTypeIndex = make(map[string]Type)
+		}
+		dynamicTypeIndex[key] = t
+	}
+	typeLock.Unlock()
+	return t
+}
+
+// ArrayOf returns the array type with the given length and element type. It
+// returns the same Type as the compiler uses if this array type exists in the
+// program.
+func ArrayOf(length int, elem Type) Type {
+	if length < 0 {
+		panic("reflect: negative length passed to ArrayOf")
+	}
+	checkedSize(uint64(length), elem.Size(), "reflect.ArrayOf: array size would exceed virtual address space")
+
+	// Look for this type in the sidetable of the compiler. It is a sequence
+	// of {element type, array length} that ends with a zero type code.
+	p := unsafe.Pointer(&arrayTypesSidetable)
+	for {
+		entry := uintptr(p) - uintptr(unsafe.Pointer(&arrayTypesSidetable))
+		var elemType, arrayLen uintptr
+		elemType, p = readVarint(p)
+		if elemType == 0 {
+			break
+		}
+		arrayLen, p = readVarint(p)
+		if Type(elemType) == elem && arrayLen == uintptr(length) {
+			return makeComplexType(Array, entry<<1)
+		}
+	}
+
+	data := appendVarint(nil, uintptr(elem))
+	data = appendVarint(data, uintptr(length))
+	var bitmap []byte
+	if length != 0 && elem.hasPointers() {
+		elemSize := elem.Size()
+		bitmap = newPointerBitmap(uintptr(length) * elemSize)
+		for i := 0; i < length; i++ {
+			elem.addPointers(bitmap, uintptr(i)*elemSize)
+		}
+	}
+	return addDynamicType(Array, data, nil, bitmap)
+}
+
+// MapOf returns the map type with the given key and element types. It panics
+// if the key type is not a valid map key type.
+func MapOf(key, elem Type) Type {
+	if !key.Comparable() {
+		panic("reflect.MapOf: invalid key type " + key.String())
+	}
+
+	// Look for this type in the sidetable of the compiler. It is a sequence
+	// of {key type, element type} that ends with a zero type code.
+	p := unsafe.Pointer(&mapTypesSidetable)
+	for {
+		entry := uintptr(p) - uintptr(unsafe.Pointer(&mapTypesSidetable))
+		var keyType, elemType uintptr
+		keyType, p = readVarint(p)
+		if keyType == 0 {
+			break
+		}
+		elemType, p = readVarint(p)
+		if Type(keyType) == key && Type(elemType) == elem {
+			return makeComplexType(Map, entry<<1)
+		}
+	}
+
+	data := appendVarint(nil, uintptr(key))
+	data = appendVarint(data, uintptr(elem))
+	// A map is a single pointer.
+	bitmap := newPointerBitmap(unsafe.Sizeof(uintptr(0)))
+	setPointerBit(bitmap, 0)
+	return addDynamicType(Map, data, nil, bitmap)
+}
+
+// StructOf returns the struct type containing the given fields. The Offset and
+// Index fields are ignored and computed as the compiler would. Only exported
+// fields are supported, and methods of embedded fields are not promoted.
+func StructOf(fields []StructField) Type {
+	// Don't modify the slice of the caller when setting the offsets.
+	fields = append([]StructField(nil), fields...)
+	seen := make(map[string]bool, len(fields))
+	offset := uintptr(0)
+	for i := range fields {
+		field := &fields[i]
+		if field.Name == "" {
+			panic("reflect.StructOf: field " + itoa(i) + " has no name")
+		}
+		if !isExportedName(field.Name) || field.PkgPath != "" {
+			panic("reflect.StructOf: field \"" + field.Name + "\" is unexported")
+		}
+		if seen[field.Name] {
+			panic("reflect.StructOf: duplicate field " + field.Name)
+		}
+		seen[field.Name] = true
+		offset = align(offset, uintptr(field.Type.Align()))
+		if field.Type.Size() > maxSize-offset {
+			panic("reflect.StructOf: struct size would exceed virtual address space")
+		}
+		field.Offset = offset
+		offset += field.Type.Size()
+	}
+
+	// Look for this type in the sidetable of the compiler. The sidetable
+	// ends with a header that says the struct has no fields but does have
+	// unexported fields.
+	p := unsafe.Pointer(&structTypesSidetable)
+	for {
+		entry := uintptr(p) - uintptr(unsafe.Pointer(&structTypesSidetable))
+		var header uintptr
+		header, p = readVarint(p)
+		if header == 1 {
+			break
+		}
+		p = skipStructFields(header, p)
+		if t := makeComplexType(Struct, entry<<1); t.hasFields(fields) {
+			return t
+		}
+	}
+	// Encode the struct type in the format used by the compiler (see
+	// Type.Field), except that strings refer to names. A struct type that was
+	// constructed before has the same encoding.
+	data := appendVarint(nil, uintptr(len(fields))<<1)
+	var names []byte
+	previousOffset := uintptr(0)
+	for _, field := range fields {
+		flagsByte := byte(4) // exported
+		if field.Anonymous {
+			flagsByte |= 1
+		}
+		if field.Tag != "" {
+			flagsByte |= 2
+		}
+		data = append(data, flagsByte)
+		data = appendVarint(data, field.Offset-previousOffset)
+		previousOffset = field.Offset
+		data = appendVarint(data, uintptr(field.Type))
+		data = appendVarint(data, uintptr(len(names)))
+		names = appendVarint(names, uintptr(len(field.Name)))
+		names = append(names, field.Name...)
+		if field.Tag != "" {
+			data = appendVarint(data, uintptr(len(names)))
+			names = appendVarint(names, uintptr(len(field.Tag)))
+			names = append(names, field.Tag...)
+		}
+	}
+	if len(names) == 0 {
+		// Make sure structNames can point to something.
+		names = []byte{0}
+	}
+	var bitmap []byte
+	for _, field := range fields {
+		if field.Type.hasPointers() {
+			if bitmap == nil {
+				bitmap = newPointerBitmap(offset)
+			}
+			field.Type.addPointers(bitmap, field.Offset)
+		}
+	}
+	return addDynamicType(Struct, data, names, bitmap)
+}
+
+// skipStructFields skips past the fields of a struct in the struct types
+// sidetable, where p points just after the header.
+func skipStructFields(header uintptr, p unsafe.Pointer) unsafe.Pointer {
+	if header&1 != 0 {
+		// Skip the package path.
+		_, p = readVarint(p)
+	}
+	for i := uintptr(0); i < header>>1; i++ {
+		flagsByte := *(*uint8)(p)
+		p = unsafe.Pointer(uintptr(p) + 1)
+		_, p = readVarint(p) // offset
+		_, p = readVarint(p) // type
+		_, p = readVarint(p) // name
+		if flagsByte&2 != 0 {
+			_, p = readVarint(p) // tag
+		}
+	}
+	return p
+}
+
+// hasFields returns whether the struct type t has exactly the given fields,
+// with offsets as computed by StructOf.
+func (t Type) hasFields(fields []StructField) bool {
+	if t.NumField() != len(fields) {
+		return false
+	}
+	for i, field := range fields {
+		f := t.Field(i)
+		if f.Name != field.Name || f.PkgPath != "" || f.Type != field.Type || f.Tag != field.Tag || f.Anonymous != field.Anonymous || f.Offset != field.Offset {
+			return false
+		}
+	}
+	return true
+}
+
+// appendVarint appends n to buf in the varint encoding read by readVarint.
+func appendVarint(buf []byte, n uintptr) []byte {
+	for n >= 0x80 {
+		buf = append(buf, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(buf, byte(n))
+}
+
+// pointerBitmap returns the pointer bitmap of type t, as expected by
+// runtime.allocLayout: bit n is set if the word at offset
+// n*unsafe.Sizeof(uintptr(0)) may contain a pointer. It returns nil if the type
+// doesn't contain any pointers.
+func (t Type) pointerBitmap() []byte {
+	switch t.Kind() {
+	case Array, Map, Struct:
+		if dt := t.dynamic(); dt != nil {
+			return dt.bitmap
+		}
+	}
+	if !t.hasPointers() {
+		return nil
+	}
+	typeLock.Lock()
+	bitmap, ok := pointerBitmaps[t]
+	typeLock.Unlock()
+	if ok {
+		return bitmap
+	}
+
+	// Compute the bitmap without holding the lock, as it can be large. Check
+	// again afterwards, so that every caller gets the same bitmap.
+	bitmap = t.makePointerBitmap()
+	typeLock.Lock()
+	if existing, ok := pointerBitmaps[t]; ok {
+		bitmap = existing
+	} else {
+		if pointerBitmaps == nil {
+			pointerBitmaps = make(map[Type][]byte)
+		}
+		pointerBitmaps[t] = bitmap
+	}
+	typeLock.Unlock()
+	return bitmap
+}
+
+// makePointerBitmap computes the pointer bitmap of type t.
+func (t Type) makePointerBitmap() []byte {
+	bitmap := newPointerBitmap(t.Size())
+	t.addPointers(bitmap, 0)
+	return bitmap
+}
+
+// newPointerBitmap returns an empty pointer bitmap for a value of the given
+// size.
+func newPointerBitmap(size uintptr) []byte {
+	wordSize := unsafe.Sizeof(uintptr(0))
+	numWords := (size + wordSize - 1) / wordSize
+	return make([]byte, (numWords+7)/8)
+}
+
+// hasPointers returns whether a value of type t may contain a pointer.
+func (t Type) hasPointers() bool {
+	switch t.Kind() {
+	case Chan, Func, Interface, Map, Ptr, Slice, String, UnsafePointer:
+		return true
+	case Array:
+		return t.Len() != 0 && t.Elem().hasPointers()
+	case Struct:
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			if t.Field(i).Type.hasPointers() {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// addPointers sets the bits in the pointer bitmap for all pointers of a value
+// of type t that is stored at the given offset.
+func (t Type) addPointers(bitmap []byte, offset uintptr) {
+	switch t.Kind() {
+	case Chan, Map, Ptr, UnsafePointer:
+		setPointerBit(bitmap, offset)
+	case Slice:
+		setPointerBit(bitmap, offset+unsafe.Offsetof(sliceHeader{}.data))
+	case String:
+		setPointerBit(bitmap, offset+unsafe.Offsetof(stringHeader{}.data))
+	case Interface:
+		setPointerBit(bitmap, offset+unsafe.Offsetof(interfaceHeader{}.value))
+	case Func:
+		setPointerBit(bitmap, offset+unsafe.Offsetof(funcHeader{}.Context))
+	case Array:
+		elem := t.Elem()
+		if !elem.hasPointers() {
+			return
+		}
+		elemSize := elem.Size()
+		length := t.Len()
+		for i := 0; i < length; i++ {
+			elem.addPointers(bitmap, offset+uintptr(i)*elemSize)
+		}
+	case Struct:
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			field := t.Field(i)
+			field.Type.addPointers(bitmap, offset+field.Offset)
+		}
+	}
+}
+
+// setPointerBit marks the word at the given offset as a possible pointer.
+func setPointerBit(bitmap []byte, offset uintptr) {
+	word := offset / unsafe.Sizeof(uintptr(0))
+	bitmap[word/8] |= 1 << (word % 8)
+}
@@ -0,0 +1,115 @@
+package reflect
+
+// This file implements comparison of values of any comparable type, as needed
+// for the == operator on interface values and for map keys.
+
+import (
+	"unsafe"
+)
+
+// equal returns whether the two values of type t stored at x and y are equal,
+// following the rules of the == operator.
+func equal(t Type, x, y unsafe.Pointer) bool {
+	switch t.Kind() {
+	case Bool, Int, Int8, Int16, Int32, Int64, Uint, Uint8, Uint16, Uint32, Uint64, Uintptr, UnsafePointer, Chan, Ptr:
+		n := t.Size()
+		for i := uintptr(0); i < n; i++ {
+			if *(*uint8)(unsafe.Pointer(uintptr(x) + i)) != *(*uint8)(unsafe.Pointer(uintptr(y) + i)) {
+				return false
+			}
+		}
+		return true
+	case Float32:
+		return *(*float32)(x) == *(*float32)(y)
+	case Float64:
+		return *(*float64)(x) == *(*float64)(y)
+	case Complex64:
+		return *(*complex64)(x) == *(*complex64)(y)
+	case Complex128:
+		return *(*complex128)(x) == *(*complex128)(y)
+	case String:
+		return *(*string)(x) == *(*string)(y)
+	case Interface:
+		itfX := (*interfaceHeader)(x)
+		itfY := (*interfaceHeader)(y)
+		if itfX.typecode != itfY.typecode {
+			return false
+		}
+		if itfX.typecode == 0 {
+			// Both are nil interfaces.
+			return true
+		}
+		return interfaceValueEqual(itfX.typecode, &itfX.value, &itfY.value)
+	case Array:
+		elem := t.Elem()
+		elemSize := elem.Size()
+		n := uintptr(t.Len())
+		for i := uintptr(0); i < n; i++ {
+			offset := i * elemSize
+			if !equal(elem, unsafe.Pointer(uintptr(x)+offset), unsafe.Pointer(uintptr(y)+offset)) {
+				return false
+			}
+		}
+		return true
+	case Struct:
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			field := t.Field(i)
+			if !equal(field.Type, unsafe.Pointer(uintptr(x)+field.Offset), unsafe.Pointer(uintptr(y)+field.Offset)) {
+				return false
+			}
+		}
+		return true
+	default: // Slice, Map, Func
+		mustBeComparable(t)
+		return false
+	}
+}
+
+//go:linkname runtimePanic runtime.runtimePanic
+func runtimePanic(msg string)
+
+// mustBeComparable panics with the same message as the Go runtime if values of
+// type t cannot be compared with the == operator. Comparing two interfaces
+// that hold such values, comparing them with Value.Equal, and using them as
+// map keys all panic this way.
+func mustBeComparable(t Type) {
+	if !t.Comparable() {
+		runtimePanic("comparing uncomparable type " + t.String())
+	}
+}
+
+// interfaceValueEqual compares the values of two interfaces with dynamic type
+// t, given pointers to the value field of both interfaces. It implements
+// interface comparison for the runtime.
+//
+//go:linkname interfaceValueEqual runtime.interfaceValueEqual
+func interfaceValueEqual(t Type, x, y *unsafe.Pointer) bool {
+	mustBeComparable(t)
+	return equal(t, interfaceData(t, x), interfaceData(t, y))
+}
+
+// interfaceData returns a pointer to the data of an interface value with
+// dynamic type t, given a pointer to the value field of the interface. Small
+// values are stored directly in the value field instead of being pointed to.
+func interfaceData(t Type, value *unsafe.Pointer) unsafe.Pointer {
+	if t.Size() <= unsafe.Sizeof(uintptr(0)) {
+		return unsafe.Pointer(value)
+	}
+	return *value
+}
+
+// Equal reports whether v is equal to u, following the rules of the ==
+// operator. Two invalid values are equal. It panics if the values are of the
+// same type but this type is not comparable, like the == operator does for
+// interface values.
+func (v Value) Equal(u Value) bool {
+	if !v.IsValid() || !u.IsValid() {
+		return v.IsValid() == u.IsValid()
+	}
+	if v.Type() != u.Type() {
+		return false
+	}
+	mustBeComparable(v.Type())
+	return equal(v.Type(), v.pointerTo(v.Type(), "reflect.Value.Equal"), u.pointerTo(u.Type(), "reflect.Value.Equal"))
+}
@@ -0,0 +1,7 @@
+// +build !avr
+
+package reflect
+
+// intw is an integer type with the size of the length and capacity fields of
+// slices and strings. On most targets this is int, like in the standard library.
+type intw = int
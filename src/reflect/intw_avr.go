@@ -0,0 +1,8 @@
+// +build avr
+
+package reflect
+
+// intw is an integer type with the size of the length and capacity fields of
+// slices and strings. On AVR, int is 32 bits but pointers (and thus lengths)
+// are only 16 bits, so int cannot be used here.
+type intw = int16
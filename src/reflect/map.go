@@ -0,0 +1,243 @@
+package reflect
+
+// This file implements map operations on map values of any type. The runtime
+// hashmap does not know about types, so the hash of a key and the function to
+// compare two keys are derived here from the key type code.
+//
+// The hash must be identical to the one the compiler uses for the same key
+// type, otherwise maps created by compiled code cannot be read or written
+// reflectively without corrupting its buckets. See compiler/map.go.
+
+import (
+	"unsafe"
+)
+
+//go:linkname hashmapMake runtime.hashmapReflectMake
+func hashmapMake(keySize, valueSize uintptr, sizeHint uintptr) unsafe.Pointer
+
+//go:linkname hashmapLen runtime.hashmapReflectLen
+func hashmapLen(m unsafe.Pointer) int
+
+//go:linkname hashmapSet runtime.hashmapReflectSet
+func hashmapSet(m unsafe.Pointer, key, value unsafe.Pointer, hash uint32, keyEqual func(x, y unsafe.Pointer, n uintptr) bool)
+
+//go:linkname hashmapGet runtime.hashmapReflectGet
+func hashmapGet(m unsafe.Pointer, key, value unsafe.Pointer, hash uint32, keyEqual func(x, y unsafe.Pointer, n uintptr) bool) bool
+
+//go:linkname hashmapDelete runtime.hashmapReflectDelete
+func hashmapDelete(m unsafe.Pointer, key unsafe.Pointer, hash uint32, keyEqual func(x, y unsafe.Pointer, n uintptr) bool)
+
+// FNV-1a parameters, identical to the ones used in runtime.hashmapHash.
+const (
+	fnvOffsetBasis uint32 = 2166136261
+	fnvPrime       uint32 = 16777619
+)
+
+// hashBytes continues the FNV-1a hash h with the n bytes at ptr.
+func hashBytes(h uint32, ptr unsafe.Pointer, n uintptr) uint32 {
+	for i := uintptr(0); i < n; i++ {
+		h ^= uint32(*(*uint8)(unsafe.Pointer(uintptr(ptr) + i)))
+		h *= fnvPrime
+	}
+	return h
+}
+
+// isBinaryKey returns whether keys of this type are hashed and compared as
+// plain bytes by compiled code. This must match hashmapIsBinaryKey in the
+// compiler.
+func isBinaryKey(t Type) bool {
+	switch t.Kind() {
+	case Bool, Int, Int8, Int16, Int32, Int64, Uint, Uint8, Uint16, Uint32, Uint64, Uintptr, Ptr:
+		return true
+	case Array:
+		return isBinaryKey(t.Elem())
+	case Struct:
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			if !isBinaryKey(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// hash returns the hash of the value of type t stored at ptr, as used for map
+// keys.
+func hash(t Type, ptr unsafe.Pointer) uint32 {
+	if isBinaryKey(t) {
+		// Binary keys are hashed as a whole, including any padding.
+		return hashBytes(fnvOffsetBasis, ptr, t.Size())
+	}
+	return hashValue(fnvOffsetBasis, t, ptr)
+}
+
+// hashValue continues the hash h with the value of type t stored at ptr.
+// Values that compare equal must result in the same hash.
+func hashValue(h uint32, t Type, ptr unsafe.Pointer) uint32 {
+	switch t.Kind() {
+	case Bool, Int, Int8, Int16, Int32, Int64, Uint, Uint8, Uint16, Uint32, Uint64, Uintptr, UnsafePointer, Chan, Ptr:
+		return hashBytes(h, ptr, t.Size())
+	case Float32:
+		return hashFloat32(h, *(*float32)(ptr))
+	case Float64:
+		return hashFloat64(h, *(*float64)(ptr))
+	case Complex64:
+		c := *(*complex64)(ptr)
+		return hashFloat32(hashFloat32(h, real(c)), imag(c))
+	case Complex128:
+		c := *(*complex128)(ptr)
+		return hashFloat64(hashFloat64(h, real(c)), imag(c))
+	case String:
+		s := (*stringHeader)(ptr)
+		return hashBytes(h, s.data, s.len)
+	case Interface:
+		itf := (*interfaceHeader)(ptr)
+		h = hashBytes(h, unsafe.Pointer(&itf.typecode), unsafe.Sizeof(itf.typecode))
+		if itf.typecode == 0 {
+			// nil interface
+			return h
+		}
+		return hashValue(h, itf.typecode, interfaceData(itf.typecode, &itf.value))
+	case Array:
+		elem := t.Elem()
+		elemSize := elem.Size()
+		n := uintptr(t.Len())
+		for i := uintptr(0); i < n; i++ {
+			h = hashValue(h, elem, unsafe.Pointer(uintptr(ptr)+i*elemSize))
+		}
+		return h
+	case Struct:
+		numField := t.NumField()
+		for i := 0; i < numField; i++ {
+			field := t.Field(i)
+			h = hashValue(h, field.Type, unsafe.Pointer(uintptr(ptr)+field.Offset))
+		}
+		return h
+	default: // Slice, Map, Func
+		runtimePanic("hash of unhashable type " + t.String())
+		return h
+	}
+}
+
+// hashFloat32 continues the hash h with the given float. NaN values never
+// compare equal so their hash doesn't matter, but +0 and -0 must hash the same.
+func hashFloat32(h uint32, f float32) uint32 {
+	if f == 0 {
+		f = 0
+	}
+	return hashBytes(h, unsafe.Pointer(&f), 4)
+}
+
+// hashFloat64 is like hashFloat32, but for float64 values.
+func hashFloat64(h uint32, f float64) uint32 {
+	if f == 0 {
+		f = 0
+	}
+	return hashBytes(h, unsafe.Pointer(&f), 8)
+}
+
+// keyEqual returns an equality function for keys of the given type, as
+// expected by the runtime hashmap implementation.
+func keyEqual(t Type) func(x, y unsafe.Pointer, n uintptr) bool {
+	return func(x, y unsafe.Pointer, n uintptr) bool {
+		return equal(t, x, y)
+	}
+}
+
+// MakeMap creates a new map with the specified type.
+func MakeMap(typ Type) Value {
+	return MakeMapWithSize(typ, 8)
+}
+
+// MakeMapWithSize creates a new map with the specified type and initial space
+// for approximately n elements.
+func MakeMapWithSize(typ Type, n int) Value {
+	if typ.Kind() != Map {
+		panic("reflect.MakeMapWithSize of non-map type")
+	}
+	if n < 0 {
+		n = 0
+	}
+	// The runtime stores the key and element sizes in a byte, so bigger
+	// types would get buckets that are too small.
+	keySize := typ.Key().Size()
+	elemSize := typ.Elem().Size()
+	if keySize > 255 || elemSize > 255 {
+		panic("reflect.MakeMapWithSize: key or element type of " + typ.String() + " is too large")
+	}
+	m := hashmapMake(keySize, elemSize, uintptr(n))
+	return Value{typ, m, valueFlagExported}
+}
+
+// MapIndex returns the value associated with key in the map v. It returns the
+// zero Value if key is not found in the map or if v is a nil map.
+func (v Value) MapIndex(key Value) Value {
+	v.mustBe(Map, "reflect.Value.MapIndex")
+	keyType := v.Type().Key()
+	keyPtr := key.pointerTo(keyType, "reflect.Value.MapIndex")
+	m := unsafe.Pointer(v.Pointer())
+	if m == nil {
+		return Value{}
+	}
+	elemType := v.Type().Elem()
+	elem := allocLayout(elemType.Size(), uintptr(elemType.Align()), elemType.pointerBitmap())
+	if !hashmapGet(m, keyPtr, elem, hash(keyType, keyPtr), keyEqual(keyType)) {
+		return Value{}
+	}
+	// The returned value is a copy, so it must not be addressable.
+	if elemType.Size() <= unsafe.Sizeof(uintptr(0)) {
+		elem = unsafe.Pointer(loadValue(elem, elemType.Size()))
+	}
+	return Value{
+		typecode: elemType,
+		value:    elem,
+		flags:    v.flags &^ valueFlagIndirect,
+	}
+}
+
+// SetMapIndex sets the element associated with key in the map v to elem. If
+// elem is the zero Value, SetMapIndex deletes the key from the map.
+func (v Value) SetMapIndex(key, elem Value) {
+	v.mustBe(Map, "reflect.Value.SetMapIndex")
+	v.mustBeExported("reflect.Value.SetMapIndex")
+	key.mustBeExported("reflect.Value.SetMapIndex")
+	keyType := v.Type().Key()
+	keyPtr := key.pointerTo(keyType, "reflect.Value.SetMapIndex")
+	m := unsafe.Pointer(v.Pointer())
+	if !elem.IsValid() {
+		if m != nil {
+			hashmapDelete(m, keyPtr, hash(keyType, keyPtr), keyEqual(keyType))
+		}
+		return
+	}
+	elem.mustBeExported("reflect.Value.SetMapIndex")
+	elemPtr := elem.pointerTo(v.Type().Elem(), "reflect.Value.SetMapIndex")
+	if m == nil {
+		panic("assignment to entry in nil map")
+	}
+	hashmapSet(m, keyPtr, elemPtr, hash(keyType, keyPtr), keyEqual(keyType))
+}
+
+// pointerTo returns a pointer to the data of this value, converted to type t.
+// The value must be of type t, or t must be an interface type in which case
+// the value is wrapped in an interface. For small values that are stored
+// directly in the Value, the returned pointer points to a copy.
+// The context is used in the panic message when the value is not assignable to
+// type t.
+func (v Value) pointerTo(t Type, context string) unsafe.Pointer {
+	if v.Type() == t {
+		if v.isIndirect() || t.Size() > unsafe.Sizeof(uintptr(0)) {
+			return v.value
+		}
+		value := v.value
+		return unsafe.Pointer(&value)
+	}
+	if t.Kind() != Interface || !v.Type().Implements(t) {
+		panic(context + ": value of type " + v.Type().String() + " is not assignable to type " + t.String())
+	}
+	itf := v.valueInterface()
+	return unsafe.Pointer(&itf)
+}
@@ -19,15 +19,27 @@ var structNamesSidetable byte
 //go:extern reflect.arrayTypesSidetable
 var arrayTypesSidetable byte
 
+//go:extern reflect.mapTypesSidetable
+var mapTypesSidetable byte
+
+//go:extern reflect.interfaceTypesSidetable
+var interfaceTypesSidetable byte
+
+// The methods of named types and pointers to named types, as a list of
+// {typecode, index in interfaceTypesSidetable} entries terminated by a zero
+// typecode.
+//go:extern reflect.methodSetsSidetable
+var methodSetsSidetable byte
+
 // readStringSidetable reads a string from the given table (like
 // structNamesSidetable) and returns this string. No heap allocation is
 // necessary because it makes the string point directly to the raw bytes of the
 // table.
 func readStringSidetable(table unsafe.Pointer, index uintptr) string {
 	nameLen, namePtr := readVarint(unsafe.Pointer(uintptr(table) + index))
-	return *(*string)(unsafe.Pointer(&StringHeader{
-		Data: uintptr(namePtr),
-		Len:  nameLen,
+	return *(*string)(unsafe.Pointer(&stringHeader{
+		data: namePtr,
+		len:  nameLen,
 	}))
 }
 
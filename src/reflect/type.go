@@ -11,14 +11,15 @@ import (
 // xxxxx0: basic types, where xxxxx is the basic type number (never 0).
 //         The higher bits indicate the named type, if any.
 //  nxxx1: complex types, where n indicates whether this is a named type (named
-//         if set) and xxx contains the type kind number:
-//             0 (0001): Chan
-//             1 (0011): Interface
-//             2 (0101): Ptr
-//             3 (0111): Slice
-//             4 (1001): Array
-//             5 (1011): Func
-//             6 (1101): Map
+//         if set) and xxx contains the type kind number, in the same order
+//         as the Kind constants:
+//             0 (0001): Array
+//             1 (0011): Chan
+//             2 (0101): Func
+//             3 (0111): Interface
+//             4 (1001): Map
+//             5 (1011): Ptr
+//             6 (1101): Slice
 //             7 (1111): Struct
 //         The higher bits are either the contents of the type depending on the
 //         type (if n is clear) or indicate the number of the named type (if n
@@ -28,6 +29,7 @@ type Kind uintptr
 
 // Copied from reflect/type.go
 // https://golang.org/src/reflect/type.go?s=8302:8316#L217
+// The numeric values must stay identical to the ones of the standard library.
 const (
 	Invalid Kind = iota
 	Bool
@@ -46,20 +48,30 @@ const (
 	Float64
 	Complex64
 	Complex128
-	String
-	UnsafePointer
+	Array
 	Chan
+	Func
 	Interface
+	Map
 	Ptr
 	Slice
-	Array
-	Func
-	Map
+	String
 	Struct
+	UnsafePointer
 )
 
+// PtrTo returns the pointer type with element type t. Like slice types, pointer
+// types are stored directly in the type code, so unlike the types constructed
+// by ArrayOf, MapOf and StructOf they don't need to be registered.
 func PtrTo(t Type) Type {
-	return (t << 5) + Type((Ptr-19)<<1) + 1
+	return (t << 5) + Type((Ptr-Array)<<1) + 1
+}
+
+// SliceOf returns the slice type with element type t. Like pointer types, slice
+// types are stored directly in the type code so they can be constructed at
+// runtime, even if the compiler never emitted this slice type.
+func SliceOf(t Type) Type {
+	return (t << 5) + Type((Slice-Array)<<1) + 1
 }
 
 func (k Kind) String() string {
@@ -133,8 +145,58 @@ func TypeOf(i interface{}) Type {
 	return ValueOf(i).typecode
 }
 
+// String returns a string representation of the type, like "[]int" or
+// "map[string]bool". The names of named types are not stored in the binary,
+// so named types are described by their underlying type instead.
 func (t Type) String() string {
-	return "T"
+	switch t.Kind() {
+	case Chan:
+		return "chan " + t.Elem().String()
+	case Ptr:
+		return "*" + t.Elem().String()
+	case Slice:
+		return "[]" + t.Elem().String()
+	case Array:
+		return "[" + itoa(t.Len()) + "]" + t.Elem().String()
+	case Map:
+		return "map[" + t.Key().String() + "]" + t.Elem().String()
+	case Struct:
+		numField := t.NumField()
+		if numField == 0 {
+			return "struct {}"
+		}
+		s := "struct {"
+		for i := 0; i < numField; i++ {
+			if i != 0 {
+				s += ";"
+			}
+			field := t.Field(i)
+			s += " " + field.Name + " " + field.Type.String()
+		}
+		return s + " }"
+	case Interface:
+		if t.NumMethod() == 0 {
+			return "interface {}"
+		}
+		return "interface"
+	default:
+		return t.Kind().String()
+	}
+}
+
+// itoa converts a non-negative integer to its decimal representation.
+func itoa(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	var buf [20]byte
+	i := len(buf)
+	for n != 0 {
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
+	}
+	return string(buf[i:])
 }
 
 func (t Type) Kind() Kind {
@@ -142,25 +204,43 @@ func (t Type) Kind() Kind {
 		// basic type
 		return Kind((t >> 1) % 32)
 	} else {
-		return Kind(t>>1)%8 + 19
+		// The non-basic kinds are numbered from Array to Struct, except for
+		// String which is a basic type.
+		kind := Kind(t>>1)%8 + Array
+		if kind >= String {
+			kind++
+		}
+		return kind
 	}
 }
 
-// Elem returns the element type for channel, slice and array types, the
-// pointed-to value for pointer types, and the key type for map types.
+// Elem returns the element type for channel, slice, array and map types, and
+// the pointed-to value for pointer types.
 func (t Type) Elem() Type {
 	switch t.Kind() {
 	case Chan, Ptr, Slice:
 		return t.stripPrefix()
 	case Array:
-		index := t.stripPrefix()
-		elem, _ := readVarint(unsafe.Pointer(uintptr(unsafe.Pointer(&arrayTypesSidetable)) + uintptr(index)))
+		elem, _ := readVarint(t.typeData(unsafe.Pointer(&arrayTypesSidetable)))
+		return Type(elem)
+	case Map:
+		_, p := readVarint(t.typeData(unsafe.Pointer(&mapTypesSidetable)))
+		elem, _ := readVarint(p)
 		return Type(elem)
-	default: // not implemented: Map
-		panic("unimplemented: (reflect.Type).Elem()")
+	default:
+		panic(&TypeError{"Elem"})
 	}
 }
 
+// Key returns the key type of a map type. It panics if t is not a map type.
+func (t Type) Key() Type {
+	if t.Kind() != Map {
+		panic(&TypeError{"Key"})
+	}
+	key, _ := readVarint(t.typeData(unsafe.Pointer(&mapTypesSidetable)))
+	return Type(key)
+}
+
 // stripPrefix removes the "prefix" (the first 5 bytes of the type code) from
 // the type code. If this is a named type, it will resolve the underlying type
 // (which is the data for this named type). If it is not, the lower bits are
@@ -186,19 +266,28 @@ func (t Type) Field(i int) StructField {
 	if t.Kind() != Struct {
 		panic(&TypeError{"Field"})
 	}
-	structIdentifier := t.stripPrefix()
-
-	numField, p := readVarint(unsafe.Pointer(uintptr(unsafe.Pointer(&structTypesSidetable)) + uintptr(structIdentifier)))
-	if uint(i) >= uint(numField) {
+	header, p := readVarint(t.typeData(unsafe.Pointer(&structTypesSidetable)))
+	if uint(i) >= uint(header>>1) {
 		panic("reflect: field index out of range")
 	}
 
+	// The lowest bit of the header indicates whether the struct has unexported
+	// fields. They are all declared in the same package, so the package path
+	// is stored only once.
+	names := t.structNames()
+	pkgPath := ""
+	if header&1 != 0 {
+		var pkgPathNum uintptr
+		pkgPathNum, p = readVarint(p)
+		pkgPath = readStringSidetable(names, pkgPathNum)
+	}
+
 	// Iterate over every field in the struct and update the StructField each
 	// time, until the target field has been reached. This is very much not
 	// efficient, but it is easy to implement.
 	// Adding a jump table at the start to jump to the field directly would
 	// make this much faster, but that would also impact code size.
-	field := StructField{}
+	field := StructField{Index: []int{i}}
 	offset := uintptr(0)
 	for fieldNum := 0; fieldNum <= i; fieldNum++ {
 		// Read some flags of this field, like whether the field is an
@@ -206,21 +295,21 @@ func (t Type) Field(i int) StructField {
 		flagsByte := *(*uint8)(p)
 		p = unsafe.Pointer(uintptr(p) + 1)
 
+		// Read the offset of this field, relative to the previous field.
+		var offsetDelta uintptr
+		offsetDelta, p = readVarint(p)
+		offset += offsetDelta
+		field.Offset = offset
+
 		// Read the type of this struct field.
 		var fieldType uintptr
 		fieldType, p = readVarint(p)
 		field.Type = Type(fieldType)
 
-		// Move Offset forward to align it to this field's alignment.
-		// Assume alignment is a power of two.
-		offset = align(offset, uintptr(field.Type.Align()))
-		field.Offset = offset
-		offset += field.Type.Size() // starting (unaligned) offset for next field
-
 		// Read the field name.
 		var nameNum uintptr
 		nameNum, p = readVarint(p)
-		field.Name = readStringSidetable(unsafe.Pointer(&structNamesSidetable), nameNum)
+		field.Name = readStringSidetable(names, nameNum)
 
 		// The first bit in the flagsByte indicates whether this is an embedded
 		// field.
@@ -231,7 +320,7 @@ func (t Type) Field(i int) StructField {
 			// There is a tag.
 			var tagNum uintptr
 			tagNum, p = readVarint(p)
-			field.Tag = readStringSidetable(unsafe.Pointer(&structNamesSidetable), tagNum)
+			field.Tag = readStringSidetable(names, tagNum)
 		} else {
 			// There is no tag.
 			field.Tag = ""
@@ -239,20 +328,98 @@ func (t Type) Field(i int) StructField {
 
 		// The third bit indicates whether this field is exported.
 		if flagsByte&4 != 0 {
-			// This field is exported.
 			field.PkgPath = ""
 		} else {
-			// This field is unexported.
-			// TODO: list the real package path here. Storing it should not
-			// significantly impact binary size as there is only a limited
-			// number of packages in any program.
-			field.PkgPath = "<unimplemented>"
+			field.PkgPath = pkgPath
 		}
 	}
 
 	return field
 }
 
+// FieldByName returns the struct field with the given name, including fields
+// promoted from embedded structs. Like in Go, shallower fields take precedence
+// over deeper ones and a name that is ambiguous at the shallowest depth is not
+// found.
+func (t Type) FieldByName(name string) (StructField, bool) {
+	if t.Kind() != Struct {
+		panic(&TypeError{"FieldByName"})
+	}
+	// Do a breadth-first search through the embedded structs, one depth at a
+	// time. Like in the standard library, each struct type is only searched
+	// once (at the shallowest depth it is embedded at), so that recursive
+	// types like struct{ *T } terminate. A struct type that is embedded more
+	// than once at the same depth makes all its fields ambiguous.
+	current := []StructField{{Type: t}}
+	count := map[Type]int{t: 1}
+	visited := map[Type]bool{}
+	for len(current) != 0 {
+		var next []StructField
+		nextCount := map[Type]int{}
+		var result StructField
+		found := 0
+		for _, parent := range current {
+			if visited[parent.Type] {
+				continue
+			}
+			visited[parent.Type] = true
+			numField := parent.Type.NumField()
+			for i := 0; i < numField; i++ {
+				field := parent.Type.Field(i)
+				field.Index = append(append([]int(nil), parent.Index...), i)
+				if field.Name == name {
+					result = field
+					found += count[parent.Type]
+					continue
+				}
+				if field.Anonymous {
+					embedded := field.Type
+					if embedded.Kind() == Ptr {
+						embedded = embedded.Elem()
+					}
+					if embedded.Kind() != Struct {
+						continue
+					}
+					if nextCount[embedded] > 0 {
+						// Embedded more than once at this depth.
+						nextCount[embedded] = 2
+						continue
+					}
+					nextCount[embedded] = 1
+					next = append(next, StructField{Type: embedded, Index: field.Index})
+				}
+			}
+		}
+		if found == 1 {
+			return result, true
+		}
+		if found > 1 {
+			// Ambiguous selector.
+			return StructField{}, false
+		}
+		current = next
+		count = nextCount
+	}
+	return StructField{}, false
+}
+
+// FieldByIndex returns the nested field corresponding to the index sequence,
+// following pointers to embedded structs. It is equivalent to calling Field
+// for each index in turn.
+func (t Type) FieldByIndex(index []int) StructField {
+	if t.Kind() != Struct {
+		panic(&TypeError{"FieldByIndex"})
+	}
+	field := StructField{Type: t}
+	for i, x := range index {
+		if i > 0 && field.Type.Kind() == Ptr && field.Type.Elem().Kind() == Struct {
+			field.Type = field.Type.Elem()
+		}
+		field = field.Type.Field(x)
+	}
+	return field
+}
+
 // Bits returns the number of bits that this type uses. It is only valid for
 // arithmetic types (integers, floats, and complex numbers). For other types, it
 // will panic.
@@ -272,8 +439,7 @@ func (t Type) Len() int {
 	}
 
 	// skip past the element type
-	arrayIdentifier := t.stripPrefix()
-	_, p := readVarint(unsafe.Pointer(uintptr(unsafe.Pointer(&arrayTypesSidetable)) + uintptr(arrayIdentifier)))
+	_, p := readVarint(t.typeData(unsafe.Pointer(&arrayTypesSidetable)))
 
 	// Read the array length.
 	arrayLen, _ := readVarint(p)
@@ -286,9 +452,139 @@ func (t Type) NumField() int {
 	if t.Kind() != Struct {
 		panic(&TypeError{"NumField"})
 	}
-	structIdentifier := t.stripPrefix()
-	n, _ := readVarint(unsafe.Pointer(uintptr(unsafe.Pointer(&structTypesSidetable)) + uintptr(structIdentifier)))
-	return int(n)
+	header, _ := readVarint(t.typeData(unsafe.Pointer(&structTypesSidetable)))
+	return int(header >> 1) // see Field for the header format
+}
+
+// NumMethod returns the number of methods of this type. For non-interface
+// types, only exported methods are counted, like in the standard library.
+func (t Type) NumMethod() int {
+	numMethod, p := t.methodList()
+	if t.Kind() == Interface {
+		return int(numMethod)
+	}
+	n := 0
+	for i := uintptr(0); i < numMethod; i++ {
+		var method Method
+		method, p = readMethod(p)
+		if method.PkgPath == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Method returns the i'th method of this type. For non-interface types, only
+// exported methods are considered. The Type field of the returned Method is the
+// method signature without the receiver and the Func field is the zero Value,
+// as methods cannot be called through reflection yet.
+func (t Type) Method(i int) Method {
+	numMethod, p := t.methodList()
+	index := 0
+	for j := uintptr(0); j < numMethod; j++ {
+		var method Method
+		method, p = readMethod(p)
+		if t.Kind() != Interface && method.PkgPath != "" {
+			continue
+		}
+		if index == i {
+			method.Index = i
+			return method
+		}
+		index++
+	}
+	panic("reflect: method index out of range")
+}
+
+// MethodByName returns the method with the given name in the method set of
+// this type, and whether that method was found.
+func (t Type) MethodByName(name string) (Method, bool) {
+	numMethod := t.NumMethod()
+	for i := 0; i < numMethod; i++ {
+		if method := t.Method(i); method.Name == name {
+			return method, true
+		}
+	}
+	return Method{}, false
+}
+
+// Implements returns whether type t implements the interface type u.
+func (t Type) Implements(u Type) bool {
+	if u.Kind() != Interface {
+		panic("reflect: non-interface type passed to Type.Implements")
+	}
+	numMethod, methods := t.methodList()
+	numItfMethod, p := u.methodList()
+	for i := uintptr(0); i < numItfMethod; i++ {
+		var method Method
+		method, p = readMethod(p)
+		found := false
+		q := methods
+		for j := uintptr(0); j < numMethod; j++ {
+			var m Method
+			m, q = readMethod(q)
+			if m.Name == method.Name && m.PkgPath == method.PkgPath && m.Type == method.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// methodList returns the number of methods in the method set of this type,
+// including unexported methods, and a pointer to the first method. All lists
+// of methods are stored in the interface sidetable. Interface type codes refer
+// to them directly, other types are looked up in the method sets sidetable.
+// Types without methods are not stored in the method sets sidetable.
+func (t Type) methodList() (uintptr, unsafe.Pointer) {
+	var index uintptr
+	if t.Kind() == Interface {
+		index = uintptr(t.stripPrefix())
+	} else {
+		p := unsafe.Pointer(&methodSetsSidetable)
+		for {
+			var typecode uintptr
+			typecode, p = readVarint(p)
+			if typecode == 0 {
+				// End of the sidetable: this type has no methods.
+				return 0, nil
+			}
+			index, p = readVarint(p)
+			if Type(typecode) == t {
+				break
+			}
+		}
+	}
+	return readVarint(unsafe.Pointer(uintptr(unsafe.Pointer(&interfaceTypesSidetable)) + index))
+}
+
+// readMethod reads a single method from a list of methods, as returned by
+// methodList. It returns the method and a pointer to the next method.
+func readMethod(p unsafe.Pointer) (Method, unsafe.Pointer) {
+	var methodType, nameNum uintptr
+	methodType, p = readVarint(p)
+	nameNum, p = readVarint(p)
+	method := Method{
+		Type: Type(methodType),
+		Name: readStringSidetable(unsafe.Pointer(&structNamesSidetable), nameNum),
+	}
+	if !isExportedName(method.Name) {
+		// Unexported methods are followed by their package path.
+		var pkgPathNum uintptr
+		pkgPathNum, p = readVarint(p)
+		method.PkgPath = readStringSidetable(unsafe.Pointer(&structNamesSidetable), pkgPathNum)
+	}
+	return method, p
+}
+
+// isExportedName returns whether this identifier starts with an upper case
+// letter. Only ASCII letters are recognized.
+func isExportedName(name string) bool {
+	return len(name) != 0 && name[0] >= 'A' && name[0] <= 'Z'
 }
 
 // Size returns the size in bytes of a given type. It is similar to
@@ -316,13 +612,15 @@ func (t Type) Size() uintptr {
 	case Complex128:
 		return 16
 	case String:
-		return unsafe.Sizeof(StringHeader{})
+		return unsafe.Sizeof(stringHeader{})
 	case UnsafePointer, Chan, Map, Ptr:
 		return unsafe.Sizeof(uintptr(0))
 	case Slice:
-		return unsafe.Sizeof(SliceHeader{})
+		return unsafe.Sizeof(sliceHeader{})
 	case Interface:
 		return unsafe.Sizeof(interfaceHeader{})
+	case Func:
+		return unsafe.Sizeof(funcHeader{})
 	case Array:
 		return t.Elem().Size() * uintptr(t.Len())
 	case Struct:
@@ -331,7 +629,7 @@ func (t Type) Size() uintptr {
 			return 0
 		}
 		lastField := t.Field(numField - 1)
-		return lastField.Offset + lastField.Type.Size()
+		return align(lastField.Offset+lastField.Type.Size(), uintptr(t.Align()))
 	default:
 		panic("unimplemented: size of type")
 	}
@@ -362,13 +660,17 @@ func (t Type) Align() int {
 	case Complex128:
 		return int(unsafe.Alignof(complex128(0)))
 	case String:
-		return int(unsafe.Alignof(StringHeader{}))
+		return int(unsafe.Alignof(stringHeader{}))
 	case UnsafePointer, Chan, Map, Ptr:
 		return int(unsafe.Alignof(uintptr(0)))
 	case Slice:
-		return int(unsafe.Alignof(SliceHeader{}))
+		return int(unsafe.Alignof(sliceHeader{}))
 	case Interface:
 		return int(unsafe.Alignof(interfaceHeader{}))
+	case Func:
+		return int(unsafe.Alignof(funcHeader{}))
+	case Array:
+		return t.Elem().Align()
 	case Struct:
 		numField := t.NumField()
 		alignment := 1
@@ -390,14 +692,15 @@ func (t Type) FieldAlign() int {
 	return t.Align()
 }
 
-// AssignableTo returns whether a value of type u can be assigned to a variable
-// of type t.
+// AssignableTo returns whether a value of type t can be assigned to a variable
+// of type u. Only identical types and interfaces implemented by t are
+// supported.
 func (t Type) AssignableTo(u Type) bool {
 	if t == u {
 		return true
 	}
-	if t.Kind() == Interface {
-		panic("reflect: unimplemented: assigning to interface of different type")
+	if u.Kind() == Interface {
+		return t.Implements(u)
 	}
 	return false
 }
@@ -440,6 +743,20 @@ func (t Type) Comparable() bool {
 	}
 }
 
+// Method represents a single method.
+type Method struct {
+	// Name is the method name.
+	Name string
+
+	// PkgPath is the package path that qualifies an unexported method name,
+	// or the empty string for exported methods.
+	PkgPath string
+
+	Type  Type  // method type
+	Func  Value // func with receiver as first argument
+	Index int   // index for Type.Method
+}
+
 // A StructField describes a single field in a struct.
 type StructField struct {
 	// Name indicates the field name.
@@ -452,7 +769,17 @@ type StructField struct {
 	Type      Type
 	Tag       string
 	Anonymous bool
-	Offset    uintptr
+
+	// Offset is the offset of this field in bytes, relative to the start of
+	// the struct that directly contains it. For a field promoted from an
+	// embedded struct, that is the embedded struct and not the outer struct.
+	Offset uintptr
+
+	// Index is the index sequence for Type.FieldByIndex and
+	// Value.FieldByIndex. It has a single element when returned by
+	// Type.Field, and is the full path from the outer struct when returned by
+	// Type.FieldByName.
+	Index []int
 }
 
 // TypeError is the error that is used in a panic when invoking a method on a
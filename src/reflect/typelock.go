@@ -0,0 +1,9 @@
+// +build !baremetal
+
+package reflect
+
+import "sync"
+
+// typeLock protects the types constructed at runtime and the cached pointer
+// bitmaps, see dynamicTypes and pointerBitmaps.
+var typeLock sync.Mutex
@@ -0,0 +1,37 @@
+// +build baremetal
+
+package reflect
+
+import "runtime/volatile"
+
+// typeLock protects the types constructed at runtime and the cached pointer
+// bitmaps, see dynamicTypes and pointerBitmaps. Types may also be constructed
+// from an interrupt, so interrupts are disabled while it is held.
+var typeLock spinLock
+
+// spinLock is a lock that disables interrupts while it is held. On a single
+// core, disabling interrupts is enough to make sure it is never contended.
+type spinLock struct {
+	state volatile.Register8
+	mask  uintptr
+}
+
+func (l *spinLock) Lock() {
+	mask := disableInterrupts()
+	for l.state.Get() != 0 {
+	}
+	l.state.Set(1)
+	l.mask = mask
+}
+
+func (l *spinLock) Unlock() {
+	mask := l.mask
+	l.state.Set(0)
+	restoreInterrupts(mask)
+}
+
+//go:linkname disableInterrupts runtime.disableInterrupts
+func disableInterrupts() uintptr
+
+//go:linkname restoreInterrupts runtime.restoreInterrupts
+func restoreInterrupts(mask uintptr)
@@ -45,6 +45,22 @@ func ValueOf(i interface{}) Value {
 }
 
 func (v Value) Interface() interface{} {
+	if !v.IsValid() {
+		panic(&ValueError{Method: "reflect.Value.Interface", Kind: Invalid})
+	}
+	if !v.CanInterface() {
+		panic("reflect.Value.Interface: cannot return value obtained from unexported field or method")
+	}
+	return v.valueInterface()
+}
+
+// valueInterface returns the value as an interface, like Interface, but without
+// checking whether it was obtained through an unexported field.
+func (v Value) valueInterface() interface{} {
+	if v.Kind() == Interface {
+		// The value already is an interface, so don't wrap it again.
+		return *(*interface{})(v.value)
+	}
 	i := interfaceHeader{
 		typecode: v.typecode,
 		value:    v.value,
@@ -57,6 +73,14 @@ func (v Value) Interface() interface{} {
 			value = (value << 8) | uintptr(*(*uint8)(unsafe.Pointer(uintptr(v.value) + j - 1)))
 		}
 		i.value = unsafe.Pointer(value)
+	} else if v.isIndirect() {
+		// Value was indirect and points into memory that may be modified
+		// later (for example a struct field), so make a copy. Values that
+		// are not indirect point to data owned by an interface, which is
+		// never modified, so those can be used directly.
+		size := v.Type().Size()
+		i.value = allocLayout(size, uintptr(v.Type().Align()), v.Type().pointerBitmap())
+		memcpy(i.value, v.value, size)
 	}
 	return *(*interface{})(unsafe.Pointer(&i))
 }
@@ -79,30 +103,40 @@ func (v Value) IsNil() bool {
 		}
 		return v.value == nil
 	case Func:
+		// A func value is nil only if both the context and the code are nil,
+		// which is how the compiler emits nil funcs. Top-level functions have
+		// a nil context but a non-nil code pointer.
 		if v.value == nil {
 			return true
 		}
 		fn := (*funcHeader)(v.value)
-		return fn.Code == nil
+		return fn.Code == nil && fn.Context == nil
 	case Slice:
 		if v.value == nil {
 			return true
 		}
-		slice := (*SliceHeader)(v.value)
-		return slice.Data == 0
+		slice := (*sliceHeader)(v.value)
+		return slice.data == nil
 	case Interface:
 		if v.value == nil {
 			return true
 		}
+		// An interface holding a zero value, like a zero integer, is not nil:
+		// only the type code tells whether it holds a value.
 		itf := (*interfaceHeader)(v.value)
-		return itf.value == nil
+		return itf.typecode == 0
 	default:
-		panic(&ValueError{"IsNil"})
+		panic(&ValueError{Method: "reflect.Value.IsNil", Kind: v.Kind()})
 	}
 }
 
 // Pointer returns the underlying pointer of the given value for the following
 // types: chan, map, pointer, unsafe.Pointer, slice, func.
+//
+// For func values, this is the code pointer, so it is the same for all copies
+// of a func value and for all closures of the same function. Depending on the
+// target, it may be an opaque identifier of the function instead of a real
+// function pointer.
 func (v Value) Pointer() uintptr {
 	switch v.Kind() {
 	case Chan, Map, Ptr, UnsafePointer:
@@ -111,22 +145,45 @@ func (v Value) Pointer() uintptr {
 		}
 		return uintptr(v.value)
 	case Slice:
-		slice := (*SliceHeader)(v.value)
-		return slice.Data
+		slice := (*sliceHeader)(v.value)
+		return uintptr(slice.data)
 	case Func:
-		panic("unimplemented: (reflect.Value).Pointer()")
-	default: // not implemented: Func
-		panic(&ValueError{"Pointer"})
+		if v.value == nil {
+			return 0
+		}
+		fn := (*funcHeader)(v.value)
+		return uintptr(fn.Code)
+	default:
+		panic(&ValueError{Method: "reflect.Value.Pointer", Kind: v.Kind()})
 	}
 }
 
+// UnsafePointer returns the same pointer as Pointer, as an unsafe.Pointer.
+func (v Value) UnsafePointer() unsafe.Pointer {
+	return unsafe.Pointer(v.Pointer())
+}
+
 func (v Value) IsValid() bool {
 	return v.typecode != 0
 }
 
+// CanInterface returns whether Interface can be used without leaking the
+// contents of unexported struct fields. Values obtained through unexported
+// fields can still be read using methods like Int and String.
 func (v Value) CanInterface() bool {
-	// No Value types of private data can be constructed at the moment.
-	return true
+	return v.flags&valueFlagExported != 0
+}
+
+// UnsafeAddr returns a pointer to the data of v. It panics if v is not stored
+// in memory that can be modified, like a value reached through a pointer.
+func (v Value) UnsafeAddr() uintptr {
+	if !v.IsValid() {
+		panic(&ValueError{Method: "reflect.Value.UnsafeAddr", Kind: Invalid})
+	}
+	if !v.isIndirect() {
+		panic("reflect.Value.UnsafeAddr of unaddressable value")
+	}
+	return uintptr(v.value)
 }
 
 func (v Value) CanAddr() bool {
@@ -150,7 +207,7 @@ func (v Value) Bool() bool {
 			return uintptr(v.value) != 0
 		}
 	default:
-		panic(&ValueError{"Bool"})
+		panic(&ValueError{Method: "reflect.Value.Bool", Kind: v.Kind()})
 	}
 }
 
@@ -187,7 +244,7 @@ func (v Value) Int() int64 {
 			return int64(int64(uintptr(v.value)))
 		}
 	default:
-		panic(&ValueError{"Int"})
+		panic(&ValueError{Method: "reflect.Value.Int", Kind: v.Kind()})
 	}
 }
 
@@ -230,7 +287,7 @@ func (v Value) Uint() uint64 {
 			return uint64(uintptr(v.value))
 		}
 	default:
-		panic(&ValueError{"Uint"})
+		panic(&ValueError{Method: "reflect.Value.Uint", Kind: v.Kind()})
 	}
 }
 
@@ -256,7 +313,7 @@ func (v Value) Float() float64 {
 			return *(*float64)(unsafe.Pointer(&v.value))
 		}
 	default:
-		panic(&ValueError{"Float"})
+		panic(&ValueError{Method: "reflect.Value.Float", Kind: v.Kind()})
 	}
 }
 
@@ -278,7 +335,7 @@ func (v Value) Complex() complex128 {
 		// architectures with 128-bit pointers, however.
 		return *(*complex128)(v.value)
 	default:
-		panic(&ValueError{"Complex"})
+		panic(&ValueError{Method: "reflect.Value.Complex", Kind: v.Kind()})
 	}
 }
 
@@ -288,9 +345,11 @@ func (v Value) String() string {
 		// A string value is always bigger than a pointer as it is made of a
 		// pointer and a length.
 		return *(*string)(v.value)
+	case Invalid:
+		return "<invalid Value>"
 	default:
 		// Special case because of the special treatment of .String() in Go.
-		return "<T>"
+		return "<" + v.Type().String() + " Value>"
 	}
 }
 
@@ -308,13 +367,17 @@ func (v Value) Len() int {
 	t := v.Type()
 	switch t.Kind() {
 	case Slice:
-		return int((*SliceHeader)(v.value).Len)
+		return int((*sliceHeader)(v.value).len)
 	case String:
-		return int((*StringHeader)(v.value).Len)
+		return int((*stringHeader)(v.value).len)
 	case Array:
 		return v.Type().Len()
-	default: // Chan, Map
+	case Map:
+		return hashmapLen(unsafe.Pointer(v.Pointer()))
+	case Chan:
 		panic("unimplemented: (reflect.Value).Len()")
+	default:
+		panic(&ValueError{Method: "reflect.Value.Len", Kind: v.Kind()})
 	}
 }
 
@@ -322,15 +385,20 @@ func (v Value) Cap() int {
 	t := v.Type()
 	switch t.Kind() {
 	case Slice:
-		return int((*SliceHeader)(v.value).Cap)
-	default: // Array, Chan
+		return int((*sliceHeader)(v.value).cap)
+	case Array:
+		return v.Type().Len()
+	case Chan:
 		panic("unimplemented: (reflect.Value).Cap()")
+	default:
+		panic(&ValueError{Method: "reflect.Value.Cap", Kind: v.Kind()})
 	}
 }
 
 // NumField returns the number of fields of this struct. It panics for other
 // value types.
 func (v Value) NumField() int {
+	v.mustBe(Struct, "reflect.Value.NumField")
 	return v.Type().NumField()
 }
 
@@ -349,13 +417,27 @@ func (v Value) Elem() Value {
 			value:    ptr,
 			flags:    v.flags | valueFlagIndirect,
 		}
-	default: // not implemented: Interface
-		panic(&ValueError{"Elem"})
+	case Interface:
+		// Values of interface kind are never stored directly in a Value, as
+		// they're bigger than a pointer. The dynamic value is stored in the
+		// same way as in a Value that is not indirect.
+		itf := *(*interfaceHeader)(v.value)
+		if itf.typecode == 0 {
+			return Value{}
+		}
+		return Value{
+			typecode: itf.typecode,
+			value:    itf.value,
+			flags:    v.flags &^ valueFlagIndirect,
+		}
+	default:
+		panic(&ValueError{Method: "reflect.Value.Elem", Kind: v.Kind()})
 	}
 }
 
 // Field returns the value of the i'th field of this struct.
 func (v Value) Field(i int) Value {
+	v.mustBe(Struct, "reflect.Value.Field")
 	structField := v.Type().Field(i)
 	flags := v.flags
 	if structField.PkgPath != "" {
@@ -398,7 +480,7 @@ func (v Value) Field(i int) Value {
 		ptr := unsafe.Pointer(uintptr(v.value) + structField.Offset)
 		value := unsafe.Pointer(loadValue(ptr, fieldSize))
 		return Value{
-			flags:    0,
+			flags:    flags,
 			typecode: structField.Type,
 			value:    value,
 		}
@@ -414,35 +496,64 @@ func (v Value) Field(i int) Value {
 	}
 }
 
+// FieldByIndex returns the nested field corresponding to index, following
+// pointers to embedded structs.
+func (v Value) FieldByIndex(index []int) Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == Ptr && v.Type().Elem().Kind() == Struct {
+			if v.IsNil() {
+				panic("reflect: indirection through nil pointer to embedded struct")
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// FieldByName returns the struct field with the given name, or the zero Value
+// if no field was found.
+func (v Value) FieldByName(name string) Value {
+	v.mustBe(Struct, "reflect.Value.FieldByName")
+	if field, ok := v.Type().FieldByName(name); ok {
+		return v.FieldByIndex(field.Index)
+	}
+	return Value{}
+}
+
 func (v Value) Index(i int) Value {
 	switch v.Kind() {
 	case Slice:
 		// Extract an element from the slice.
-		slice := *(*SliceHeader)(v.value)
-		if uint(i) >= uint(slice.Len) {
+		slice := *(*sliceHeader)(v.value)
+		if uint(i) >= uint(slice.len) {
 			panic("reflect: slice index out of range")
 		}
 		elem := Value{
 			typecode: v.Type().Elem(),
 			flags:    v.flags | valueFlagIndirect,
 		}
-		addr := uintptr(slice.Data) + elem.Type().Size()*uintptr(i) // pointer to new value
+		addr := uintptr(slice.data) + elem.Type().Size()*uintptr(i) // pointer to new value
 		elem.value = unsafe.Pointer(addr)
 		return elem
 	case String:
 		// Extract a character from a string.
 		// A string is never stored directly in the interface, but always as a
 		// pointer to the string value.
-		s := *(*StringHeader)(v.value)
-		if uint(i) >= uint(s.Len) {
+		s := *(*stringHeader)(v.value)
+		if uint(i) >= uint(s.len) {
 			panic("reflect: string index out of range")
 		}
 		return Value{
 			typecode: Uint8.basicType(),
-			value:    unsafe.Pointer(uintptr(*(*uint8)(unsafe.Pointer(s.Data + uintptr(i))))),
+			value:    unsafe.Pointer(uintptr(*(*uint8)(unsafe.Pointer(uintptr(s.data) + uintptr(i))))),
+			flags:    v.flags & valueFlagExported,
 		}
 	case Array:
 		// Extract an element from the array.
+		if uint(i) >= uint(v.Len()) {
+			panic("reflect: array index out of range")
+		}
 		elemType := v.Type().Elem()
 		elemSize := elemType.Size()
 		size := v.Type().Size()
@@ -453,11 +564,11 @@ func (v Value) Index(i int) Value {
 				flags:    v.flags,
 			}
 		}
-		if elemSize > unsafe.Sizeof(uintptr(0)) {
-			// The resulting value doesn't fit in a pointer so must be
-			// indirect. Also, because size != 0 this implies that the array
-			// length must be != 0, and thus that the total size is at least
-			// elemSize.
+		if v.isIndirect() || elemSize > unsafe.Sizeof(uintptr(0)) {
+			// v.value was already a pointer to the array, or the resulting
+			// value doesn't fit in a pointer so must be indirect. Also,
+			// because size != 0 this implies that the array length must be
+			// != 0, and thus that the total size is at least elemSize.
 			addr := uintptr(v.value) + elemSize*uintptr(i) // pointer to new value
 			return Value{
 				typecode: v.Type().Elem(),
@@ -487,7 +598,7 @@ func (v Value) Index(i int) Value {
 			value:    unsafe.Pointer(value),
 		}
 	default:
-		panic(&ValueError{"Index"})
+		panic(&ValueError{Method: "reflect.Value.Index", Kind: v.Kind()})
 	}
 }
 
@@ -515,10 +626,6 @@ func (v Value) MapKeys() []Value {
 	panic("unimplemented: (reflect.Value).MapKeys()")
 }
 
-func (v Value) MapIndex(key Value) Value {
-	panic("unimplemented: (reflect.Value).MapIndex()")
-}
-
 func (v Value) MapRange() *MapIter {
 	panic("unimplemented: (reflect.Value).MapRange()")
 }
@@ -538,32 +645,34 @@ func (it *MapIter) Next() bool {
 	panic("unimplemented: (*reflect.MapIter).Next()")
 }
 
+// Set assigns x to the value v. If v is of interface kind, x is stored in it
+// like in a Go assignment. If x is of interface kind while v is not, the dynamic
+// value stored in x is assigned instead and must be of the type of v; the
+// standard library panics in that case.
 func (v Value) Set(x Value) {
-	v.checkAddressable()
-	if !v.Type().AssignableTo(x.Type()) {
-		panic("reflect: cannot set")
-	}
-	size := v.Type().Size()
-	xptr := x.value
-	if size <= unsafe.Sizeof(uintptr(0)) && !x.isIndirect() {
-		value := x.value
-		xptr = unsafe.Pointer(&value)
+	v.mustBeAssignable("reflect.Value.Set")
+	x.mustBeExported("reflect.Value.Set")
+	if x.Kind() == Interface && v.Kind() != Interface {
+		x = x.Elem()
+		if !x.IsValid() {
+			panic("reflect.Value.Set: value of nil interface")
+		}
 	}
-	memcpy(v.value, xptr, size)
+	memcpy(v.value, x.pointerTo(v.Type(), "reflect.Set"), v.Type().Size())
 }
 
 func (v Value) SetBool(x bool) {
-	v.checkAddressable()
+	v.mustBeAssignable("reflect.Value.SetBool")
 	switch v.Kind() {
 	case Bool:
 		*(*bool)(v.value) = x
 	default:
-		panic(&ValueError{"SetBool"})
+		panic(&ValueError{Method: "reflect.Value.SetBool", Kind: v.Kind()})
 	}
 }
 
 func (v Value) SetInt(x int64) {
-	v.checkAddressable()
+	v.mustBeAssignable("reflect.Value.SetInt")
 	switch v.Kind() {
 	case Int:
 		*(*int)(v.value) = int(x)
@@ -576,12 +685,12 @@ func (v Value) SetInt(x int64) {
 	case Int64:
 		*(*int64)(v.value) = x
 	default:
-		panic(&ValueError{"SetInt"})
+		panic(&ValueError{Method: "reflect.Value.SetInt", Kind: v.Kind()})
 	}
 }
 
 func (v Value) SetUint(x uint64) {
-	v.checkAddressable()
+	v.mustBeAssignable("reflect.Value.SetUint")
 	switch v.Kind() {
 	case Uint:
 		*(*uint)(v.value) = uint(x)
@@ -596,64 +705,241 @@ func (v Value) SetUint(x uint64) {
 	case Uintptr:
 		*(*uintptr)(v.value) = uintptr(x)
 	default:
-		panic(&ValueError{"SetUint"})
+		panic(&ValueError{Method: "reflect.Value.SetUint", Kind: v.Kind()})
 	}
 }
 
 func (v Value) SetFloat(x float64) {
-	v.checkAddressable()
+	v.mustBeAssignable("reflect.Value.SetFloat")
 	switch v.Kind() {
 	case Float32:
 		*(*float32)(v.value) = float32(x)
 	case Float64:
 		*(*float64)(v.value) = x
 	default:
-		panic(&ValueError{"SetFloat"})
+		panic(&ValueError{Method: "reflect.Value.SetFloat", Kind: v.Kind()})
 	}
 }
 
 func (v Value) SetComplex(x complex128) {
-	v.checkAddressable()
+	v.mustBeAssignable("reflect.Value.SetComplex")
 	switch v.Kind() {
 	case Complex64:
 		*(*complex64)(v.value) = complex64(x)
 	case Complex128:
 		*(*complex128)(v.value) = x
 	default:
-		panic(&ValueError{"SetComplex"})
+		panic(&ValueError{Method: "reflect.Value.SetComplex", Kind: v.Kind()})
 	}
 }
 
 func (v Value) SetString(x string) {
-	v.checkAddressable()
+	v.mustBeAssignable("reflect.Value.SetString")
 	switch v.Kind() {
 	case String:
 		*(*string)(v.value) = x
 	default:
-		panic(&ValueError{"SetString"})
+		panic(&ValueError{Method: "reflect.Value.SetString", Kind: v.Kind()})
+	}
+}
+
+// mustBe panics with a *ValueError if v is not of the given kind. The method
+// name is the full name used in the panic message, like "reflect.Value.Int".
+func (v Value) mustBe(kind Kind, method string) {
+	if k := v.Kind(); k != kind {
+		panic(&ValueError{Method: method, Kind: k})
+	}
+}
+
+// mustBeExported panics if v is the zero Value or if it was obtained through an
+// unexported field.
+func (v Value) mustBeExported(method string) {
+	if !v.IsValid() {
+		panic(&ValueError{Method: method, Kind: Invalid})
+	}
+	if v.flags&valueFlagExported == 0 {
+		panic("reflect: " + method + " using value obtained using unexported field")
 	}
 }
 
-func (v Value) checkAddressable() {
+// mustBeAssignable panics if v cannot be modified, either because it was
+// obtained through an unexported field or because it is not addressable.
+func (v Value) mustBeAssignable(method string) {
+	v.mustBeExported(method)
 	if !v.isIndirect() {
-		panic("reflect: value is not addressable")
+		panic("reflect: " + method + " using unaddressable value")
 	}
 }
 
-//go:linkname alloc runtime.alloc
-func alloc(size uintptr) unsafe.Pointer
+// allocLayout allocates zeroed memory aligned to the given alignment. The layout
+// is the pointer bitmap of the allocated type (see Type.pointerBitmap), or of
+// the element type when allocating the backing array of a slice.
+//go:linkname allocLayout runtime.allocLayout
+func allocLayout(size, alignment uintptr, layout []byte) unsafe.Pointer
 
 func MakeSlice(typ Type, len, cap int) Value {
-	panic("unimplemented: reflect.MakeSlice()")
+	if typ.Kind() != Slice {
+		panic("reflect.MakeSlice of non-slice type")
+	}
+	if len < 0 {
+		panic("reflect.MakeSlice: negative len")
+	}
+	if cap < 0 {
+		panic("reflect.MakeSlice: negative cap")
+	}
+	if len > cap {
+		panic("reflect.MakeSlice: len > cap")
+	}
+	elem := typ.Elem()
+	size := checkedSize(uint64(cap), elem.Size(), "reflect.MakeSlice: cap out of range")
+	data := allocLayout(size, uintptr(elem.Align()), elem.pointerBitmap())
+	slice := &sliceHeader{
+		data: data,
+		len:  uintptr(len),
+		cap:  uintptr(cap),
+	}
+	return Value{typ, unsafe.Pointer(slice), valueFlagExported}
+}
+
+// maxSize is the largest size of an object in bytes, which is also the largest
+// length of a slice as it must fit in intw. On AVR, where uintptr is only 16
+// bits, it is easily exceeded. Types created at runtime (by ArrayOf and
+// StructOf) are checked against it like the compiler does, so offsets within a
+// value, like the ones in Field and Index, can't overflow.
+const maxSize = ^uintptr(0) >> 1
+
+// checkedSize returns the size in bytes of n elements of the given size. It
+// panics with the given message if that size is bigger than maxSize, instead
+// of silently wrapping around.
+func checkedSize(n uint64, elemSize uintptr, msg string) uintptr {
+	if n > uint64(maxSize) || (elemSize != 0 && n > uint64(maxSize/elemSize)) {
+		panic(msg)
+	}
+	return uintptr(n) * elemSize
+}
+
+//go:linkname sliceGrow runtime.sliceGrowLayout
+func sliceGrow(oldBuf unsafe.Pointer, oldLen, oldCap, newCap, elemSize, elemAlign uintptr, layout []byte) (unsafe.Pointer, uintptr, uintptr)
+
+// Append appends the values x to a slice s and returns the resulting slice. It
+// grows the slice in the same way as the append builtin.
+func Append(s Value, x ...Value) Value {
+	s.mustBe(Slice, "reflect.Append")
+	elem := s.Type().Elem()
+	elemSize := elem.Size()
+	slice := *(*sliceHeader)(s.value)
+	checkedSize(uint64(slice.len)+uint64(len(x)), elemSize, "reflect.Append: slice overflow")
+	buf, length, capacity := sliceGrow(slice.data, slice.len, slice.cap, slice.len+uintptr(len(x)), elemSize, uintptr(elem.Align()), elem.pointerBitmap())
+	for _, v := range x {
+		memcpy(unsafe.Pointer(uintptr(buf)+length*elemSize), v.pointerTo(elem, "reflect.Set"), elemSize)
+		length++
+	}
+	return Value{
+		typecode: s.typecode,
+		value:    unsafe.Pointer(&sliceHeader{buf, length, capacity}),
+		flags:    s.flags &^ valueFlagIndirect,
+	}
+}
+
+// AppendSlice appends a slice t to a slice s and returns the resulting slice.
+// The slices s and t must have the same element type.
+func AppendSlice(s, t Value) Value {
+	s.mustBe(Slice, "reflect.AppendSlice")
+	t.mustBe(Slice, "reflect.AppendSlice")
+	typesMustMatch("reflect.AppendSlice", s.Type().Elem(), t.Type().Elem())
+	elem := s.Type().Elem()
+	elemSize := elem.Size()
+	slice := *(*sliceHeader)(s.value)
+	extra := *(*sliceHeader)(t.value)
+	checkedSize(uint64(slice.len)+uint64(extra.len), elemSize, "reflect.AppendSlice: slice overflow")
+	buf, length, capacity := sliceGrow(slice.data, slice.len, slice.cap, slice.len+extra.len, elemSize, uintptr(elem.Align()), elem.pointerBitmap())
+	memmove(unsafe.Pointer(uintptr(buf)+length*elemSize), extra.data, extra.len*elemSize)
+	return Value{
+		typecode: s.typecode,
+		value:    unsafe.Pointer(&sliceHeader{buf, length + extra.len, capacity}),
+		flags:    s.flags &^ valueFlagIndirect,
+	}
+}
+
+// Grow increases the slice's capacity, if necessary, to guarantee space for
+// another n elements. The slice must be addressable.
+func (v Value) Grow(n int) {
+	v.mustBeAssignable("reflect.Value.Grow")
+	v.mustBe(Slice, "reflect.Value.Grow")
+	if n < 0 {
+		panic("reflect.Value.Grow: negative len")
+	}
+	slice := (*sliceHeader)(v.value)
+	elem := v.Type().Elem()
+	elemSize := elem.Size()
+	checkedSize(uint64(slice.len)+uint64(n), elemSize, "reflect.Value.Grow: slice overflow")
+	buf, length, capacity := sliceGrow(slice.data, slice.len, slice.cap, slice.len+uintptr(n), elemSize, uintptr(elem.Align()), elem.pointerBitmap())
+	slice.data = buf
+	slice.len = length
+	slice.cap = capacity
+}
+
+// Copy copies the contents of src into dst until either dst has been filled or
+// src has been exhausted, and returns the number of elements copied. Dst must be
+// a slice or an addressable array, src must be a slice or array with the same
+// element type, or a string if dst is a byte slice or array.
+func Copy(dst, src Value) int {
+	var dstData unsafe.Pointer
+	var dstLen uintptr
+	switch dst.Kind() {
+	case Slice:
+		slice := (*sliceHeader)(dst.value)
+		dstData, dstLen = slice.data, slice.len
+	case Array:
+		dst.mustBeAssignable("reflect.Copy")
+		dstData, dstLen = dst.value, uintptr(dst.Len())
+	default:
+		panic(&ValueError{Method: "reflect.Copy", Kind: dst.Kind()})
+	}
+	dst.mustBeExported("reflect.Copy")
+	elem := dst.Type().Elem()
+
+	var srcData unsafe.Pointer
+	var srcLen uintptr
+	switch src.Kind() {
+	case Slice:
+		slice := (*sliceHeader)(src.value)
+		srcData, srcLen = slice.data, slice.len
+	case Array:
+		srcData, srcLen = src.pointerTo(src.Type(), "reflect.Copy"), uintptr(src.Len())
+	case String:
+		if elem.Kind() != Uint8 {
+			panic(&ValueError{Method: "reflect.Copy", Kind: String})
+		}
+		str := (*stringHeader)(src.value)
+		srcData, srcLen = str.data, str.len
+	default:
+		panic(&ValueError{Method: "reflect.Copy", Kind: src.Kind()})
+	}
+	src.mustBeExported("reflect.Copy")
+	if src.Kind() != String {
+		typesMustMatch("reflect.Copy", elem, src.Type().Elem())
+	}
+
+	n := srcLen
+	if n > dstLen {
+		n = dstLen
+	}
+	// The memory areas may overlap, and either of them may be unaligned when
+	// they point inside a struct.
+	memmove(dstData, srcData, n*elem.Size())
+	return int(n)
 }
 
 func Zero(typ Type) Value {
 	panic("unimplemented: reflect.Zero()")
 }
 
+// New returns a Value representing a pointer to a new zero value for the
+// specified type.
 func New(typ Type) Value {
-	data := alloc(typ.Size())
-	val := Value{PtrTo(typ), data, 0}
+	data := allocLayout(typ.Size(), uintptr(typ.Align()), typ.pointerBitmap())
+	val := Value{PtrTo(typ), data, valueFlagExported}
 	return val
 }
 
@@ -668,24 +954,63 @@ type interfaceHeader struct {
 	value    unsafe.Pointer
 }
 
+// SliceHeader is the runtime representation of a slice. The Len and Cap fields
+// are of type int like in the standard library, except on AVR where they are
+// 16 bits wide to match the size of a pointer.
 type SliceHeader struct {
 	Data uintptr
-	Len  uintptr
-	Cap  uintptr
+	Len  intw
+	Cap  intw
+}
+
+// sliceHeader is the same as SliceHeader, but with the data field as a real
+// pointer. The reflect package uses this type internally so that the garbage
+// collector knows the data field is a pointer: a uintptr is not considered a
+// reference to an object, neither on the stack nor in globals.
+type sliceHeader struct {
+	data unsafe.Pointer
+	len  uintptr
+	cap  uintptr
 }
 
+// StringHeader is the runtime representation of a string. See SliceHeader for
+// the type of the Len field.
 type StringHeader struct {
 	Data uintptr
-	Len  uintptr
+	Len  intw
+}
+
+// stringHeader is the same as StringHeader, but with a real pointer as data
+// field. See sliceHeader.
+type stringHeader struct {
+	data unsafe.Pointer
+	len  uintptr
 }
 
+// A ValueError occurs when a Value method is invoked on a Value that does not
+// support it. Such cases are documented in the description of each method.
 type ValueError struct {
 	Method string
+	Kind   Kind
 }
 
 func (e *ValueError) Error() string {
-	return "reflect: call of reflect.Value." + e.Method + " on invalid type"
+	if e.Kind == Invalid {
+		return "reflect: call of " + e.Method + " on zero Value"
+	}
+	return "reflect: call of " + e.Method + " on " + e.Kind.String() + " Value"
+}
+
+// typesMustMatch panics if the two types are not the same, with a message like
+// the standard library uses.
+func typesMustMatch(what string, t1, t2 Type) {
+	if t1 != t2 {
+		panic(what + ": " + t1.String() + " != " + t2.String())
+	}
 }
 
 //go:linkname memcpy runtime.memcpy
 func memcpy(dst, src unsafe.Pointer, size uintptr)
+
+//go:linkname memmove runtime.memmove
+func memmove(dst, src unsafe.Pointer, size uintptr)
@@ -2,6 +2,12 @@
 
 package runtime
 
+import (
+	"device/avr"
+	"runtime/volatile"
+	"unsafe"
+)
+
 const GOARCH = "arm" // avr pretends to be arm
 
 // The bitness of the CPU (e.g. 8, 32, 64).
@@ -14,3 +20,20 @@ func align(ptr uintptr) uintptr {
 }
 
 func getCurrentStackPointer() uintptr
+
+// sreg is the status register, which includes the global interrupt flag.
+var sreg = (*volatile.Register8)(unsafe.Pointer(uintptr(0x5f)))
+
+// disableInterrupts disables all interrupts and returns the previous interrupt
+// state, to be passed to restoreInterrupts.
+func disableInterrupts() uintptr {
+	mask := uintptr(sreg.Get())
+	avr.Asm("cli")
+	return mask
+}
+
+// restoreInterrupts restores the interrupt state returned by
+// disableInterrupts.
+func restoreInterrupts(mask uintptr) {
+	sreg.Set(uint8(mask))
+}
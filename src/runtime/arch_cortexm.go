@@ -19,3 +19,15 @@ func align(ptr uintptr) uintptr {
 func getCurrentStackPointer() uintptr {
 	return arm.ReadRegister("sp")
 }
+
+// disableInterrupts disables all interrupts and returns the previous interrupt
+// state, to be passed to restoreInterrupts.
+func disableInterrupts() uintptr {
+	return arm.DisableInterrupts()
+}
+
+// restoreInterrupts restores the interrupt state returned by
+// disableInterrupts.
+func restoreInterrupts(mask uintptr) {
+	arm.EnableInterrupts(mask)
+}
@@ -17,3 +17,15 @@ func align(ptr uintptr) uintptr {
 func getCurrentStackPointer() uintptr {
 	return riscv.ReadRegister("sp")
 }
+
+// disableInterrupts disables all interrupts and returns the previous interrupt
+// state, to be passed to restoreInterrupts. Interrupts are never enabled on
+// this target, so there is nothing to disable.
+func disableInterrupts() uintptr {
+	return 0
+}
+
+// restoreInterrupts restores the interrupt state returned by
+// disableInterrupts.
+func restoreInterrupts(mask uintptr) {
+}
@@ -19,9 +19,20 @@ package runtime
 // "head" and is followed by "tail" blocks. The reason for this distinction is
 // that this way, the start and end of every object can be found easily.
 //
+// Because the head of an object can be found from any of its blocks, a pointer
+// into the middle of an object keeps the entire object alive. This is relied
+// upon by the reflect package: a reflect.Value created with Field, Index or
+// Elem only stores a pointer to the element, not to the parent object.
+//
+// Objects are scanned conservatively: every word of an object is treated as a
+// possible pointer. The only exception are objects allocated by the reflect
+// package with a pointer bitmap (see allocLayout) that says they don't contain
+// any pointers. These are marked as "noscan" and their contents are never
+// scanned.
+//
 // Metadata is stored in a special area at the beginning of the heap, in the
-// area heapStart..poolStart. The actual blocks are stored in
-// poolStart..heapEnd.
+// area heapStart..poolStart: first the block states, then one noscan bit per
+// block. The actual blocks are stored in poolStart..heapEnd.
 //
 // More information:
 // https://github.com/micropython/micropython/wiki/Memory-Manager
@@ -48,9 +59,10 @@ const (
 )
 
 var (
-	poolStart uintptr // the first heap pointer
-	nextAlloc gcBlock // the next block that should be tried by the allocator
-	endBlock  gcBlock // the block just past the end of the available space
+	noscanStart uintptr // the start of the noscan bits
+	poolStart   uintptr // the first heap pointer
+	nextAlloc   gcBlock // the next block that should be tried by the allocator
+	endBlock    gcBlock // the block just past the end of the available space
 )
 
 // zeroSizedAlloc is just a sentinel that gets returned when allocating 0 bytes.
@@ -176,6 +188,24 @@ func (b gcBlock) unmark() {
 	}
 }
 
+// noscan returns whether the contents of the object starting at this block
+// contain no pointers and don't need to be scanned.
+func (b gcBlock) noscan() bool {
+	noscanBytePtr := (*uint8)(unsafe.Pointer(noscanStart + uintptr(b/8)))
+	return *noscanBytePtr&(1<<(b%8)) != 0
+}
+
+// setNoscan sets or clears the noscan bit of the object starting at this
+// block. It is cleared when the object is freed.
+func (b gcBlock) setNoscan(noscan bool) {
+	noscanBytePtr := (*uint8)(unsafe.Pointer(noscanStart + uintptr(b/8)))
+	if noscan {
+		*noscanBytePtr |= 1 << (b % 8)
+	} else {
+		*noscanBytePtr &^= 1 << (b % 8)
+	}
+}
+
 // Initialize the memory allocator.
 // No memory may be allocated before this is called. That means the runtime and
 // any packages the runtime depends upon may not allocate memory during package
@@ -183,8 +213,12 @@ func (b gcBlock) unmark() {
 func init() {
 	totalSize := heapEnd - heapStart
 
-	// Allocate some memory to keep 2 bits of information about every block.
-	metadataSize := totalSize / (blocksPerStateByte * bytesPerBlock)
+	// Allocate some memory to keep 2 bits of information about every block,
+	// followed by the noscan bit of every block.
+	stateSize := totalSize / (blocksPerStateByte * bytesPerBlock)
+	noscanSize := totalSize/(8*bytesPerBlock) + 1
+	metadataSize := stateSize + noscanSize
+	noscanStart = heapStart + stateSize
 
 	// Align the pool.
 	poolStart = (heapStart + metadataSize + (bytesPerBlock - 1)) &^ (bytesPerBlock - 1)
@@ -198,19 +232,20 @@ func init() {
 		println("metadata size:    ", metadataSize)
 		println("poolStart:        ", poolStart)
 		println("# of blocks:      ", numBlocks)
-		println("# of block states:", metadataSize*blocksPerStateByte)
+		println("# of block states:", stateSize*blocksPerStateByte)
 	}
-	if gcAsserts && metadataSize*blocksPerStateByte < numBlocks {
+	if gcAsserts && (stateSize*blocksPerStateByte < numBlocks || noscanSize*8 < numBlocks) {
 		// sanity check
 		runtimePanic("gc: metadata array is too small")
 	}
 
-	// Set all block states to 'free'.
+	// Set all block states to 'free' and clear all noscan bits.
 	memzero(unsafe.Pointer(heapStart), metadataSize)
 }
 
 // alloc tries to find some free space on the heap, possibly doing a garbage
-// collection cycle if needed. If no space is free, it panics.
+// collection cycle if needed. If no space is free, it panics. The returned
+// memory is always zeroed, even if it was used by an object freed earlier.
 //go:noinline
 func alloc(size uintptr) unsafe.Pointer {
 	if size == 0 {
@@ -272,14 +307,51 @@ func alloc(size uintptr) unsafe.Pointer {
 				i.setState(blockStateTail)
 			}
 
-			// Return a pointer to this allocation.
+			// Return a pointer to this allocation. Clear all the blocks, not
+			// just the requested size: the remainder of the last block is
+			// scanned as part of this object, so stale pointers left there by
+			// a freed object would otherwise keep garbage alive.
 			pointer := thisAlloc.pointer()
-			memzero(pointer, size)
+			memzero(pointer, neededBlocks*bytesPerBlock)
 			return pointer
 		}
 	}
 }
 
+// allocAligned is like alloc, but the returned pointer is aligned to the given
+// alignment, which must be a power of two. Every block is already aligned to
+// bytesPerBlock so only larger alignments need extra work: the object is
+// over-allocated and the returned pointer points into it, which keeps the
+// object alive as interior pointers are followed during marking. Zero-sized
+// objects don't need to be aligned, and must not use any heap memory.
+func allocAligned(size, alignment uintptr) unsafe.Pointer {
+	if alignment <= bytesPerBlock || size == 0 {
+		return alloc(size)
+	}
+	ptr := uintptr(alloc(size + alignment - bytesPerBlock))
+	return unsafe.Pointer((ptr + alignment - 1) &^ (alignment - 1))
+}
+
+// allocLayout is like allocAligned, but also receives the pointer bitmap of the
+// object: bit n is set when the word at offset n*unsafe.Sizeof(uintptr(0)) may
+// contain a pointer. For slices, it is the bitmap of the element type. It is
+// used by the reflect package, which knows the layout of the objects it
+// allocates. Objects whose bitmap has no bits set are never scanned.
+func allocLayout(size, alignment uintptr, layout []byte) unsafe.Pointer {
+	ptr := allocAligned(size, alignment)
+	if size == 0 {
+		return ptr
+	}
+	for _, bits := range layout {
+		if bits != 0 {
+			// The object contains pointers, so must be scanned.
+			return ptr
+		}
+	}
+	blockFromAddr(uintptr(ptr)).findHead().setNoscan(true)
+	return ptr
+}
+
 func free(ptr unsafe.Pointer) {
 	// TODO: free blocks on request, when the compiler knows they're unused.
 }
@@ -339,6 +411,10 @@ func markRoot(addr, root uintptr) {
 				println("found unmarked pointer", root, "at address", addr)
 			}
 			head.setState(blockStateMark)
+			if head.noscan() {
+				// This object doesn't contain any pointers.
+				return
+			}
 			next := block.findNext()
 			// TODO: avoid recursion as much as possible
 			markRoots(head.address(), next.address())
@@ -354,6 +430,7 @@ func sweep() {
 		case blockStateHead:
 			// Unmarked head. Free it, including all tail blocks following it.
 			block.markFree()
+			block.setNoscan(false)
 			freeCurrentObject = true
 		case blockStateTail:
 			if freeCurrentObject {
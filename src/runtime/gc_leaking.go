@@ -23,13 +23,30 @@ func alloc(size uintptr) unsafe.Pointer {
 	if heapptr >= heapEnd {
 		runtimePanic("out of memory")
 	}
-	for i := uintptr(0); i < uintptr(size); i += 4 {
-		ptr := (*uint32)(unsafe.Pointer(addr + i))
-		*ptr = 0
-	}
+	// The size is not necessarily a multiple of 4 (for example on AVR), so
+	// clear it with memzero instead of storing whole words.
+	memzero(unsafe.Pointer(addr), size)
 	return unsafe.Pointer(addr)
 }
 
+// allocAligned is like alloc, but the returned pointer is aligned to the given
+// alignment, which must be a power of two. Zero-sized objects don't need to be
+// aligned.
+func allocAligned(size, alignment uintptr) unsafe.Pointer {
+	if alignment <= align(1) || size == 0 {
+		return alloc(size)
+	}
+	ptr := uintptr(alloc(size + alignment - 1))
+	return unsafe.Pointer((ptr + alignment - 1) &^ (alignment - 1))
+}
+
+// allocLayout is like allocAligned, but also receives the pointer bitmap of the
+// object, for the reflect package. Memory is never freed, so the layout is not
+// needed.
+func allocLayout(size, alignment uintptr, layout []byte) unsafe.Pointer {
+	return allocAligned(size, alignment)
+}
+
 func free(ptr unsafe.Pointer) {
 	// Memory is never freed.
 }
@@ -12,6 +12,29 @@ import (
 
 func alloc(size uintptr) unsafe.Pointer
 
+// allocAligned is like alloc, but the returned pointer is aligned to the given
+// alignment, which must be a power of two. The allocator is provided
+// externally, so don't assume it clears memory that it reuses: the reflect
+// package relies on this function returning zeroed memory.
+func allocAligned(size, alignment uintptr) unsafe.Pointer {
+	if alignment <= align(1) || size == 0 {
+		ptr := alloc(size)
+		memzero(ptr, size)
+		return ptr
+	}
+	ptr := uintptr(alloc(size + alignment - 1))
+	ptr = (ptr + alignment - 1) &^ (alignment - 1)
+	memzero(unsafe.Pointer(ptr), size)
+	return unsafe.Pointer(ptr)
+}
+
+// allocLayout is like allocAligned, but also receives the pointer bitmap of the
+// object, for the reflect package. The external allocator doesn't know about
+// pointer layouts.
+func allocLayout(size, alignment uintptr, layout []byte) unsafe.Pointer {
+	return allocAligned(size, alignment)
+}
+
 func free(ptr unsafe.Pointer) {
 	// Nothing to free when nothing gets allocated.
 }
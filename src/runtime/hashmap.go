@@ -318,3 +318,32 @@ func hashmapStringDelete(m *hashmap, key string) {
 	hash := hashmapStringHash(key)
 	hashmapDelete(m, unsafe.Pointer(&key), hash, hashmapStringEqual)
 }
+
+// Hashmap with keys of any comparable type, used by the reflect package. The
+// reflect package computes the hash and provides the equality function based
+// on the key type code, as the runtime has no knowledge of types.
+
+//go:linkname hashmapReflectMake reflect.hashmapMake
+func hashmapReflectMake(keySize, valueSize uintptr, sizeHint uintptr) unsafe.Pointer {
+	return unsafe.Pointer(hashmapMake(uint8(keySize), uint8(valueSize), sizeHint))
+}
+
+//go:linkname hashmapReflectLen reflect.hashmapLen
+func hashmapReflectLen(m unsafe.Pointer) int {
+	return hashmapLen((*hashmap)(m))
+}
+
+//go:linkname hashmapReflectSet reflect.hashmapSet
+func hashmapReflectSet(m unsafe.Pointer, key, value unsafe.Pointer, hash uint32, keyEqual func(x, y unsafe.Pointer, n uintptr) bool) {
+	hashmapSet((*hashmap)(m), key, value, hash, keyEqual)
+}
+
+//go:linkname hashmapReflectGet reflect.hashmapGet
+func hashmapReflectGet(m unsafe.Pointer, key, value unsafe.Pointer, hash uint32, keyEqual func(x, y unsafe.Pointer, n uintptr) bool) bool {
+	return hashmapGet((*hashmap)(m), key, value, hash, keyEqual)
+}
+
+//go:linkname hashmapReflectDelete reflect.hashmapDelete
+func hashmapReflectDelete(m unsafe.Pointer, key unsafe.Pointer, hash uint32, keyEqual func(x, y unsafe.Pointer, n uintptr) bool) {
+	hashmapDelete((*hashmap)(m), key, hash, keyEqual)
+}
@@ -22,10 +22,16 @@ func interfaceEqual(x, y _interface) bool {
 		// Both interfaces are nil, so they are equal.
 		return true
 	}
-	// TODO: depends on reflection.
-	panic("unimplemented: interface equality")
+	// Both interfaces have the same dynamic type, so compare the values.
+	return interfaceValueEqual(x.typecode, &x.value, &y.value)
 }
 
+// interfaceValueEqual compares the values of two interfaces that have the given
+// dynamic type, following the rules of the == operator. It is passed pointers
+// to the value fields of both interfaces. It is implemented in the reflect
+// package, which knows how to interpret type codes.
+func interfaceValueEqual(typecode uintptr, x, y *unsafe.Pointer) bool
+
 // interfaceTypeAssert is called when a type assert without comma-ok still
 // returns false.
 func interfaceTypeAssert(ok bool) {
@@ -48,14 +54,22 @@ type typecodeID struct {
 	// different:
 	// * basic types: null
 	// * named type: the underlying type
-	// * interface: null
+	// * interface: bitcast of global with interfaceMethod array
 	// * chan/pointer/slice/array: the element type
 	// * struct: bitcast of global with structField array
-	// * func/map: TODO
+	// * map: bitcast of global with the key and element typecodeID
+	// * func: TODO
 	references *typecodeID
 
 	// The array length, for array types.
 	length uintptr
+
+	// The methods of a named type and of the pointer to this named type, as a
+	// bitcast of a global with an interfaceMethod array (or nil when there are
+	// no methods). They are stored in the method sets sidetable of the reflect
+	// package.
+	methodSet    *interfaceMethod
+	ptrMethodSet *interfaceMethod
 }
 
 // structField is used by the compiler to pass information to the interface
@@ -65,6 +79,17 @@ type structField struct {
 	name     *uint8      // pointer to char array
 	tag      *uint8      // pointer to char array, or nil
 	embedded bool
+	pkgpath  *uint8  // pointer to char array, or nil for exported fields
+	offset   uintptr // offset of this field within the struct
+}
+
+// interfaceMethod is used by the compiler to pass information about the
+// methods of an interface type to the interface lowering pass, like
+// structField. It is not used in the final binary.
+type interfaceMethod struct {
+	typecode *typecodeID // signature of this method
+	name     *uint8      // pointer to char array
+	pkgpath  *uint8      // pointer to char array, or nil for exported methods
 }
 
 // Pseudo type used before interface lowering. By using a struct instead of a
@@ -74,6 +99,11 @@ type structField struct {
 type typeInInterface struct {
 	typecode  *typecodeID
 	methodSet *interfaceMethodInfo // nil or a GEP of an array
+
+	// For named types, the method set of the pointer to this type. The reflect
+	// package can take the address of a value (for example using Value.Addr),
+	// and the resulting pointer may need to implement interfaces.
+	ptrMethodSet *interfaceMethodInfo // nil or a GEP of an array
 }
 
 // Pseudo function call used during a type assert. It is used during interface
@@ -39,14 +39,25 @@ func os_runtime_args() []string {
 }
 
 // Copy size bytes from src to dst. The memory areas must not overlap.
+//
+// Pointers may have any alignment: word sized loads and stores are only used
+// when both dst and src are word aligned. Other pointers (for example to
+// fields in the middle of a struct) are copied byte by byte, because some
+// targets like the Cortex-M0 fault on unaligned word accesses.
 func memcpy(dst, src unsafe.Pointer, size uintptr) {
-	for i := uintptr(0); i < size; i++ {
+	i := uintptr(0)
+	if isWordAligned(dst, src) {
+		for ; i+wordSize <= size; i += wordSize {
+			*(*uintptr)(unsafe.Pointer(uintptr(dst) + i)) = *(*uintptr)(unsafe.Pointer(uintptr(src) + i))
+		}
+	}
+	for ; i < size; i++ {
 		*(*uint8)(unsafe.Pointer(uintptr(dst) + i)) = *(*uint8)(unsafe.Pointer(uintptr(src) + i))
 	}
 }
 
 // Copy size bytes from src to dst. The memory areas may overlap and will do the
-// correct thing.
+// correct thing. Like memcpy, pointers may have any alignment.
 func memmove(dst, src unsafe.Pointer, size uintptr) {
 	if uintptr(dst) < uintptr(src) {
 		// Copy forwards.
@@ -54,12 +65,32 @@ func memmove(dst, src unsafe.Pointer, size uintptr) {
 		return
 	}
 	// Copy backwards.
-	for i := size; i != 0; {
+	i := size
+	if isWordAligned(dst, src) {
+		// Copy the trailing bytes first, so that the rest can be copied a
+		// word at a time.
+		for ; i%wordSize != 0; i-- {
+			*(*uint8)(unsafe.Pointer(uintptr(dst) + i - 1)) = *(*uint8)(unsafe.Pointer(uintptr(src) + i - 1))
+		}
+		for ; i != 0; i -= wordSize {
+			*(*uintptr)(unsafe.Pointer(uintptr(dst) + i - wordSize)) = *(*uintptr)(unsafe.Pointer(uintptr(src) + i - wordSize))
+		}
+		return
+	}
+	for i != 0 {
 		i--
 		*(*uint8)(unsafe.Pointer(uintptr(dst) + i)) = *(*uint8)(unsafe.Pointer(uintptr(src) + i))
 	}
 }
 
+// The size of a machine word, used for fast memory copies.
+const wordSize = unsafe.Sizeof(uintptr(0))
+
+// isWordAligned returns whether both pointers are aligned to a word boundary.
+func isWordAligned(x, y unsafe.Pointer) bool {
+	return (uintptr(x)|uintptr(y))%wordSize == 0
+}
+
 // Set the given number of bytes to zero.
 func memzero(ptr unsafe.Pointer, size uintptr) {
 	for i := uintptr(0); i < size; i++ {
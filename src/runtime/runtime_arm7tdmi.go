@@ -90,3 +90,15 @@ func libc_memset(ptr unsafe.Pointer, c byte, size uintptr) {
 func libc_memmove(dst, src unsafe.Pointer, size uintptr) {
 	memmove(dst, src, size)
 }
+
+// disableInterrupts disables all interrupts and returns the previous interrupt
+// state, to be passed to restoreInterrupts. Interrupts are never enabled on
+// this target, so there is nothing to disable.
+func disableInterrupts() uintptr {
+	return 0
+}
+
+// restoreInterrupts restores the interrupt state returned by
+// disableInterrupts.
+func restoreInterrupts(mask uintptr) {
+}
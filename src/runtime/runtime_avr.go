@@ -90,7 +90,10 @@ func ticks() timeUnit {
 }
 
 func abort() {
+	// Disable interrupts and go to sleep. Only a reset can wake up the chip
+	// again, and simavr recognizes this as the end of the program.
+	avr.Asm("cli")
 	for {
-		sleepWDT(WDT_PERIOD_2S)
+		avr.Asm("sleep")
 	}
 }
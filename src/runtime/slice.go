@@ -16,24 +16,7 @@ func sliceAppend(srcBuf, elemsBuf unsafe.Pointer, srcLen, srcCap, elemsLen uintp
 
 	if srcLen+elemsLen > srcCap {
 		// Slice does not fit, allocate a new buffer that's large enough.
-		srcCap = srcCap * 2
-		if srcCap == 0 { // e.g. zero slice
-			srcCap = 1
-		}
-		for srcLen+elemsLen > srcCap {
-			// This algorithm may be made more memory-efficient: don't multiply
-			// by two but by 1.5 or something. As far as I can see, that's
-			// allowed by the Go language specification (but may be observed by
-			// programs).
-			srcCap *= 2
-		}
-		buf := alloc(srcCap * elemSize)
-
-		// Copy the old slice to the new slice.
-		if srcLen != 0 {
-			memmove(buf, srcBuf, srcLen*elemSize)
-		}
-		srcBuf = buf
+		srcBuf, _, srcCap = sliceGrow(srcBuf, srcLen, srcCap, srcLen+elemsLen, elemSize)
 	}
 
 	// The slice fits (after possibly allocating a new one), append it in-place.
@@ -41,6 +24,78 @@ func sliceAppend(srcBuf, elemsBuf unsafe.Pointer, srcLen, srcCap, elemsLen uintp
 	return srcBuf, srcLen + elemsLen, srcCap
 }
 
+// sliceGrow returns a slice with a capacity of at least newCap, with the
+// contents of the old slice copied over if a new buffer had to be allocated.
+// It is used by the append builtin. No type information is needed: the garbage
+// collector scans the new buffer conservatively.
+func sliceGrow(oldBuf unsafe.Pointer, oldLen, oldCap, newCap, elemSize uintptr) (unsafe.Pointer, uintptr, uintptr) {
+	if oldCap >= newCap {
+		// No need to grow.
+		return oldBuf, oldLen, oldCap
+	}
+	capacity := sliceGrowCap(oldCap, newCap, elemSize)
+	buf := alloc(capacity * elemSize)
+
+	// Copy the old slice to the new slice.
+	if oldLen != 0 {
+		memmove(buf, oldBuf, oldLen*elemSize)
+	}
+	return buf, oldLen, capacity
+}
+
+// sliceGrowLayout is like sliceGrow, but allocates the new buffer with the
+// alignment and the pointer bitmap of the element type, see allocLayout. It is
+// used by the reflect package, so that slices grow in the same way as with the
+// append builtin while keeping the layout that reflect.MakeSlice gives them.
+func sliceGrowLayout(oldBuf unsafe.Pointer, oldLen, oldCap, newCap, elemSize, elemAlign uintptr, layout []byte) (unsafe.Pointer, uintptr, uintptr) {
+	if oldCap >= newCap {
+		// No need to grow.
+		return oldBuf, oldLen, oldCap
+	}
+	capacity := sliceGrowCap(oldCap, newCap, elemSize)
+	buf := allocLayout(capacity*elemSize, elemAlign, layout)
+
+	// Copy the old slice to the new slice.
+	if oldLen != 0 {
+		memmove(buf, oldBuf, oldLen*elemSize)
+	}
+	return buf, oldLen, capacity
+}
+
+// sliceGrowCap returns the capacity of a slice that is grown from oldCap to
+// hold at least newCap elements.
+func sliceGrowCap(oldCap, newCap, elemSize uintptr) uintptr {
+	// The largest capacity of a slice with this element type. The size of an
+	// object must fit in an int, which is easily exceeded on targets with a
+	// 16-bit uintptr.
+	maxCap := ^uintptr(0) >> 1
+	if elemSize != 0 {
+		maxCap /= elemSize
+	}
+	if newCap > maxCap {
+		runtimePanic("growslice: cap out of range")
+	}
+
+	// The old capacity and newCap are at most maxCap, so doubling can't
+	// overflow.
+	capacity := oldCap * 2
+	if capacity == 0 { // e.g. zero slice
+		capacity = 1
+	}
+	for newCap > capacity {
+		// This algorithm may be made more memory-efficient: don't multiply by
+		// two but by 1.5 or something. As far as I can see, that's allowed by
+		// the Go language specification (but may be observed by programs).
+		capacity *= 2
+	}
+	if capacity > maxCap {
+		// Doubling the capacity would make the buffer bigger than the address
+		// space allows, so only allocate what is needed.
+		capacity = newCap
+	}
+	return capacity
+}
+
 // Builtin copy(dst, src) function: copy bytes from dst to src.
 func sliceCopy(dst, src unsafe.Pointer, dstLen, srcLen uintptr, elemSize uintptr) uintptr {
 	// n = min(srcLen, dstLen)
@@ -37,7 +37,8 @@ type TargetSpec struct {
 	Scheduler  string   `json:"scheduler"`
 	Compiler   string   `json:"compiler"`
 	Linker     string   `json:"linker"`
-	RTLib      string   `json:"rtlib"` // compiler runtime library (libgcc, compiler-rt)
+	RTLib      string   `json:"rtlib"`  // compiler runtime library (libgcc, compiler-rt)
+	NoCgo      bool     `json:"no-cgo"` // cgo is not supported on this target
 	CFlags     []string `json:"cflags"`
 	LDFlags    []string `json:"ldflags"`
 	ExtraFiles []string `json:"extra-files"`
@@ -82,6 +83,9 @@ func (spec *TargetSpec) copyProperties(spec2 *TargetSpec) {
 	if spec2.RTLib != "" {
 		spec.RTLib = spec2.RTLib
 	}
+	if spec2.NoCgo {
+		spec.NoCgo = true
+	}
 	spec.CFlags = append(spec.CFlags, spec2.CFlags...)
 	spec.LDFlags = append(spec.LDFlags, spec2.LDFlags...)
 	spec.ExtraFiles = append(spec.ExtraFiles, spec2.ExtraFiles...)
@@ -102,6 +106,13 @@ func (spec *TargetSpec) copyProperties(spec2 *TargetSpec) {
 	}
 }
 
+// CgoEnabled returns whether packages may use cgo on this target. It is
+// disabled on targets without a C library (marked with no-cgo) and when the
+// CGO_ENABLED environment variable is set to 0, like with the go tool.
+func (spec *TargetSpec) CgoEnabled() bool {
+	return !spec.NoCgo && os.Getenv("CGO_ENABLED") != "0"
+}
+
 // load reads a target specification from the JSON in the given io.Reader. It
 // may load more targets specified using the "inherits" property.
 func (spec *TargetSpec) load(r io.Reader) error {
@@ -1,6 +1,16 @@
 package main
 
-import "testing"
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/loader"
+)
 
 func TestLoadTarget(t *testing.T) {
 	_, err := LoadTarget("arduino")
@@ -17,3 +27,93 @@ func TestLoadTarget(t *testing.T) {
 		t.Error("LoadTarget failed for wrong reason:", err)
 	}
 }
+
+// TestTargetCgo checks that packages with a cgo implementation and a pure Go
+// fallback use the fallback on targets without cgo support.
+func TestTargetCgo(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	dir := filepath.Join(tmpdir, "src", "example.com", "impl")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string]string{
+		"impl.go": "package impl\n\nfunc Value() int { return value() }\n",
+		"impl_cgo.go": `// +build cgo
+
+package impl
+
+// static int value(void) { return 3; }
+import "C"
+
+func value() int { return int(C.value()) }
+`,
+		"impl_nocgo.go": `// +build !cgo
+
+package impl
+
+func value() int { return 3 }
+`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		target string
+		cgo    bool
+	}{
+		{"", os.Getenv("CGO_ENABLED") != "0"}, // host
+		{"wasm", false},
+		{"qemu", false},
+		{"arduino", false},
+		{"hifive1b", false},
+		{"gameboy-advance", false},
+	} {
+		spec, err := LoadTarget(tc.target)
+		if err != nil {
+			t.Errorf("target %q: could not load target: %v", tc.target, err)
+			continue
+		}
+		if spec.CgoEnabled() != tc.cgo {
+			t.Errorf("target %q: expected cgo support to be %v", tc.target, tc.cgo)
+		}
+
+		ctx := build.Default
+		ctx.GOROOT = runtime.GOROOT()
+		ctx.GOPATH = tmpdir
+		ctx.GOOS = spec.GOOS
+		ctx.GOARCH = spec.GOARCH
+		ctx.BuildTags = spec.BuildTags
+		ctx.CgoEnabled = spec.CgoEnabled()
+		ctx.JoinPath = filepath.Join
+		p := &loader.Program{
+			Build:       &ctx,
+			OverlayPath: func(path string) string { return "" },
+			Dir:         tmpdir,
+		}
+		pkg, err := p.Import("example.com/impl", "")
+		if err != nil {
+			t.Errorf("target %q: could not import package: %v", tc.target, err)
+			continue
+		}
+		goFiles := strings.Join(pkg.GoFiles, " ")
+		cgoFiles := strings.Join(pkg.CgoFiles, " ")
+		if tc.cgo {
+			if goFiles != "impl.go" || cgoFiles != "impl_cgo.go" {
+				t.Errorf("target %q: unexpected files: %q, cgo files: %q", tc.target, goFiles, cgoFiles)
+			}
+			continue
+		}
+		if goFiles != "impl.go impl_nocgo.go" || cgoFiles != "" {
+			t.Errorf("target %q: unexpected files: %q, cgo files: %q", tc.target, goFiles, cgoFiles)
+		}
+		if err := p.Parse(false); err != nil {
+			t.Errorf("target %q: could not load package with fallback implementation: %v", tc.target, err)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package main
 
+import (
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
 var xorshift32State uint32 = 1
 
 func xorshift32(x uint32) uint32 {
@@ -17,6 +23,11 @@ func randuint32() uint32 {
 
 func main() {
 	testNonPointerHeap()
+	testReflectInteriorPointers()
+	testReflectMakeSlice()
+	testReflectZeroed()
+	testReflectPointerFields()
+	testReflectStructOf()
 }
 
 var scalarSlices [4][]byte
@@ -57,3 +68,235 @@ func testNonPointerHeap() {
 	}
 	println("ok")
 }
+
+type reflectPoint struct {
+	Name string
+	X, Y int32
+	Next *reflectPoint
+}
+
+var (
+	reflectFields [64]reflect.Value
+	garbageSink   []byte
+)
+
+// clobberFreedMemory runs a few garbage collection cycles and overwrites any
+// memory that was freed with garbage, so that objects that were freed by
+// mistake no longer contain the values they had.
+func clobberFreedMemory() {
+	for gc := 0; gc < 3; gc++ {
+		runtime.GC()
+		for i := 0; i < 100; i++ {
+			garbage := make([]byte, 32<<uint(i%3))
+			for j := range garbage {
+				garbage[j] = 0xff
+			}
+			garbageSink = garbage
+		}
+	}
+}
+
+// testReflectInteriorPointers checks that reflect.Values pointing into an
+// object keep the entire object alive, even if no pointer to the start of the
+// object remains.
+func testReflectInteriorPointers() {
+	for round := 0; round < 20; round++ {
+		// Create values pointing into the middle of a freshly allocated
+		// struct and slice, and drop the parent objects.
+		for i := range reflectFields {
+			n := int32(round*len(reflectFields) + i)
+			if i%2 == 0 {
+				p := &reflectPoint{Name: "point", X: n, Y: -n}
+				reflectFields[i] = reflect.ValueOf(p).Elem().Field(2)
+			} else {
+				s := make([]int32, 16)
+				s[13] = -n
+				reflectFields[i] = reflect.ValueOf(s).Index(13)
+			}
+		}
+
+		clobberFreedMemory()
+
+		for i, v := range reflectFields {
+			n := int32(round*len(reflectFields) + i)
+			if v.Int() != int64(-n) {
+				panic("reflect.Value points to freed memory!")
+			}
+		}
+	}
+	println("ok")
+}
+
+var reflectSlices [16]reflect.Value
+
+// testReflectMakeSlice checks that slices created by reflect.MakeSlice are kept
+// alive while the only reference to their backing array is the slice header
+// allocated by the reflect package.
+func testReflectMakeSlice() {
+	sliceType := reflect.TypeOf([]int32(nil))
+	for round := 0; round < 20; round++ {
+		for i := range reflectSlices {
+			n := int32(round*len(reflectSlices) + i)
+			rv := reflect.MakeSlice(sliceType, 32, 32)
+			for j := 0; j < rv.Len(); j++ {
+				rv.Index(j).SetInt(int64(n + int32(j)))
+			}
+			reflectSlices[i] = rv
+		}
+
+		clobberFreedMemory()
+
+		for i, rv := range reflectSlices {
+			n := int32(round*len(reflectSlices) + i)
+			for j := 0; j < rv.Len(); j++ {
+				if rv.Index(j).Int() != int64(n+int32(j)) {
+					panic("reflect.MakeSlice data was freed!")
+				}
+			}
+		}
+	}
+	println("ok")
+}
+
+type paddedRecord struct {
+	A byte
+	B int64
+	C [3]byte
+	D *int
+}
+
+// testReflectZeroed checks that memory returned by reflect.New and
+// reflect.MakeSlice is zeroed, even when it reuses memory that was filled with
+// garbage before being freed.
+func testReflectZeroed() {
+	recordType := reflect.TypeOf(paddedRecord{})
+	sliceType := reflect.TypeOf([]uint64(nil))
+	for round := 0; round < 50; round++ {
+		// Fill the heap with garbage that will be freed in the next GC cycle.
+		for i := 0; i < 100; i++ {
+			garbage := make([]byte, 32+i%64)
+			for j := range garbage {
+				garbage[j] = 0xa5
+			}
+			garbageSink = garbage
+		}
+		garbageSink = nil
+		runtime.GC()
+
+		for i := 0; i < 20; i++ {
+			ptr := reflect.New(recordType).Interface().(*paddedRecord)
+			raw := (*[unsafe.Sizeof(paddedRecord{})]byte)(unsafe.Pointer(ptr))
+			for _, b := range raw {
+				if b != 0 {
+					panic("reflect.New returned memory that is not zeroed!")
+				}
+			}
+			ptr.A = 0xff
+			ptr.B = -1
+
+			rv := reflect.MakeSlice(sliceType, 8, 8+i)
+			for j := 0; j < rv.Len(); j++ {
+				if rv.Index(j).Uint() != 0 {
+					panic("reflect.MakeSlice returned memory that is not zeroed!")
+				}
+				rv.Index(j).SetUint(^uint64(0))
+			}
+		}
+	}
+	println("ok")
+}
+
+type pointerHolder struct {
+	Count int
+	First *reflectPoint
+	Items []*reflectPoint
+}
+
+var reflectHolders [16]reflect.Value
+
+// testReflectPointerFields checks that objects that are only referenced from
+// pointer fields of objects allocated by reflect (using a slice type that is
+// constructed at runtime and grown by reflect.Append) are not freed.
+func testReflectPointerFields() {
+	holderType := reflect.TypeOf(pointerHolder{})
+	itemsType := reflect.SliceOf(reflect.TypeOf((*reflectPoint)(nil)))
+	for round := 0; round < 20; round++ {
+		for i := range reflectHolders {
+			n := int32(round*len(reflectHolders) + i)
+			ptr := reflect.New(holderType)
+			holder := ptr.Elem()
+			holder.Field(0).SetInt(int64(n))
+			holder.Field(1).Set(reflect.ValueOf(&reflectPoint{Name: "first", X: n}))
+			items := reflect.MakeSlice(itemsType, 4, 4)
+			for j := 0; j < items.Len(); j++ {
+				items.Index(j).Set(reflect.ValueOf(&reflectPoint{Name: "item", X: n, Y: int32(j)}))
+			}
+			// Grow the slice, so that the new backing array must be scanned
+			// as well.
+			items = reflect.Append(items, reflect.ValueOf(&reflectPoint{Name: "item", X: n, Y: 4}))
+			holder.Field(2).Set(items)
+			reflectHolders[i] = ptr
+		}
+
+		clobberFreedMemory()
+
+		for i, ptr := range reflectHolders {
+			n := int32(round*len(reflectHolders) + i)
+			h := ptr.Interface().(*pointerHolder)
+			if h.Count != int(n) || h.First.Name != "first" || h.First.X != n {
+				panic("object referenced from reflect.New was freed!")
+			}
+			for j, item := range h.Items {
+				if item.Name != "item" || item.X != n || item.Y != int32(j) {
+					panic("object referenced from reflect.MakeSlice was freed!")
+				}
+			}
+		}
+	}
+	println("ok")
+}
+
+var reflectStructs [16]reflect.Value
+
+// testReflectStructOf checks that objects that are only referenced from
+// pointer fields of a struct type constructed with reflect.StructOf are not
+// freed, even though the compiler doesn't know the layout of this type.
+func testReflectStructOf() {
+	pointType := reflect.TypeOf((*reflectPoint)(nil))
+	structType := reflect.StructOf([]reflect.StructField{
+		{Name: "Count", Type: reflect.TypeOf(int32(0))},
+		{Name: "Point", Type: pointType},
+		{Name: "Points", Type: reflect.ArrayOf(3, pointType)},
+	})
+	for round := 0; round < 20; round++ {
+		for i := range reflectStructs {
+			n := int32(round*len(reflectStructs) + i)
+			v := reflect.New(structType).Elem()
+			v.Field(0).SetInt(int64(n))
+			v.Field(1).Set(reflect.ValueOf(&reflectPoint{Name: "point", X: n}))
+			points := v.Field(2)
+			for j := 0; j < points.Len(); j++ {
+				points.Index(j).Set(reflect.ValueOf(&reflectPoint{Name: "array", X: n, Y: int32(j)}))
+			}
+			reflectStructs[i] = v
+		}
+
+		clobberFreedMemory()
+
+		for i, v := range reflectStructs {
+			n := int32(round*len(reflectStructs) + i)
+			p := v.Field(1).Interface().(*reflectPoint)
+			if v.Field(0).Int() != int64(n) || p.Name != "point" || p.X != n {
+				panic("object referenced from reflect.StructOf value was freed!")
+			}
+			points := v.Field(2)
+			for j := 0; j < points.Len(); j++ {
+				p := points.Index(j).Interface().(*reflectPoint)
+				if p.Name != "array" || p.X != n || p.Y != int32(j) {
+					panic("object referenced from reflect.ArrayOf field was freed!")
+				}
+			}
+		}
+	}
+	println("ok")
+}
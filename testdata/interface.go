@@ -27,6 +27,34 @@ func main() {
 
 	println("nested switch:", nestedSwitch('v', 3))
 
+	// Methods promoted from embedded fields are part of the method set.
+	itf = EmbeddedThing{Thing{"embedded"}, 1}
+	println("promoted:", itf.(Stringer).String())
+	itf = &PointerEmbed{new(Number)}
+	_, ok := itf.(Doubler)
+	println("promoted through pointer:", ok)
+	itf = DeepEmbed{EmbeddedThing{Thing{"deep"}, 2}}
+	println("promoted from depth 2:", itf.(Stringer).String())
+	itf = ShadowedThing{EmbeddedThing{Thing{"hidden"}, 3}}
+	println("shadowed:", itf.(Stringer).String())
+	itf = AmbiguousThing{Thing{"a"}, OtherThing{"b"}}
+	_, ok = itf.(Stringer)
+	println("ambiguous:", ok)
+
+	// Compare interfaces holding composite values.
+	var x, y interface{} = paddedStruct{1, 2, "foo", 1.5}, paddedStruct{1, 2, "foo", 1.5}
+	println("equal padded structs:", x == y)
+	y = paddedStruct{1, 2, "bar", 1.5}
+	println("different padded structs:", x == y)
+	zero := 0.0
+	x = paddedStruct{f: zero / zero}
+	println("struct with NaN:", x == x)
+	x, y = [2]float64{zero, 1}, [2]float64{-zero, 1}
+	println("arrays with signed zeros:", x == y)
+	println("different dynamic types:", interface{}(5) == interface{}(int8(5)))
+	x, y = nil, nil
+	println("nil interfaces:", x == y)
+
 	// Try putting a linked list in an interface:
 	// https://github.com/tinygo-org/tinygo/issues/309
 	itf = linkedList{}
@@ -77,6 +105,13 @@ func nestedSwitch(verb rune, arg interface{}) bool {
 	return false
 }
 
+type paddedStruct struct {
+	a byte
+	b int32
+	s string
+	f float64
+}
+
 type Thing struct {
 	name string
 }
@@ -146,6 +181,46 @@ func (p SmallPair) Print() {
 	println("SmallPair.Print:", p.a, p.b)
 }
 
+// EmbeddedThing implements Stringer only through the embedded Thing.
+type EmbeddedThing struct {
+	Thing
+	id int
+}
+
+// PointerEmbed implements Doubler through an embedded pointer.
+type PointerEmbed struct {
+	*Number
+}
+
+// DeepEmbed implements Stringer through a method promoted twice.
+type DeepEmbed struct {
+	EmbeddedThing
+}
+
+// ShadowedThing has its own String method, which shadows the promoted one.
+type ShadowedThing struct {
+	EmbeddedThing
+}
+
+func (t ShadowedThing) String() string {
+	return "shadowed " + t.Thing.name
+}
+
+type OtherThing struct {
+	name string
+}
+
+func (t OtherThing) String() string {
+	return t.name
+}
+
+// AmbiguousThing has two String methods at the same depth, so neither is
+// promoted and it doesn't implement Stringer.
+type AmbiguousThing struct {
+	Thing
+	OtherThing
+}
+
 // There is no type that matches this method.
 type Unmatched interface {
 	NeverImplementedMethod()
@@ -0,0 +1,15 @@
+package main
+
+// These variables can be set with -ldflags="-X main.Version=...".
+var Version string
+var BuildID = "unknown"
+
+// Calculated at compile time, also when the variables above are set.
+var versionString = "v" + Version + " (" + BuildID + ")"
+
+var count int
+
+func main() {
+	println(versionString)
+	println(count)
+}
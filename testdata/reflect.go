@@ -1,12 +1,15 @@
 package main
 
 import (
+	"io"
 	"reflect"
+	"sync/atomic"
 	"unsafe"
 )
 
 type (
 	myint    int
+	mystring string
 	myslice  []byte
 	myslice2 []myint
 	mychan   chan int
@@ -22,12 +25,94 @@ type (
 		buf  []byte
 		Buf  []byte
 	}
+	multiMethod interface {
+		Close() error
+		Read(p []byte) (int, error)
+		private()
+	}
 	linkedList struct {
 		next *linkedList `description:"chain"`
 		foo  int
 	}
+	embeddedPoint struct {
+		a     uint8
+		point `json:"pt"`
+		Z     [2]int64
+	}
+	deepInner struct {
+		P byte
+		Q int32
+	}
+	deepMiddle struct {
+		m int16
+		deepInner
+	}
+	deepPtrInner struct {
+		R int64
+	}
+	deepPtrMiddle struct {
+		s byte
+		*deepPtrInner
+	}
+	deepOuter struct {
+		o byte
+		deepMiddle
+		*deepPtrMiddle
+	}
+	selfEmbedding struct {
+		*selfEmbedding
+		X int
+	}
+	mutualA struct {
+		*mutualB
+		A int
+	}
+	mutualB struct {
+		*mutualA
+		B int
+	}
+	jsonMarshaler interface {
+		MarshalJSON() ([]byte, error)
+	}
+	textUnmarshaler interface {
+		UnmarshalText(text []byte) error
+	}
+	level       int
+	upperString string
+
+	// Only used through reflection: never put in an interface directly.
+	fixedReader struct {
+		N int
+	}
 )
 
+func (r fixedReader) Read(p []byte) (int, error) {
+	return r.N, nil
+}
+
+func (l level) MarshalJSON() ([]byte, error) {
+	if l > 1 {
+		return []byte(`"high"`), nil
+	}
+	return []byte(`"low"`), nil
+}
+
+func (l level) valid() bool {
+	return l >= 0
+}
+
+func (s *upperString) UnmarshalText(text []byte) error {
+	buf := make([]byte, len(text))
+	for i, c := range text {
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	*s = upperString(buf)
+	return nil
+}
+
 func main() {
 	println("matching types")
 	println(reflect.TypeOf(int(3)) == reflect.TypeOf(int(5)))
@@ -254,6 +339,412 @@ func main() {
 	if rv.Len() != 2 || rv.Index(0).Int() != 3 {
 		panic("slice was changed while setting part of it")
 	}
+
+	// New and MakeSlice of types with an alignment above the word size
+	rt := reflect.TypeOf(struct{ X int64 }{})
+	for i := 0; i < 4; i++ {
+		rv = reflect.New(rt)
+		if rv.Pointer()%uintptr(rt.Align()) != 0 {
+			panic("reflect.New returned a misaligned pointer")
+		}
+		rv.Elem().Field(0).SetInt(-5)
+		if atomic.LoadUint64((*uint64)(unsafe.Pointer(rv.Pointer()))) != 1<<64-5 {
+			panic("could not set int64 field of new struct")
+		}
+	}
+	rv = reflect.MakeSlice(reflect.TypeOf([]int64{}), 2, 3)
+	if rv.Len() != 2 || rv.Cap() != 3 || rv.Index(1).Int() != 0 {
+		panic("reflect.MakeSlice returned an invalid slice")
+	}
+	if rv.Pointer()%uintptr(reflect.TypeOf(int64(0)).Align()) != 0 {
+		panic("reflect.MakeSlice returned a misaligned slice")
+	}
+	rv.Index(1).SetInt(7)
+	if rv.Interface().([]int64)[1] != 7 {
+		panic("could not set int64 in slice created with reflect.MakeSlice")
+	}
+
+	// Maps created by compiled code
+	m := map[string]int{"a": 1}
+	rv = reflect.ValueOf(m)
+	if rv.MapIndex(reflect.ValueOf("a")).Int() != 1 || rv.MapIndex(reflect.ValueOf("b")).IsValid() {
+		panic("could not read map with MapIndex")
+	}
+	rv.SetMapIndex(reflect.ValueOf("b"), reflect.ValueOf(2))
+	rv.SetMapIndex(reflect.ValueOf("a"), reflect.Value{})
+	if _, ok := m["a"]; ok || m["b"] != 2 || rv.Len() != 1 {
+		panic("could not update map with SetMapIndex")
+	}
+	mp := map[point]string{point{1, 2}: "x"}
+	rv = reflect.ValueOf(mp)
+	rv.SetMapIndex(reflect.ValueOf(point{3, 4}), reflect.ValueOf("y"))
+	if rv.MapIndex(reflect.ValueOf(point{1, 2})).String() != "x" || mp[point{3, 4}] != "y" {
+		panic("could not use map with struct keys")
+	}
+
+	// Maps with keys that are not supported by compiled code
+	rv = reflect.MakeMap(reflect.TypeOf(map[interface{}]float64(nil)))
+	rv.SetMapIndex(reflect.ValueOf(3), reflect.ValueOf(1.5))
+	rv.SetMapIndex(reflect.ValueOf("3"), reflect.ValueOf(2.5))
+	if rv.Len() != 2 || rv.MapIndex(reflect.ValueOf(3)).Float() != 1.5 || rv.MapIndex(reflect.ValueOf("3")).Float() != 2.5 {
+		panic("could not use map with interface keys")
+	}
+	negativeZero := 0.0
+	negativeZero = -negativeZero
+	rv = reflect.MakeMap(reflect.TypeOf(map[float64]int(nil)))
+	rv.SetMapIndex(reflect.ValueOf(negativeZero), reflect.ValueOf(5))
+	if rv.MapIndex(reflect.ValueOf(0.0)).Int() != 5 {
+		panic("could not use map with float keys")
+	}
+
+	// Append, mixing the append builtin and reflect.Append
+	var appended, mixed []*int
+	for i := 0; i < 20; i++ {
+		n := i
+		appended = append(appended, &n)
+		if i%2 == 0 {
+			mixed = append(mixed, &n)
+		} else {
+			mixed = reflect.Append(reflect.ValueOf(mixed), reflect.ValueOf(&n)).Interface().([]*int)
+		}
+		if len(mixed) != len(appended) || cap(mixed) != cap(appended) {
+			panic("reflect.Append grows slices differently than append")
+		}
+	}
+	mixed = reflect.AppendSlice(reflect.ValueOf(mixed[:10]), reflect.ValueOf(mixed[15:])).Interface().([]*int)
+	if len(mixed) != 15 || *mixed[9] != 9 || *mixed[10] != 15 || *mixed[14] != 19 {
+		panic("reflect.AppendSlice returned the wrong slice")
+	}
+	rv = reflect.ValueOf(&mixed).Elem()
+	rv.Grow(100)
+	if len(mixed) != 15 || cap(mixed) < 115 || *mixed[14] != 19 {
+		panic("reflect.Value.Grow did not grow the slice")
+	}
+	rv = reflect.MakeSlice(reflect.TypeOf([]int64{}), 0, 0)
+	for i := 0; i < 3; i++ {
+		rv = reflect.Append(rv, reflect.ValueOf(int64(i)))
+		if rv.Pointer()%uintptr(reflect.TypeOf(int64(0)).Align()) != 0 {
+			panic("reflect.Append returned a misaligned slice")
+		}
+	}
+	rv = reflect.AppendSlice(rv, reflect.ValueOf([]int64{3, 4}))
+	if rv.Pointer()%uintptr(reflect.TypeOf(int64(0)).Align()) != 0 || rv.Index(4).Int() != 4 {
+		panic("reflect.AppendSlice returned a misaligned slice")
+	}
+
+	// Interface() returns a copy of values bigger than a word
+	container := &struct{ A [3]int64 }{[3]int64{1, 2, 3}}
+	rv = reflect.ValueOf(container).Elem().Field(0)
+	snapshot := rv.Interface()
+	rv.Index(0).SetInt(5)
+	if container.A[0] != 5 || snapshot.([3]int64)[0] != 1 {
+		panic("reflect.Value.Interface did not copy the value")
+	}
+
+	// methods of interface types
+	println("\ninterface methods:")
+	for _, rt := range []reflect.Type{
+		reflect.TypeOf((*io.Reader)(nil)).Elem(),
+		reflect.TypeOf((*multiMethod)(nil)).Elem(),
+	} {
+		println("num methods:", rt.NumMethod())
+		for i := 0; i < rt.NumMethod(); i++ {
+			method := rt.Method(i)
+			println("method:", method.Index, method.Name, method.PkgPath, method.Type.Kind().String(), method.Func.IsValid())
+		}
+	}
+	method, ok := reflect.TypeOf((*multiMethod)(nil)).Elem().MethodByName("Read")
+	println("Read:", ok, method.Type == reflect.TypeOf(func([]byte) (int, error) { return 0, nil }))
+	_, ok = reflect.TypeOf((*multiMethod)(nil)).Elem().MethodByName("Write")
+	println("Write:", ok)
+	readerType := reflect.TypeOf((*io.Reader)(nil)).Elem()
+	multiMethodType := reflect.TypeOf((*multiMethod)(nil)).Elem()
+	emptyType := reflect.TypeOf((*interface{})(nil)).Elem()
+	println("Implements:", multiMethodType.Implements(readerType), readerType.Implements(multiMethodType), readerType.Implements(emptyType), emptyType.Implements(readerType))
+
+	// struct field metadata
+	println("\nstruct fields:")
+	ep := embeddedPoint{a: 3, point: point{X: 5, Y: -7}, Z: [2]int64{11, 13}}
+	rt = reflect.TypeOf(ep)
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		println("field:", field.Name, field.PkgPath, field.Tag, field.Anonymous, field.Index[0])
+	}
+	if rt.Field(0).Offset != unsafe.Offsetof(ep.a) || rt.Field(1).Offset != unsafe.Offsetof(ep.point) || rt.Field(2).Offset != unsafe.Offsetof(ep.Z) {
+		panic("reflect.Type.Field returned a wrong offset")
+	}
+	if rt.Size() != unsafe.Sizeof(ep) {
+		panic("reflect.Type.Size returned a wrong size")
+	}
+	field, ok := rt.FieldByName("Y")
+	println("Y:", ok, len(field.Index), field.Index[0], field.Index[1], field.Offset)
+	_, ok = rt.FieldByName("W")
+	println("W:", ok)
+	_, ok = reflect.TypeOf(selfEmbedding{}).FieldByName("Missing")
+	field, ok2 := reflect.TypeOf(mutualA{}).FieldByName("B")
+	_, ok3 := reflect.TypeOf(mutualA{}).FieldByName("Missing")
+	println("recursive:", ok, ok2, len(field.Index), ok3)
+	rv = reflect.ValueOf(ep)
+	println("values:", rv.FieldByName("Y").Int(), rv.FieldByName("Z").Index(1).Int())
+
+	// Unexported fields can be read, but not modified or converted back to an
+	// interface.
+	ms := mystruct{n: 3, Buf: []byte{11}}
+	rv = reflect.ValueOf(&ms).Elem()
+	println("unexported:", rv.Field(0).Int(), rv.Field(0).CanSet(), rv.Field(0).CanInterface())
+	println("exported:", rv.Field(4).Index(0).Uint(), rv.Field(4).CanSet(), rv.Field(4).CanInterface())
+	rv.Field(4).Index(0).SetUint(17)
+	println("set:", ms.Buf[0])
+
+	// Pointer types created by reflect can be type asserted on, even though
+	// *embeddedPoint is never put in an interface by compiled code.
+	newPoint, ok := reflect.New(rt).Interface().(*embeddedPoint)
+	if !ok {
+		panic("type assert on reflect.New result failed")
+	}
+	newPoint.Z[1] = 5
+	println("reflect.New:", newPoint.Z[1])
+
+	// Index paths of fields promoted through two levels of embedded structs,
+	// both by value and by pointer.
+	deep := deepOuter{
+		deepMiddle:    deepMiddle{deepInner: deepInner{Q: 5}},
+		deepPtrMiddle: &deepPtrMiddle{deepPtrInner: &deepPtrInner{R: 7}},
+	}
+	rv = reflect.ValueOf(&deep).Elem()
+	for _, name := range []string{"Q", "R"} {
+		field, _ := rv.Type().FieldByName(name)
+		chained := rv
+		for _, i := range field.Index {
+			chained = reflect.Indirect(chained).Field(i)
+		}
+		byIndex := rv.FieldByIndex(field.Index)
+		println("field path:", name, len(field.Index), byIndex.UnsafeAddr() == chained.UnsafeAddr(), byIndex.Int(), rv.Type().FieldByIndex(field.Index).Offset == field.Offset)
+	}
+	if rv.FieldByName("Q").UnsafeAddr() != uintptr(unsafe.Pointer(&deep.Q)) || rv.FieldByName("R").UnsafeAddr() != uintptr(unsafe.Pointer(&deep.R)) {
+		panic("reflect.Value.FieldByIndex returned a wrong address")
+	}
+	field, _ = rv.Type().FieldByName("Q")
+	field2, _ := rv.Type().FieldByName("R")
+	if field.Offset != unsafe.Offsetof(deep.deepInner.Q) || field2.Offset != unsafe.Offsetof(deepPtrInner{}.R) {
+		panic("reflect.Type.FieldByName returned an offset relative to the wrong struct")
+	}
+
+	// Set unwraps values of interface kind when assigning to a concrete type,
+	// and boxes values when assigning to an interface.
+	values := map[string]interface{}{"pt": point{X: 3, Y: -4}, "n": 7}
+	var target struct {
+		P point
+		N int
+		I interface{}
+	}
+	rv = reflect.ValueOf(&target).Elem()
+	rv.Field(0).Set(reflect.ValueOf(values).MapIndex(reflect.ValueOf("pt")))
+	rv.Field(1).Set(reflect.ValueOf(values).MapIndex(reflect.ValueOf("n")))
+	rv.Field(2).Set(reflect.ValueOf(values).MapIndex(reflect.ValueOf("pt")))
+	println("set from interface:", target.P.X, target.P.Y, target.N, target.I.(point).Y)
+	rv.Field(2).Set(reflect.ValueOf(values).MapIndex(reflect.ValueOf("n")).Elem())
+	println("set to interface:", target.I.(int), rv.Field(2).Elem().Int(), rv.Field(2).Interface().(int))
+
+	// Element offsets near the end of a big array, which must not overflow on
+	// targets with a small address space.
+	var big [1000]uint32
+	big[999] = 5
+	println("big array:", reflect.ValueOf(&big).Elem().Index(999).Uint(), reflect.ValueOf(big).Index(999).Uint(), reflect.MakeSlice(reflect.TypeOf([]uint32{}), 1000, 1000).Index(999).Uint())
+
+	// Copies to and from unaligned memory, like odd offsets in a byte buffer.
+	unaligned := struct {
+		A   byte
+		Buf [19]byte
+	}{}
+	rv = reflect.ValueOf(&unaligned).Elem().Field(1)
+	n = reflect.Copy(rv, reflect.ValueOf("0123456789abcdefghi"))
+	n2 := reflect.Copy(reflect.ValueOf(unaligned.Buf[1:]), reflect.ValueOf(unaligned.Buf[:18]))
+	n3 := reflect.Copy(reflect.ValueOf(unaligned.Buf[:17]), reflect.ValueOf(unaligned.Buf[2:]))
+	println("copy:", n, n2, n3, string(unaligned.Buf[:]))
+	rv.Index(3).Set(reflect.ValueOf(byte('x')))
+	var words [2]uint64
+	n = reflect.Copy(reflect.ValueOf(&words).Elem(), reflect.ValueOf([]uint64{1 << 40, 3}))
+	println("copy words:", n, words[0]>>40, words[1], string(unaligned.Buf[:5]))
+
+	// type names, as used in panic messages
+	println("\ntype strings:")
+	for _, v := range []interface{}{
+		[]int(nil),
+		map[string][2]bool(nil),
+		(*chan uint8)(nil),
+		struct {
+			A int16
+			b []string
+		}{},
+		struct{}{},
+		func() {},
+		[]interface{}(nil),
+	} {
+		rt := reflect.TypeOf(v)
+		println(rt.String(), rt.Comparable())
+	}
+
+	// Kind values must match the standard library.
+	println("\nkinds:")
+	for kind := reflect.Invalid; kind <= reflect.UnsafePointer; kind++ {
+		println(int(kind), kind.String())
+	}
+	println(reflect.TypeOf("").Kind() == reflect.String, reflect.TypeOf(unsafe.Pointer(nil)).Kind() == reflect.UnsafePointer, reflect.TypeOf(point{}).Kind() == reflect.Struct)
+
+	// SliceHeader and StringHeader use int fields, like the standard library.
+	headerSlice := []int16{1, 2, 3, 4}
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&headerSlice))
+	length := 2
+	hdr.Len = length
+	hdr.Cap = hdr.Len + 1
+	headerString := "header"
+	strHdr := (*reflect.StringHeader)(unsafe.Pointer(&headerString))
+	strHdr.Len = length + 1
+	println("headers:", len(headerSlice), cap(headerSlice), headerSlice[1], headerString)
+
+	// Func values are compared by their code pointer.
+	println("\nfuncs:")
+	counter := 0
+	closure := func() int {
+		counter++
+		return counter
+	}
+	closureCopy := closure
+	noop := func() {}
+	callbacks := struct {
+		Done   func()
+		Next   func() int
+		Cancel func()
+	}{Next: closure, Cancel: emptyFunc}
+	rv = reflect.ValueOf(callbacks)
+	println("IsNil:", reflect.ValueOf(emptyFunc).IsNil(), reflect.ValueOf(closure).IsNil(), rv.Field(0).IsNil(), rv.Field(1).IsNil(), rv.Field(2).IsNil())
+	println("top-level:", reflect.ValueOf(emptyFunc).Pointer() == rv.Field(2).Pointer(), reflect.ValueOf(emptyFunc).Pointer() != reflect.ValueOf(noop).Pointer())
+	println("closure:", reflect.ValueOf(closure).Pointer() == reflect.ValueOf(closureCopy).Pointer(), reflect.ValueOf(closure).Pointer() == rv.Field(1).Pointer(), closure() == 1)
+	println("nil:", rv.Field(0).Pointer() == 0, rv.Field(0).UnsafePointer() == nil, rv.Field(2).UnsafePointer() != nil)
+
+	// Conversions between strings and byte or rune slices.
+	println("\nconversions:")
+	stringType := reflect.TypeOf("")
+	bytesType := reflect.TypeOf([]byte(nil))
+	runesType := reflect.TypeOf([]rune(nil))
+	println(stringType.ConvertibleTo(bytesType), runesType.ConvertibleTo(stringType), reflect.TypeOf(myslice(nil)).ConvertibleTo(reflect.TypeOf(mystring(""))))
+	println(stringType.ConvertibleTo(reflect.TypeOf(myslice2(nil))), bytesType.ConvertibleTo(runesType), stringType.ConvertibleTo(reflect.TypeOf(0)))
+	src := "a\xffb\u00e9"
+	converted := reflect.ValueOf(src).Convert(bytesType).Interface().([]byte)
+	println("[]byte:", len(converted), converted[1], string(converted) == src)
+	runes := reflect.ValueOf(src).Convert(runesType).Interface().([]rune)
+	println("[]rune:", len(runes), runes[0], runes[1], runes[2], runes[3])
+	println("string:", reflect.ValueOf(runes).Convert(stringType).String() == string(runes), reflect.ValueOf(myslice("hi")).Convert(reflect.TypeOf(mystring(""))).Interface().(mystring))
+	converted[0] = 'x'
+	println("copy:", src[0] == 'a', reflect.ValueOf(mystring("named")).Convert(stringType).Interface().(string))
+
+	// Derived types are identical, even when constructed concurrently. The
+	// array, map and struct types don't exist in the program, so they are
+	// registered at runtime.
+	println("\nderived types:")
+	type derivedTypes struct {
+		ptr, array, mapType, structType reflect.Type
+	}
+	derived := make(chan derivedTypes)
+	pointType := reflect.TypeOf(point{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 8; j++ {
+				structType := reflect.StructOf([]reflect.StructField{
+					{Name: "Derived", Type: reflect.PtrTo(pointType)},
+					{Name: "Count", Type: reflect.TypeOf(0)},
+				})
+				derived <- derivedTypes{
+					ptr:        reflect.PtrTo(reflect.SliceOf(pointType)),
+					array:      reflect.New(reflect.ArrayOf(7, pointType)).Elem().Type(),
+					mapType:    reflect.MapOf(reflect.TypeOf(int16(0)), pointType),
+					structType: reflect.New(structType).Elem().Type(),
+				}
+			}
+		}()
+	}
+	first := <-derived
+	identical := first.ptr == reflect.TypeOf(&[]point{}) && first.array.Len() == 7 && first.mapType.Key().Kind() == reflect.Int16 && first.structType.NumField() == 2
+	for i := 1; i < 4*8; i++ {
+		if <-derived != first {
+			identical = false
+		}
+	}
+	println("identical:", identical, reflect.PtrTo(reflect.TypeOf(0)) == reflect.TypeOf(new(int)))
+
+	// Method sets of concrete types, used by encoding/json to find custom
+	// marshalers.
+	println("\nmethod sets:")
+	marshalerType := reflect.TypeOf((*jsonMarshaler)(nil)).Elem()
+	unmarshalerType := reflect.TypeOf((*textUnmarshaler)(nil)).Elem()
+	levelType := reflect.TypeOf(level(0))
+	nameType := reflect.TypeOf(upperString(""))
+	println("value receiver:", levelType.Implements(marshalerType), reflect.PtrTo(levelType).Implements(marshalerType), levelType.Implements(unmarshalerType))
+	println("pointer receiver:", nameType.Implements(unmarshalerType), reflect.PtrTo(nameType).Implements(unmarshalerType))
+	method, ok = levelType.MethodByName("MarshalJSON")
+	_, okPrivate := levelType.MethodByName("valid")
+	println("methods:", levelType.NumMethod(), reflect.PtrTo(levelType).NumMethod(), nameType.NumMethod(), method.Name, ok, okPrivate)
+	record := struct {
+		Level level
+		Name  upperString
+	}{Level: 2}
+	recordValue := reflect.ValueOf(&record).Elem()
+	encoded, _ := recordValue.Field(0).Interface().(jsonMarshaler).MarshalJSON()
+	recordValue.Field(1).Addr().Interface().(textUnmarshaler).UnmarshalText([]byte("gopher"))
+	println("dispatch:", string(encoded), record.Name)
+
+	// Values created by the reflect package behave like other values in type
+	// switches and type asserts.
+	println("\ntype switch:")
+	readerElem := reflect.TypeOf([]fixedReader(nil)).Elem()
+	readerValue := reflect.New(readerElem).Elem()
+	readerValue.Field(0).SetInt(3)
+	for _, v := range []interface{}{
+		reflect.MakeSlice(reflect.TypeOf([]int(nil)), 2, 2).Interface(),
+		reflect.New(reflect.TypeOf(0)).Interface(),
+		readerValue.Interface(),
+		reflect.New(readerElem).Interface(),
+		reflect.New(reflect.TypeOf(point{})).Elem().Interface(),
+	} {
+		switch v := v.(type) {
+		case []int:
+			println("[]int:", len(v))
+		case *int:
+			println("*int:", *v)
+		case io.Reader:
+			n, _ := v.Read(nil)
+			println("io.Reader:", n)
+		default:
+			_, ok := v.(io.Reader)
+			println("other:", ok)
+		}
+	}
+
+	// Types constructed at runtime are the same as the types emitted by the
+	// compiler, if there is one.
+	println("\nruntime types:")
+	intType := reflect.TypeOf(0)
+	println("identical:", reflect.ArrayOf(3, intType) == reflect.TypeOf([3]int{}), reflect.MapOf(reflect.TypeOf(""), intType) == reflect.TypeOf(map[string]int{}), reflect.StructOf([]reflect.StructField{{Name: "X", Type: intType, Tag: `json:"x"`}}) == reflect.TypeOf(struct {
+		X int `json:"x"`
+	}{}))
+	arrayType := reflect.ArrayOf(5, reflect.TypeOf(int16(0)))
+	println("array:", arrayType.String(), arrayType.Len(), arrayType.Size(), arrayType == reflect.ArrayOf(5, reflect.TypeOf(int16(0))))
+	mapType := reflect.MapOf(intType, reflect.TypeOf(true))
+	mapValue := reflect.MakeMap(mapType)
+	mapValue.SetMapIndex(reflect.ValueOf(3), reflect.ValueOf(true))
+	println("map:", mapType.String(), mapValue.Len(), mapValue.MapIndex(reflect.ValueOf(3)).Bool())
+	structType := reflect.StructOf([]reflect.StructField{
+		{Name: "A", Type: reflect.TypeOf(byte(0))},
+		{Name: "B", Type: reflect.TypeOf(int32(0))},
+	})
+	structValue := reflect.New(structType).Elem()
+	structValue.Field(1).SetInt(-5)
+	fieldB, _ := structType.FieldByName("B")
+	println("struct:", structType.String(), structType.Size(), fieldB.Offset, structValue.Field(1).Int(), structType == reflect.StructOf([]reflect.StructField{
+		{Name: "A", Type: reflect.TypeOf(byte(0))},
+		{Name: "B", Type: reflect.TypeOf(int32(0))},
+	}))
 }
 
 func emptyFunc() {
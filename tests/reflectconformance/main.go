@@ -0,0 +1,659 @@
+package main
+
+// This program checks the reflect package against the behavior of the standard
+// library for values of every Kind. Each check is done both on a value that is
+// passed to reflect.ValueOf directly and on the same value reached through a
+// pointer, as small values are stored directly in a Value while bigger values
+// and addressable values are stored indirectly. Which values are small depends
+// on the pointer size of the target, so the program uses a mix of value sizes
+// to cover both cases on 16-bit, 32-bit and 64-bit targets.
+//
+// The expected values are part of the program, which prints the name of each
+// section and a line for every failed check. The output is therefore the same
+// on all targets.
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+var failures int
+
+func check(what string, ok bool) {
+	if !ok {
+		failures++
+		println("  FAIL:", what)
+	}
+}
+
+type name string
+
+func (n name) String() string {
+	return string(n)
+}
+
+type stringer interface {
+	String() string
+}
+
+type (
+	myInt  int16
+	myUint uint8
+)
+
+// Structs with a size of 2, 4 and 8 bytes, which fit in a pointer on some
+// targets but not on others. The fields are at a non-zero offset so that they
+// must be shifted and masked out of a direct value.
+type tiny struct {
+	A bool
+	B int8
+}
+
+type small struct {
+	A int8
+	B uint8
+	C int16
+}
+
+type pair struct {
+	F float32
+	G float32
+}
+
+type nested struct {
+	In  tiny
+	C   uint16
+	hid int8
+}
+
+type big struct {
+	Bool       bool
+	Int        int
+	Int8       int8
+	Int16      int16
+	Int32      int32
+	Int64      int64
+	Uint       uint
+	Uint8      uint8
+	Uint16     uint16
+	Uint32     uint32
+	Uint64     uint64
+	Uintptr    uintptr
+	Float32    float32
+	Float64    float64
+	Complex64  complex64
+	Complex128 complex128
+	String     string
+	Ptr        *int
+	Slice      []byte
+	Array      [3]int16
+	Map        map[string]int
+	Func       func() int
+	Iface      interface{}
+	Tiny       tiny
+	hidden     uint32
+}
+
+func main() {
+	println("kinds")
+	testKinds()
+	println("ints")
+	testInts()
+	println("uints")
+	testUints()
+	println("floats and complex numbers")
+	testFloats()
+	println("bools and strings")
+	testBoolsAndStrings()
+	println("struct fields")
+	testStructs()
+	println("arrays")
+	testArrays()
+	println("slices")
+	testSlices()
+	println("pointers")
+	testPointers()
+	println("interfaces")
+	testInterfaces()
+	println("funcs, maps and chans")
+	testReferences()
+	if failures != 0 {
+		println("failures:", failures)
+	}
+}
+
+func testKinds() {
+	var (
+		i      int
+		fn     = func() int { return 1 }
+		ch     = make(chan int)
+		m      = map[string]int{}
+		arr    [3]int16
+		sl     []byte
+		ptr    = &i
+		b      big
+		itf    interface{}
+		uptr   unsafe.Pointer
+		nilFn  func()
+		cplx   complex128
+		smallS small
+	)
+	tests := []struct {
+		name  string
+		value reflect.Value
+		kind  reflect.Kind
+		size  uintptr
+		align int
+	}{
+		{"bool", reflect.ValueOf(true), reflect.Bool, 1, 1},
+		{"int", reflect.ValueOf(i), reflect.Int, unsafe.Sizeof(i), int(unsafe.Alignof(i))},
+		{"int8", reflect.ValueOf(int8(0)), reflect.Int8, 1, 1},
+		{"int16", reflect.ValueOf(int16(0)), reflect.Int16, 2, int(unsafe.Alignof(int16(0)))},
+		{"int32", reflect.ValueOf(int32(0)), reflect.Int32, 4, int(unsafe.Alignof(int32(0)))},
+		{"int64", reflect.ValueOf(int64(0)), reflect.Int64, 8, int(unsafe.Alignof(int64(0)))},
+		{"uint", reflect.ValueOf(uint(0)), reflect.Uint, unsafe.Sizeof(uint(0)), int(unsafe.Alignof(uint(0)))},
+		{"uint8", reflect.ValueOf(uint8(0)), reflect.Uint8, 1, 1},
+		{"uint16", reflect.ValueOf(uint16(0)), reflect.Uint16, 2, int(unsafe.Alignof(uint16(0)))},
+		{"uint32", reflect.ValueOf(uint32(0)), reflect.Uint32, 4, int(unsafe.Alignof(uint32(0)))},
+		{"uint64", reflect.ValueOf(uint64(0)), reflect.Uint64, 8, int(unsafe.Alignof(uint64(0)))},
+		{"uintptr", reflect.ValueOf(uintptr(0)), reflect.Uintptr, unsafe.Sizeof(uintptr(0)), int(unsafe.Alignof(uintptr(0)))},
+		{"float32", reflect.ValueOf(float32(0)), reflect.Float32, 4, int(unsafe.Alignof(float32(0)))},
+		{"float64", reflect.ValueOf(float64(0)), reflect.Float64, 8, int(unsafe.Alignof(float64(0)))},
+		{"complex64", reflect.ValueOf(complex64(0)), reflect.Complex64, 8, int(unsafe.Alignof(complex64(0)))},
+		{"complex128", reflect.ValueOf(cplx), reflect.Complex128, 16, int(unsafe.Alignof(cplx))},
+		{"string", reflect.ValueOf(""), reflect.String, unsafe.Sizeof(""), int(unsafe.Alignof(""))},
+		{"unsafe.Pointer", reflect.ValueOf(uptr), reflect.UnsafePointer, unsafe.Sizeof(uptr), int(unsafe.Alignof(uptr))},
+		{"chan", reflect.ValueOf(ch), reflect.Chan, unsafe.Sizeof(ch), int(unsafe.Alignof(ch))},
+		{"map", reflect.ValueOf(m), reflect.Map, unsafe.Sizeof(m), int(unsafe.Alignof(m))},
+		{"pointer", reflect.ValueOf(ptr), reflect.Ptr, unsafe.Sizeof(ptr), int(unsafe.Alignof(ptr))},
+		{"slice", reflect.ValueOf(sl), reflect.Slice, unsafe.Sizeof(sl), int(unsafe.Alignof(sl))},
+		{"array", reflect.ValueOf(arr), reflect.Array, unsafe.Sizeof(arr), int(unsafe.Alignof(arr))},
+		{"func", reflect.ValueOf(fn), reflect.Func, unsafe.Sizeof(fn), int(unsafe.Alignof(fn))},
+		{"nil func", reflect.ValueOf(nilFn), reflect.Func, unsafe.Sizeof(nilFn), int(unsafe.Alignof(nilFn))},
+		{"interface", reflect.ValueOf(&itf).Elem(), reflect.Interface, unsafe.Sizeof(itf), int(unsafe.Alignof(itf))},
+		{"small struct", reflect.ValueOf(smallS), reflect.Struct, unsafe.Sizeof(smallS), int(unsafe.Alignof(smallS))},
+		{"big struct", reflect.ValueOf(b), reflect.Struct, unsafe.Sizeof(b), int(unsafe.Alignof(b))},
+	}
+	for _, tc := range tests {
+		check(tc.name+": Kind", tc.value.Kind() == tc.kind)
+		check(tc.name+": Type().Kind", tc.value.Type().Kind() == tc.kind)
+		check(tc.name+": Size", tc.value.Type().Size() == tc.size)
+		check(tc.name+": Align", tc.value.Type().Align() == tc.align)
+		check(tc.name+": IsValid", tc.value.IsValid())
+	}
+
+	// The size of a big struct is the sum of the sizes of its fields and the
+	// padding between them, so check the offsets of all fields.
+	bt := reflect.TypeOf(b)
+	offsets := []uintptr{
+		unsafe.Offsetof(b.Bool), unsafe.Offsetof(b.Int), unsafe.Offsetof(b.Int8),
+		unsafe.Offsetof(b.Int16), unsafe.Offsetof(b.Int32), unsafe.Offsetof(b.Int64),
+		unsafe.Offsetof(b.Uint), unsafe.Offsetof(b.Uint8), unsafe.Offsetof(b.Uint16),
+		unsafe.Offsetof(b.Uint32), unsafe.Offsetof(b.Uint64), unsafe.Offsetof(b.Uintptr),
+		unsafe.Offsetof(b.Float32), unsafe.Offsetof(b.Float64), unsafe.Offsetof(b.Complex64),
+		unsafe.Offsetof(b.Complex128), unsafe.Offsetof(b.String), unsafe.Offsetof(b.Ptr),
+		unsafe.Offsetof(b.Slice), unsafe.Offsetof(b.Array), unsafe.Offsetof(b.Map),
+		unsafe.Offsetof(b.Func), unsafe.Offsetof(b.Iface), unsafe.Offsetof(b.Tiny),
+		unsafe.Offsetof(b.hidden),
+	}
+	check("big struct: NumField", bt.NumField() == len(offsets))
+	for i, offset := range offsets {
+		field := bt.Field(i)
+		check("big struct: offset of "+field.Name, field.Offset == offset)
+		check("big struct: kind of "+field.Name, field.Type.Kind() == reflect.ValueOf(b).Field(i).Kind())
+	}
+
+	var zero reflect.Value
+	check("zero Value: IsValid", !zero.IsValid())
+	check("zero Value: Kind", zero.Kind() == reflect.Invalid)
+}
+
+// checkInt checks a signed integer through a Value v of a copy of the integer
+// and through a Value p of the integer itself, which is addressable. After the
+// checks, the integer is set to set.
+func checkInt(what string, v, p reflect.Value, want, set int64) {
+	check(what+": Int", v.Int() == want)
+	check(what+": Int of addressable value", p.Int() == want)
+	check(what+": CanSet", !v.CanSet() && p.CanSet())
+	check(what+": Interface", v.Interface() == p.Interface())
+	p.SetInt(set)
+	check(what+": SetInt", p.Int() == set)
+	check(what+": Interface after SetInt", v.Interface() != p.Interface())
+}
+
+func testInts() {
+	var (
+		i   = -1
+		i8  = int8(-128)
+		i16 = int16(-32768)
+		i32 = int32(-2147483648)
+		i64 = int64(-9223372036854775808)
+		mi  = myInt(-2)
+	)
+	checkInt("int", reflect.ValueOf(i), reflect.ValueOf(&i).Elem(), -1, 2)
+	checkInt("int8", reflect.ValueOf(i8), reflect.ValueOf(&i8).Elem(), -128, 127)
+	checkInt("int16", reflect.ValueOf(i16), reflect.ValueOf(&i16).Elem(), -32768, 32767)
+	checkInt("int32", reflect.ValueOf(i32), reflect.ValueOf(&i32).Elem(), -2147483648, 2147483647)
+	checkInt("int64", reflect.ValueOf(i64), reflect.ValueOf(&i64).Elem(), -9223372036854775808, 9223372036854775807)
+	checkInt("myInt", reflect.ValueOf(mi), reflect.ValueOf(&mi).Elem(), -2, 3)
+	check("int: variable", i == 2)
+	check("int8: variable", i8 == 127)
+	check("int16: variable", i16 == 32767)
+	check("int32: variable", i32 == 2147483647)
+	check("int64: variable", i64 == 9223372036854775807)
+	check("myInt: variable", mi == 3)
+
+	// SetInt truncates like a conversion does.
+	reflect.ValueOf(&i8).Elem().SetInt(0x1ff)
+	check("int8: truncated", i8 == -1)
+	reflect.ValueOf(&i16).Elem().SetInt(-0x18000)
+	check("int16: truncated", i16 == 0x8000-0x10000)
+
+	// Converting between named and unnamed integers.
+	conv := reflect.ValueOf(mi).Convert(reflect.TypeOf(int16(0)))
+	check("myInt: Convert", conv.Type() == reflect.TypeOf(int16(0)) && conv.Int() == 3)
+	check("myInt: Convert Interface", conv.Interface() == int16(3))
+}
+
+// checkUint is like checkInt, for unsigned integers.
+func checkUint(what string, v, p reflect.Value, want, set uint64) {
+	check(what+": Uint", v.Uint() == want)
+	check(what+": Uint of addressable value", p.Uint() == want)
+	check(what+": CanSet", !v.CanSet() && p.CanSet())
+	check(what+": Interface", v.Interface() == p.Interface())
+	p.SetUint(set)
+	check(what+": SetUint", p.Uint() == set)
+	check(what+": Interface after SetUint", v.Interface() != p.Interface())
+}
+
+func testUints() {
+	var (
+		u   = ^uint(0)
+		u8  = uint8(0xff)
+		u16 = uint16(0xffff)
+		u32 = uint32(0xffffffff)
+		u64 = uint64(0xffffffffffffffff)
+		up  = ^uintptr(0)
+		mu  = myUint(0x80)
+	)
+	checkUint("uint", reflect.ValueOf(u), reflect.ValueOf(&u).Elem(), uint64(^uint(0)), 1)
+	checkUint("uint8", reflect.ValueOf(u8), reflect.ValueOf(&u8).Elem(), 0xff, 0x7f)
+	checkUint("uint16", reflect.ValueOf(u16), reflect.ValueOf(&u16).Elem(), 0xffff, 0x7fff)
+	checkUint("uint32", reflect.ValueOf(u32), reflect.ValueOf(&u32).Elem(), 0xffffffff, 0x7fffffff)
+	checkUint("uint64", reflect.ValueOf(u64), reflect.ValueOf(&u64).Elem(), 0xffffffffffffffff, 0x7fffffffffffffff)
+	checkUint("uintptr", reflect.ValueOf(up), reflect.ValueOf(&up).Elem(), uint64(^uintptr(0)), 1)
+	checkUint("myUint", reflect.ValueOf(mu), reflect.ValueOf(&mu).Elem(), 0x80, 0x81)
+	check("uint: variable", u == 1)
+	check("uint8: variable", u8 == 0x7f)
+	check("uint16: variable", u16 == 0x7fff)
+	check("uint32: variable", u32 == 0x7fffffff)
+	check("uint64: variable", u64 == 0x7fffffffffffffff)
+	check("uintptr: variable", up == 1)
+	check("myUint: variable", mu == 0x81)
+
+	reflect.ValueOf(&u8).Elem().SetUint(0x1234)
+	check("uint8: truncated", u8 == 0x34)
+}
+
+func testFloats() {
+	f32 := float32(1.5)
+	f64 := -2.25
+	c64 := complex64(complex(1.5, -2))
+	c128 := complex(-0.5, 8)
+
+	v, p := reflect.ValueOf(f32), reflect.ValueOf(&f32).Elem()
+	check("float32: Float", v.Float() == 1.5 && p.Float() == 1.5)
+	check("float32: Interface", v.Interface() == p.Interface() && v.Interface() == float32(1.5))
+	p.SetFloat(-3.75)
+	check("float32: SetFloat", f32 == -3.75 && p.Float() == -3.75)
+
+	v, p = reflect.ValueOf(f64), reflect.ValueOf(&f64).Elem()
+	check("float64: Float", v.Float() == -2.25 && p.Float() == -2.25)
+	check("float64: Interface", v.Interface() == p.Interface() && v.Interface() == -2.25)
+	p.SetFloat(1e100)
+	check("float64: SetFloat", f64 == 1e100 && p.Float() == 1e100)
+
+	v, p = reflect.ValueOf(c64), reflect.ValueOf(&c64).Elem()
+	check("complex64: Complex", v.Complex() == complex(1.5, -2) && p.Complex() == complex(1.5, -2))
+	check("complex64: Interface", v.Interface() == p.Interface() && v.Interface() == complex64(complex(1.5, -2)))
+	p.SetComplex(complex(0.25, 0.5))
+	check("complex64: SetComplex", c64 == complex(0.25, 0.5))
+
+	v, p = reflect.ValueOf(c128), reflect.ValueOf(&c128).Elem()
+	check("complex128: Complex", v.Complex() == complex(-0.5, 8) && p.Complex() == complex(-0.5, 8))
+	check("complex128: Interface", v.Interface() == p.Interface() && v.Interface() == complex(-0.5, 8))
+	p.SetComplex(complex(3, -3))
+	check("complex128: SetComplex", c128 == complex(3, -3))
+}
+
+func testBoolsAndStrings() {
+	b := true
+	v, p := reflect.ValueOf(b), reflect.ValueOf(&b).Elem()
+	check("bool: Bool", v.Bool() && p.Bool())
+	check("bool: Interface", v.Interface() == p.Interface() && v.Interface() == true)
+	p.SetBool(false)
+	check("bool: SetBool", !b && !p.Bool())
+	check("bool: false Interface", p.Interface() == false)
+
+	s := "héllo"
+	v, p = reflect.ValueOf(s), reflect.ValueOf(&s).Elem()
+	check("string: String", v.String() == "héllo" && p.String() == "héllo")
+	check("string: Len", v.Len() == 6 && p.Len() == 6)
+	check("string: Index", v.Index(1).Uint() == 0xc3 && p.Index(5).Uint() == 'o')
+	check("string: Index Kind", v.Index(0).Kind() == reflect.Uint8)
+	check("string: Index CanSet", !p.Index(0).CanSet())
+	check("string: Interface", v.Interface() == p.Interface() && v.Interface() == "héllo")
+	p.SetString("bye")
+	check("string: SetString", s == "bye" && p.String() == "bye")
+	check("string: original", v.String() == "héllo")
+
+	n := name("gopher")
+	check("named string: String", reflect.ValueOf(n).String() == "gopher")
+	check("non-string: String", reflect.ValueOf(3).String() == "<int Value>")
+}
+
+func testStructs() {
+	// A struct of 2 bytes, which is stored directly on all targets.
+	t := tiny{true, -3}
+	v, p := reflect.ValueOf(t), reflect.ValueOf(&t).Elem()
+	check("tiny: Field(0)", v.Field(0).Bool() && p.Field(0).Bool())
+	check("tiny: Field(1)", v.Field(1).Int() == -3 && p.Field(1).Int() == -3)
+	check("tiny: Field CanSet", !v.Field(1).CanSet() && p.Field(1).CanSet())
+	check("tiny: Interface", v.Interface() == p.Interface() && v.Interface() == tiny{true, -3})
+	check("tiny: Field Interface", v.Field(1).Interface() == int8(-3) && p.Field(1).Interface() == int8(-3))
+	p.Field(0).SetBool(false)
+	p.Field(1).SetInt(100)
+	check("tiny: set fields", t == tiny{false, 100})
+	check("tiny: original", v.Field(0).Bool() && v.Field(1).Int() == -3)
+
+	// A struct of 4 bytes, stored directly on 32-bit and 64-bit targets.
+	s := small{-1, 0xfe, -300}
+	v, p = reflect.ValueOf(s), reflect.ValueOf(&s).Elem()
+	check("small: Field(0)", v.Field(0).Int() == -1 && p.Field(0).Int() == -1)
+	check("small: Field(1)", v.Field(1).Uint() == 0xfe && p.Field(1).Uint() == 0xfe)
+	check("small: Field(2)", v.Field(2).Int() == -300 && p.Field(2).Int() == -300)
+	check("small: FieldByName", v.FieldByName("C").Int() == -300)
+	check("small: Interface", v.Interface() == p.Interface() && v.Interface() == small{-1, 0xfe, -300})
+	check("small: Field Interface", v.Field(2).Interface() == int16(-300) && p.Field(1).Interface() == uint8(0xfe))
+	p.Field(2).SetInt(0x1234)
+	check("small: set field", s == small{-1, 0xfe, 0x1234})
+
+	// A struct of 8 bytes, stored directly on 64-bit targets only.
+	pr := pair{1.25, -8}
+	v, p = reflect.ValueOf(pr), reflect.ValueOf(&pr).Elem()
+	check("pair: Field(0)", v.Field(0).Float() == 1.25 && p.Field(0).Float() == 1.25)
+	check("pair: Field(1)", v.Field(1).Float() == -8 && p.Field(1).Float() == -8)
+	check("pair: Field Interface", v.Field(1).Interface() == float32(-8))
+	p.Field(1).SetFloat(0.5)
+	check("pair: set field", pr == pair{1.25, 0.5})
+
+	// Nested structs, with an unexported field.
+	n := nested{tiny{true, 7}, 0xabcd, -9}
+	v, p = reflect.ValueOf(n), reflect.ValueOf(&n).Elem()
+	check("nested: Field(0).Field(1)", v.Field(0).Field(1).Int() == 7 && p.Field(0).Field(1).Int() == 7)
+	check("nested: Field(1)", v.Field(1).Uint() == 0xabcd && p.Field(1).Uint() == 0xabcd)
+	check("nested: FieldByIndex", v.FieldByIndex([]int{0, 0}).Bool())
+	check("nested: Field(0) Interface", v.Field(0).Interface() == tiny{true, 7})
+	check("nested: unexported Int", v.Field(2).Int() == -9 && p.Field(2).Int() == -9)
+	check("nested: unexported CanInterface", !v.Field(2).CanInterface() && !p.Field(2).CanInterface())
+	check("nested: unexported CanSet", !p.Field(2).CanSet())
+	check("nested: exported CanInterface", p.Field(1).CanInterface())
+	p.Field(0).Field(1).SetInt(-7)
+	check("nested: set nested field", n.In.B == -7)
+	p.Field(0).Set(reflect.ValueOf(tiny{false, 1}))
+	check("nested: Set struct", n.In == tiny{false, 1} && n.C == 0xabcd)
+
+	// A struct bigger than a pointer on all targets, with a field of every
+	// kind.
+	x := 5
+	b := big{
+		Bool: true, Int: -1, Int8: -2, Int16: -3, Int32: -4, Int64: -5,
+		Uint: 1, Uint8: 2, Uint16: 3, Uint32: 4, Uint64: 5, Uintptr: 6,
+		Float32: 7.5, Float64: 8.5, Complex64: 9i, Complex128: 10i,
+		String: "eleven", Ptr: &x, Slice: []byte{12}, Array: [3]int16{13, 14, 15},
+		Map: map[string]int{"sixteen": 16}, Func: func() int { return 17 },
+		Iface: uint16(18), Tiny: tiny{true, 19}, hidden: 20,
+	}
+	for _, bv := range []reflect.Value{reflect.ValueOf(b), reflect.ValueOf(&b).Elem()} {
+		check("big: Bool", bv.Field(0).Bool())
+		check("big: Int", bv.Field(1).Int() == -1)
+		check("big: Int8", bv.Field(2).Int() == -2)
+		check("big: Int16", bv.Field(3).Int() == -3)
+		check("big: Int32", bv.Field(4).Int() == -4)
+		check("big: Int64", bv.Field(5).Int() == -5)
+		check("big: Uint", bv.Field(6).Uint() == 1)
+		check("big: Uint8", bv.Field(7).Uint() == 2)
+		check("big: Uint16", bv.Field(8).Uint() == 3)
+		check("big: Uint32", bv.Field(9).Uint() == 4)
+		check("big: Uint64", bv.Field(10).Uint() == 5)
+		check("big: Uintptr", bv.Field(11).Uint() == 6)
+		check("big: Float32", bv.Field(12).Float() == 7.5)
+		check("big: Float64", bv.Field(13).Float() == 8.5)
+		check("big: Complex64", bv.Field(14).Complex() == 9i)
+		check("big: Complex128", bv.Field(15).Complex() == 10i)
+		check("big: String", bv.Field(16).String() == "eleven")
+		check("big: Ptr", bv.Field(17).Elem().Int() == 5)
+		check("big: Slice", bv.Field(18).Len() == 1 && bv.Field(18).Index(0).Uint() == 12)
+		check("big: Array", bv.Field(19).Index(2).Int() == 15)
+		check("big: Map", bv.Field(20).Len() == 1)
+		check("big: Func", !bv.Field(21).IsNil())
+		check("big: Iface", bv.Field(22).Elem().Uint() == 18)
+		check("big: Tiny", bv.Field(23).Field(1).Int() == 19)
+		check("big: hidden", bv.Field(24).Uint() == 20)
+		check("big: Interface of fields", bv.Field(16).Interface() == "eleven" && bv.Field(22).Interface() == uint16(18))
+	}
+	p = reflect.ValueOf(&b).Elem()
+	p.Field(5).SetInt(-50)
+	p.Field(13).SetFloat(85)
+	p.Field(16).SetString("11")
+	p.Field(17).Elem().SetInt(55)
+	p.Field(19).Index(0).SetInt(130)
+	p.Field(22).Set(reflect.ValueOf("eighteen"))
+	check("big: set fields", b.Int64 == -50 && b.Float64 == 85 && b.String == "11" && x == 55 && b.Array[0] == 130 && b.Iface == "eighteen")
+	check("big: neighbours unchanged", b.Int32 == -4 && b.Uint == 1 && b.Float32 == 7.5 && b.Array[1] == 14)
+}
+
+func testArrays() {
+	// An array of 4 bytes, stored directly on 32-bit and 64-bit targets.
+	a := [4]uint8{1, 2, 3, 0xff}
+	v, p := reflect.ValueOf(a), reflect.ValueOf(&a).Elem()
+	check("[4]uint8: Len", v.Len() == 4 && p.Len() == 4 && v.Cap() == 4)
+	for i := 0; i < 4; i++ {
+		check("[4]uint8: Index", v.Index(i).Uint() == uint64(a[i]) && p.Index(i).Uint() == uint64(a[i]))
+	}
+	check("[4]uint8: Index Interface", v.Index(3).Interface() == uint8(0xff) && p.Index(3).Interface() == uint8(0xff))
+	check("[4]uint8: Index CanSet", !v.Index(0).CanSet() && p.Index(0).CanSet())
+	check("[4]uint8: Interface", v.Interface() == p.Interface() && v.Interface() == [4]uint8{1, 2, 3, 0xff})
+	p.Index(2).SetUint(30)
+	check("[4]uint8: set element", a == [4]uint8{1, 2, 30, 0xff})
+
+	// An array of signed elements, which must be sign-extended.
+	s := [2]int16{-1, -2}
+	v = reflect.ValueOf(s)
+	check("[2]int16: Index", v.Index(0).Int() == -1 && v.Index(1).Int() == -2)
+
+	// An array bigger than a pointer on all targets.
+	l := [3]int64{-1, 1 << 40, -1 << 40}
+	v, p = reflect.ValueOf(l), reflect.ValueOf(&l).Elem()
+	check("[3]int64: Index", v.Index(1).Int() == 1<<40 && p.Index(2).Int() == -1<<40)
+	check("[3]int64: Interface", v.Interface() == [3]int64{-1, 1 << 40, -1 << 40})
+	p.Index(0).SetInt(7)
+	check("[3]int64: set element", l == [3]int64{7, 1 << 40, -1 << 40})
+	check("[3]int64: original", v.Index(0).Int() == -1)
+
+	// An array of structs.
+	st := [2]tiny{{true, 1}, {false, 2}}
+	v, p = reflect.ValueOf(st), reflect.ValueOf(&st).Elem()
+	check("[2]tiny: Index Field", v.Index(1).Field(1).Int() == 2 && p.Index(0).Field(0).Bool())
+	p.Index(1).Field(0).SetBool(true)
+	check("[2]tiny: set field", st[1].A)
+
+	// An empty array.
+	var e [0]int
+	v = reflect.ValueOf(e)
+	check("[0]int: Len", v.Len() == 0)
+	check("[0]int: Interface", v.Interface() == [0]int{})
+
+	// Arrays allocated by the reflect package.
+	np := reflect.New(reflect.TypeOf([5]int32{}))
+	np.Elem().Index(4).SetInt(-4)
+	check("New([5]int32)", *(np.Interface().(*[5]int32)) == [5]int32{0, 0, 0, 0, -4})
+}
+
+func testSlices() {
+	s := []int16{1, -2, 3}
+	v := reflect.ValueOf(s)
+	check("[]int16: Len", v.Len() == 3 && v.Cap() == cap(s))
+	check("[]int16: Index", v.Index(1).Int() == -2)
+	check("[]int16: Index CanSet", v.Index(0).CanSet())
+	v.Index(2).SetInt(30)
+	check("[]int16: set element", s[2] == 30)
+	check("[]int16: IsNil", !v.IsNil())
+
+	strs := []string{"a", "b"}
+	v = reflect.ValueOf(strs)
+	v.Index(0).SetString("c")
+	check("[]string: set element", strs[0] == "c" && v.Index(1).String() == "b")
+	check("[]string: Index Interface", v.Index(0).Interface() == "c")
+
+	structs := []small{{1, 2, 3}}
+	v = reflect.ValueOf(structs)
+	v.Index(0).Field(2).SetInt(-3)
+	check("[]small: set field", structs[0] == small{1, 2, -3})
+
+	var nilSlice []byte
+	v = reflect.ValueOf(nilSlice)
+	check("nil slice: IsNil", v.IsNil() && v.Len() == 0)
+
+	m := reflect.MakeSlice(reflect.TypeOf([]uint32{}), 2, 4)
+	m.Index(1).SetUint(0xdeadbeef)
+	check("MakeSlice", m.Len() == 2 && m.Cap() == 4 && m.Interface().([]uint32)[1] == 0xdeadbeef)
+	m = reflect.Append(m, reflect.ValueOf(uint32(5)))
+	check("Append", m.Len() == 3 && m.Index(2).Uint() == 5)
+
+	ps := reflect.ValueOf(&s).Elem()
+	ps.Set(reflect.ValueOf([]int16{9}))
+	check("Set slice", len(s) == 1 && s[0] == 9)
+}
+
+func testPointers() {
+	types := []reflect.Type{
+		reflect.TypeOf(false), reflect.TypeOf(int8(0)), reflect.TypeOf(int64(0)),
+		reflect.TypeOf(uint16(0)), reflect.TypeOf(float32(0)), reflect.TypeOf(complex128(0)),
+		reflect.TypeOf(""), reflect.TypeOf(tiny{}), reflect.TypeOf(big{}),
+		reflect.TypeOf([3]int16{}), reflect.TypeOf([]byte{}), reflect.TypeOf(&big{}),
+	}
+	for _, t := range types {
+		p := reflect.New(t)
+		check("New("+t.String()+"): Type", p.Type() == reflect.PtrTo(t) && p.Type().Elem() == t)
+		check("New("+t.String()+"): Kind", p.Kind() == reflect.Ptr && p.Elem().Kind() == t.Kind())
+		check("New("+t.String()+"): IsNil", !p.IsNil())
+		check("New("+t.String()+"): CanSet", !p.CanSet() && p.Elem().CanSet())
+	}
+
+	n := reflect.New(reflect.TypeOf(int64(0)))
+	n.Elem().SetInt(-1 << 50)
+	check("New(int64): value", *(n.Interface().(*int64)) == -1<<50)
+	b := reflect.New(reflect.TypeOf(false))
+	b.Elem().SetBool(true)
+	check("New(bool): value", *(b.Interface().(*bool)))
+	s := reflect.New(reflect.TypeOf(tiny{}))
+	s.Elem().Field(1).SetInt(-100)
+	check("New(tiny): value", *(s.Interface().(*tiny)) == tiny{false, -100})
+
+	x := 3
+	px := &x
+	v := reflect.ValueOf(&px).Elem()
+	check("**int: Elem", v.Elem().Int() == 3)
+	v.Elem().SetInt(4)
+	check("**int: set", x == 4)
+	y := 10
+	v.Set(reflect.ValueOf(&y))
+	check("**int: Set pointer", px == &y)
+	check("**int: Pointer", v.Pointer() == uintptr(unsafe.Pointer(&y)))
+
+	var nilPtr *int
+	v = reflect.ValueOf(nilPtr)
+	check("nil pointer: IsNil", v.IsNil())
+	check("nil pointer: Elem", !v.Elem().IsValid())
+
+	check("Indirect", reflect.Indirect(reflect.ValueOf(&x)).Int() == 4)
+	check("Indirect of non-pointer", reflect.Indirect(reflect.ValueOf(x)).Int() == 4)
+}
+
+func testInterfaces() {
+	var e interface{} = int16(-7)
+	v := reflect.ValueOf(&e).Elem()
+	check("interface: Kind", v.Kind() == reflect.Interface)
+	check("interface: IsNil", !v.IsNil())
+	check("interface: Elem", v.Elem().Kind() == reflect.Int16 && v.Elem().Int() == -7)
+	check("interface: Interface", v.Interface() == int16(-7))
+	v.Set(reflect.ValueOf("str"))
+	check("interface: Set", e == "str")
+	v.Set(reflect.ValueOf(big{Int: 3}))
+	check("interface: Set big", e.(big).Int == 3)
+
+	// An interface holding a zero value is not nil.
+	e = 0
+	check("interface with zero value: IsNil", !v.IsNil())
+	check("interface with zero value: Elem", v.Elem().IsValid() && v.Elem().Int() == 0)
+	e = (*int)(nil)
+	check("interface with nil pointer: IsNil", !v.IsNil() && v.Elem().IsNil())
+
+	e = nil
+	check("nil interface: IsNil", v.IsNil())
+	check("nil interface: Elem", !v.Elem().IsValid())
+
+	// Interfaces with methods.
+	var st stringer
+	v = reflect.ValueOf(&st).Elem()
+	check("stringer: NumMethod", v.Type().NumMethod() == 1)
+	check("stringer: nil", v.IsNil())
+	v.Set(reflect.ValueOf(name("foo")))
+	check("stringer: Set", st != nil && st.String() == "foo")
+	check("stringer: Elem", v.Elem().Type() == reflect.TypeOf(name("")) && v.Elem().String() == "foo")
+	check("name: Implements", reflect.TypeOf(name("")).Implements(v.Type()))
+	check("int: Implements", !reflect.TypeOf(0).Implements(v.Type()))
+	check("name: AssignableTo", reflect.TypeOf(name("")).AssignableTo(v.Type()) && !v.Type().AssignableTo(reflect.TypeOf(name(""))))
+	check("int: AssignableTo", !reflect.TypeOf(0).AssignableTo(v.Type()))
+
+	// An interface stored in a slice.
+	itfs := []interface{}{1, "two", 3.0}
+	sv := reflect.ValueOf(itfs)
+	check("[]interface{}: Index Elem", sv.Index(1).Elem().String() == "two")
+	sv.Index(0).Set(reflect.ValueOf(uint8(4)))
+	check("[]interface{}: Set", itfs[0] == uint8(4))
+}
+
+func testReferences() {
+	fn := func() int { return 1 }
+	v := reflect.ValueOf(fn)
+	check("func: IsNil", !v.IsNil())
+	check("func: Pointer", v.Pointer() != 0)
+	var nilFn func() int
+	check("nil func: IsNil", reflect.ValueOf(nilFn).IsNil())
+	pf := reflect.ValueOf(&nilFn).Elem()
+	pf.Set(v)
+	check("func: Set", nilFn != nil && nilFn() == 1)
+	nf := reflect.New(reflect.TypeOf(fn))
+	check("New(func): IsNil", nf.Elem().IsNil())
+
+	m := map[string]int{"a": 1}
+	v = reflect.ValueOf(m)
+	check("map: Len", v.Len() == 1)
+	check("map: MapIndex", v.MapIndex(reflect.ValueOf("a")).Int() == 1)
+	check("map: missing MapIndex", !v.MapIndex(reflect.ValueOf("b")).IsValid())
+	v.SetMapIndex(reflect.ValueOf("b"), reflect.ValueOf(2))
+	check("map: SetMapIndex", m["b"] == 2 && v.Len() == 2)
+	v.SetMapIndex(reflect.ValueOf("a"), reflect.Value{})
+	check("map: delete", len(m) == 1)
+	var nilMap map[string]int
+	check("nil map: IsNil", reflect.ValueOf(nilMap).IsNil())
+
+	ch := make(chan int)
+	v = reflect.ValueOf(ch)
+	check("chan: IsNil", !v.IsNil())
+	check("chan: Pointer", v.Pointer() != 0)
+	var nilChan chan int
+	check("nil chan: IsNil", reflect.ValueOf(nilChan).IsNil())
+}
@@ -12,9 +12,6 @@ type String struct {
 func main() {
 	p := reflect.New(reflect.TypeOf(String{}))
 
-	// NOTE: uncomment this code and it works
-	// reflect.TypeOf((*String)(nil))
-
 	v, ok := p.Interface().(*String)
 	if !ok {
 		fmt.Println("type assert failed")